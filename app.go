@@ -105,6 +105,8 @@ func (a *App) Run() (err error) {
 		}
 	}
 
+	a.startLeaderTasks(group, ctx)
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, a.opts.sigs...)
 	group.Go(func() error {
@@ -176,8 +178,12 @@ func (a *App) buildInstance() (*registry.Instance, error) {
 	return &registry.Instance{
 		ID:        a.opts.id,
 		Name:      a.opts.name,
+		Version:   a.opts.version,
 		MetaData:  a.opts.metadata,
 		Endpoints: endpoints,
+		Weight:    a.opts.weight,
+		Zone:      a.opts.zone,
+		Status:    registry.StatusUp,
 	}, nil
 }
 
@@ -195,6 +201,28 @@ func (a *App) getInstance() *registry.Instance {
 	return instance
 }
 
+// UpdateStatus 修改当前节点在注册中心中的状态，如设置为 DRAINING 后不再接收新的流量
+func (a *App) UpdateStatus(ctx context.Context, status registry.Status) error {
+	updater, ok := a.opts.registrar.(registry.StatusUpdater)
+	if !ok {
+		return errors.New("registrar does not support update status")
+	}
+
+	instance := a.getInstance()
+	if instance == nil {
+		return errors.New("app is not running")
+	}
+
+	if err := updater.UpdateStatus(ctx, instance, status); err != nil {
+		return err
+	}
+
+	newInstance := *instance
+	newInstance.Status = status
+	a.updateInstance(&newInstance)
+	return nil
+}
+
 func (a *App) Stop() (err error) {
 	alog.Info("app %s:%s stop", a.opts.name, a.opts.id)
 
@@ -0,0 +1,43 @@
+// Package coordination 提供分布式协调能力：leader 选举和分布式锁，
+// 用于赛季结算等只能在一个节点上执行的任务
+package coordination
+
+import (
+	"context"
+
+	"github.com/lightmen/nami/codes"
+	"github.com/lightmen/nami/pkg/aerror"
+)
+
+var (
+	ErrLocked    = aerror.New(codes.Aborted, "mutex is locked by another session")                // TryLock 时锁已被占用
+	ErrNotLocked = aerror.New(codes.FailedPrecondition, "mutex is not locked by current session") // Unlock 时没有持有锁
+)
+
+// Coordinator 分布式协调
+type Coordinator interface {
+	// Elect 参与名为 name 的选举，阻塞直到当选或者 ctx 结束，val 为当选后对外公布的值，一般为节点ID
+	Elect(ctx context.Context, name, val string) (Leader, error)
+	// Observe 监控名为 name 的选举，leader 变化时发送新 leader 的值，ctx 结束时关闭 channel
+	Observe(ctx context.Context, name string) (<-chan string, error)
+	// NewMutex 创建名为 name 的分布式锁
+	NewMutex(name string) Mutex
+}
+
+// Leader 当选的 leader
+type Leader interface {
+	// Resign 主动放弃 leader 身份
+	Resign(ctx context.Context) error
+	// Done 失去 leader 身份(Resign 或者租约过期)时关闭
+	Done() <-chan struct{}
+}
+
+// Mutex 分布式锁，持有锁的节点异常退出时，锁在租约过期后自动释放
+type Mutex interface {
+	// Lock 阻塞直到获取锁或者 ctx 结束
+	Lock(ctx context.Context) error
+	// TryLock 尝试获取锁，锁已被占用时返回 ErrLocked
+	TryLock(ctx context.Context) error
+	// Unlock 释放锁
+	Unlock(ctx context.Context) error
+}
@@ -0,0 +1,288 @@
+// Package etcd 基于 etcd concurrency 实现的分布式协调，每个 leader 和持有的锁使用独立的租约
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/lightmen/nami/alog"
+	"github.com/lightmen/nami/coordination"
+)
+
+const (
+	minRetryBackoff = 100 * time.Millisecond
+	maxRetryBackoff = 5 * time.Second
+)
+
+var _ coordination.Coordinator = (*Coordinator)(nil)
+
+// Coordinator is etcd coordinator.
+type Coordinator struct {
+	opts   *options
+	client *clientv3.Client
+}
+
+// New creates etcd coordinator
+func New(client *clientv3.Client, opts ...Option) *Coordinator {
+	op := &options{
+		namespace: "/coordination",
+		ttl:       time.Second * 15,
+	}
+	for _, o := range opts {
+		o(op)
+	}
+
+	return &Coordinator{
+		opts:   op,
+		client: client,
+	}
+}
+
+// Elect 参与选举，阻塞直到当选或者 ctx 结束
+func (c *Coordinator) Elect(ctx context.Context, name, val string) (coordination.Leader, error) {
+	s, err := c.newSession()
+	if err != nil {
+		return nil, err
+	}
+
+	e := concurrency.NewElection(s, c.prefix("election", name))
+	if err = e.Campaign(ctx, val); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	l := &leader{
+		session:  s,
+		election: e,
+		done:     make(chan struct{}),
+	}
+	go l.watch()
+	return l, nil
+}
+
+// Observe 监控选举，leader 变化时发送新 leader 的值。只读取选举的 key，不需要创建 session
+func (c *Coordinator) Observe(ctx context.Context, name string) (<-chan string, error) {
+	// 与 concurrency.Election 的 key 前缀相同，最早创建的 key 为 leader
+	pfx := c.prefix("election", name) + "/"
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+
+		// etcd 暂时不可用时退避重试，只有 ctx 结束才关闭 channel
+		backoff := minRetryBackoff
+		retry := func() bool {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return false
+			}
+			if backoff *= 2; backoff > maxRetryBackoff {
+				backoff = maxRetryBackoff
+			}
+			return true
+		}
+
+		for ctx.Err() == nil {
+			rsp, err := c.client.Get(ctx, pfx, clientv3.WithFirstCreate()...)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				alog.Error("[etcd] observe %s error: %s", name, err.Error())
+				if !retry() {
+					return
+				}
+				continue
+			}
+
+			var kv *mvccpb.KeyValue
+			if len(rsp.Kvs) > 0 {
+				kv = rsp.Kvs[0]
+			} else if kv = c.waitLeader(ctx, pfx, rsp.Header.Revision+1); kv == nil {
+				if ctx.Err() == nil && !retry() {
+					return
+				}
+				continue
+			}
+			backoff = minRetryBackoff
+
+			select {
+			case ch <- string(kv.Value):
+			case <-ctx.Done():
+				return
+			}
+			c.watchLeader(ctx, kv.Key, kv.ModRevision+1, ch)
+		}
+	}()
+	return ch, nil
+}
+
+// waitLeader 没有 leader 时等待第一个参选者，watch 出错时返回 nil
+func (c *Coordinator) waitLeader(ctx context.Context, pfx string, rev int64) *mvccpb.KeyValue {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for rsp := range c.client.Watch(wctx, pfx, clientv3.WithPrefix(), clientv3.WithRev(rev), clientv3.WithFilterDelete()) {
+		if rsp.Err() != nil {
+			return nil
+		}
+		if len(rsp.Events) > 0 {
+			return rsp.Events[0].Kv
+		}
+	}
+	return nil
+}
+
+// watchLeader 监控 leader 的 key，值修改时发送新的值，key 删除或者 watch 出错时返回
+func (c *Coordinator) watchLeader(ctx context.Context, key []byte, rev int64, ch chan<- string) {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for rsp := range c.client.Watch(wctx, string(key), clientv3.WithRev(rev)) {
+		if rsp.Err() != nil {
+			return
+		}
+		for _, ev := range rsp.Events {
+			if ev.Type == mvccpb.DELETE {
+				return
+			}
+			select {
+			case ch <- string(ev.Kv.Value):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// NewMutex 创建分布式锁
+func (c *Coordinator) NewMutex(name string) coordination.Mutex {
+	return &mutex{
+		c:     c,
+		pfx:   c.prefix("mutex", name),
+		local: make(chan struct{}, 1),
+	}
+}
+
+func (c *Coordinator) newSession() (*concurrency.Session, error) {
+	ttl := int(c.opts.ttl.Seconds())
+	if ttl <= 0 {
+		ttl = 1
+	}
+	return concurrency.NewSession(c.client, concurrency.WithTTL(ttl))
+}
+
+func (c *Coordinator) prefix(typ, name string) string {
+	return fmt.Sprintf("%s/%s/%s", c.opts.namespace, typ, name)
+}
+
+type leader struct {
+	session  *concurrency.Session
+	election *concurrency.Election
+	once     sync.Once
+	done     chan struct{}
+}
+
+// watch 租约过期时失去 leader 身份
+func (l *leader) watch() {
+	select {
+	case <-l.session.Done():
+		l.close()
+	case <-l.done:
+	}
+}
+
+func (l *leader) Resign(ctx context.Context) error {
+	defer l.close()
+	defer l.session.Close()
+
+	return l.election.Resign(ctx)
+}
+
+func (l *leader) Done() <-chan struct{} {
+	return l.done
+}
+
+func (l *leader) close() {
+	l.once.Do(func() {
+		close(l.done)
+	})
+}
+
+// mutex 每次加锁使用新的 session，local 保证同一个 mutex 在进程内同时只有一个持有者
+type mutex struct {
+	c     *Coordinator
+	pfx   string
+	local chan struct{}
+
+	session *concurrency.Session
+	m       *concurrency.Mutex
+}
+
+func (m *mutex) Lock(ctx context.Context) error {
+	select {
+	case m.local <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return m.lock(func(em *concurrency.Mutex) error {
+		return em.Lock(ctx)
+	})
+}
+
+func (m *mutex) TryLock(ctx context.Context) error {
+	select {
+	case m.local <- struct{}{}:
+	default:
+		return coordination.ErrLocked
+	}
+
+	err := m.lock(func(em *concurrency.Mutex) error {
+		return em.TryLock(ctx)
+	})
+	if errors.Is(err, concurrency.ErrLocked) {
+		return coordination.ErrLocked
+	}
+	return err
+}
+
+// lock 在持有进程内的锁后获取 etcd 的锁，失败时释放进程内的锁
+func (m *mutex) lock(fn func(em *concurrency.Mutex) error) error {
+	s, err := m.c.newSession()
+	if err != nil {
+		<-m.local
+		return err
+	}
+
+	em := concurrency.NewMutex(s, m.pfx)
+	if err = fn(em); err != nil {
+		s.Close()
+		<-m.local
+		return err
+	}
+
+	m.session = s
+	m.m = em
+	return nil
+}
+
+func (m *mutex) Unlock(ctx context.Context) error {
+	if m.m == nil {
+		return coordination.ErrNotLocked
+	}
+
+	err := m.m.Unlock(ctx)
+	m.session.Close()
+	m.session = nil
+	m.m = nil
+	<-m.local
+	return err
+}
@@ -0,0 +1,124 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+
+	"github.com/lightmen/nami/coordination"
+)
+
+// newClient 需要设置 NAMI_ETCD_ADDR 环境变量指定 etcd 地址，多个地址用逗号分隔
+func newClient(t *testing.T) *clientv3.Client {
+	addr := os.Getenv("NAMI_ETCD_ADDR")
+	if addr == "" {
+		t.Skip("NAMI_ETCD_ADDR not set")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   strings.Split(addr, ","),
+		DialTimeout: time.Second, DialOptions: []grpc.DialOption{grpc.WithBlock()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestElect(t *testing.T) {
+	c := New(newClient(t), TTL(2*time.Second))
+	ctx := context.Background()
+
+	octx, ocancel := context.WithCancel(ctx)
+	defer ocancel()
+	observe, err := c.Observe(octx, "season")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l1, err := c.Elect(ctx, "season", "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := <-observe; v != "node1" {
+		t.Fatalf("expect leader node1, got: %s", v)
+	}
+
+	elected := make(chan coordination.Leader, 1)
+	go func() {
+		l2, err := c.Elect(ctx, "season", "node2")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		elected <- l2
+	}()
+
+	select {
+	case <-elected:
+		t.Fatalf("node2 should not be elected while node1 is leader")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	if err = l1.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var l2 coordination.Leader
+	select {
+	case l2 = <-elected:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("node2 should be elected after node1 resign")
+	}
+	if v := <-observe; v != "node2" {
+		t.Fatalf("expect leader node2, got: %s", v)
+	}
+
+	if err = l2.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-l2.Done():
+	default:
+		t.Fatalf("done should be closed after resign")
+	}
+}
+
+func TestMutex(t *testing.T) {
+	client := newClient(t)
+	ctx := context.Background()
+
+	// 两个 Coordinator 模拟两个节点
+	m1 := New(client, TTL(2*time.Second)).NewMutex("settle")
+	m2 := New(client, TTL(2*time.Second)).NewMutex("settle")
+
+	if err := m1.Unlock(ctx); !errors.Is(err, coordination.ErrNotLocked) {
+		t.Fatalf("expect ErrNotLocked, got: %v", err)
+	}
+
+	if err := m1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m1.TryLock(ctx); !errors.Is(err, coordination.ErrLocked) {
+		t.Fatalf("expect ErrLocked in same process, got: %v", err)
+	}
+	if err := m2.TryLock(ctx); !errors.Is(err, coordination.ErrLocked) {
+		t.Fatalf("expect ErrLocked, got: %v", err)
+	}
+
+	if err := m1.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m2.TryLock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m2.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
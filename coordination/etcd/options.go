@@ -0,0 +1,25 @@
+package etcd
+
+import "time"
+
+// Option is etcd coordinator option.
+type Option func(o *options)
+
+type options struct {
+	namespace string
+	ttl       time.Duration
+}
+
+// Namespace with coordinator namespace.
+func Namespace(ns string) Option {
+	return func(o *options) {
+		o.namespace = ns
+	}
+}
+
+// TTL with the lease ttl of leader and mutex, 持有者异常退出后最多 ttl 时间释放
+func TTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
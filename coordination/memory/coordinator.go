@@ -0,0 +1,206 @@
+// Package memory 进程内的分布式协调实现，用于测试和单进程部署
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/lightmen/nami/coordination"
+)
+
+var _ coordination.Coordinator = (*Coordinator)(nil)
+
+// Coordinator is memory coordinator.
+type Coordinator struct {
+	sync.Mutex
+	elections map[string]*election
+	mutexes   map[string]chan struct{}
+}
+
+type election struct {
+	leader  *leader
+	changed chan struct{} // leader 变化时关闭并重建
+}
+
+// New creates memory coordinator
+func New() *Coordinator {
+	return &Coordinator{
+		elections: make(map[string]*election),
+		mutexes:   make(map[string]chan struct{}),
+	}
+}
+
+// Elect 参与选举，阻塞直到当选或者 ctx 结束
+func (c *Coordinator) Elect(ctx context.Context, name, val string) (coordination.Leader, error) {
+	for {
+		c.Lock()
+		e := c.election(name)
+		if e.leader == nil {
+			l := &leader{
+				c:    c,
+				name: name,
+				val:  val,
+				done: make(chan struct{}),
+			}
+			e.leader = l
+			e.notify()
+			c.Unlock()
+			return l, nil
+		}
+		changed := e.changed
+		c.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Observe 监控选举，leader 变化时发送新 leader 的值
+func (c *Coordinator) Observe(ctx context.Context, name string) (<-chan string, error) {
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+
+		var last *leader
+		for {
+			c.Lock()
+			e := c.election(name)
+			cur, changed := e.leader, e.changed
+			c.Unlock()
+
+			if cur != nil && cur != last {
+				select {
+				case ch <- cur.val:
+				case <-ctx.Done():
+					return
+				}
+				last = cur
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// NewMutex 创建分布式锁，同一个 Coordinator 中同名的锁互斥
+func (c *Coordinator) NewMutex(name string) coordination.Mutex {
+	c.Lock()
+	defer c.Unlock()
+
+	ch, ok := c.mutexes[name]
+	if !ok {
+		ch = make(chan struct{}, 1)
+		c.mutexes[name] = ch
+	}
+	return &mutex{ch: ch}
+}
+
+// Revoke 模拟 leader 的租约过期，当前的 leader 失去 leader 身份
+func (c *Coordinator) Revoke(name string) {
+	c.Lock()
+	l := c.election(name).leader
+	c.Unlock()
+
+	if l != nil {
+		l.resign()
+	}
+}
+
+// election 调用时需持有锁
+func (c *Coordinator) election(name string) *election {
+	e, ok := c.elections[name]
+	if !ok {
+		e = &election{changed: make(chan struct{})}
+		c.elections[name] = e
+	}
+	return e
+}
+
+func (e *election) notify() {
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+type leader struct {
+	c    *Coordinator
+	name string
+	val  string
+	once sync.Once
+	done chan struct{}
+}
+
+func (l *leader) Resign(ctx context.Context) error {
+	l.resign()
+	return nil
+}
+
+func (l *leader) Done() <-chan struct{} {
+	return l.done
+}
+
+func (l *leader) resign() {
+	l.once.Do(func() {
+		l.c.Lock()
+		e := l.c.election(l.name)
+		if e.leader == l {
+			e.leader = nil
+			e.notify()
+		}
+		l.c.Unlock()
+
+		close(l.done)
+	})
+}
+
+type mutex struct {
+	ch chan struct{}
+
+	lk     sync.Mutex
+	locked bool // 是否由当前 Mutex 持有，Lock 和 Unlock 可能在不同的协程调用
+}
+
+func (m *mutex) Lock(ctx context.Context) error {
+	select {
+	case m.ch <- struct{}{}:
+		m.setLocked()
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *mutex) TryLock(ctx context.Context) error {
+	select {
+	case m.ch <- struct{}{}:
+		m.setLocked()
+		return nil
+	default:
+		return coordination.ErrLocked
+	}
+}
+
+func (m *mutex) Unlock(ctx context.Context) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	if !m.locked {
+		return coordination.ErrNotLocked
+	}
+	m.locked = false
+	<-m.ch
+	return nil
+}
+
+func (m *mutex) setLocked() {
+	m.lk.Lock()
+	m.locked = true
+	m.lk.Unlock()
+}
@@ -0,0 +1,159 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lightmen/nami/coordination"
+)
+
+func TestElect(t *testing.T) {
+	c := New()
+	ctx := context.Background()
+
+	octx, ocancel := context.WithCancel(ctx)
+	defer ocancel()
+	observe, err := c.Observe(octx, "season")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l1, err := c.Elect(ctx, "season", "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := <-observe; v != "node1" {
+		t.Fatalf("expect leader node1, got: %s", v)
+	}
+
+	elected := make(chan coordination.Leader)
+	go func() {
+		l2, err := c.Elect(ctx, "season", "node2")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		elected <- l2
+	}()
+
+	select {
+	case <-elected:
+		t.Fatalf("node2 should not be elected while node1 is leader")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err = l1.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-l1.Done():
+	default:
+		t.Fatalf("done should be closed after resign")
+	}
+
+	var l2 coordination.Leader
+	select {
+	case l2 = <-elected:
+	case <-time.After(time.Second):
+		t.Fatalf("node2 should be elected after node1 resign")
+	}
+	if v := <-observe; v != "node2" {
+		t.Fatalf("expect leader node2, got: %s", v)
+	}
+
+	// 租约过期
+	c.Revoke("season")
+	select {
+	case <-l2.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("done should be closed after revoke")
+	}
+}
+
+func TestElectCancel(t *testing.T) {
+	c := New()
+	if _, err := c.Elect(context.Background(), "season", "node1"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Elect(ctx, "season", "node2"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded, got: %v", err)
+	}
+}
+
+func TestMutex(t *testing.T) {
+	c := New()
+	ctx := context.Background()
+
+	m1 := c.NewMutex("settle")
+	m2 := c.NewMutex("settle")
+
+	if err := m1.Unlock(ctx); !errors.Is(err, coordination.ErrNotLocked) {
+		t.Fatalf("expect ErrNotLocked, got: %v", err)
+	}
+
+	if err := m1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m2.TryLock(ctx); !errors.Is(err, coordination.ErrLocked) {
+		t.Fatalf("expect ErrLocked, got: %v", err)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := m2.Lock(tctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded, got: %v", err)
+	}
+
+	if err := m1.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m2.TryLock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m2.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMutexConcurrentUnlock 多个协程同时解锁时只有一个成功，其他的返回 ErrNotLocked
+func TestMutexConcurrentUnlock(t *testing.T) {
+	c := New()
+	ctx := context.Background()
+	m := c.NewMutex("settle")
+
+	for i := 0; i < 100; i++ {
+		if err := m.Lock(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 2)
+		for j := 0; j < 2; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- m.Unlock(ctx)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		unlocked := 0
+		for err := range errs {
+			if err == nil {
+				unlocked++
+			} else if !errors.Is(err, coordination.ErrNotLocked) {
+				t.Fatalf("expect ErrNotLocked, got: %v", err)
+			}
+		}
+		if unlocked != 1 {
+			t.Fatalf("expect 1 unlock, got: %d", unlocked)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package nami
+
+import (
+	"context"
+	"time"
+
+	"github.com/lightmen/nami/alog"
+	"github.com/lightmen/nami/coordination"
+	"golang.org/x/sync/errgroup"
+)
+
+// leaderRetryInterval 选举失败或者失去 leader 身份后，重新参与选举前的等待时间
+var leaderRetryInterval = time.Second
+
+type leaderTask struct {
+	coord coordination.Coordinator
+	name  string
+	fn    func(ctx context.Context) error
+}
+
+func (a *App) startLeaderTasks(group *errgroup.Group, ctx context.Context) {
+	for _, t := range a.opts.leaderTasks {
+		task := t
+		group.Go(func() error {
+			a.runLeaderTask(ctx, task)
+			return nil
+		})
+	}
+}
+
+// runLeaderTask 循环参与选举，直到 ctx 结束
+func (a *App) runLeaderTask(ctx context.Context, task *leaderTask) {
+	for ctx.Err() == nil {
+		if err := a.leadOnce(ctx, task); err != nil && ctx.Err() == nil {
+			alog.ErrorCtx(ctx, "[leader][%s] error: %s", task.name, err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(leaderRetryInterval):
+		}
+	}
+}
+
+func (a *App) leadOnce(ctx context.Context, task *leaderTask) error {
+	leader, err := task.coord.Elect(ctx, task.name, a.opts.id)
+	if err != nil {
+		return err
+	}
+	alog.InfoCtx(ctx, "[leader][%s] %s became leader", task.name, a.opts.id)
+
+	lctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-leader.Done():
+			cancel()
+		case <-lctx.Done():
+		}
+	}()
+
+	err = task.fn(lctx)
+
+	// app 退出时 ctx 已经结束，使用新的 ctx 放弃 leader 身份
+	rctx, rcancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer rcancel()
+	if rerr := leader.Resign(rctx); rerr != nil {
+		alog.ErrorCtx(ctx, "[leader][%s] resign error: %s", task.name, rerr.Error())
+	}
+	alog.InfoCtx(ctx, "[leader][%s] %s resigned", task.name, a.opts.id)
+
+	return err
+}
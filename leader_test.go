@@ -0,0 +1,72 @@
+package nami
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lightmen/nami/coordination/memory"
+)
+
+func TestLeaderTask(t *testing.T) {
+	old := leaderRetryInterval
+	leaderRetryInterval = 10 * time.Millisecond
+	defer func() { leaderRetryInterval = old }()
+
+	coord := memory.New()
+
+	var running, leaders int32
+	task := func(ctx context.Context) error {
+		atomic.AddInt32(&running, 1)
+		atomic.AddInt32(&leaders, 1)
+		<-ctx.Done()
+		atomic.AddInt32(&running, -1)
+		return nil
+	}
+
+	apps := make([]*App, 2)
+	errs := make(chan error, len(apps))
+	for i := range apps {
+		app, err := New(Name("gamesrv"), LeaderTask(coord, "season", task))
+		if err != nil {
+			t.Fatal(err)
+		}
+		apps[i] = app
+		go func() {
+			errs <- app.Run()
+		}()
+	}
+
+	waitLeaders := func(n int32) {
+		deadline := time.Now().Add(time.Second)
+		for atomic.LoadInt32(&leaders) < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("expect %d leaders, got: %d", n, atomic.LoadInt32(&leaders))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitLeaders(1)
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&leaders); n != 1 {
+		t.Fatalf("expect only one leader, got: %d", n)
+	}
+
+	// 租约过期后另一个节点当选
+	coord.Revoke("season")
+	waitLeaders(2)
+
+	for _, app := range apps {
+		_ = app.Stop()
+	}
+	for range apps {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&running); n != 0 {
+		t.Fatalf("expect no running task after stop, got: %d", n)
+	}
+}
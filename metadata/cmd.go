@@ -15,3 +15,13 @@ func FromCmdContext(ctx context.Context) string {
 
 	return addr
 }
+
+// FromCmdClientContext 从客户端的 metadata 中获取协议号
+func FromCmdClientContext(ctx context.Context) string {
+	md, ok := FromClientContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	return md.Get(CmdKey)
+}
@@ -5,4 +5,5 @@ const (
 	UIDKey      = "x-md-global-uid"
 	CmdKey      = "x-md-cmd"
 	GateAddrKey = "x-md-global-gate" //存储gatesrv地址
+	ExecKey     = "x-md-global-exec" //调用链上正在串行执行的任务，用于检测重入，只在同步请求中传递
 )
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 
+	"github.com/lightmen/nami/coordination"
 	"github.com/lightmen/nami/registry"
 	"github.com/lightmen/nami/transport"
 )
@@ -20,10 +21,14 @@ type options struct {
 	metadata  map[string]string
 	registrar registry.Registrar
 	version   string
+	weight    int
+	zone      string
 
 	beforeStart []func(context.Context) error
 	afterStart  []func(context.Context) error
 	afterStop   []func(context.Context) error
+
+	leaderTasks []*leaderTask
 }
 
 func Name(name string) Option {
@@ -71,6 +76,20 @@ func Version(version string) Option {
 	}
 }
 
+// Weight with service instance weight.
+func Weight(weight int) Option {
+	return func(o *options) {
+		o.weight = weight
+	}
+}
+
+// Zone with service instance zone.
+func Zone(zone string) Option {
+	return func(o *options) {
+		o.zone = zone
+	}
+}
+
 func BeforeStart(fn func(context.Context) error) Option {
 	return func(o *options) {
 		o.beforeStart = append(o.beforeStart, fn)
@@ -93,3 +112,15 @@ func SigFunc(fn func(os.Signal) bool) Option {
 		o.sigFunc = fn
 	}
 }
+
+// LeaderTask 参与名为 name 的选举，只在当选 leader 期间执行 fn，
+// 失去 leader 身份时取消 fn 的 ctx，fn 返回后重新参与选举
+func LeaderTask(coord coordination.Coordinator, name string, fn func(ctx context.Context) error) Option {
+	return func(o *options) {
+		o.leaderTasks = append(o.leaderTasks, &leaderTask{
+			coord: coord,
+			name:  name,
+			fn:    fn,
+		})
+	}
+}
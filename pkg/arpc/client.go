@@ -13,7 +13,7 @@ type Client interface {
 	Event(ctx context.Context, srv, route, uid string, cmd int32, event codec.Codec, opts ...CallOption) (err error)
 	// Broadcast 将 req 广播到所有的srv服务上
 	Broadcast(ctx context.Context, srv, uid string, cmd int32, req codec.Codec, opts ...CallOption) (err error)
-	//Notify 对某几个玩家发送通知
+	//Notify 对某几个玩家发送通知，设置了在线状态服务并且玩家不在线时返回 ErrOffline
 	Notify(ctx context.Context, srv string, uid string, cmd int32, req codec.Codec, opts ...CallOption) (err error)
 	//NotifyAll 对所有在线玩家发送通知
 	NotifyAll(ctx context.Context, srv string, cmd int32, req codec.Codec, opts ...CallOption) (err error)
@@ -35,7 +35,7 @@ func Event(ctx context.Context, srv, route, uid string, cmd int32, event codec.C
 	return defaultClient.Event(ctx, srv, route, uid, cmd, event, opts...)
 }
 
-// Notify 对某几个玩家发送通知
+// Notify 对某几个玩家发送通知，设置了在线状态服务并且玩家不在线时返回 ErrOffline
 func Notify(ctx context.Context, target string, uid string, cmd int32, req codec.Codec, opts ...CallOption) (err error) {
 	return defaultClient.Notify(ctx, target, uid, cmd, req, opts...)
 }
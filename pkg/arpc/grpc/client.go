@@ -2,6 +2,8 @@ package grpc
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/lightmen/nami/alog"
@@ -9,8 +11,10 @@ import (
 	"github.com/lightmen/nami/message"
 	"github.com/lightmen/nami/metadata"
 	"github.com/lightmen/nami/pkg/arpc"
+	"github.com/lightmen/nami/pkg/cast"
 	"github.com/lightmen/nami/pkg/endpoint"
 	"github.com/lightmen/nami/registry"
+	"github.com/lightmen/nami/session"
 	"github.com/lightmen/nami/transport/agrpc/balancer"
 )
 
@@ -73,9 +77,35 @@ func (cli *client) Notify(ctx context.Context, target string, uid string, cmd in
 		UID:    uid,
 	}
 
-	//如果只有一个玩家
+	for _, opt := range opts {
+		opt(info)
+	}
 
-	return cli.call(ctx, info, opts...)
+	//没有指定地址时，根据在线状态发送到玩家所在的网关，玩家不在线时返回 arpc.ErrOffline
+	p := arpc.GetPresence()
+	if info.Addr != "" || p == nil {
+		return cli.call(ctx, info)
+	}
+
+	locs, err := p.Locate(ctx, uid)
+	if err != nil {
+		alog.ErrorCtx(ctx, "%s|%d|%s|Locate error: %s", uid, cmd, target, err.Error())
+		return cli.call(ctx, info)
+	}
+	if len(locs) == 0 {
+		return arpc.ErrOffline
+	}
+
+	//多端登录时发送到每个设备，单个设备失败不影响其他设备
+	errs := make([]error, 0, len(locs))
+	for _, loc := range locs {
+		info.Addr = loc.GateAddr
+		if e := cli.call(ctx, info); e != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", loc.Device, e))
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
 func (cli *client) NotifyAll(ctx context.Context, srv string, cmd int32, req codec.Codec, opts ...arpc.CallOption) (err error) {
@@ -151,12 +181,13 @@ func (cli *client) call(ctx context.Context, info *arpc.CallInfo, opts ...arpc.C
 	}
 
 	//获取链接
-	conn, err := GetConn(ctx, target, info.Addr)
+	conn, err := AcquireConn(ctx, target, info.Addr)
 	if err != nil {
-		alog.ErrorCtx(ctx, "%s|%d|%s|GetConn error: %s", uid, info.Cmd, target, err.Error())
+		alog.ErrorCtx(ctx, "%s|%d|%s|AcquireConn error: %s", uid, info.Cmd, target, err.Error())
 		return err
 	}
-	msgClient := message.NewMessageClient(conn)
+	defer conn.Close()
+	msgClient := message.NewMessageClient(conn.Value())
 
 	reply, err := msgClient.HandleMessage(ctx, mpkt)
 	if err != nil {
@@ -177,15 +208,26 @@ func (cli *client) call(ctx context.Context, info *arpc.CallInfo, opts ...arpc.C
 func (cli *client) buildContext(ctx context.Context, info *arpc.CallInfo) (context.Context, error) {
 	uid := info.UID
 	if info.Addr == "" { //说明不是直连
-		ctx = balancer.NewNameContext(ctx, balancer.Consistent)
 		ctx = balancer.NewTargetContext(ctx, info.Target)
-		ctx = balancer.NewParamContext(ctx, info.Route)
+		if info.Route != "" { //有路由参数时使用一致性hash，否则使用默认负载或者 ctx 中指定的负载
+			ctx = balancer.NewParamContext(ctx, info.Route)
+		}
+	}
+
+	//只有同步请求会等待下游返回，异步调用不传递正在执行的session，下游排队执行
+	if info.Type != message.REQUEST {
+		ctx = session.WithoutExecuting(ctx)
 	}
 
 	if metadata.GetUIDFromClientContext(ctx) != uid {
 		ctx = metadata.AppendUIDToClientContext(ctx, uid)
 	}
 
+	//协议号用于匹配负载的路由规则
+	if cmd := cast.ToString(info.Cmd); metadata.FromCmdClientContext(ctx) != cmd {
+		ctx = metadata.AppendToClientContext(ctx, metadata.CmdKey, cmd)
+	}
+
 	return ctx, nil
 }
 
@@ -0,0 +1,94 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lightmen/nami/message"
+	"github.com/lightmen/nami/pkg/arpc"
+	"github.com/lightmen/nami/presence"
+	"github.com/lightmen/nami/presence/memory"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type rawCodec []byte
+
+func (c rawCodec) Marshal() ([]byte, error) { return c, nil }
+func (c *rawCodec) Unmarshal(data []byte) error {
+	*c = data
+	return nil
+}
+
+type countServer struct {
+	message.UnimplementedMessageServer
+	count int32
+}
+
+func (s *countServer) HandleMessage(ctx context.Context, pkt *message.Packet) (*message.Packet, error) {
+	atomic.AddInt32(&s.count, 1)
+	return &message.Packet{Head: pkt.Head}, nil
+}
+
+func TestNotifyDevices(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &countServer{}
+	gs := grpc.NewServer()
+	message.RegisterMessageServer(gs, srv)
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	// grpc://up 连接到测试服务，其他地址连接不上
+	m := newTestManager(t)
+	m.dial = func(ctx context.Context, target string) (*grpc.ClientConn, error) {
+		addr := "127.0.0.1:1"
+		if target == "grpc://up" {
+			addr = lis.Addr().String()
+		}
+		return grpc.NewClient("passthrough:///"+addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	old := gManager
+	gManager = m
+	defer func() { gManager = old }()
+
+	p := memory.New(memory.WithPolicy(presence.AllowMultiple))
+	arpc.SetPresence(p)
+	defer arpc.SetPresence(nil)
+
+	ctx := context.Background()
+	cli := New()
+	req := rawCodec("hello")
+	if err = cli.Notify(ctx, "gate", "10001", 1, &req); !errors.Is(err, arpc.ErrOffline) {
+		t.Fatalf("offline Notify error = %v, want ErrOffline", err)
+	}
+
+	for _, loc := range []*presence.Location{
+		{UID: "10001", Device: "pc", GateAddr: "grpc://down"},
+		{UID: "10001", Device: "phone", GateAddr: "grpc://up"},
+	} {
+		if _, err = p.Login(ctx, loc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 选项只应用一次，一个设备失败不影响其他设备
+	var applied int32
+	opt := func(*arpc.CallInfo) { atomic.AddInt32(&applied, 1) }
+	err = cli.Notify(ctx, "gate", "10001", 1, &req, opt)
+	if err == nil || !strings.Contains(err.Error(), "pc:") || strings.Contains(err.Error(), "phone:") {
+		t.Fatalf("Notify error = %v, want only pc failed", err)
+	}
+	if n := atomic.LoadInt32(&srv.count); n != 1 {
+		t.Fatalf("phone received %d notifies, want 1", n)
+	}
+	if n := atomic.LoadInt32(&applied); n != 1 {
+		t.Fatalf("option applied %d times, want 1", n)
+	}
+}
@@ -6,15 +6,20 @@ import (
 	"google.golang.org/grpc"
 )
 
-// GetConn 根据target获取conn，target为srv名字, 类似 gamesrv, addr为地址,类似 grpc://192.168.15.117:33308，addr可以为空
-func GetConn(ctx context.Context, target, addr string) (*grpc.ClientConn, error) {
+// AcquireConn 根据target获取连接，target为srv名字, 类似 gamesrv, addr为地址,类似 grpc://192.168.15.117:33308，addr可以为空，
+// 不为空时使用直连，使用完后调用 Conn.Close 归还
+func AcquireConn(ctx context.Context, target, addr string) (Conn, error) {
 	if addr != "" {
 		target = addr
 	}
-	wrap, err := getClientConn(ctx, target)
-	if err != nil {
-		return nil, err
-	}
+	return gManager.Acquire(ctx, target)
+}
 
-	return wrap.conn, nil
+// GetConn 根据target获取conn，target为srv名字, 类似 gamesrv, addr为地址,类似 grpc://192.168.15.117:33308，addr可以为空。
+// 返回的是每个 target 一个的常驻连接，不使用连接池，不会因为空闲被关闭，直连地址从服务发现中下线后关闭，新代码使用 AcquireConn
+func GetConn(ctx context.Context, target, addr string) (*grpc.ClientConn, error) {
+	if addr != "" {
+		target = addr
+	}
+	return gManager.Pin(ctx, target)
 }
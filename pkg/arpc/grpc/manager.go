@@ -0,0 +1,430 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lightmen/nami/alog"
+	"github.com/lightmen/nami/pkg/arpc"
+	"github.com/lightmen/nami/pkg/endpoint"
+	"github.com/lightmen/nami/pkg/safe"
+	"github.com/lightmen/nami/transport/agrpc/pool"
+	"google.golang.org/grpc"
+)
+
+// Conn 从连接管理器获取的连接，使用完后调用 Close 归还，不会关闭物理连接
+type Conn = pool.Conn
+
+const (
+	closeIdle    = "idle"    // 空闲超时关闭
+	closeRemoved = "removed" // 实例从服务发现中移除后关闭
+)
+
+var gManager = newConnManager()
+
+// ConfigureManager 设置全局连接管理器，需要在第一次请求之前调用
+func ConfigureManager(opts ...ManagerOption) {
+	gManager.lk.Lock()
+	defer gManager.lk.Unlock()
+
+	for _, o := range opts {
+		o(gManager.opts)
+	}
+}
+
+// PoolStats 返回所有连接的统计信息
+func PoolStats() []pool.Stats {
+	return gManager.Stats()
+}
+
+// connManager 按 target 管理连接：
+//   - 服务名(如 gamesrv)使用一个 ClientConn，由 mix 负载在服务的实例之间选择
+//   - 直连地址(如 grpc://192.168.15.117:33308)使用连接池，按并发流数扩缩物理连接
+type connManager struct {
+	opts    *managerOptions
+	dial    func(ctx context.Context, target string) (*grpc.ClientConn, error)
+	newPool func(address string, opts ...pool.Option) (pool.Pool, error)
+	now     func() time.Time
+
+	lk      sync.RWMutex
+	entries map[string]*entry
+	closing  []*entry              // 已经移除，等待请求结束后关闭
+	pinned   map[string]*pinnedConn // GetConn 使用的常驻连接，不会因为空闲被关闭
+	unpinned []*pinnedConn          // 已经从服务发现中下线的常驻连接，reap 时关闭
+
+	once   sync.Once
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type entry struct {
+	target   string
+	cc       *grpc.ClientConn // 服务名的连接
+	pool     pool.Pool        // 直连地址的连接池
+	streams  atomic.Int64     // 正在处理的请求数
+	lastUsed atomic.Int64     // 最后一次使用的时间(纳秒)
+
+	discovered bool // 地址出现在服务发现中，实例下线后关闭，调用时需持有 connManager 的锁
+}
+
+type pinnedConn struct {
+	target     string
+	cc         *grpc.ClientConn
+	discovered bool // 同 entry.discovered
+}
+
+func newConnManager() *connManager {
+	m := &connManager{
+		opts:    defaultManagerOptions(),
+		dial:    createClientConn,
+		newPool: pool.New,
+		now:     time.Now,
+		entries: make(map[string]*entry),
+		pinned:  make(map[string]*pinnedConn),
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	return m
+}
+
+// Acquire 获取 target 的连接，使用完后调用 Conn.Close 归还
+func (m *connManager) Acquire(ctx context.Context, target string) (Conn, error) {
+	m.once.Do(m.start)
+
+	e, err := m.getEntry(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &managedConn{m: m, entry: e, cc: e.cc}
+	if e.pool != nil {
+		if c.inner, err = e.pool.Get(); err != nil {
+			e.streams.Add(-1)
+			return nil, err
+		}
+		c.cc = c.inner.Value()
+	}
+	return c, nil
+}
+
+// getEntry 返回 target 的 entry 并增加请求数，在持有锁时增加，保证 reap 不会关闭刚获取的 entry
+func (m *connManager) getEntry(ctx context.Context, target string) (*entry, error) {
+	m.lk.RLock()
+	e, ok := m.entries[target]
+	if ok {
+		e.use(m.now())
+	}
+	m.lk.RUnlock()
+	if ok {
+		return e, nil
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	if e, ok = m.entries[target]; !ok {
+		var err error
+		if e, err = m.newEntry(ctx, target); err != nil {
+			return nil, err
+		}
+		m.entries[target] = e
+	}
+	e.use(m.now())
+	return e, nil
+}
+
+// Pin 返回 target 的常驻连接，不计入请求数，不会因为空闲被关闭，直连地址从服务发现中下线后关闭
+func (m *connManager) Pin(ctx context.Context, target string) (*grpc.ClientConn, error) {
+	m.once.Do(m.start)
+
+	m.lk.RLock()
+	p, ok := m.pinned[target]
+	m.lk.RUnlock()
+	if ok {
+		return p.cc, nil
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	if p, ok = m.pinned[target]; ok {
+		return p.cc, nil
+	}
+
+	// 直连地址不使用连接池，连接池缩容时会关闭连接
+	cc, err := m.dial(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	m.pinned[target] = &pinnedConn{target: target, cc: cc}
+	alog.Info("create pinned grpc client conn: %s", target)
+	return cc, nil
+}
+
+// newEntry 调用时需持有锁
+func (m *connManager) newEntry(ctx context.Context, target string) (*entry, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &entry{target: target}
+	if u.Scheme == "grpc" {
+		e.pool, err = m.newPool(target,
+			pool.WithDial(func(address string) (*grpc.ClientConn, error) {
+				dctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+				defer cancel()
+				return m.dial(dctx, address)
+			}),
+			pool.WithSize(m.opts.maxIdle, m.opts.maxActive, m.opts.maxStreams),
+		)
+	} else {
+		e.cc, err = m.dial(ctx, target)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	alog.Info("create grpc client conn: %s", target)
+	return e, nil
+}
+
+// start 第一次使用时启动后台任务
+func (m *connManager) start() {
+	safe.Go(m.loop)
+
+	if m.opts.watchDiscovery {
+		safe.Go(m.watch)
+	}
+}
+
+func (m *connManager) loop() {
+	ticker := time.NewTicker(m.opts.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.reap()
+			m.report()
+		}
+	}
+}
+
+// reap 关闭空闲超时的连接和已经移除并且请求都已结束的连接
+func (m *connManager) reap() {
+	now := m.now()
+
+	m.lk.Lock()
+	closes := make([]*entry, 0)
+	for target, e := range m.entries {
+		idle := now.Sub(time.Unix(0, e.lastUsed.Load()))
+		if e.streams.Load() == 0 && idle >= m.opts.idleTimeout {
+			delete(m.entries, target)
+			closes = append(closes, e)
+		}
+	}
+
+	closing := m.closing[:0]
+	removed := make([]*entry, 0)
+	for _, e := range m.closing {
+		if e.streams.Load() == 0 {
+			removed = append(removed, e)
+		} else {
+			closing = append(closing, e)
+		}
+	}
+	m.closing = closing
+
+	unpinned := m.unpinned
+	m.unpinned = nil
+	m.lk.Unlock()
+
+	for _, e := range closes {
+		m.close(e, closeIdle)
+	}
+	for _, e := range removed {
+		m.close(e, closeRemoved)
+	}
+	for _, p := range unpinned {
+		if err := p.cc.Close(); err != nil {
+			alog.Error("close pinned grpc client conn %s error: %s", p.target, err.Error())
+		}
+		alog.Info("close pinned grpc client conn: %s, reason: %s", p.target, closeRemoved)
+	}
+}
+
+// remove 移除从服务发现中下线的直连地址，新的请求会创建新的连接池，
+// 从来没有出现在服务发现中的地址(如业务直接指定的地址)只会因为空闲被关闭
+func (m *connManager) remove(live map[string]struct{}) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	for target, e := range m.entries {
+		if e.pool == nil {
+			continue
+		}
+		if _, ok := live[target]; ok {
+			e.discovered = true
+			continue
+		}
+		if !e.discovered {
+			continue
+		}
+
+		delete(m.entries, target)
+		m.closing = append(m.closing, e)
+		alog.Info("grpc client conn removed from discovery: %s", target)
+	}
+
+	// 常驻连接不计入请求数，下一次 reap 时关闭
+	for target, p := range m.pinned {
+		if _, ok := live[target]; ok {
+			p.discovered = true
+			continue
+		}
+		if !p.discovered {
+			continue
+		}
+
+		delete(m.pinned, target)
+		m.unpinned = append(m.unpinned, p)
+		alog.Info("pinned grpc client conn removed from discovery: %s", target)
+	}
+}
+
+func (m *connManager) close(e *entry, reason string) {
+	var err error
+	if e.pool != nil {
+		err = e.pool.Close()
+	} else {
+		err = e.cc.Close()
+	}
+	if err != nil {
+		alog.Error("close grpc client conn %s error: %s", e.target, err.Error())
+	}
+	alog.Info("close grpc client conn: %s, reason: %s", e.target, reason)
+
+	if m.opts.closed != nil {
+		m.opts.closed.With(e.target, reason).Inc()
+	}
+	if m.opts.conns != nil {
+		m.opts.conns.With(e.target).Set(0)
+	}
+	if m.opts.streams != nil {
+		m.opts.streams.With(e.target).Set(0)
+	}
+}
+
+// watch 监听服务发现，实例下线时关闭直连地址的连接
+func (m *connManager) watch() {
+	dis := arpc.GetDiscorey()
+	if dis == nil {
+		return
+	}
+
+	for m.ctx.Err() == nil {
+		w, err := dis.Watch(m.ctx, "")
+		if err != nil {
+			alog.Error("[conn manager] watch discovery error: %s", err.Error())
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for {
+			instances, err := w.Next()
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					alog.Error("[conn manager] watch next error: %s", err.Error())
+				}
+				break
+			}
+
+			live := make(map[string]struct{}, len(instances))
+			for _, ins := range instances {
+				if addr := endpoint.GetGrpcEndpoint(ins.Endpoints); addr != "" {
+					live[addr] = struct{}{}
+				}
+			}
+			m.remove(live)
+		}
+
+		_ = w.Stop()
+		time.Sleep(time.Second)
+	}
+}
+
+// report 上报每个 target 的连接数和请求数
+func (m *connManager) report() {
+	if m.opts.conns == nil && m.opts.streams == nil {
+		return
+	}
+
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+
+	for target, e := range m.entries {
+		if m.opts.conns != nil {
+			m.opts.conns.With(target).Set(float64(e.conns()))
+		}
+		if m.opts.streams != nil {
+			m.opts.streams.With(target).Set(float64(e.streams.Load()))
+		}
+	}
+}
+
+// Stats 返回所有连接的统计信息
+func (m *connManager) Stats() []pool.Stats {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+
+	stats := make([]pool.Stats, 0, len(m.entries))
+	for target, e := range m.entries {
+		stats = append(stats, pool.Stats{
+			Address: target,
+			Conns:   e.conns(),
+			Streams: int(e.streams.Load()),
+		})
+	}
+	return stats
+}
+
+func (e *entry) use(now time.Time) {
+	e.streams.Add(1)
+	e.lastUsed.Store(now.UnixNano())
+}
+
+func (e *entry) conns() int {
+	if e.pool != nil {
+		return e.pool.Stats().Conns
+	}
+	return 1
+}
+
+type managedConn struct {
+	m     *connManager
+	entry *entry
+	cc    *grpc.ClientConn
+	inner pool.Conn // 直连地址时为连接池中的连接
+	once  sync.Once
+}
+
+func (c *managedConn) Value() *grpc.ClientConn {
+	return c.cc
+}
+
+func (c *managedConn) Close() (err error) {
+	c.once.Do(func() {
+		c.entry.lastUsed.Store(c.m.now().UnixNano())
+		c.entry.streams.Add(-1)
+		if c.inner != nil {
+			err = c.inner.Close()
+		}
+	})
+	return
+}
@@ -0,0 +1,85 @@
+package grpc
+
+import (
+	"time"
+
+	"github.com/lightmen/nami/metrics"
+)
+
+// ManagerOption is connection manager option.
+type ManagerOption func(o *managerOptions)
+
+type managerOptions struct {
+	idleTimeout    time.Duration
+	interval       time.Duration
+	maxIdle        int
+	maxActive      int
+	maxStreams     int
+	conns          metrics.Gauge
+	streams        metrics.Gauge
+	closed         metrics.Counter
+	watchDiscovery bool
+}
+
+func defaultManagerOptions() *managerOptions {
+	return &managerOptions{
+		idleTimeout:    time.Second * 360,
+		interval:       time.Second * 30,
+		maxIdle:        1,
+		maxActive:      8,
+		maxStreams:     100,
+		watchDiscovery: true,
+	}
+}
+
+// IdleTimeout 连接超过该时间没有使用时关闭
+func IdleTimeout(d time.Duration) ManagerOption {
+	return func(o *managerOptions) {
+		o.idleTimeout = d
+	}
+}
+
+// CheckInterval 检查空闲连接和上报统计信息的间隔
+func CheckInterval(d time.Duration) ManagerOption {
+	return func(o *managerOptions) {
+		o.interval = d
+	}
+}
+
+// DirectPool 直连地址连接池的大小，常驻 maxIdle 个物理连接，每个物理连接的并发流数超过 maxStreams 时扩容，
+// 最多 maxActive 个物理连接
+func DirectPool(maxIdle, maxActive, maxStreams int) ManagerOption {
+	return func(o *managerOptions) {
+		o.maxIdle = maxIdle
+		o.maxActive = maxActive
+		o.maxStreams = maxStreams
+	}
+}
+
+// WithConnsGauge 上报每个 target 的物理连接数，label 为 target
+func WithConnsGauge(g metrics.Gauge) ManagerOption {
+	return func(o *managerOptions) {
+		o.conns = g
+	}
+}
+
+// WithStreamsGauge 上报每个 target 正在处理的请求数，label 为 target
+func WithStreamsGauge(g metrics.Gauge) ManagerOption {
+	return func(o *managerOptions) {
+		o.streams = g
+	}
+}
+
+// WithClosedCounter 统计关闭的连接，label 为 target 和原因(idle/removed)
+func WithClosedCounter(c metrics.Counter) ManagerOption {
+	return func(o *managerOptions) {
+		o.closed = c
+	}
+}
+
+// WatchDiscovery 是否监听服务发现，实例下线时关闭直连地址的连接
+func WatchDiscovery(watch bool) ManagerOption {
+	return func(o *managerOptions) {
+		o.watchDiscovery = watch
+	}
+}
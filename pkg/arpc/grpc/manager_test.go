@@ -0,0 +1,244 @@
+package grpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lightmen/nami/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type fakeGauge struct {
+	lk     *sync.Mutex
+	values map[string]float64
+	label  string
+}
+
+func newFakeGauge() *fakeGauge {
+	return &fakeGauge{lk: &sync.Mutex{}, values: make(map[string]float64)}
+}
+
+func (g *fakeGauge) With(lvs ...string) metrics.Gauge {
+	return &fakeGauge{lk: g.lk, values: g.values, label: lvs[0]}
+}
+
+func (g *fakeGauge) Set(value float64) {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+	g.values[g.label] = value
+}
+
+func (g *fakeGauge) Add(delta float64) {}
+func (g *fakeGauge) Sub(delta float64) {}
+
+func (g *fakeGauge) get(label string) float64 {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+	return g.values[label]
+}
+
+type fakeCounter struct {
+	lk     *sync.Mutex
+	values map[string]float64
+	label  string
+}
+
+func (c *fakeCounter) With(lvs ...string) metrics.Counter {
+	return &fakeCounter{lk: c.lk, values: c.values, label: lvs[0] + "|" + lvs[1]}
+}
+
+func (c *fakeCounter) Inc() { c.Add(1) }
+
+func (c *fakeCounter) Add(delta float64) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.values[c.label] += delta
+}
+
+func newTestManager(t *testing.T, opts ...ManagerOption) *connManager {
+	m := newConnManager()
+	m.dial = func(ctx context.Context, target string) (*grpc.ClientConn, error) {
+		return grpc.NewClient("passthrough:///127.0.0.1:1", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	for _, o := range append([]ManagerOption{WatchDiscovery(false), CheckInterval(time.Hour)}, opts...) {
+		o(m.opts)
+	}
+	t.Cleanup(m.cancel)
+	return m
+}
+
+func TestManagerAcquire(t *testing.T) {
+	conns := newFakeGauge()
+	streams := newFakeGauge()
+	m := newTestManager(t, DirectPool(1, 2, 2), WithConnsGauge(conns), WithStreamsGauge(streams))
+
+	const addr = "grpc://127.0.0.1:1"
+	held := make([]Conn, 0)
+	for i := 0; i < 4; i++ {
+		c, err := m.Acquire(context.Background(), addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		held = append(held, c)
+	}
+
+	m.report()
+	if n := conns.get(addr); n != 2 {
+		t.Fatalf("conns = %v, want 2", n)
+	}
+	if n := streams.get(addr); n != 4 {
+		t.Fatalf("streams = %v, want 4", n)
+	}
+
+	srv, err := m.Acquire(context.Background(), "gamesrv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv2, _ := m.Acquire(context.Background(), "gamesrv")
+	if srv.Value() != srv2.Value() {
+		t.Fatal("service target should share one client conn")
+	}
+	srv.Close()
+	srv2.Close()
+
+	for _, c := range held {
+		c.Close()
+		c.Close() // 重复 Close 不影响计数
+	}
+
+	m.report()
+	if n := streams.get(addr); n != 0 {
+		t.Fatalf("streams = %v, want 0", n)
+	}
+	if len(m.Stats()) != 2 {
+		t.Fatalf("stats = %v", m.Stats())
+	}
+}
+
+func TestManagerReap(t *testing.T) {
+	closed := &fakeCounter{lk: &sync.Mutex{}, values: make(map[string]float64)}
+	m := newTestManager(t, IdleTimeout(time.Minute), WithClosedCounter(closed))
+
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	const addr = "grpc://127.0.0.1:1"
+	busy, err := m.Acquire(context.Background(), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idle, _ := m.Acquire(context.Background(), "gamesrv")
+	idle.Close()
+
+	now = now.Add(2 * time.Minute)
+	m.reap()
+	if len(m.Stats()) != 1 {
+		t.Fatalf("idle conn should be reaped, stats = %v", m.Stats())
+	}
+
+	// 实例下线，请求结束之后才关闭
+	m.remove(map[string]struct{}{addr: {}})
+	m.remove(map[string]struct{}{})
+	if len(m.Stats()) != 0 {
+		t.Fatalf("removed conn should be deleted, stats = %v", m.Stats())
+	}
+	m.reap()
+	if closed.values[addr+"|"+closeRemoved] != 0 {
+		t.Fatal("busy conn should not be closed")
+	}
+
+	busy.Close()
+	m.reap()
+	if closed.values[addr+"|"+closeRemoved] != 1 || closed.values["gamesrv|"+closeIdle] != 1 {
+		t.Fatalf("closed = %v", closed.values)
+	}
+}
+
+func TestManagerRemoveExplicit(t *testing.T) {
+	m := newTestManager(t)
+
+	// 不在服务发现中的地址不会因为服务发现的变化被移除
+	const addr = "grpc://127.0.0.1:2"
+	c, err := m.Acquire(context.Background(), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	m.remove(map[string]struct{}{"grpc://127.0.0.1:1": {}})
+	m.remove(map[string]struct{}{})
+	if len(m.Stats()) != 1 {
+		t.Fatalf("explicit addr should not be removed, stats = %v", m.Stats())
+	}
+}
+
+func TestManagerAcquireReap(t *testing.T) {
+	m := newTestManager(t, IdleTimeout(0))
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				m.reap()
+			}
+		}
+	}()
+
+	for i := 0; i < 1000; i++ {
+		c, err := m.Acquire(context.Background(), "gamesrv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Value().GetState() == connectivity.Shutdown {
+			t.Fatal("acquired conn closed by reap")
+		}
+		c.Close()
+	}
+	close(stop)
+	<-done
+}
+
+func TestManagerPin(t *testing.T) {
+	m := newTestManager(t, IdleTimeout(0))
+
+	const addr = "grpc://127.0.0.1:1"
+	cc, err := m.Pin(context.Background(), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc2, _ := m.Pin(context.Background(), addr)
+	if cc != cc2 {
+		t.Fatal("pinned conn should be shared")
+	}
+
+	// 不在服务发现中的地址和服务名不会被关闭
+	explicit, _ := m.Pin(context.Background(), "grpc://127.0.0.1:2")
+	srv, _ := m.Pin(context.Background(), "gamesrv")
+	m.reap()
+	if cc.GetState() == connectivity.Shutdown {
+		t.Fatal("pinned conn should not be closed by idle")
+	}
+
+	// 实例下线后关闭
+	m.remove(map[string]struct{}{addr: {}})
+	m.remove(map[string]struct{}{})
+	m.reap()
+	if cc.GetState() != connectivity.Shutdown {
+		t.Fatal("pinned conn should be closed after removed from discovery")
+	}
+	if explicit.GetState() == connectivity.Shutdown || srv.GetState() == connectivity.Shutdown {
+		t.Fatal("undiscovered pinned conn should not be closed")
+	}
+	if cc2, _ = m.Pin(context.Background(), addr); cc2 == cc {
+		t.Fatal("expect new pinned conn")
+	}
+}
@@ -0,0 +1,21 @@
+package arpc
+
+import (
+	"errors"
+
+	"github.com/lightmen/nami/presence"
+)
+
+// ErrOffline 设置了在线状态服务时，Notify 的玩家不在线
+var ErrOffline = errors.New("arpc: player offline")
+
+var gPresence presence.Presence
+
+// SetPresence 设置在线状态服务，设置后 Notify 根据玩家所在的网关直接发送
+func SetPresence(p presence.Presence) {
+	gPresence = p
+}
+
+func GetPresence() presence.Presence {
+	return gPresence
+}
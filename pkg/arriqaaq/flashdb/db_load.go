@@ -1,12 +1,13 @@
 package flashdb
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/lightmen/nami/pkg/arriqaaq/aol"
 )
 
-// load String, Hash, Set and ZSet stores from append-only log
+// load String, Hash, Set, ZSet and List stores from append-only log
 func (db *FlashDB) load() error {
 	if db.log == nil {
 		return nil
@@ -54,6 +55,8 @@ func (db *FlashDB) loadRecord(r *record) (err error) {
 		err = db.buildSetRecord(r)
 	case ZSetRecord:
 		err = db.buildZsetRecord(r)
+	case ListRecord:
+		err = db.buildListRecord(r)
 	}
 	return
 }
@@ -168,3 +171,48 @@ func (db *FlashDB) buildZsetRecord(r *record) error {
 
 	return nil
 }
+
+func (db *FlashDB) buildListRecord(r *record) error {
+
+	key := string(r.meta.key)
+	member := string(r.meta.member)
+	value := string(r.meta.value)
+
+	switch r.getMark() {
+	case ListLPush:
+		db.listStore.LPush(key, member)
+		db.listStore.notify(key)
+	case ListRPush:
+		db.listStore.RPush(key, member)
+		db.listStore.notify(key)
+	case ListLPop:
+		db.listStore.LPop(key)
+	case ListRPop:
+		db.listStore.RPop(key)
+	case ListLTrim:
+		start, err := strconv.Atoi(member)
+		if err != nil {
+			return err
+		}
+		stop, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		db.listStore.LTrim(key, start, stop)
+	case ListLClear:
+		db.listStore.LClear(key)
+	case ListLExpire:
+		if r.timestamp < uint64(time.Now().Unix()) {
+			db.listStore.LClear(key)
+		} else {
+			db.setTTL(List, key, int64(r.timestamp))
+		}
+	}
+
+	// an empty list is removed together with its ttl
+	if !db.listStore.LKeyExists(key) {
+		db.exps.HDel(List, key)
+	}
+
+	return nil
+}
@@ -16,6 +16,7 @@ var (
 	ErrTxClosed       = errors.New("tx closed")
 	ErrDatabaseClosed = errors.New("database closed")
 	ErrTxNotWritable  = errors.New("tx not writable")
+	ErrPopTimeout     = errors.New("blocking pop timeout")
 )
 
 type (
@@ -32,6 +33,7 @@ type (
 		hashStore *hashStore
 		setStore  *setStore
 		zsetStore *zsetStore
+		listStore *listStore
 
 		evictors []evictor // background manager to delete keys periodically
 	}
@@ -47,6 +49,7 @@ func New(config *Config) (*FlashDB, error) {
 		setStore:  newSetStore(),
 		hashStore: newHashStore(),
 		zsetStore: newZSetStore(),
+		listStore: newListStore(),
 		exps:      hash.New(),
 	}
 
@@ -57,6 +60,7 @@ func New(config *Config) (*FlashDB, error) {
 			newSweeperWithStore(db.setStore, evictionInterval),
 			newSweeperWithStore(db.hashStore, evictionInterval),
 			newSweeperWithStore(db.zsetStore, evictionInterval),
+			newSweeperWithStore(db.listStore, evictionInterval),
 		}
 		for _, evictor := range db.evictors {
 			go evictor.run(db.exps)
@@ -125,6 +129,9 @@ func (db *FlashDB) evict(key string, dType DataType) {
 		case ZSet:
 			r = newRecord([]byte(key), nil, ZSetRecord, ZSetZClear)
 			db.zsetStore.ZClear(key)
+		case List:
+			r = newRecord([]byte(key), nil, ListRecord, ListLClear)
+			db.listStore.LClear(key)
 		}
 
 		if err := db.write(r); err != nil {
@@ -137,6 +144,8 @@ func (db *FlashDB) evict(key string, dType DataType) {
 
 func (db *FlashDB) Close() error {
 	db.closed = true
+	// wake up blocking pops so they can return ErrDatabaseClosed
+	db.listStore.close()
 	for _, evictor := range db.evictors {
 		evictor.stop()
 	}
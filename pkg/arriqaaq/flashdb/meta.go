@@ -7,6 +7,7 @@ const (
 	Hash   DataType = "Hash"
 	Set    DataType = "Set"
 	ZSet   DataType = "ZSet"
+	List   DataType = "List"
 )
 
 const (
@@ -14,6 +15,7 @@ const (
 	HashRecord
 	SetRecord
 	ZSetRecord
+	ListRecord
 )
 
 // The operations on Strings.
@@ -48,3 +50,14 @@ const (
 	ZSetZExpire
 	ZSetZRemByRank
 )
+
+// The operations on List.
+const (
+	ListLPush uint16 = iota
+	ListRPush
+	ListLPop
+	ListRPop
+	ListLTrim
+	ListLClear
+	ListLExpire
+)
@@ -6,6 +6,7 @@ import (
 
 	"github.com/lightmen/nami/pkg/arriqaaq/art"
 	"github.com/lightmen/nami/pkg/arriqaaq/hash"
+	"github.com/lightmen/nami/pkg/arriqaaq/list"
 	"github.com/lightmen/nami/pkg/arriqaaq/set"
 	"github.com/lightmen/nami/pkg/arriqaaq/zset"
 )
@@ -15,6 +16,7 @@ var (
 	_ store = &setStore{}
 	_ store = &zsetStore{}
 	_ store = &hashStore{}
+	_ store = &listStore{}
 )
 
 type store interface {
@@ -174,3 +176,110 @@ func (z *zsetStore) evict(cache *hash.Hash) {
 		cache.HDel(ZSet, k)
 	}
 }
+
+type listStore struct {
+	sync.RWMutex
+	*list.List
+
+	wmu     sync.Mutex
+	waiters map[string]map[*listWaiter]struct{} // blocking pops waiting on each key
+	closed  bool
+}
+
+// listWaiter is woken up when any of the keys it waits on is pushed.
+type listWaiter struct {
+	once sync.Once
+	c    chan struct{}
+}
+
+func (w *listWaiter) wake() {
+	w.once.Do(func() { close(w.c) })
+}
+
+func newListStore() *listStore {
+	n := &listStore{}
+	n.List = list.New()
+	n.waiters = make(map[string]map[*listWaiter]struct{})
+	return n
+}
+
+// wait registers a waiter on keys. The waiter must be removed with unwait
+// once it is done.
+func (l *listStore) wait(keys ...string) *listWaiter {
+	w := &listWaiter{c: make(chan struct{})}
+
+	l.wmu.Lock()
+	defer l.wmu.Unlock()
+
+	if l.closed {
+		w.wake()
+		return w
+	}
+	for _, k := range keys {
+		if l.waiters[k] == nil {
+			l.waiters[k] = make(map[*listWaiter]struct{})
+		}
+		l.waiters[k][w] = struct{}{}
+	}
+	return w
+}
+
+func (l *listStore) unwait(w *listWaiter, keys ...string) {
+	l.wmu.Lock()
+	defer l.wmu.Unlock()
+
+	for _, k := range keys {
+		delete(l.waiters[k], w)
+		if len(l.waiters[k]) == 0 {
+			delete(l.waiters, k)
+		}
+	}
+}
+
+// notify wakes up all the waiters on key.
+func (l *listStore) notify(key string) {
+	l.wmu.Lock()
+	defer l.wmu.Unlock()
+
+	for w := range l.waiters[key] {
+		w.wake()
+	}
+	delete(l.waiters, key)
+}
+
+// close wakes up all the waiters, and the ones registered later return at once.
+func (l *listStore) close() {
+	l.wmu.Lock()
+	defer l.wmu.Unlock()
+
+	l.closed = true
+	for k, ws := range l.waiters {
+		for w := range ws {
+			w.wake()
+		}
+		delete(l.waiters, k)
+	}
+}
+
+func (l *listStore) evict(cache *hash.Hash) {
+	l.Lock()
+	defer l.Unlock()
+
+	keys := l.Keys()
+	expiredKeys := make([]string, 0, 1)
+
+	for _, k := range keys {
+		ttl := cache.HGet(List, k)
+		if ttl == nil {
+			continue
+		}
+		if time.Now().Unix() > ttl.(int64) {
+			expiredKeys = append(expiredKeys, k)
+		}
+	}
+
+	for _, k := range expiredKeys {
+		l.LClear(k)
+		cache.HDel(List, k)
+	}
+}
@@ -0,0 +1,266 @@
+package flashdb
+
+import (
+	"strconv"
+	"time"
+)
+
+// listUndo keeps a list as it was before the first modification in a tx. List
+// operations are applied when they are called, so that pops return what the
+// previous operations in the same tx left, and are reverted on rollback.
+type listUndo struct {
+	values []interface{}
+	ttl    interface{}
+}
+
+// LPush inserts the values at the head of the list stored at key. It returns
+// the length of the list after the push.
+func (tx *Tx) LPush(key string, values ...string) (int, error) {
+	return tx.push(key, ListLPush, values)
+}
+
+// RPush inserts the values at the tail of the list stored at key. It returns
+// the length of the list after the push.
+func (tx *Tx) RPush(key string, values ...string) (int, error) {
+	return tx.push(key, ListRPush, values)
+}
+
+// LPop removes and returns the first element of the list stored at key. ok is
+// false when the list is empty. If the key has expired, the key is evicted.
+func (tx *Tx) LPop(key string) (value string, ok bool, err error) {
+	return tx.pop(key, ListLPop)
+}
+
+// RPop removes and returns the last element of the list stored at key. ok is
+// false when the list is empty. If the key has expired, the key is evicted.
+func (tx *Tx) RPop(key string) (value string, ok bool, err error) {
+	return tx.pop(key, ListRPop)
+}
+
+// LRange returns the elements between start and stop (both inclusive) of the
+// list stored at key. Negative indexes count from the tail, -1 being the last
+// element. If the key has expired, the key is evicted.
+func (tx *Tx) LRange(key string, start, stop int) (values []string) {
+	if tx.db.hasExpired(key, List) {
+		tx.db.evict(key, List)
+		return nil
+	}
+
+	vals := tx.db.listStore.LRange(key, start, stop)
+	for _, v := range vals {
+		values = append(values, toString(v))
+	}
+	return
+}
+
+// LTrim trims the list stored at key so that it only contains the elements
+// between start and stop (both inclusive).
+func (tx *Tx) LTrim(key string, start, stop int) error {
+	if err := tx.modifyList(key); err != nil {
+		return err
+	}
+
+	e := newRecordWithValue([]byte(key), []byte(strconv.Itoa(start)), []byte(strconv.Itoa(stop)), ListRecord, ListLTrim)
+	return tx.applyList(e)
+}
+
+// LLen returns the length of the list stored at key. If the key has expired,
+// the key is evicted.
+func (tx *Tx) LLen(key string) int {
+	if tx.db.hasExpired(key, List) {
+		tx.db.evict(key, List)
+		return 0
+	}
+	return tx.db.listStore.LLen(key)
+}
+
+// LKeyExists returns if the key exists. If the key has expired, the key is
+// evicted.
+func (tx *Tx) LKeyExists(key string) (ok bool) {
+	if tx.db.hasExpired(key, List) {
+		tx.db.evict(key, List)
+		return
+	}
+	return tx.db.listStore.LKeyExists(key)
+}
+
+// LClear removes the list stored at key.
+func (tx *Tx) LClear(key string) error {
+	if !tx.LKeyExists(key) {
+		return ErrInvalidKey
+	}
+	if err := tx.modifyList(key); err != nil {
+		return err
+	}
+
+	e := newRecord([]byte(key), nil, ListRecord, ListLClear)
+	return tx.applyList(e)
+}
+
+// LExpire sets expire time at key. duration should be more than zero.
+func (tx *Tx) LExpire(key string, duration int64) error {
+	if duration <= 0 {
+		return ErrInvalidTTL
+	}
+	if !tx.LKeyExists(key) {
+		return ErrInvalidKey
+	}
+	if err := tx.modifyList(key); err != nil {
+		return err
+	}
+
+	ttl := time.Now().Unix() + duration
+	e := newRecordWithExpire([]byte(key), nil, ttl, ListRecord, ListLExpire)
+	return tx.applyList(e)
+}
+
+// LTTL returns the remaining TTL of the given key.
+func (tx *Tx) LTTL(key string) (ttl int64) {
+	if !tx.LKeyExists(key) {
+		return
+	}
+
+	deadline := tx.db.getTTL(List, key)
+	if deadline == nil {
+		return
+	}
+	return deadline.(int64) - time.Now().Unix()
+}
+
+func (tx *Tx) push(key string, mark uint16, values []string) (int, error) {
+	if err := tx.modifyList(key); err != nil {
+		return 0, err
+	}
+
+	for _, v := range values {
+		e := newRecord([]byte(key), []byte(v), ListRecord, mark)
+		if err := tx.applyList(e); err != nil {
+			return 0, err
+		}
+	}
+	return tx.db.listStore.LLen(key), nil
+}
+
+func (tx *Tx) pop(key string, mark uint16) (value string, ok bool, err error) {
+	if err = tx.modifyList(key); err != nil {
+		return
+	}
+
+	var vals []interface{}
+	if mark == ListLPop {
+		vals = tx.db.listStore.LRange(key, 0, 0)
+	} else {
+		vals = tx.db.listStore.LRange(key, -1, -1)
+	}
+	if len(vals) == 0 {
+		return
+	}
+
+	e := newRecord([]byte(key), nil, ListRecord, mark)
+	if err = tx.applyList(e); err != nil {
+		return
+	}
+	return toString(vals[0]), true, nil
+}
+
+// modifyList evicts the expired key and saves the list for rollback before the
+// first modification in the tx.
+func (tx *Tx) modifyList(key string) error {
+	if tx.db == nil {
+		return ErrTxClosed
+	} else if !tx.writable {
+		return ErrTxNotWritable
+	}
+
+	if tx.db.hasExpired(key, List) {
+		tx.db.evict(key, List)
+	}
+
+	if tx.wc.lists == nil {
+		tx.wc.lists = make(map[string]*listUndo)
+	}
+	if _, ok := tx.wc.lists[key]; !ok {
+		tx.wc.lists[key] = &listUndo{
+			values: tx.db.listStore.LRange(key, 0, -1),
+			ttl:    tx.db.getTTL(List, key),
+		}
+	}
+	return nil
+}
+
+// applyList applies the record to the list store at once, and writes it to
+// the append-only log on commit.
+func (tx *Tx) applyList(r *record) error {
+	if err := tx.db.buildListRecord(r); err != nil {
+		return err
+	}
+	tx.addRecord(r)
+	return nil
+}
+
+func (tx *Tx) rollbackLists() {
+	for key, undo := range tx.wc.lists {
+		tx.db.listStore.LClear(key)
+		if len(undo.values) > 0 {
+			tx.db.listStore.RPush(key, undo.values...)
+		}
+		if undo.ttl != nil {
+			tx.db.exps.HSet(List, key, undo.ttl)
+		} else {
+			tx.db.exps.HDel(List, key)
+		}
+	}
+	tx.wc.lists = nil
+}
+
+// BLPop removes and returns the first element of the first non-empty list
+// among keys, blocking until an element is pushed or timeout elapses. A zero
+// timeout blocks indefinitely. ErrPopTimeout is returned on timeout.
+func (db *FlashDB) BLPop(timeout time.Duration, keys ...string) (key, value string, err error) {
+	return db.bpop(timeout, ListLPop, keys)
+}
+
+// BRPop is like BLPop but pops from the tail of the lists.
+func (db *FlashDB) BRPop(timeout time.Duration, keys ...string) (key, value string, err error) {
+	return db.bpop(timeout, ListRPop, keys)
+}
+
+func (db *FlashDB) bpop(timeout time.Duration, mark uint16, keys []string) (key, value string, err error) {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		var ok bool
+		var w *listWaiter
+		err = db.Update(func(tx *Tx) error {
+			for _, k := range keys {
+				v, popped, err := tx.pop(k, mark)
+				if err != nil {
+					return err
+				}
+				if popped {
+					key, value, ok = k, v, true
+					return nil
+				}
+			}
+			// register while holding the lock, so that a push can't be missed
+			w = db.listStore.wait(keys...)
+			return nil
+		})
+		if err != nil || ok {
+			return
+		}
+
+		select {
+		case <-w.c:
+			db.listStore.unwait(w, keys...)
+		case <-deadline:
+			db.listStore.unwait(w, keys...)
+			return "", "", ErrPopTimeout
+		}
+	}
+}
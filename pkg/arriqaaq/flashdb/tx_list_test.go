@@ -0,0 +1,205 @@
+package flashdb
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlashDB_LPushPop(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	if err := db.Update(func(tx *Tx) error {
+		n, err := tx.RPush(testKey, "b", "c")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+		n, err = tx.LPush(testKey, "a")
+		assert.NoError(t, err)
+		assert.Equal(t, 3, n)
+
+		// pops see the pushes of the same tx
+		val, ok, err := tx.RPop(testKey)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "c", val)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	db.View(func(tx *Tx) error {
+		assert.Equal(t, 2, tx.LLen(testKey))
+		assert.Equal(t, []string{"a", "b"}, tx.LRange(testKey, 0, -1))
+		_, _, err := tx.LPop(testKey)
+		assert.Equal(t, ErrTxNotWritable, err)
+		return nil
+	})
+
+	db.Update(func(tx *Tx) error {
+		val, ok, _ := tx.LPop(testKey)
+		assert.True(t, ok)
+		assert.Equal(t, "a", val)
+		val, ok, _ = tx.LPop(testKey)
+		assert.True(t, ok)
+		assert.Equal(t, "b", val)
+		_, ok, _ = tx.LPop(testKey)
+		assert.False(t, ok)
+		assert.False(t, tx.LKeyExists(testKey))
+		return nil
+	})
+}
+
+func TestFlashDB_LTrim(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	db.Update(func(tx *Tx) error {
+		tx.RPush(testKey, "1", "2", "3", "4", "5")
+		assert.NoError(t, tx.LTrim(testKey, 1, -2))
+		return nil
+	})
+
+	db.View(func(tx *Tx) error {
+		assert.Equal(t, []string{"2", "3", "4"}, tx.LRange(testKey, 0, -1))
+		assert.Equal(t, []string{"4"}, tx.LRange(testKey, -1, -1))
+		return nil
+	})
+}
+
+func TestFlashDB_LRollback(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	db.Update(func(tx *Tx) error {
+		tx.RPush(testKey, "1", "2")
+		return tx.LExpire(testKey, 100)
+	})
+
+	errRollback := errors.New("rollback")
+	err := db.Update(func(tx *Tx) error {
+		tx.LPop(testKey)
+		tx.LPop(testKey)
+		tx.RPush(testKey, "3")
+		return errRollback
+	})
+	assert.Equal(t, errRollback, err)
+
+	db.View(func(tx *Tx) error {
+		assert.Equal(t, []string{"1", "2"}, tx.LRange(testKey, 0, -1))
+		assert.True(t, tx.LTTL(testKey) > 0)
+		return nil
+	})
+}
+
+func TestFlashDB_LExpire(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	db.Update(func(tx *Tx) error {
+		assert.Equal(t, ErrInvalidKey, tx.LExpire(testKey, 1))
+		tx.RPush(testKey, "1")
+		assert.Equal(t, ErrInvalidTTL, tx.LExpire(testKey, 0))
+		assert.NoError(t, tx.LExpire(testKey, 1))
+		return nil
+	})
+
+	db.View(func(tx *Tx) error {
+		ttl := tx.LTTL(testKey)
+		assert.True(t, ttl > 0 && ttl <= 1)
+		return nil
+	})
+
+	time.Sleep(2 * time.Second)
+	db.Update(func(tx *Tx) error {
+		assert.Equal(t, 0, tx.LLen(testKey))
+
+		// the ttl is removed together with the list
+		tx.RPush(testKey, "2")
+		assert.Equal(t, int64(0), tx.LTTL(testKey))
+		return nil
+	})
+}
+
+func TestFlashDB_LLoad(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	db.Update(func(tx *Tx) error {
+		tx.RPush(testKey, "1", "2", "3", "4", "5")
+		tx.LPush(testKey, "0")
+		tx.LPop(testKey)
+		tx.RPop(testKey)
+		tx.LTrim(testKey, 1, -1)
+		return nil
+	})
+	db.Update(func(tx *Tx) error {
+		tx.RPush("expire", "1")
+		return tx.LExpire("expire", 100)
+	})
+	db.Update(func(tx *Tx) error {
+		tx.LPop(testKey)
+		return errors.New("rollback")
+	})
+	db.Close()
+
+	db2 := getTestDB()
+	defer db2.Close()
+
+	db2.View(func(tx *Tx) error {
+		assert.Equal(t, []string{"2", "3", "4"}, tx.LRange(testKey, 0, -1))
+		assert.True(t, tx.LTTL("expire") > 0)
+		return nil
+	})
+}
+
+func TestFlashDB_BLPop(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	_, _, err := db.BLPop(50*time.Millisecond, testKey)
+	assert.Equal(t, ErrPopTimeout, err)
+
+	db.Update(func(tx *Tx) error {
+		tx.RPush("other", "1", "2")
+		return nil
+	})
+	key, val, err := db.BRPop(time.Second, testKey, "other")
+	assert.NoError(t, err)
+	assert.Equal(t, "other", key)
+	assert.Equal(t, "2", val)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		db.Update(func(tx *Tx) error {
+			tx.RPush(testKey, "a")
+			return nil
+		})
+	}()
+	key, val, err = db.BLPop(0, "none", testKey)
+	assert.NoError(t, err)
+	assert.Equal(t, testKey, key)
+	assert.Equal(t, "a", val)
+
+	done := make(chan error)
+	go func() {
+		_, _, err := db.BLPop(0, "none")
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	db.Close()
+	select {
+	case err = <-done:
+		assert.Equal(t, ErrDatabaseClosed, err)
+	case <-time.After(time.Second):
+		t.Fatal("BLPop not woken up by Close")
+	}
+}
@@ -21,7 +21,8 @@ func (tx *Tx) addRecord(r *record) {
 }
 
 type txWriteContext struct {
-	commitItems []*record // details for committing tx.
+	commitItems []*record            // details for committing tx.
+	lists       map[string]*listUndo // lists modified in tx, restored on rollback.
 }
 
 // lock locks the database based on the transaction type.
@@ -170,6 +171,7 @@ func (tx *Tx) Rollback() error {
 // Intended to be called from Commit() and Rollback().
 func (tx *Tx) rollback() {
 	tx.wc.commitItems = nil
+	tx.rollbackLists()
 }
 
 func (tx *Tx) buildRecords(recs []*record) (err error) {
@@ -183,6 +185,8 @@ func (tx *Tx) buildRecords(recs []*record) (err error) {
 			err = tx.db.buildSetRecord(r)
 		case ZSetRecord:
 			err = tx.db.buildZsetRecord(r)
+		case ListRecord:
+			// list operations have been applied when they were called
 		}
 	}
 	return
@@ -0,0 +1,182 @@
+package list
+
+import (
+	"container/list"
+)
+
+type (
+	List struct {
+		records map[string]*list.List
+	}
+)
+
+/*
+Related commands
+
+LPUSH
+RPUSH
+LPOP
+RPOP
+LRANGE
+LTRIM
+LLEN
+*/
+
+func New() *List {
+	return &List{
+		records: make(map[string]*list.List),
+	}
+}
+
+func (l *List) Keys() []string {
+	keys := make([]string, 0, len(l.records))
+
+	for k := range l.records {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// LPush inserts the values at the head of the list stored at key, and returns
+// the length of the list after the push.
+func (l *List) LPush(key string, values ...interface{}) int {
+	lst := l.getOrCreate(key)
+	for _, v := range values {
+		lst.PushFront(v)
+	}
+	return lst.Len()
+}
+
+// RPush inserts the values at the tail of the list stored at key, and returns
+// the length of the list after the push.
+func (l *List) RPush(key string, values ...interface{}) int {
+	lst := l.getOrCreate(key)
+	for _, v := range values {
+		lst.PushBack(v)
+	}
+	return lst.Len()
+}
+
+// LPop removes and returns the first element of the list stored at key. The
+// key is removed when the list becomes empty.
+func (l *List) LPop(key string) (interface{}, bool) {
+	if !l.exists(key) {
+		return nil, false
+	}
+	return l.remove(key, l.records[key].Front()), true
+}
+
+// RPop removes and returns the last element of the list stored at key. The
+// key is removed when the list becomes empty.
+func (l *List) RPop(key string) (interface{}, bool) {
+	if !l.exists(key) {
+		return nil, false
+	}
+	return l.remove(key, l.records[key].Back()), true
+}
+
+// LRange returns the elements between start and stop (both inclusive). Negative
+// indexes count from the tail, -1 being the last element.
+func (l *List) LRange(key string, start, stop int) (res []interface{}) {
+	if !l.exists(key) {
+		return
+	}
+
+	lst := l.records[key]
+	start, stop, ok := bounds(lst.Len(), start, stop)
+	if !ok {
+		return
+	}
+
+	res = make([]interface{}, 0, stop-start+1)
+	e := lst.Front()
+	for i := 0; i < start; i++ {
+		e = e.Next()
+	}
+	for i := start; i <= stop; i++ {
+		res = append(res, e.Value)
+		e = e.Next()
+	}
+	return
+}
+
+// LTrim trims the list stored at key so that it only contains the elements
+// between start and stop (both inclusive). The key is removed when the range
+// is empty.
+func (l *List) LTrim(key string, start, stop int) {
+	if !l.exists(key) {
+		return
+	}
+
+	lst := l.records[key]
+	start, stop, ok := bounds(lst.Len(), start, stop)
+	if !ok {
+		l.LClear(key)
+		return
+	}
+
+	for i := lst.Len() - 1; i > stop; i-- {
+		lst.Remove(lst.Back())
+	}
+	for i := 0; i < start; i++ {
+		lst.Remove(lst.Front())
+	}
+}
+
+func (l *List) LLen(key string) int {
+	if !l.exists(key) {
+		return 0
+	}
+	return l.records[key].Len()
+}
+
+func (l *List) LClear(key string) {
+	delete(l.records, key)
+}
+
+func (l *List) LKeyExists(key string) bool {
+	return l.exists(key)
+}
+
+func (l *List) exists(key string) bool {
+	_, exist := l.records[key]
+	return exist
+}
+
+func (l *List) getOrCreate(key string) *list.List {
+	if !l.exists(key) {
+		l.records[key] = list.New()
+	}
+	return l.records[key]
+}
+
+func (l *List) remove(key string, e *list.Element) interface{} {
+	lst := l.records[key]
+	v := lst.Remove(e)
+	if lst.Len() == 0 {
+		delete(l.records, key)
+	}
+	return v
+}
+
+// bounds converts start and stop to valid indexes of a list with size elements,
+// ok is false when the range is empty.
+func bounds(size, start, stop int) (int, int, bool) {
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start > stop || start >= size {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
@@ -0,0 +1,57 @@
+package list
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testKey = "test_list"
+
+func TestList_PushPop(t *testing.T) {
+	l := New()
+	assert.Equal(t, 2, l.RPush(testKey, "b", "c"))
+	assert.Equal(t, 4, l.LPush(testKey, "a", "z"))
+	assert.Equal(t, []interface{}{"z", "a", "b", "c"}, l.LRange(testKey, 0, -1))
+
+	v, ok := l.LPop(testKey)
+	assert.True(t, ok)
+	assert.Equal(t, "z", v)
+	v, ok = l.RPop(testKey)
+	assert.True(t, ok)
+	assert.Equal(t, "c", v)
+	assert.Equal(t, 2, l.LLen(testKey))
+
+	l.LPop(testKey)
+	l.LPop(testKey)
+	assert.False(t, l.LKeyExists(testKey))
+	_, ok = l.RPop(testKey)
+	assert.False(t, ok)
+	assert.Empty(t, l.Keys())
+}
+
+func TestList_LRange(t *testing.T) {
+	l := New()
+	l.RPush(testKey, 0, 1, 2, 3, 4)
+
+	assert.Equal(t, []interface{}{1, 2, 3}, l.LRange(testKey, 1, 3))
+	assert.Equal(t, []interface{}{3, 4}, l.LRange(testKey, -2, -1))
+	assert.Equal(t, []interface{}{0, 1, 2, 3, 4}, l.LRange(testKey, -100, 100))
+	assert.Nil(t, l.LRange(testKey, 3, 1))
+	assert.Nil(t, l.LRange(testKey, 5, 10))
+	assert.Nil(t, l.LRange("none", 0, -1))
+}
+
+func TestList_LTrim(t *testing.T) {
+	l := New()
+	l.RPush(testKey, 0, 1, 2, 3, 4)
+
+	l.LTrim(testKey, 1, -2)
+	assert.Equal(t, []interface{}{1, 2, 3}, l.LRange(testKey, 0, -1))
+
+	l.LTrim(testKey, 0, 0)
+	assert.Equal(t, []interface{}{1}, l.LRange(testKey, 0, -1))
+
+	l.LTrim(testKey, 1, 0)
+	assert.False(t, l.LKeyExists(testKey))
+}
@@ -0,0 +1,442 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/lightmen/nami/alog"
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrNotFound 数据不存在，Loader 返回该错误时会缓存 NegativeTTL
+var ErrNotFound = errors.New("cache: not found")
+
+// Loader 缓存没有命中时从数据源加载
+type Loader[V any] func(ctx context.Context, key string) (V, error)
+
+// Writer 批量写回数据源
+type Writer[V any] func(ctx context.Context, items map[string]V) error
+
+const (
+	remoteNotFound byte = iota // 远端缓存中记录数据不存在
+	remoteValue
+)
+
+// loadState 正在加载的 key，加载期间被 Set 或者失效时不再写回缓存
+type loadState struct {
+	stale bool
+}
+
+type entry[V any] struct {
+	val   V
+	found bool
+}
+
+func (e *entry[V]) result() (val V, err error) {
+	if !e.found {
+		err = ErrNotFound
+		return
+	}
+	return e.val, nil
+}
+
+// Cache 两级缓存：本地缓存 -> 远端缓存 -> Loader。
+// 相同 key 的并发加载合并为一次，数据不存在时也会缓存，过期时间随机增加避免同时失效
+type Cache[V any] struct {
+	name   string
+	opts   *options
+	loader Loader[V]
+	group  singleflight.Group
+
+	lk      sync.Mutex
+	loading map[string]*loadState
+	writing map[string]int // 正在 Set 的 key，期间开始的加载可能从远端读到旧数据
+
+	writer   Writer[V]
+	wlk      sync.Mutex
+	dirty    map[string]V
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// New 创建名字为 name 的缓存，loader 为 nil 时只读取缓存
+func New[V any](name string, loader Loader[V], opts ...Option) *Cache[V] {
+	c := &Cache[V]{
+		name:    name,
+		opts:    defaultOptions(name),
+		loader:  loader,
+		loading: make(map[string]*loadState),
+		writing: make(map[string]int),
+		stop:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c.opts)
+	}
+
+	if c.opts.invalidator != nil {
+		c.opts.invalidator.Subscribe(name, c.Invalidate)
+	}
+	return c
+}
+
+// Name 返回缓存的名字
+func (c *Cache[V]) Name() string {
+	return c.name
+}
+
+// Get 获取数据，没有命中时从远端缓存或者 Loader 加载，数据不存在时返回 ErrNotFound。
+// 合并的加载不受单个调用方 ctx 取消的影响，使用 WithLoadTimeout 的超时时间
+func (c *Cache[V]) Get(ctx context.Context, key string) (val V, err error) {
+	if e, ok := c.getLocal(key); ok {
+		c.stat("local")
+		return e.result()
+	}
+
+	ch := c.group.DoChan(key, func() (any, error) {
+		lctx := context.WithoutCancel(ctx)
+		if c.opts.loadTimeout > 0 {
+			var cancel context.CancelFunc
+			lctx, cancel = context.WithTimeout(lctx, c.opts.loadTimeout)
+			defer cancel()
+		}
+		return c.load(lctx, key)
+	})
+
+	select {
+	case r := <-ch:
+		if r.Err != nil {
+			c.stat("error")
+			err = r.Err
+			return
+		}
+		return r.Val.(*entry[V]).result()
+	case <-ctx.Done():
+		c.stat("error")
+		err = ctx.Err()
+		return
+	}
+}
+
+func (c *Cache[V]) load(ctx context.Context, key string) (*entry[V], error) {
+	st := c.beginLoad(key)
+	defer c.endLoad(key, st)
+
+	if e, ok := c.getRemote(ctx, key); ok {
+		c.stat("remote")
+		c.commitLoad(key, st, e)
+		return e, nil
+	}
+
+	if c.loader == nil {
+		c.stat("miss")
+		return &entry[V]{}, nil
+	}
+
+	val, err := c.loader(ctx, key)
+	e := &entry[V]{val: val, found: true}
+	if errors.Is(err, ErrNotFound) {
+		if c.opts.negativeTTL <= 0 {
+			c.stat("miss")
+			return &entry[V]{}, nil
+		}
+		e = &entry[V]{}
+	} else if err != nil {
+		return nil, err
+	}
+
+	c.stat("load")
+	if !c.commitLoad(key, st, e) {
+		return e, nil
+	}
+	// 远端缓存中已经有数据时说明加载期间其他节点 Set 过，不覆盖
+	if err = c.setRemoteNX(ctx, key, e); err != nil {
+		alog.ErrorCtx(ctx, "[cache] %s|%s set remote error: %s", c.name, key, err.Error())
+	}
+	return e, nil
+}
+
+func (c *Cache[V]) beginLoad(key string) *loadState {
+	c.lk.Lock()
+	st := &loadState{stale: c.writing[key] > 0}
+	c.loading[key] = st
+	c.lk.Unlock()
+	return st
+}
+
+func (c *Cache[V]) endLoad(key string, st *loadState) {
+	c.lk.Lock()
+	if c.loading[key] == st {
+		delete(c.loading, key)
+	}
+	c.lk.Unlock()
+}
+
+// commitLoad 加载期间没有被 Set 或者失效时写入本地缓存，返回是否写入
+func (c *Cache[V]) commitLoad(key string, st *loadState, e *entry[V]) bool {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if st.stale {
+		return false
+	}
+	c.setLocal(key, e)
+	return true
+}
+
+// markStale 正在加载的数据已经过期，加载完成后不写回缓存，之后的 Get 不再合并到这次加载
+func (c *Cache[V]) markStale(key string) {
+	c.lk.Lock()
+	c.markStaleLocked(key)
+	c.lk.Unlock()
+}
+
+// markStaleLocked 调用时需持有锁
+func (c *Cache[V]) markStaleLocked(key string) {
+	if st, ok := c.loading[key]; ok {
+		st.stale = true
+		c.group.Forget(key)
+	}
+}
+
+// beginSet 开始 Set，之前和期间开始的加载都不写回缓存
+func (c *Cache[V]) beginSet(key string) {
+	c.lk.Lock()
+	c.writing[key]++
+	c.markStaleLocked(key)
+	c.lk.Unlock()
+}
+
+// endSet 远端缓存已经更新，之后的 Get 不再合并到 Set 期间开始的加载
+func (c *Cache[V]) endSet(key string) {
+	c.lk.Lock()
+	if c.writing[key]--; c.writing[key] <= 0 {
+		delete(c.writing, key)
+	}
+	c.markStaleLocked(key)
+	c.lk.Unlock()
+}
+
+// Set 更新缓存并通知其他节点，设置了 WriteBehind 时稍后批量写回数据源
+func (c *Cache[V]) Set(ctx context.Context, key string, val V) (err error) {
+	e := &entry[V]{val: val, found: true}
+	c.beginSet(key)
+	c.setLocal(key, e)
+	err = c.setRemote(ctx, key, e)
+	c.endSet(key)
+	if err != nil {
+		return
+	}
+
+	if c.writer != nil {
+		c.wlk.Lock()
+		c.dirty[key] = val
+		c.wlk.Unlock()
+	}
+	return c.publish(ctx, key)
+}
+
+// Delete 删除本地和远端缓存并通知其他节点，数据源中的数据需要调用方自己删除
+func (c *Cache[V]) Delete(ctx context.Context, keys ...string) (err error) {
+	c.Invalidate(keys)
+
+	if c.opts.remote != nil {
+		remoteKeys := make([]string, 0, len(keys))
+		for _, key := range keys {
+			remoteKeys = append(remoteKeys, c.opts.prefix+key)
+		}
+		if err = c.opts.remote.Delete(ctx, remoteKeys...); err != nil {
+			return
+		}
+	}
+	return c.publish(ctx, keys...)
+}
+
+// Invalidate 只删除本地缓存，收到其他节点的失效通知时调用
+func (c *Cache[V]) Invalidate(keys []string) {
+	for _, key := range keys {
+		c.markStale(key)
+	}
+	if c.opts.local == nil {
+		return
+	}
+	for _, key := range keys {
+		c.opts.local.Delete(key)
+	}
+}
+
+func (c *Cache[V]) publish(ctx context.Context, keys ...string) error {
+	if c.opts.invalidator == nil || len(keys) == 0 {
+		return nil
+	}
+	return c.opts.invalidator.Publish(ctx, c.name, keys...)
+}
+
+func (c *Cache[V]) getLocal(key string) (*entry[V], bool) {
+	if c.opts.local == nil {
+		return nil, false
+	}
+	v, ok := c.opts.local.Get(key)
+	if !ok {
+		return nil, false
+	}
+	e, ok := v.(*entry[V])
+	return e, ok
+}
+
+func (c *Cache[V]) setLocal(key string, e *entry[V]) {
+	if c.opts.local == nil {
+		return
+	}
+
+	ttl := c.opts.localTTL
+	if !e.found && c.opts.negativeTTL < ttl {
+		ttl = c.opts.negativeTTL
+	}
+	c.opts.local.Set(key, e, c.jitter(ttl))
+}
+
+func (c *Cache[V]) getRemote(ctx context.Context, key string) (*entry[V], bool) {
+	if c.opts.remote == nil {
+		return nil, false
+	}
+
+	// 远端缓存出错时降级为直接加载
+	data, ok, err := c.opts.remote.Get(ctx, c.opts.prefix+key)
+	if err != nil {
+		alog.ErrorCtx(ctx, "[cache] %s|%s get remote error: %s", c.name, key, err.Error())
+		return nil, false
+	}
+	if !ok || len(data) == 0 {
+		return nil, false
+	}
+
+	e := &entry[V]{}
+	if data[0] == remoteNotFound {
+		return e, true
+	}
+	if err = c.opts.codec.Unmarshal(data[1:], &e.val); err != nil {
+		alog.ErrorCtx(ctx, "[cache] %s|%s decode error: %s", c.name, key, err.Error())
+		return nil, false
+	}
+	e.found = true
+	return e, true
+}
+
+func (c *Cache[V]) setRemote(ctx context.Context, key string, e *entry[V]) error {
+	if c.opts.remote == nil {
+		return nil
+	}
+
+	data, ttl, err := c.encode(e)
+	if err != nil {
+		return err
+	}
+	return c.opts.remote.Set(ctx, c.opts.prefix+key, data, ttl)
+}
+
+// setRemoteNX 远端缓存中没有数据时才写入
+func (c *Cache[V]) setRemoteNX(ctx context.Context, key string, e *entry[V]) error {
+	if c.opts.remote == nil {
+		return nil
+	}
+
+	data, ttl, err := c.encode(e)
+	if err != nil {
+		return err
+	}
+	_, err = c.opts.remote.SetNX(ctx, c.opts.prefix+key, data, ttl)
+	return err
+}
+
+// encode 编码远端缓存的数据，返回数据和过期时间
+func (c *Cache[V]) encode(e *entry[V]) ([]byte, time.Duration, error) {
+	if !e.found {
+		return []byte{remoteNotFound}, c.jitter(c.opts.negativeTTL), nil
+	}
+
+	val, err := c.opts.codec.Marshal(e.val)
+	if err != nil {
+		return nil, 0, err
+	}
+	return append([]byte{remoteValue}, val...), c.jitter(c.opts.ttl), nil
+}
+
+// jitter 随机增加 [0, jitter*ttl]
+func (c *Cache[V]) jitter(ttl time.Duration) time.Duration {
+	n := int64(float64(ttl) * c.opts.jitter)
+	if ttl <= 0 || n <= 0 {
+		return ttl
+	}
+	return ttl + time.Duration(rand.Int63n(n+1))
+}
+
+func (c *Cache[V]) stat(result string) {
+	if c.opts.requests != nil {
+		c.opts.requests.With(c.name, result).Inc()
+	}
+}
+
+// WriteBehind 开启延迟写：Set 之后不立即写数据源，每隔 interval 把修改过的数据交给 w 批量写回，
+// 同一个 key 多次修改只写最后一次，写失败时下次重试。需要在使用缓存前调用
+func (c *Cache[V]) WriteBehind(w Writer[V], interval time.Duration) {
+	c.writer = w
+	c.dirty = make(map[string]V)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.Flush(context.Background()); err != nil {
+					alog.Error("[cache] %s write behind error: %s", c.name, err.Error())
+				}
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Flush 立即写回修改过的数据
+func (c *Cache[V]) Flush(ctx context.Context) error {
+	if c.writer == nil {
+		return nil
+	}
+
+	c.wlk.Lock()
+	items := c.dirty
+	c.dirty = make(map[string]V)
+	c.wlk.Unlock()
+
+	if len(items) == 0 {
+		return nil
+	}
+
+	err := c.writer(ctx, items)
+	if err != nil {
+		// 写失败的数据放回去，期间又被修改的以新数据为准
+		c.wlk.Lock()
+		for key, val := range items {
+			if _, ok := c.dirty[key]; !ok {
+				c.dirty[key] = val
+			}
+		}
+		c.wlk.Unlock()
+	}
+	return err
+}
+
+// Close 停止延迟写并写回剩余的数据
+func (c *Cache[V]) Close(ctx context.Context) error {
+	c.stopOnce.Do(func() { close(c.stop) })
+	c.wg.Wait()
+	return c.Flush(ctx)
+}
@@ -0,0 +1,418 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lightmen/nami/pkg/redispool"
+	"github.com/lightmen/nami/service/cmd"
+)
+
+type user struct {
+	Name  string `json:"name"`
+	Level int    `json:"level"`
+}
+
+// mapRemote 内存实现的远端缓存
+type mapRemote struct {
+	mu   sync.Mutex
+	data map[string][]byte
+	ttls map[string]time.Duration
+}
+
+func newMapRemote() *mapRemote {
+	return &mapRemote{data: make(map[string][]byte), ttls: make(map[string]time.Duration)}
+}
+
+func (r *mapRemote) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, ok := r.data[key]
+	return data, ok, nil
+}
+
+func (r *mapRemote) Set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data[key], r.ttls[key] = data, ttl
+	return nil
+}
+
+func (r *mapRemote) SetNX(ctx context.Context, key string, data []byte, ttl time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.data[key]; ok {
+		return false, nil
+	}
+	r.data[key], r.ttls[key] = data, ttl
+	return true, nil
+}
+
+func (r *mapRemote) Delete(ctx context.Context, keys ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range keys {
+		delete(r.data, key)
+	}
+	return nil
+}
+
+// bus 进程内的失效通知，模拟多个节点
+type bus struct {
+	nodes []*subscribers
+}
+
+type busInvalidator struct {
+	*subscribers
+	b *bus
+}
+
+func (b *bus) node() *busInvalidator {
+	s := newSubscribers()
+	b.nodes = append(b.nodes, s)
+	return &busInvalidator{subscribers: s, b: b}
+}
+
+func (i *busInvalidator) Publish(ctx context.Context, name string, keys ...string) error {
+	for _, n := range i.b.nodes {
+		n.dispatch(i.msg(name, keys))
+	}
+	return nil
+}
+
+func TestCacheLoad(t *testing.T) {
+	ctx := context.Background()
+	remote := newMapRemote()
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context, key string) (*user, error) {
+		loads.Add(1)
+		<-release
+		if key == "none" {
+			return nil, ErrNotFound
+		}
+		return &user{Name: key, Level: 1}, nil
+	}
+	c := New("user", loader, WithRemote(remote), WithJitter(0))
+
+	// 并发加载合并为一次
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if u, err := c.Get(ctx, "u1"); err != nil || u.Name != "u1" {
+				t.Errorf("get = %v, %v", u, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("loads = %d", n)
+	}
+	if remote.ttls["cache:user:u1"] != defaultTTL {
+		t.Fatalf("remote ttl = %v", remote.ttls["cache:user:u1"])
+	}
+
+	// 不存在的数据也会缓存
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get(ctx, "none"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("get none = %v", err)
+		}
+	}
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("loads = %d", n)
+	}
+	if remote.ttls["cache:user:none"] != defaultNegativeTTL {
+		t.Fatalf("negative ttl = %v", remote.ttls["cache:user:none"])
+	}
+
+	// 其他节点从远端缓存读取，不再调用 loader
+	c2 := New("user", loader, WithRemote(remote))
+	if u, err := c2.Get(ctx, "u1"); err != nil || u.Level != 1 {
+		t.Fatalf("get from remote = %v, %v", u, err)
+	}
+	if _, err := c2.Get(ctx, "none"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get none from remote = %v", err)
+	}
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("loads = %d", n)
+	}
+
+	// loader 出错时不缓存
+	fail := New("fail", func(ctx context.Context, key string) (int, error) {
+		loads.Add(1)
+		return 0, errors.New("db down")
+	})
+	fail.Get(ctx, "k")
+	fail.Get(ctx, "k")
+	if n := loads.Load(); n != 4 {
+		t.Fatalf("loads = %d", n)
+	}
+}
+
+func TestCacheLoadDetached(t *testing.T) {
+	remote := newMapRemote()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loader := func(ctx context.Context, key string) (*user, error) {
+		close(started)
+		<-release
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return &user{Name: key, Level: 1}, nil
+	}
+	c := New("user", loader, WithRemote(remote))
+
+	// 第一个调用方取消后不影响合并的加载
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.Get(ctx, "u1")
+		first <- err
+	}()
+	<-started
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("first get = %v", err)
+	}
+
+	// 加载期间 Set 的数据不被加载结果覆盖
+	if err := c.Set(context.Background(), "u1", &user{Name: "u1", Level: 9}); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if u, err := c.Get(context.Background(), "u1"); err != nil || u.Level != 9 {
+		t.Fatalf("get after set = %v, %v", u, err)
+	}
+	c.Invalidate([]string{"u1"})
+	if u, err := c.Get(context.Background(), "u1"); err != nil || u.Level != 9 {
+		t.Fatalf("get remote after set = %v, %v", u, err)
+	}
+}
+
+func TestCacheJitter(t *testing.T) {
+	c := New[int]("jitter", nil, WithJitter(0.5))
+	for i := 0; i < 100; i++ {
+		if ttl := c.jitter(time.Minute); ttl < time.Minute || ttl > 90*time.Second {
+			t.Fatalf("ttl = %v", ttl)
+		}
+	}
+	if ttl := c.jitter(0); ttl != 0 {
+		t.Fatalf("ttl = %v", ttl)
+	}
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	ctx := context.Background()
+	remote := newMapRemote()
+	b := &bus{}
+
+	var loads atomic.Int32
+	loader := func(ctx context.Context, key string) (int, error) {
+		loads.Add(1)
+		return 1, nil
+	}
+	c1 := New("score", loader, WithRemote(remote), WithInvalidator(b.node()))
+	c2 := New("score", loader, WithRemote(remote), WithInvalidator(b.node()))
+
+	if v, _ := c2.Get(ctx, "k"); v != 1 {
+		t.Fatalf("get = %d", v)
+	}
+
+	// c1 修改后 c2 的本地缓存失效，从远端读到新的值
+	if err := c1.Set(ctx, "k", 2); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := c2.Get(ctx, "k"); v != 2 {
+		t.Fatalf("get after set = %d", v)
+	}
+
+	if err := c1.Delete(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := c2.Get(ctx, "k"); v != 1 || loads.Load() != 2 {
+		t.Fatalf("get after delete = %d, loads = %d", v, loads.Load())
+	}
+}
+
+func TestCacheWriteBehind(t *testing.T) {
+	ctx := context.Background()
+	c := New[int]("wb", nil)
+
+	var mu sync.Mutex
+	written := make(map[string]int)
+	fail := true
+	c.WriteBehind(func(ctx context.Context, items map[string]int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			fail = false
+			return errors.New("db down")
+		}
+		for k, v := range items {
+			written[k] = v
+		}
+		return nil
+	}, time.Hour)
+
+	c.Set(ctx, "a", 1)
+	c.Set(ctx, "a", 2)
+	c.Set(ctx, "b", 1)
+	if err := c.Flush(ctx); err == nil {
+		t.Fatal("first flush should fail")
+	}
+
+	c.Set(ctx, "b", 3)
+	if err := c.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if written["a"] != 2 || written["b"] != 3 {
+		t.Fatalf("written = %v", written)
+	}
+	if v, _ := c.Get(ctx, "a"); v != 2 {
+		t.Fatalf("get = %d", v)
+	}
+}
+
+func TestArpcInvalidator(t *testing.T) {
+	reg := cmd.New()
+	inv, err := NewArpcInvalidator("game", 9001, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(chan []string, 1)
+	inv.Subscribe("user", func(keys []string) { got <- keys })
+
+	h, ok := reg.Get(int32(9001))
+	if !ok {
+		t.Fatal("handler not registered")
+	}
+	data, _ := (&InvalidateMsg{Node: "other", Name: "user", Keys: []string{"u1"}}).Marshal()
+	h.Req.Unmarshal(data)
+	h.Handle(context.Background(), h.Req)
+
+	select {
+	case keys := <-got:
+		if len(keys) != 1 || keys[0] != "u1" {
+			t.Fatalf("keys = %v", keys)
+		}
+	default:
+		t.Fatal("not dispatched")
+	}
+
+	// 自己发出的通知不处理
+	h.Req.Unmarshal(mustMarshal(inv.msg("user", []string{"u2"})))
+	h.Handle(context.Background(), h.Req)
+	if len(got) != 0 {
+		t.Fatal("own message should be ignored")
+	}
+}
+
+func mustMarshal(m *InvalidateMsg) []byte {
+	data, _ := m.Marshal()
+	return data
+}
+
+// TestRedis 需要设置 NAMI_REDIS_ADDR 环境变量指定 redis 地址
+func TestRedis(t *testing.T) {
+	addr := os.Getenv("NAMI_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("NAMI_REDIS_ADDR not set")
+	}
+	pool, err := redispool.NewPool(addr, os.Getenv("NAMI_REDIS_PASS"), 2, 16, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	inv1, err := NewRedisInvalidator(pool, "test:cache:invalidate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inv1.Close()
+	inv2, err := NewRedisInvalidator(pool, "test:cache:invalidate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inv2.Close()
+
+	loader := func(ctx context.Context, key string) (int, error) { return 1, nil }
+	remote := NewRedisRemote(pool)
+	c1 := New("test", loader, WithRemote(remote), WithInvalidator(inv1))
+	c2 := New("test", loader, WithRemote(remote), WithInvalidator(inv2))
+	defer c1.Delete(ctx, "k")
+
+	if v, err := c2.Get(ctx, "k"); err != nil || v != 1 {
+		t.Fatalf("get = %d, %v", v, err)
+	}
+	time.Sleep(100 * time.Millisecond) // 等待订阅生效
+	if err = c1.Set(ctx, "k", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if v, _ := c2.Get(ctx, "k"); v == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("invalidate timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// gatedRemote Set 写入之前等待 gate，用于在 Set 期间插入加载
+type gatedRemote struct {
+	*mapRemote
+	entered chan struct{}
+	gate    chan struct{}
+}
+
+func (r *gatedRemote) Set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	if r.gate != nil {
+		close(r.entered)
+		<-r.gate
+	}
+	return r.mapRemote.Set(ctx, key, data, ttl)
+}
+
+func TestCacheSetDuringLoad(t *testing.T) {
+	ctx := context.Background()
+	remote := &gatedRemote{mapRemote: newMapRemote()}
+	c := New[*user]("user", nil, WithRemote(remote))
+	if err := c.Set(ctx, "u1", &user{Name: "u1", Level: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	remote.entered, remote.gate = make(chan struct{}), make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Set(ctx, "u1", &user{Name: "u1", Level: 2})
+	}()
+	<-remote.entered
+
+	// Set 已经写入本地缓存但还没有写入远端缓存，此时开始的加载读到远端的旧数据，不能覆盖本地缓存
+	if e, err := c.load(ctx, "u1"); err != nil || e.val.Level != 1 {
+		t.Fatalf("load during set = %v, %v", e, err)
+	}
+	close(remote.gate)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if u, err := c.Get(ctx, "u1"); err != nil || u.Level != 2 {
+		t.Fatalf("get after set = %v, %v", u, err)
+	}
+}
@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/lightmen/nami/alog"
+	"github.com/lightmen/nami/pkg/arpc"
+	"github.com/lightmen/nami/pkg/random"
+	"github.com/lightmen/nami/pkg/redispool"
+	"github.com/lightmen/nami/service"
+)
+
+// Invalidator 在节点之间广播失效的 key，收到其他节点的通知后删除本地缓存
+type Invalidator interface {
+	// Publish 通知其他节点 name 缓存中的 keys 已经失效
+	Publish(ctx context.Context, name string, keys ...string) error
+	// Subscribe 注册 name 缓存收到失效通知时的回调，不会收到自己发送的通知
+	Subscribe(name string, fn func(keys []string))
+}
+
+// InvalidateMsg 失效通知
+type InvalidateMsg struct {
+	Node string   `json:"node"`
+	Name string   `json:"name"`
+	Keys []string `json:"keys"`
+}
+
+func (m *InvalidateMsg) Marshal() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m *InvalidateMsg) Unmarshal(data []byte) error {
+	return json.Unmarshal(data, m)
+}
+
+// subscribers 按缓存名字分发失效通知
+type subscribers struct {
+	node string // 节点的唯一标识，过滤自己发出的通知
+
+	lk  sync.RWMutex
+	fns map[string][]func(keys []string)
+}
+
+func newSubscribers() *subscribers {
+	return &subscribers{
+		node: random.String(16),
+		fns:  make(map[string][]func(keys []string)),
+	}
+}
+
+func (s *subscribers) Subscribe(name string, fn func(keys []string)) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.fns[name] = append(s.fns[name], fn)
+}
+
+func (s *subscribers) msg(name string, keys []string) *InvalidateMsg {
+	return &InvalidateMsg{Node: s.node, Name: name, Keys: keys}
+}
+
+func (s *subscribers) dispatch(msg *InvalidateMsg) {
+	if msg.Node == s.node {
+		return
+	}
+
+	s.lk.RLock()
+	fns := s.fns[msg.Name]
+	s.lk.RUnlock()
+
+	for _, fn := range fns {
+		fn(msg.Keys)
+	}
+}
+
+// RedisInvalidator 通过 redis pub/sub 广播失效通知
+type RedisInvalidator struct {
+	*subscribers
+	pool    *redispool.Pool
+	channel string
+	sub     *redispool.Subscriber
+}
+
+var _ Invalidator = (*RedisInvalidator)(nil)
+
+// NewRedisInvalidator 订阅 channel 接收失效通知，断线后自动重连，断线期间的通知会丢失
+func NewRedisInvalidator(pool *redispool.Pool, channel string) (*RedisInvalidator, error) {
+	r := &RedisInvalidator{
+		subscribers: newSubscribers(),
+		pool:        pool,
+		channel:     channel,
+	}
+
+	r.sub = pool.NewSubscriber(r.handle)
+	if err := r.sub.Subscribe(channel); err != nil {
+		r.sub.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RedisInvalidator) handle(m *redispool.Message) {
+	msg := &InvalidateMsg{}
+	if err := msg.Unmarshal(m.Data); err != nil {
+		alog.Error("[cache] %s invalid message: %s", r.channel, err.Error())
+		return
+	}
+	r.dispatch(msg)
+}
+
+func (r *RedisInvalidator) Publish(ctx context.Context, name string, keys ...string) error {
+	data, err := r.msg(name, keys).Marshal()
+	if err != nil {
+		return err
+	}
+
+	cli, err := r.pool.GetClientContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Put()
+
+	_, err = cli.Do("PUBLISH", r.channel, data)
+	return err
+}
+
+// Close 取消订阅
+func (r *RedisInvalidator) Close() error {
+	return r.sub.Close()
+}
+
+// ArpcInvalidator 通过 arpc.Broadcast 把失效通知广播到 srv 服务的所有实例
+type ArpcInvalidator struct {
+	*subscribers
+	srv string
+	cmd int32
+}
+
+var _ Invalidator = (*ArpcInvalidator)(nil)
+
+// NewArpcInvalidator 在 reg 中注册 cmd 的处理函数，reg 为 nil 时使用 service.Get()。
+// srv 一般为本服务的名字，通知会发给它的所有实例
+func NewArpcInvalidator(srv string, cmd int32, reg service.Registrar) (*ArpcInvalidator, error) {
+	a := &ArpcInvalidator{
+		subscribers: newSubscribers(),
+		srv:         srv,
+		cmd:         cmd,
+	}
+
+	if reg == nil {
+		reg = service.Get()
+	}
+	if err := reg.Register(cmd, &InvalidateMsg{}, a.handle); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *ArpcInvalidator) handle(ctx context.Context, req any) (any, error) {
+	if msg, ok := req.(*InvalidateMsg); ok {
+		a.dispatch(msg)
+	}
+	return nil, nil
+}
+
+func (a *ArpcInvalidator) Publish(ctx context.Context, name string, keys ...string) error {
+	return arpc.Broadcast(ctx, a.srv, "", a.cmd, a.msg(name, keys))
+}
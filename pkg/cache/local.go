@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Local 本地缓存，容量满时按淘汰策略删除，过期的数据在 Get 时删除
+type Local interface {
+	Get(key string) (val any, ok bool)
+	Set(key string, val any, ttl time.Duration)
+	Delete(key string)
+	Len() int
+}
+
+type lruItem struct {
+	key      string
+	val      any
+	expireAt time.Time
+}
+
+func (it *lruItem) expired(now time.Time) bool {
+	return !it.expireAt.IsZero() && now.After(it.expireAt)
+}
+
+func expireAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+type lru struct {
+	size int
+
+	lk    sync.Mutex
+	ll    *list.List // 头部为最近访问的数据
+	items map[string]*list.Element
+}
+
+var _ Local = (*lru)(nil)
+
+// NewLRU 创建最多保存 size 个数据的 LRU 缓存
+func NewLRU(size int) Local {
+	return &lru{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (c *lru) Get(key string) (val any, ok bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return
+	}
+	it := e.Value.(*lruItem)
+	if it.expired(time.Now()) {
+		c.remove(e)
+		return nil, false
+	}
+
+	c.ll.MoveToFront(e)
+	return it.val, true
+}
+
+func (c *lru) Set(key string, val any, ttl time.Duration) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		it := e.Value.(*lruItem)
+		it.val, it.expireAt = val, expireAt(ttl)
+		c.ll.MoveToFront(e)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&lruItem{key: key, val: val, expireAt: expireAt(ttl)})
+	for c.size > 0 && c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *lru) Delete(key string) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.remove(e)
+	}
+}
+
+func (c *lru) Len() int {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return c.ll.Len()
+}
+
+func (c *lru) remove(e *list.Element) {
+	c.ll.Remove(e)
+	delete(c.items, e.Value.(*lruItem).key)
+}
+
+type lfuItem struct {
+	lruItem
+	freq  int
+	seq   uint64 // 访问序号，频率相同时淘汰最久没有访问的
+	index int
+}
+
+type lfuHeap []*lfuItem
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x any) {
+	it := x.(*lfuItem)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *lfuHeap) Pop() any {
+	old := *h
+	it := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return it
+}
+
+type lfu struct {
+	size int
+
+	lk    sync.Mutex
+	seq   uint64
+	heap  lfuHeap // 堆顶为访问频率最低的数据
+	items map[string]*lfuItem
+}
+
+var _ Local = (*lfu)(nil)
+
+// NewLFU 创建最多保存 size 个数据的 LFU 缓存，淘汰访问次数最少的数据
+func NewLFU(size int) Local {
+	return &lfu{
+		size:  size,
+		items: make(map[string]*lfuItem),
+	}
+}
+
+func (c *lfu) Get(key string) (val any, ok bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	it, ok := c.items[key]
+	if !ok {
+		return
+	}
+	if it.expired(time.Now()) {
+		c.remove(it)
+		return nil, false
+	}
+
+	c.touch(it)
+	return it.val, true
+}
+
+func (c *lfu) Set(key string, val any, ttl time.Duration) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if it, ok := c.items[key]; ok {
+		it.val, it.expireAt = val, expireAt(ttl)
+		c.touch(it)
+		return
+	}
+
+	if c.size > 0 && len(c.items) >= c.size {
+		c.remove(c.heap[0])
+	}
+
+	c.seq++
+	it := &lfuItem{lruItem: lruItem{key: key, val: val, expireAt: expireAt(ttl)}, freq: 1, seq: c.seq}
+	heap.Push(&c.heap, it)
+	c.items[key] = it
+}
+
+func (c *lfu) Delete(key string) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if it, ok := c.items[key]; ok {
+		c.remove(it)
+	}
+}
+
+func (c *lfu) Len() int {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return len(c.items)
+}
+
+func (c *lfu) touch(it *lfuItem) {
+	c.seq++
+	it.freq++
+	it.seq = c.seq
+	heap.Fix(&c.heap, it.index)
+}
+
+func (c *lfu) remove(it *lfuItem) {
+	heap.Remove(&c.heap, it.index)
+	delete(c.items, it.key)
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	c := NewLRU(2)
+	c.Set("a", 1, 0)
+	c.Set("b", 2, 0)
+	c.Get("a")
+	c.Set("c", 3, 0) // 淘汰最久没有访问的 b
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("b should be evicted")
+	}
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("a = %v, %v", v, ok)
+	}
+
+	c.Set("d", 4, 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := c.Get("d"); ok {
+		t.Fatal("d should be expired")
+	}
+
+	c.Delete("a")
+	if c.Len() != 0 {
+		t.Fatalf("len = %d", c.Len())
+	}
+}
+
+func TestLFU(t *testing.T) {
+	c := NewLFU(2)
+	c.Set("a", 1, 0)
+	c.Set("b", 2, 0)
+	c.Get("a")
+	c.Get("a")
+	c.Get("b")
+	c.Set("c", 3, 0) // 淘汰访问次数最少的 b
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("b should be evicted")
+	}
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("a = %v, %v", v, ok)
+	}
+
+	// 频率相同时淘汰最久没有访问的
+	c.Get("c")
+	c.Get("c")
+	c.Get("c")
+	c.Set("d", 4, 0)
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("a should be evicted")
+	}
+
+	c.Set("e", 5, 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := c.Get("e"); ok {
+		t.Fatal("e should be expired")
+	}
+	c.Delete("c")
+	if c.Len() != 0 {
+		t.Fatalf("len = %d", c.Len())
+	}
+}
+
+func BenchmarkLRU(b *testing.B) {
+	c := NewLRU(1024)
+	for i := 0; i < b.N; i++ {
+		key := string(rune('a' + i%2048))
+		if _, ok := c.Get(key); !ok {
+			c.Set(key, i, 0)
+		}
+	}
+}
+
+func BenchmarkLFU(b *testing.B) {
+	c := NewLFU(1024)
+	for i := 0; i < b.N; i++ {
+		key := string(rune('a' + i%2048))
+		if _, ok := c.Get(key); !ok {
+			c.Set(key, i, 0)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/lightmen/nami/metrics"
+)
+
+const (
+	defaultLocalSize   = 10000
+	defaultTTL         = 10 * time.Minute
+	defaultLocalTTL    = time.Minute
+	defaultNegativeTTL = 30 * time.Second
+	defaultJitter      = 0.1
+	defaultLoadTimeout = 5 * time.Second
+)
+
+type Option func(*options)
+
+type options struct {
+	local       Local
+	remote      Remote
+	codec       Codec
+	prefix      string
+	ttl         time.Duration
+	localTTL    time.Duration
+	negativeTTL time.Duration
+	jitter      float64
+	loadTimeout time.Duration
+	invalidator Invalidator
+	// counter: cache_requests_total{name, result}
+	requests metrics.Counter
+}
+
+func defaultOptions(name string) *options {
+	return &options{
+		local:       NewLRU(defaultLocalSize),
+		codec:       JSONCodec{},
+		prefix:      "cache:" + name + ":",
+		ttl:         defaultTTL,
+		localTTL:    defaultLocalTTL,
+		negativeTTL: defaultNegativeTTL,
+		jitter:      defaultJitter,
+		loadTimeout: defaultLoadTimeout,
+	}
+}
+
+// WithLocal 设置本地缓存，默认为容量 10000 的 LRU，nil 表示不使用本地缓存
+func WithLocal(local Local) Option {
+	return func(o *options) {
+		o.local = local
+	}
+}
+
+// WithRemote 设置远端缓存，默认不使用
+func WithRemote(remote Remote) Option {
+	return func(o *options) {
+		o.remote = remote
+	}
+}
+
+// WithCodec 设置远端缓存的编解码，默认为 json
+func WithCodec(codec Codec) Option {
+	return func(o *options) {
+		o.codec = codec
+	}
+}
+
+// WithPrefix 设置远端缓存 key 的前缀，默认为 "cache:<name>:"
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithTTL 设置远端缓存的过期时间，默认 10 分钟
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// WithLocalTTL 设置本地缓存的过期时间，默认 1 分钟，本地缓存只在失效通知丢失时依赖过期
+func WithLocalTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.localTTL = ttl
+	}
+}
+
+// WithNegativeTTL 设置数据不存在时的缓存时间，默认 30 秒，0 表示不缓存不存在的数据
+func WithNegativeTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.negativeTTL = ttl
+	}
+}
+
+// WithJitter 过期时间随机增加 [0, jitter*ttl]，避免大量数据同时过期，默认 0.1
+func WithJitter(jitter float64) Option {
+	return func(o *options) {
+		o.jitter = jitter
+	}
+}
+
+// WithLoadTimeout 设置没有命中时加载的超时时间，默认 5 秒，0 表示不限制。
+// 相同 key 的并发加载合并为一次，加载不使用调用方 ctx 的超时和取消
+func WithLoadTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.loadTimeout = timeout
+	}
+}
+
+// WithInvalidator 设置节点之间的失效通知，Set 和 Delete 之后通知其他节点删除本地缓存
+func WithInvalidator(inv Invalidator) Option {
+	return func(o *options) {
+		o.invalidator = inv
+	}
+}
+
+// WithRequests 统计请求结果，result 为 local、remote、load、miss 或 error
+func WithRequests(requests metrics.Counter) Option {
+	return func(o *options) {
+		o.requests = requests
+	}
+}
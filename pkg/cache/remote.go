@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/lightmen/nami/pkg/redispool"
+)
+
+// Remote 远端缓存，多个节点共享
+type Remote interface {
+	Get(ctx context.Context, key string) (data []byte, ok bool, err error)
+	Set(ctx context.Context, key string, data []byte, ttl time.Duration) error
+	// SetNX key 不存在时才写入，ok 表示是否写入
+	SetNX(ctx context.Context, key string, data []byte, ttl time.Duration) (ok bool, err error)
+	Delete(ctx context.Context, keys ...string) error
+}
+
+type redisRemote struct {
+	pool *redispool.Pool
+}
+
+var _ Remote = (*redisRemote)(nil)
+
+// NewRedisRemote 使用 redispool 作为远端缓存
+func NewRedisRemote(pool *redispool.Pool) Remote {
+	return &redisRemote{pool: pool}
+}
+
+func (r *redisRemote) Get(ctx context.Context, key string) (data []byte, ok bool, err error) {
+	cli, err := r.pool.GetClientContext(ctx)
+	if err != nil {
+		return
+	}
+	defer cli.Put()
+
+	return cli.Get(key)
+}
+
+func (r *redisRemote) Set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	cli, err := r.pool.GetClientContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Put()
+
+	if ttl <= 0 {
+		return cli.Set(key, data)
+	}
+	_, err = cli.Do("SET", key, data, "PX", ttl.Milliseconds())
+	return err
+}
+
+func (r *redisRemote) SetNX(ctx context.Context, key string, data []byte, ttl time.Duration) (ok bool, err error) {
+	cli, err := r.pool.GetClientContext(ctx)
+	if err != nil {
+		return
+	}
+	defer cli.Put()
+
+	if ttl <= 0 {
+		return cli.SetNX(key, data)
+	}
+	return cli.SetPXNX(key, int(ttl.Milliseconds()), data)
+}
+
+func (r *redisRemote) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	cli, err := r.pool.GetClientContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Put()
+
+	// 逐个删除，cluster 模式下 key 可能在不同的节点上
+	_, err = cli.Pipelined(func(p *redispool.Pipeline) {
+		for _, key := range keys {
+			p.Del(key)
+		}
+	})
+	return err
+}
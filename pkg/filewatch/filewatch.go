@@ -74,6 +74,10 @@ func Add(name string, load func(f string) error) (err error) {
 	}
 
 	if err = load(name); err != nil {
+		// 加载失败时不保留新加的监控，已经监控的文件保持原来的回调
+		if _, ok := gw.fileMap.Load(name); !ok {
+			_ = gw.Remove(name)
+		}
 		return
 	}
 
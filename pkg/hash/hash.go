@@ -0,0 +1,38 @@
+// Package hash 定义分布式 hash 的通用接口，ketama、rendezvous 和 jump 都实现了该接口，
+// balancer 和业务分片可以根据需要选择：
+//   - ketama: 虚拟节点的一致性 hash 环，Get 为 O(log n)，内存占用和重建开销与虚拟节点数成正比
+//   - rendezvous: 最高随机权重(HRW)，不需要额外内存，Get 为 O(n)，适合节点数不多的场景
+//   - jump: 跳跃一致性 hash，不需要额外内存，Get 为 O(log n)，只有移除最后一个节点时才是最小迁移，不支持权重
+package hash
+
+import "hash/fnv"
+
+// Hash 分布式 hash，节点和 key 都是字符串
+type Hash interface {
+	// Add 添加默认权重的节点
+	Add(nodes ...string)
+	// AddWithWeight 添加带权重的节点，权重 100 与 Add 相同，不支持权重的实现忽略 weight
+	AddWithWeight(node string, weight int)
+	// Remove 移除节点
+	Remove(nodes ...string)
+	// Get 返回 key 对应的节点，没有节点时返回 false
+	Get(key string) (string, bool)
+	// IsEmpty 是否没有节点
+	IsEmpty() bool
+}
+
+// Sum64 fnv-1a 加上 murmur3 的 fmix64，前缀相同的 key(如 player1, player2) 也能均匀分布
+func Sum64(data []byte) uint64 {
+	f := fnv.New64a()
+	f.Write(data)
+	return fmix64(f.Sum64())
+}
+
+func fmix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,114 @@
+package hash_test
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/lightmen/nami/pkg/hash"
+	"github.com/lightmen/nami/pkg/hash/jump"
+	"github.com/lightmen/nami/pkg/hash/ketama"
+	"github.com/lightmen/nami/pkg/hash/rendezvous"
+)
+
+var impls = []struct {
+	name string
+	new  func() hash.Hash
+}{
+	{"ketama", func() hash.Hash { return ketama.New() }},
+	{"rendezvous", func() hash.Hash { return rendezvous.New() }},
+	{"jump", func() hash.Hash { return jump.New() }},
+}
+
+func nodeNames(n int) []string {
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = "10.0.0." + strconv.Itoa(i) + ":8080"
+	}
+	return nodes
+}
+
+// TestUniformity 统计每个节点分到的 key 数，最多和最少的节点与平均值的偏差都不能超过 10%
+func TestUniformity(t *testing.T) {
+	const nodeCount, keyCount = 10, 100000
+	for _, impl := range impls {
+		t.Run(impl.name, func(t *testing.T) {
+			h := impl.new()
+			h.Add(nodeNames(nodeCount)...)
+
+			count := make(map[string]int, nodeCount)
+			for i := 0; i < keyCount; i++ {
+				node, _ := h.Get("player" + strconv.Itoa(i))
+				count[node]++
+			}
+
+			avg := float64(keyCount) / nodeCount
+			var sum float64
+			for _, c := range count {
+				sum += (float64(c) - avg) * (float64(c) - avg)
+				if dev := math.Abs(float64(c)-avg) / avg; dev > 0.1 {
+					t.Fatalf("deviation %.2f%% too large: %v", dev*100, count)
+				}
+			}
+			t.Logf("stddev: %.2f%% of average", math.Sqrt(sum/nodeCount)*100/avg)
+		})
+	}
+}
+
+// TestMinimalDisruption 在末尾添加一个节点，只有迁移到新节点的 key 发生变化
+func TestMinimalDisruption(t *testing.T) {
+	const keyCount = 10000
+	for _, impl := range impls {
+		t.Run(impl.name, func(t *testing.T) {
+			h := impl.new()
+			nodes := nodeNames(11)
+			h.Add(nodes[:10]...)
+
+			before := make([]string, keyCount)
+			for i := range before {
+				before[i], _ = h.Get("player" + strconv.Itoa(i))
+			}
+
+			h.Add(nodes[10])
+			moved := 0
+			for i := range before {
+				node, _ := h.Get("player" + strconv.Itoa(i))
+				if node != before[i] {
+					if node != nodes[10] {
+						t.Fatalf("key moved between old nodes: %s -> %s", before[i], node)
+					}
+					moved++
+				}
+			}
+			t.Logf("%d/%d keys moved", moved, keyCount)
+		})
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	for _, n := range []int{10, 100} {
+		for _, impl := range impls {
+			b.Run(impl.name+"/"+strconv.Itoa(n), func(b *testing.B) {
+				h := impl.new()
+				h.Add(nodeNames(n)...)
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					h.Get("player" + strconv.Itoa(i))
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkBuild(b *testing.B) {
+	nodes := nodeNames(100)
+	for _, impl := range impls {
+		b.Run(impl.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				h := impl.new()
+				h.Add(nodes...)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Package jump 跳跃一致性 hash (Lamping & Veach)，节点按添加顺序编号，
+// 在末尾添加或移除节点时只有最小数量的 key 迁移，移除中间的节点时后面节点的 key 都会迁移。
+// 每个节点只占用一个桶，不支持权重
+package jump
+
+import (
+	"sync"
+
+	"github.com/lightmen/nami/pkg/hash"
+)
+
+var _ hash.Hash = (*Jump)(nil)
+
+type HashFunc func(data []byte) uint64
+
+type Option func(j *Jump)
+
+func Hash(fn HashFunc) Option {
+	return func(j *Jump) {
+		j.hash = fn
+	}
+}
+
+type Jump struct {
+	sync.RWMutex
+	hash    HashFunc
+	buckets []string // 每个桶对应的节点
+}
+
+func New(opts ...Option) *Jump {
+	j := &Jump{
+		hash: hash.Sum64,
+	}
+
+	for _, op := range opts {
+		op(j)
+	}
+
+	return j
+}
+
+func (j *Jump) IsEmpty() bool {
+	j.RLock()
+	defer j.RUnlock()
+
+	return len(j.buckets) == 0
+}
+
+// Add 添加节点，已经存在的节点忽略
+func (j *Jump) Add(nodes ...string) {
+	j.Lock()
+	defer j.Unlock()
+
+	for _, n := range nodes {
+		if !j.exists(n) {
+			j.buckets = append(j.buckets, n)
+		}
+	}
+}
+
+// AddWithWeight jump 不支持权重，忽略 weight，等同于 Add
+func (j *Jump) AddWithWeight(node string, weight int) {
+	j.Add(node)
+}
+
+func (j *Jump) exists(node string) bool {
+	for _, n := range j.buckets {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *Jump) Remove(nodes ...string) {
+	j.Lock()
+	defer j.Unlock()
+
+	removed := make(map[string]struct{}, len(nodes))
+	for _, n := range nodes {
+		removed[n] = struct{}{}
+	}
+
+	buckets := j.buckets[:0]
+	for _, n := range j.buckets {
+		if _, ok := removed[n]; !ok {
+			buckets = append(buckets, n)
+		}
+	}
+	j.buckets = buckets
+}
+
+func (j *Jump) Get(key string) (string, bool) {
+	j.RLock()
+	defer j.RUnlock()
+
+	if len(j.buckets) == 0 {
+		return "", false
+	}
+
+	idx := Bucket(j.hash([]byte(key)), len(j.buckets))
+	return j.buckets[idx], true
+}
+
+// Bucket 返回 key 对应的桶编号，范围为 [0, buckets)
+func Bucket(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -0,0 +1,68 @@
+package jump
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/lightmen/nami/pkg/hash"
+)
+
+func TestBucket(t *testing.T) {
+	// 桶数增加时，key 只会迁移到新的桶
+	for i := 0; i < 1000; i++ {
+		key := hash.Sum64([]byte("key" + strconv.Itoa(i)))
+		last := Bucket(key, 1)
+		if last != 0 {
+			t.Fatalf("expect bucket 0, got: %d", last)
+		}
+		for n := 2; n <= 20; n++ {
+			b := Bucket(key, n)
+			if b != last && b != n-1 {
+				t.Fatalf("key moved between old buckets: %d -> %d", last, b)
+			}
+			last = b
+		}
+	}
+}
+
+func TestJump(t *testing.T) {
+	j := New()
+	if _, ok := j.Get("testKey1"); ok {
+		t.Fatalf("expect false, got true")
+	}
+
+	j.Add("node1", "node2", "node3")
+	expect, ok := j.Get("testKey1")
+	if !ok {
+		t.Fatalf("get failed")
+	}
+	if got, _ := j.Get("testKey1"); got != expect {
+		t.Fatalf("expect %s, got: %s", expect, got)
+	}
+
+	j.Remove("node1", "node2", "node3")
+	if !j.IsEmpty() {
+		t.Fatalf("is not empty")
+	}
+}
+
+func TestJumpAddTwice(t *testing.T) {
+	j := New()
+	j.Add("node1", "node2")
+	expect, _ := j.Get("testKey1")
+
+	// 重复添加和带权重添加都不会增加桶
+	j.Add("node1", "node2")
+	j.AddWithWeight("node1", 300)
+	if len(j.buckets) != 2 {
+		t.Fatalf("expect 2 buckets, got: %v", j.buckets)
+	}
+	if got, _ := j.Get("testKey1"); got != expect {
+		t.Fatalf("expect %s, got: %s", expect, got)
+	}
+
+	j.Remove("node1")
+	if len(j.buckets) != 1 {
+		t.Fatalf("expect 1 bucket, got: %v", j.buckets)
+	}
+}
@@ -5,8 +5,12 @@ import (
 	"sort"
 	"strconv"
 	"sync"
+
+	"github.com/lightmen/nami/pkg/hash"
 )
 
+var _ hash.Hash = (*Ketama)(nil)
+
 type HashFunc func(data []byte) uint32
 
 const (
@@ -20,12 +24,30 @@ func DefaultHash(data []byte) uint32 {
 	return f.Sum32()
 }
 
+// MixHash fnv-1a 加上 murmur3 的 fmix32，前缀相同的 key(如 player1, player2) 也能均匀分布在环上，
+// 通过 Hash(MixHash) 开启。与 DefaultHash 的结果不同，已有的环切换后所有 key 都会迁移
+func MixHash(data []byte) uint32 {
+	f := fnv.New32a()
+	f.Write(data)
+	return fmix32(f.Sum32())
+}
+
+func fmix32(h uint32) uint32 {
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
 type Ketama struct {
 	sync.RWMutex
-	hash     HashFunc
-	replicas int
-	keys     []int //  Sorted keys
-	hashMap  map[int]string
+	hash         HashFunc
+	replicas     int
+	keys         []int //  Sorted keys
+	hashMap      map[int]string
+	nodeReplicas map[string]int // 每个节点的虚拟节点数
 }
 
 func New(opts ...Option) *Ketama {
@@ -33,6 +55,8 @@ func New(opts ...Option) *Ketama {
 		replicas: DefaultReplicas,
 		hash:     DefaultHash,
 		hashMap:  make(map[int]string),
+
+		nodeReplicas: make(map[string]int),
 	}
 
 	for _, op := range opts {
@@ -54,28 +78,61 @@ func (h *Ketama) Add(nodes ...string) {
 	defer h.Unlock()
 
 	for _, node := range nodes {
-		for i := 0; i < h.replicas; i++ {
-			key := int(h.hash([]byte(Salt + strconv.Itoa(i) + node)))
+		h.nodeReplicas[node] = h.replicas
+		h.add(node, h.replicas)
+	}
+	sort.Ints(h.keys)
+}
 
-			if _, ok := h.hashMap[key]; !ok {
-				h.keys = append(h.keys, key)
-			}
-			h.hashMap[key] = node
+// AddWithWeight 添加带权重的节点，虚拟节点数为 replicas * weight / 100，weight 小于等于0时等同于 Add
+func (h *Ketama) AddWithWeight(node string, weight int) {
+	replicas := h.replicas
+	if weight > 0 {
+		replicas = h.replicas * weight / 100
+		if replicas <= 0 {
+			replicas = 1
 		}
 	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	h.nodeReplicas[node] = replicas
+	h.add(node, replicas)
 	sort.Ints(h.keys)
 }
 
+func (h *Ketama) add(node string, replicas int) {
+	for i := 0; i < replicas; i++ {
+		key := int(h.hash([]byte(Salt + strconv.Itoa(i) + node)))
+
+		if _, ok := h.hashMap[key]; !ok {
+			h.keys = append(h.keys, key)
+		}
+		h.hashMap[key] = node
+	}
+}
+
+func (h *Ketama) replicasOf(node string) int {
+	if replicas, ok := h.nodeReplicas[node]; ok {
+		return replicas
+	}
+	return h.replicas
+}
+
 func (h *Ketama) Remove(nodes ...string) {
 	h.Lock()
 	defer h.Unlock()
 
 	deletedKey := make([]int, 0)
 	for _, node := range nodes {
-		for i := 0; i < h.replicas; i++ {
+		replicas := h.replicasOf(node)
+		delete(h.nodeReplicas, node)
+		for i := 0; i < replicas; i++ {
 			key := int(h.hash([]byte(Salt + strconv.Itoa(i) + node)))
 
-			if _, ok := h.hashMap[key]; ok {
+			// 虚拟节点 hash 冲突时，只删除属于当前节点的
+			if n, ok := h.hashMap[key]; ok && n == node {
 				deletedKey = append(deletedKey, key)
 				delete(h.hashMap, key)
 			}
@@ -130,3 +187,40 @@ func (h *Ketama) Get(key string) (string, bool) {
 	str, ok := h.hashMap[h.keys[idx]]
 	return str, ok
 }
+
+// Walk 从 key 在环上的位置开始顺时针遍历节点，每个节点只访问一次，fn 返回 false 时停止遍历，
+// 遍历期间持有读锁，fn 中不能调用 Ketama 的其他方法
+func (h *Ketama) Walk(key string, fn func(node string) bool) {
+	hash := int(h.hash([]byte(key)))
+
+	h.RLock()
+	defer h.RUnlock()
+
+	if len(h.keys) == 0 {
+		return
+	}
+
+	idx := sort.Search(len(h.keys), func(i int) bool {
+		return h.keys[i] >= hash
+	})
+
+	var visited map[string]struct{}
+	for i := 0; i < len(h.keys); i++ {
+		node := h.hashMap[h.keys[(idx+i)%len(h.keys)]]
+		if _, ok := visited[node]; ok {
+			continue
+		}
+		if !fn(node) {
+			return
+		}
+
+		// 大部分情况下第一个节点就满足，需要继续遍历时才记录访问过的节点
+		if visited == nil {
+			visited = make(map[string]struct{})
+		}
+		visited[node] = struct{}{}
+		if len(visited) == len(h.nodeReplicas) {
+			return
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package ketama
 
-import "testing"
+import (
+	"hash/fnv"
+	"strconv"
+	"testing"
+)
 
 func TestKetama(t *testing.T) {
 	k := New(Replicas(9))
@@ -36,3 +40,126 @@ func TestKetama(t *testing.T) {
 		t.Fatalf("expect false, got true")
 	}
 }
+
+func TestKetamaWeight(t *testing.T) {
+	k := New(Replicas(100))
+
+	k.AddWithWeight("heavy", 300)
+	k.AddWithWeight("light", 100)
+
+	count := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		node, _ := k.Get("key" + strconv.Itoa(i))
+		count[node]++
+	}
+
+	if count["heavy"] <= count["light"]*2 {
+		t.Fatalf("heavy node should get about 3 times keys of light node, got: %v", count)
+	}
+
+	k.Remove("heavy", "light")
+	if !k.IsEmpty() {
+		t.Fatalf("is not empty")
+	}
+}
+
+func TestKetamaWalk(t *testing.T) {
+	k := New(Replicas(50))
+	nodes := []string{"node1", "node2", "node3"}
+	k.Add(nodes...)
+
+	first, _ := k.Get("testKey1")
+
+	visited := make([]string, 0, len(nodes))
+	k.Walk("testKey1", func(node string) bool {
+		visited = append(visited, node)
+		return true
+	})
+	if len(visited) != len(nodes) {
+		t.Fatalf("expect visit %d nodes, got: %v", len(nodes), visited)
+	}
+	if visited[0] != first {
+		t.Fatalf("expect first node %s, got: %s", first, visited[0])
+	}
+
+	count := 0
+	k.Walk("testKey1", func(node string) bool {
+		count++
+		return false
+	})
+	if count != 1 {
+		t.Fatalf("expect stop after first node, got: %d", count)
+	}
+}
+
+// assignKeys 返回每个 key 当前对应的节点
+func assignKeys(k *Ketama, keys []string) map[string]string {
+	assign := make(map[string]string, len(keys))
+	for _, key := range keys {
+		assign[key], _ = k.Get(key)
+	}
+	return assign
+}
+
+func movedKeys(before, after map[string]string) int {
+	moved := 0
+	for key, node := range before {
+		if after[key] != node {
+			moved++
+		}
+	}
+	return moved
+}
+
+// TestKetamaRebalance 统计节点加入和离开时迁移的 key 数，理想情况下只有 1/n 的 key 需要迁移
+func TestKetamaRebalance(t *testing.T) {
+	const keyCount = 100000
+	keys := make([]string, keyCount)
+	for i := range keys {
+		keys[i] = "player" + strconv.Itoa(i)
+	}
+
+	// DefaultHash 对前缀相同的 key 分布不均，统计迁移比例使用 MixHash
+	k := New(Replicas(200), Hash(MixHash))
+	for i := 0; i < 10; i++ {
+		k.Add("node" + strconv.Itoa(i))
+	}
+	before := assignKeys(k, keys)
+
+	// 加入一个节点，期望迁移 1/11 的 key，且只迁移到新节点
+	k.Add("node10")
+	joined := assignKeys(k, keys)
+	moved := movedKeys(before, joined)
+	t.Logf("join: %d/%d keys moved (%.2f%%, ideal %.2f%%)", moved, keyCount, float64(moved)*100/keyCount, 100.0/11)
+	for key, node := range joined {
+		if before[key] != node && node != "node10" {
+			t.Fatalf("key %s moved between old nodes: %s -> %s", key, before[key], node)
+		}
+	}
+	if moved > keyCount*2/11 {
+		t.Fatalf("too many keys moved on join: %d", moved)
+	}
+
+	// 离开一个节点，只有该节点上的 key 需要迁移
+	k.Remove("node3")
+	left := assignKeys(k, keys)
+	moved = movedKeys(joined, left)
+	t.Logf("leave: %d/%d keys moved (%.2f%%, ideal %.2f%%)", moved, keyCount, float64(moved)*100/keyCount, 100.0/11)
+	for key, node := range left {
+		if joined[key] != node && joined[key] != "node3" {
+			t.Fatalf("key %s moved from remaining node: %s -> %s", key, joined[key], node)
+		}
+	}
+	if moved > keyCount*2/11 {
+		t.Fatalf("too many keys moved on leave: %d", moved)
+	}
+}
+
+// TestDefaultHashCompatible DefaultHash 必须保持 fnv-1 32，否则升级后已有的 key 全部迁移
+func TestDefaultHashCompatible(t *testing.T) {
+	f := fnv.New32()
+	f.Write([]byte("player1"))
+	if DefaultHash([]byte("player1")) != f.Sum32() {
+		t.Fatal("DefaultHash changed")
+	}
+}
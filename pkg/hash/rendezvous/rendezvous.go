@@ -0,0 +1,133 @@
+// Package rendezvous 最高随机权重(HRW) hash，key 选择与它组合后得分最高的节点
+package rendezvous
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/lightmen/nami/pkg/hash"
+)
+
+var _ hash.Hash = (*Rendezvous)(nil)
+
+const DefaultWeight = 100
+
+type HashFunc func(data []byte) uint64
+
+type Option func(r *Rendezvous)
+
+func Hash(fn HashFunc) Option {
+	return func(r *Rendezvous) {
+		r.hash = fn
+	}
+}
+
+type node struct {
+	name   string
+	weight float64
+}
+
+type Rendezvous struct {
+	sync.RWMutex
+	hash  HashFunc
+	nodes []*node // 按名字排序，保证得分相同时结果稳定
+}
+
+func New(opts ...Option) *Rendezvous {
+	r := &Rendezvous{
+		hash: hash.Sum64,
+	}
+
+	for _, op := range opts {
+		op(r)
+	}
+
+	return r
+}
+
+func (r *Rendezvous) IsEmpty() bool {
+	r.RLock()
+	defer r.RUnlock()
+
+	return len(r.nodes) == 0
+}
+
+func (r *Rendezvous) Add(nodes ...string) {
+	r.Lock()
+	defer r.Unlock()
+
+	for _, n := range nodes {
+		r.add(n, DefaultWeight)
+	}
+}
+
+// AddWithWeight 添加带权重的节点，weight 小于等于0时等同于 Add
+func (r *Rendezvous) AddWithWeight(node string, weight int) {
+	if weight <= 0 {
+		weight = DefaultWeight
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.add(node, weight)
+}
+
+func (r *Rendezvous) add(name string, weight int) {
+	idx := r.search(name)
+	if idx < len(r.nodes) && r.nodes[idx].name == name {
+		r.nodes[idx].weight = float64(weight)
+		return
+	}
+
+	r.nodes = append(r.nodes, nil)
+	copy(r.nodes[idx+1:], r.nodes[idx:])
+	r.nodes[idx] = &node{name: name, weight: float64(weight)}
+}
+
+func (r *Rendezvous) Remove(nodes ...string) {
+	r.Lock()
+	defer r.Unlock()
+
+	for _, name := range nodes {
+		idx := r.search(name)
+		if idx < len(r.nodes) && r.nodes[idx].name == name {
+			r.nodes = append(r.nodes[:idx], r.nodes[idx+1:]...)
+		}
+	}
+}
+
+func (r *Rendezvous) search(name string) int {
+	return sort.Search(len(r.nodes), func(i int) bool {
+		return r.nodes[i].name >= name
+	})
+}
+
+// Get 返回得分最高的节点，得分为 -weight / ln(h)，h 为 key 和节点组合后映射到 (0, 1) 的 hash 值，
+// 每个节点被选中的概率与权重成正比
+func (r *Rendezvous) Get(key string) (string, bool) {
+	r.RLock()
+	defer r.RUnlock()
+
+	if len(r.nodes) == 0 {
+		return "", false
+	}
+
+	buf := make([]byte, 0, len(key)+32)
+	buf = append(buf, key...)
+
+	var best *node
+	bestScore := math.Inf(-1)
+	for _, n := range r.nodes {
+		h := r.hash(append(buf[:len(key)], n.name...))
+		// 取高 53 位映射到 (0, 1)
+		f := (float64(h>>11) + 0.5) / (1 << 53)
+		score := -n.weight / math.Log(f)
+		if score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+
+	return best.name, true
+}
@@ -0,0 +1,53 @@
+package rendezvous
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRendezvous(t *testing.T) {
+	r := New()
+	if _, ok := r.Get("testKey1"); ok {
+		t.Fatalf("expect false, got true")
+	}
+
+	nodes := []string{"node1", "node2", "node3", "node4"}
+	r.Add(nodes...)
+
+	expect, ok := r.Get("testKey1")
+	if !ok {
+		t.Fatalf("get failed")
+	}
+
+	// 移除其他节点不影响 key 的归属
+	for _, n := range nodes {
+		if n != expect {
+			r.Remove(n)
+			if got, _ := r.Get("testKey1"); got != expect {
+				t.Fatalf("expect %s, got: %s", expect, got)
+			}
+		}
+	}
+
+	r.Remove(expect)
+	if !r.IsEmpty() {
+		t.Fatalf("is not empty")
+	}
+}
+
+func TestRendezvousWeight(t *testing.T) {
+	r := New()
+	r.AddWithWeight("heavy", 300)
+	r.AddWithWeight("light", 100)
+
+	count := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		node, _ := r.Get("key" + strconv.Itoa(i))
+		count[node]++
+	}
+
+	// 期望 3:1
+	if count["heavy"] < 7000 || count["heavy"] > 8000 {
+		t.Fatalf("heavy node should get about 75%% keys, got: %v", count)
+	}
+}
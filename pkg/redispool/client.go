@@ -1,6 +1,7 @@
 package redispool
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"errors"
@@ -28,6 +29,16 @@ func GetClient(name string) (cli *Client, err error) {
 	return
 }
 
+// GetClientContext 获取绑定 ctx 的 client，命令遵循 ctx 的 deadline，ctx 结束后命令直接返回错误
+func GetClientContext(ctx context.Context, name string) (cli *Client, err error) {
+	pool, err := GetPool(name)
+	if err != nil {
+		return
+	}
+
+	return pool.GetClientContext(ctx)
+}
+
 // kv start
 type KeyType string
 
@@ -90,7 +101,8 @@ func (c *Client) doCmd(cmd string, args ...any) (reply any, err error) {
 	if err == nil {
 		return
 	}
-	if err != redis.ErrNil {
+	// ctx 的错误保持原样，调用方可以用 errors.Is 判断
+	if err != redis.ErrNil && err != context.Canceled && err != context.DeadlineExceeded {
 		err = errors.New(err.Error())
 	}
 	return
@@ -0,0 +1,531 @@
+package redispool
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	clusterSlots = 16384
+	maxRedirects = 5 // MOVED/ASK 最多重定向的次数
+)
+
+var errTooManyRedirects = errors.New("redis cluster too many redirects")
+
+// keylessCmds 没有 key 的命令，发送到任意节点
+var keylessCmds = map[string]bool{
+	"PING": true, "ECHO": true, "TIME": true, "INFO": true, "DBSIZE": true,
+	"SCAN": true, "KEYS": true, "RANDOMKEY": true, "FLUSHDB": true, "FLUSHALL": true,
+	"AUTH": true, "SELECT": true, "ASKING": true, "READONLY": true, "CLUSTER": true,
+	"PUBLISH": true, "SUBSCRIBE": true, "PSUBSCRIBE": true, "UNSUBSCRIBE": true, "PUNSUBSCRIBE": true,
+	"SCRIPT": true, "CLIENT": true, "CONFIG": true, "WAIT": true,
+	"MULTI": true, "EXEC": true, "DISCARD": true, "UNWATCH": true,
+}
+
+// cluster 维护 slot 到节点的映射和每个节点的连接池
+type cluster struct {
+	param *PoolParam
+	opts  []redis.DialOption
+
+	lk    sync.RWMutex
+	slots []string // slot -> 节点地址
+	pools map[string]*redis.Pool
+
+	refreshCh chan struct{}
+}
+
+func newClusterPool(param *PoolParam, opts []redis.DialOption) (pool *Pool, err error) {
+	c := &cluster{
+		param:     param,
+		opts:      opts,
+		slots:     make([]string, clusterSlots),
+		pools:     make(map[string]*redis.Pool),
+		refreshCh: make(chan struct{}, 1),
+	}
+
+	if err = c.refresh(); err != nil {
+		return
+	}
+
+	pool = &Pool{param: param, cluster: c, hooks: param.Hooks}
+	go c.loop()
+	return
+}
+
+// Slot 返回 key 在 cluster 中的 slot，key 中有 {tag} 时只使用 tag 计算
+func Slot(key string) uint16 {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return crc16(key) % clusterSlots
+}
+
+// crc16 CCITT/XMODEM
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// loop 收到 MOVED 后异步刷新，并定时刷新 slot 映射
+func (c *cluster) loop() {
+	sec := c.param.HealthCheckIntervalSec
+	if sec <= 0 {
+		sec = 10
+	}
+	tk := time.NewTicker(time.Duration(sec) * time.Second)
+	for {
+		select {
+		case <-tk.C:
+		case <-c.refreshCh:
+		}
+
+		if err := c.refresh(); err != nil {
+			log.Printf("[ERROR] refresh redis cluster slots error: %s\n", err.Error())
+		}
+	}
+}
+
+func (c *cluster) triggerRefresh() {
+	select {
+	case c.refreshCh <- struct{}{}:
+	default:
+	}
+}
+
+// refresh 从已知节点和种子节点中依次获取 CLUSTER SLOTS
+func (c *cluster) refresh() (err error) {
+	for _, addr := range c.nodes() {
+		if err = c.refreshFrom(addr); err == nil {
+			return
+		}
+		log.Printf("[ERROR] redis cluster slots from %s error: %s\n", addr, err.Error())
+	}
+
+	if err == nil {
+		err = errors.New("no cluster node available")
+	}
+	return
+}
+
+func (c *cluster) refreshFrom(addr string) error {
+	conn := c.pool(addr).Get()
+	defer conn.Close()
+
+	ranges, err := redis.Values(conn.Do("CLUSTER", "SLOTS"))
+	if err != nil {
+		return err
+	}
+
+	slots := make([]string, clusterSlots)
+	for _, r := range ranges {
+		fields, err := redis.Values(r, nil)
+		if err != nil || len(fields) < 3 {
+			return fmt.Errorf("unexpected cluster slots reply: %v", r)
+		}
+
+		start, _ := redis.Int(fields[0], nil)
+		end, _ := redis.Int(fields[1], nil)
+		master, err := redis.Values(fields[2], nil)
+		if err != nil || len(master) < 2 {
+			return fmt.Errorf("unexpected cluster slots node: %v", fields[2])
+		}
+		host, _ := redis.String(master[0], nil)
+		port, _ := redis.Int(master[1], nil)
+		if host == "" { //节点地址为空时表示与当前节点相同
+			host, _, _ = net.SplitHostPort(addr)
+		}
+
+		node := net.JoinHostPort(host, strconv.Itoa(port))
+		for slot := start; slot <= end && slot < clusterSlots; slot++ {
+			slots[slot] = node
+		}
+	}
+
+	// 下线或者迁移走所有 slot 的节点不再是已知节点，关闭它的连接池
+	live := make(map[string]bool)
+	for _, node := range slots {
+		live[node] = true
+	}
+
+	var dropped []*redis.Pool
+	c.lk.Lock()
+	c.slots = slots
+	for node, p := range c.pools {
+		if !live[node] {
+			delete(c.pools, node)
+			dropped = append(dropped, p)
+		}
+	}
+	c.lk.Unlock()
+
+	for _, p := range dropped {
+		p.Close()
+	}
+	return nil
+}
+
+// nodes 已知的节点，没有时使用种子节点
+func (c *cluster) nodes() []string {
+	c.lk.RLock()
+	nodes := make([]string, 0, len(c.pools))
+	for addr := range c.pools {
+		nodes = append(nodes, addr)
+	}
+	c.lk.RUnlock()
+
+	c.param.lock.RLock()
+	defer c.param.lock.RUnlock()
+	for _, addr := range c.param.addrList {
+		nodes = append(nodes, addr)
+	}
+
+	rand.Shuffle(len(nodes), func(i, j int) { nodes[i], nodes[j] = nodes[j], nodes[i] })
+	return nodes
+}
+
+// pool 返回节点的连接池，不存在时创建
+func (c *cluster) pool(addr string) *redis.Pool {
+	c.lk.RLock()
+	p, ok := c.pools[addr]
+	c.lk.RUnlock()
+	if ok {
+		return p
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if p, ok = c.pools[addr]; ok {
+		return p
+	}
+
+	p = newRedisPool(c.param, func() (string, error) { return addr, nil }, c.opts)
+	c.pools[addr] = p
+	return p
+}
+
+func (c *cluster) addrBySlot(slot uint16) string {
+	c.lk.RLock()
+	addr := c.slots[slot]
+	c.lk.RUnlock()
+
+	if addr == "" {
+		c.triggerRefresh()
+		addr = c.nodes()[0]
+	}
+	return addr
+}
+
+func (c *cluster) setSlot(slot uint16, addr string) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.slots[slot] = addr
+}
+
+// redirect 解析 MOVED 和 ASK 错误
+func redirect(err error) (ask bool, slot uint16, addr string, ok bool) {
+	re, isRedisErr := err.(redis.Error)
+	if !isRedisErr {
+		return
+	}
+
+	fields := strings.Fields(string(re))
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return
+	}
+
+	n, e := strconv.Atoi(fields[1])
+	if e != nil {
+		return
+	}
+	return fields[0] == "ASK", uint16(n), fields[2], true
+}
+
+// keyOf 返回命令的第一个 key，没有 key 时返回 false
+func keyOf(cmd string, args []any) (string, bool) {
+	if len(args) == 0 || keylessCmds[cmd] {
+		return "", false
+	}
+
+	idx := 0
+	switch cmd {
+	case "EVAL", "EVALSHA": // script numkeys key...
+		if len(args) < 3 {
+			return "", false
+		}
+		if numKeys(args[1]) == 0 {
+			return "", false
+		}
+		idx = 2
+	case "XGROUP", "XINFO": // subcommand key ...
+		if len(args) < 2 {
+			return "", false
+		}
+		idx = 1
+	case "XREAD", "XREADGROUP": // ... STREAMS key...
+		idx = -1
+		for i, a := range args {
+			if s, ok := a.(string); ok && strings.EqualFold(s, "STREAMS") && i+1 < len(args) {
+				idx = i + 1
+				break
+			}
+		}
+		if idx < 0 {
+			return "", false
+		}
+	}
+
+	switch k := args[idx].(type) {
+	case string:
+		return k, true
+	case []byte:
+		return string(k), true
+	default:
+		return fmt.Sprint(k), true
+	}
+}
+
+// numKeys 解析 EVAL 的 numkeys 参数，参数可能是整数也可能是字符串
+func numKeys(arg any) int {
+	switch v := arg.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(v)
+		return n
+	case []byte:
+		n, _ := strconv.Atoi(string(v))
+		return n
+	default:
+		return 0
+	}
+}
+
+// clusterConn 实现 redis.Conn，每个命令按 key 路由到对应的节点，处理 MOVED 和 ASK 重定向。
+// WATCH 和 MULTI 之后的命令固定发送到同一个节点，直到 EXEC、DISCARD 或 UNWATCH。
+// Send/Flush/Receive 在 Flush 时逐个执行，不支持订阅
+type clusterConn struct {
+	c     *cluster
+	conns map[string]redis.Conn // 已经从节点连接池中取出的连接，Close 时归还
+
+	pinned string // 事务固定的节点
+	multi  bool   // 收到 MULTI 但还没确定节点
+
+	pending []pendingCmd
+	replies []pendingReply
+	err     error
+
+	timeout time.Duration // DoWithTimeout 指定的读超时
+}
+
+type pendingCmd struct {
+	cmd  string
+	args []any
+}
+
+type pendingReply struct {
+	reply any
+	err   error
+}
+
+var errClusterConnClosed = errors.New("redis cluster conn closed")
+
+var _ redis.ConnWithTimeout = (*clusterConn)(nil)
+
+func newClusterConn(c *cluster) *clusterConn {
+	return &clusterConn{c: c, conns: make(map[string]redis.Conn)}
+}
+
+func (cc *clusterConn) Close() error {
+	for _, conn := range cc.conns {
+		conn.Close()
+	}
+	cc.conns = nil
+	cc.err = errClusterConnClosed
+	return nil
+}
+
+func (cc *clusterConn) Err() error {
+	return cc.err
+}
+
+func (cc *clusterConn) conn(addr string) redis.Conn {
+	conn, ok := cc.conns[addr]
+	if !ok {
+		conn = cc.c.pool(addr).Get()
+		cc.conns[addr] = conn
+	}
+	return conn
+}
+
+func (cc *clusterConn) Do(cmd string, args ...any) (any, error) {
+	if cc.err != nil {
+		return nil, cc.err
+	}
+	if cmd == "" { // 与 redis.Conn 一致，Do("") 执行所有 Send 的命令
+		if err := cc.Flush(); err != nil {
+			return nil, err
+		}
+		var reply any
+		var err error
+		for len(cc.replies) > 0 {
+			reply, err = cc.Receive()
+		}
+		return reply, err
+	}
+
+	cmd = strings.ToUpper(cmd)
+	switch cmd {
+	case "MULTI":
+		if cc.pinned == "" {
+			cc.multi = true
+			return "OK", nil
+		}
+	case "EXEC", "DISCARD", "UNWATCH":
+		defer cc.unpin()
+		if cc.multi { // 事务中没有命令
+			if cmd == "EXEC" {
+				return []any{}, nil
+			}
+			return "OK", nil
+		}
+	}
+
+	addr := cc.pinned
+	if addr == "" {
+		if key, ok := keyOf(cmd, args); ok {
+			addr = cc.c.addrBySlot(Slot(key))
+		} else {
+			addr = cc.c.nodes()[0]
+		}
+	}
+
+	if cmd == "WATCH" || cc.multi {
+		return cc.pin(addr, cmd, args)
+	}
+	if cc.pinned != "" {
+		return cc.exec(cc.conn(addr), cmd, args)
+	}
+	return cc.do(addr, cmd, args)
+}
+
+// pin 事务的第一个命令确定节点
+func (cc *clusterConn) pin(addr, cmd string, args []any) (any, error) {
+	cc.pinned = addr
+	conn := cc.conn(addr)
+	if cc.multi {
+		cc.multi = false
+		if _, err := conn.Do("MULTI"); err != nil {
+			return nil, err
+		}
+	}
+	return cc.exec(conn, cmd, args)
+}
+
+func (cc *clusterConn) unpin() {
+	cc.pinned = ""
+	cc.multi = false
+}
+
+// do 发送命令，处理 MOVED 和 ASK 重定向
+func (cc *clusterConn) do(addr, cmd string, args []any) (any, error) {
+	asking := false
+	for i := 0; i < maxRedirects; i++ {
+		conn := cc.conn(addr)
+		if asking {
+			if _, err := conn.Do("ASKING"); err != nil {
+				return nil, err
+			}
+		}
+
+		reply, err := cc.exec(conn, cmd, args)
+		ask, slot, to, ok := redirect(err)
+		if !ok {
+			return reply, err
+		}
+
+		if !ask {
+			cc.c.setSlot(slot, to)
+			cc.c.triggerRefresh()
+		}
+		addr, asking = to, ask
+	}
+	return nil, errTooManyRedirects
+}
+
+// DoWithTimeout 与 Do 相同，读超时使用 timeout，用于 XREADGROUP BLOCK 等阻塞命令
+func (cc *clusterConn) DoWithTimeout(timeout time.Duration, cmd string, args ...any) (any, error) {
+	cc.timeout = timeout
+	defer func() { cc.timeout = 0 }()
+	return cc.Do(cmd, args...)
+}
+
+func (cc *clusterConn) exec(conn redis.Conn, cmd string, args []any) (any, error) {
+	if cc.timeout > 0 {
+		return redis.DoWithTimeout(conn, cc.timeout, cmd, args...)
+	}
+	return conn.Do(cmd, args...)
+}
+
+func (cc *clusterConn) Send(cmd string, args ...any) error {
+	if cc.err != nil {
+		return cc.err
+	}
+	cc.pending = append(cc.pending, pendingCmd{cmd: cmd, args: args})
+	return nil
+}
+
+func (cc *clusterConn) Flush() error {
+	if cc.err != nil {
+		return cc.err
+	}
+
+	pending := cc.pending
+	cc.pending = nil
+	for _, p := range pending {
+		reply, err := cc.Do(p.cmd, p.args...)
+		cc.replies = append(cc.replies, pendingReply{reply: reply, err: err})
+	}
+	return nil
+}
+
+func (cc *clusterConn) Receive() (any, error) {
+	if cc.err != nil {
+		return nil, cc.err
+	}
+	if len(cc.replies) == 0 {
+		return nil, errors.New("redis cluster conn: no pending reply")
+	}
+
+	r := cc.replies[0]
+	cc.replies = cc.replies[1:]
+	return r.reply, r.err
+}
+
+// ReceiveWithTimeout 回包在 Flush 时已经收到，忽略 timeout
+func (cc *clusterConn) ReceiveWithTimeout(timeout time.Duration) (any, error) {
+	return cc.Receive()
+}
@@ -0,0 +1,195 @@
+package redispool
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSlot(t *testing.T) {
+	if crc16("123456789") != 0x31c3 {
+		t.Fatalf("crc16 = %x", crc16("123456789"))
+	}
+	if Slot("foo") != 12182 || Slot("bar") != 5061 {
+		t.Fatalf("slot foo = %d, bar = %d", Slot("foo"), Slot("bar"))
+	}
+	if Slot("{user1000}.following") != Slot("{user1000}.followers") {
+		t.Fatal("hash tag should map to the same slot")
+	}
+	if Slot("{}foo") == Slot("{}bar") {
+		t.Fatal("empty hash tag should use the whole key")
+	}
+}
+
+func TestKeyOf(t *testing.T) {
+	cases := []struct {
+		cmd  string
+		args []any
+		key  string
+		ok   bool
+	}{
+		{"GET", []any{"foo"}, "foo", true},
+		{"EVALSHA", []any{"sha"}, "", false}, // 参数不完整时不能越界
+		{"EVAL", []any{"src", 0}, "", false},
+		{"EVAL", []any{"src", 1, "foo", "arg"}, "foo", true},
+		{"EVALSHA", []any{"sha", "1", "bar"}, "bar", true},
+		{"XGROUP", []any{"CREATE"}, "", false},
+		{"PING", nil, "", false},
+	}
+	for _, c := range cases {
+		if key, ok := keyOf(c.cmd, c.args); key != c.key || ok != c.ok {
+			t.Fatalf("keyOf(%s %v) = %s, %v", c.cmd, c.args, key, ok)
+		}
+	}
+}
+
+func newTestClusterPool(t *testing.T, seed *fakeServer) *Pool {
+	pool, err := NewPoolWithParam(&PoolParam{
+		Addr:      seed.addr,
+		Mode:      ModeCluster,
+		MaxIdle:   2,
+		MaxActive: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func TestCluster(t *testing.T) {
+	_, nodes := newFakeCluster(t, 3)
+	pool := newTestClusterPool(t, nodes[0])
+
+	cli, err := pool.GetClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Put()
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if err = cli.Set(key, i); err != nil {
+			t.Fatal(err)
+		}
+
+		owner := nodes[int(Slot(key))*3/clusterSlots]
+		if !owner.has(key) {
+			t.Fatalf("%s should be set on %s", key, owner.addr)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		val, ok, err := cli.GetInt64(fmt.Sprintf("key%d", i))
+		if err != nil || !ok || val != int64(i) {
+			t.Fatalf("get key%d = %d, %v, %v", i, val, ok, err)
+		}
+	}
+
+	// 不经过 MOVED 直接路由到节点
+	for _, n := range nodes {
+		n.mu.Lock()
+		for _, cmd := range n.cmds {
+			if cmd != "GET" && cmd != "SET" && cmd != "CLUSTER" {
+				t.Errorf("unexpected cmd %s on %s", cmd, n.addr)
+			}
+		}
+		n.mu.Unlock()
+	}
+}
+
+func TestClusterMoved(t *testing.T) {
+	c, nodes := newFakeCluster(t, 2)
+	pool := newTestClusterPool(t, nodes[0])
+
+	cli, _ := pool.GetClient()
+	defer cli.Put()
+
+	const key = "foo"
+	slot := int(Slot(key))
+	if err := cli.Set(key, "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// slot 迁移到另一个节点，客户端还不知道
+	from := c.owner[slot]
+	to := nodes[0]
+	if from == to {
+		to = nodes[1]
+	}
+	c.move(slot, to)
+
+	val, ok, err := cli.Get(key)
+	if err != nil || !ok || string(val) != "1" {
+		t.Fatalf("get after moved = %s, %v, %v", val, ok, err)
+	}
+	if addr := pool.cluster.addrBySlot(uint16(slot)); addr != to.addr {
+		t.Fatalf("slot %d addr = %s, want %s", slot, addr, to.addr)
+	}
+}
+
+func TestClusterAsk(t *testing.T) {
+	c, nodes := newFakeCluster(t, 2)
+	pool := newTestClusterPool(t, nodes[0])
+
+	cli, _ := pool.GetClient()
+	defer cli.Put()
+
+	const key = "foo"
+	slot := int(Slot(key))
+	from := c.owner[slot]
+	to := nodes[0]
+	if from == to {
+		to = nodes[1]
+	}
+
+	// 迁移中，key 不在源节点时返回 ASK，写到目标节点
+	c.mu.Lock()
+	c.migrating[slot] = to
+	c.mu.Unlock()
+
+	if err := cli.Set(key, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if !to.has(key) || from.has(key) {
+		t.Fatal("key should be set on the importing node")
+	}
+	if addr := pool.cluster.addrBySlot(uint16(slot)); addr != from.addr {
+		t.Fatal("ASK should not update slot mapping")
+	}
+
+	to.mu.Lock()
+	cmds := strings.Join(to.cmds, ",")
+	to.mu.Unlock()
+	if !strings.Contains(cmds, "ASKING,SET") {
+		t.Fatalf("cmds on importing node = %s", cmds)
+	}
+}
+
+func TestClusterPrunePools(t *testing.T) {
+	c, nodes := newFakeCluster(t, 2)
+	pool := newTestClusterPool(t, nodes[0])
+
+	cli, _ := pool.GetClient()
+	defer cli.Put()
+	for i := 0; i < 10; i++ {
+		if err := cli.Set(fmt.Sprintf("key%d", i), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// nodes[1] 的 slot 全部迁移到 nodes[0]，刷新后不再保留 nodes[1] 的连接池
+	c.mu.Lock()
+	for slot := range c.owner {
+		c.owner[slot] = nodes[0]
+	}
+	c.mu.Unlock()
+	if err := pool.cluster.refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	pool.cluster.lk.RLock()
+	defer pool.cluster.lk.RUnlock()
+	if _, ok := pool.cluster.pools[nodes[1].addr]; ok || len(pool.cluster.pools) != 1 {
+		t.Fatalf("pools not pruned: %d", len(pool.cluster.pools))
+	}
+}
@@ -0,0 +1,224 @@
+package redispool
+
+import (
+	"context"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ctxConn 绑定 context 的连接：命令执行前检查 ctx，ctx 有 deadline 时作为读超时，并在命令前后调用 Hook。
+// 超时后底层连接不可用，归还时从连接池中丢弃
+type ctxConn struct {
+	redis.Conn
+	ctx   context.Context
+	hooks []Hook
+
+	pending []sentCmd // 已经 Send 还没 Receive 的命令
+}
+
+type sentCmd struct {
+	ctx   context.Context
+	cmd   string
+	args  []any
+	start time.Time
+}
+
+var _ redis.ConnWithTimeout = (*ctxConn)(nil)
+
+func newCtxConn(ctx context.Context, conn redis.Conn, hooks []Hook) *ctxConn {
+	if cc, ok := conn.(*ctxConn); ok {
+		conn = cc.Conn
+	}
+	return &ctxConn{Conn: conn, ctx: ctx, hooks: hooks}
+}
+
+// GetClientContext 从连接池中获取绑定 ctx 的 Client，所有命令都会检查 ctx 并遵循它的 deadline
+func (p *Pool) GetClientContext(ctx context.Context) (cli *Client, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	conn, err := p.getConn()
+	if err != nil {
+		return
+	}
+
+	cli = &Client{Conn: newCtxConn(ctx, conn, p.getHooks())}
+	return
+}
+
+// WithContext 返回绑定 ctx 的 Client，与 c 共用同一个连接，只需要 Put 一次
+func (c *Client) WithContext(ctx context.Context) *Client {
+	var hooks []Hook
+	if cc, ok := c.Conn.(*ctxConn); ok {
+		hooks = cc.hooks
+	}
+	return &Client{Conn: newCtxConn(ctx, c.Conn, hooks)}
+}
+
+// Context 返回 Client 绑定的 ctx，没有绑定时返回 context.Background()
+func (c *Client) Context() context.Context {
+	if cc, ok := c.Conn.(*ctxConn); ok {
+		return cc.ctx
+	}
+	return context.Background()
+}
+
+// timeout 根据 ctx 的 deadline 计算读超时，timeout 为 0 表示使用连接默认的超时
+func (c *ctxConn) timeout(timeout time.Duration) (time.Duration, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if deadline, ok := c.ctx.Deadline(); ok {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return 0, context.DeadlineExceeded
+		}
+		if timeout <= 0 || left < timeout {
+			timeout = left
+		}
+	}
+	return timeout, nil
+}
+
+// wrapErr 因为 ctx 超时或者取消导致的网络错误，返回 ctx 的错误
+func (c *ctxConn) wrapErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(redis.Error); ok {
+		return err
+	}
+	if ctxErr := c.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	// 读超时可能比 ctx 的定时器先触发
+	if deadline, ok := c.ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+func (c *ctxConn) Do(cmd string, args ...any) (any, error) {
+	return c.DoWithTimeout(0, cmd, args...)
+}
+
+func (c *ctxConn) DoWithTimeout(timeout time.Duration, cmd string, args ...any) (reply any, err error) {
+	// 有 Send 的命令时与 redis.Conn 一致，返回最后一个命令的回包
+	if cmd == "" || len(c.pending) > 0 {
+		if cmd != "" {
+			if err = c.Send(cmd, args...); err != nil {
+				return
+			}
+		}
+		return c.receiveAll(timeout)
+	}
+
+	if timeout, err = c.timeout(timeout); err != nil {
+		return
+	}
+
+	ctx := c.before(c.ctx, cmd, args)
+	start := time.Now()
+	if timeout > 0 {
+		reply, err = redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+	} else {
+		reply, err = c.Conn.Do(cmd, args...)
+	}
+	err = c.wrapErr(err)
+	c.after(ctx, cmd, args, hookErr(reply, err), time.Since(start))
+	return
+}
+
+func (c *ctxConn) receiveAll(timeout time.Duration) (reply any, err error) {
+	if err = c.Flush(); err != nil {
+		c.failPending(err)
+		return
+	}
+
+	var first error
+	for len(c.pending) > 0 {
+		reply, err = c.ReceiveWithTimeout(timeout)
+		if _, ok := err.(redis.Error); !ok && err != nil {
+			c.failPending(err)
+			return nil, err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return reply, first
+}
+
+// failPending 连接出错后不会再收到剩余命令的回包，用该错误结束这些命令的 Hook
+func (c *ctxConn) failPending(err error) {
+	for _, sent := range c.pending {
+		c.after(sent.ctx, sent.cmd, sent.args, err, time.Since(sent.start))
+	}
+	c.pending = nil
+}
+
+func (c *ctxConn) Send(cmd string, args ...any) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+
+	ctx := c.before(c.ctx, cmd, args)
+	if err := c.Conn.Send(cmd, args...); err != nil {
+		c.after(ctx, cmd, args, err, 0)
+		return err
+	}
+	c.pending = append(c.pending, sentCmd{ctx: ctx, cmd: cmd, args: args, start: time.Now()})
+	return nil
+}
+
+func (c *ctxConn) Receive() (any, error) {
+	return c.ReceiveWithTimeout(0)
+}
+
+// ReceiveWithTimeout 已经发送的命令必须读取回包，ctx 结束时不提前返回，只用很短的读超时让连接失效
+func (c *ctxConn) ReceiveWithTimeout(timeout time.Duration) (reply any, err error) {
+	if deadline, ok := c.ctx.Deadline(); ok {
+		left := max(time.Until(deadline), time.Nanosecond)
+		if timeout <= 0 || left < timeout {
+			timeout = left
+		}
+	}
+
+	if timeout > 0 {
+		reply, err = redis.ReceiveWithTimeout(c.Conn, timeout)
+	} else {
+		reply, err = c.Conn.Receive()
+	}
+	err = c.wrapErr(err)
+
+	if len(c.pending) > 0 {
+		sent := c.pending[0]
+		c.pending = c.pending[1:]
+		c.after(sent.ctx, sent.cmd, sent.args, hookErr(reply, err), time.Since(sent.start))
+	}
+	return
+}
+
+func (c *ctxConn) before(ctx context.Context, cmd string, args []any) context.Context {
+	for _, h := range c.hooks {
+		ctx = h.Before(ctx, cmd, args)
+	}
+	return ctx
+}
+
+func (c *ctxConn) after(ctx context.Context, cmd string, args []any, err error, cost time.Duration) {
+	for i := len(c.hooks) - 1; i >= 0; i-- {
+		c.hooks[i].After(ctx, cmd, args, err, cost)
+	}
+}
+
+// hookErr 回包为 nil(key 不存在)时传给 Hook 的错误为 ErrNil
+func hookErr(reply any, err error) error {
+	if err == nil && reply == nil {
+		return ErrNil
+	}
+	return err
+}
@@ -0,0 +1,201 @@
+package redispool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lightmen/nami/metrics"
+)
+
+const sleepScript = "redis.call('SLEEP')"
+
+type recordHook struct {
+	mu   sync.Mutex
+	cmds []string
+	errs []error
+}
+
+func (h *recordHook) Before(ctx context.Context, cmd string, args []any) context.Context {
+	return context.WithValue(ctx, h, cmd)
+}
+
+func (h *recordHook) After(ctx context.Context, cmd string, args []any, err error, cost time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ctx.Value(h) != cmd {
+		panic("ctx from Before is not passed to After")
+	}
+	h.cmds = append(h.cmds, cmd)
+	h.errs = append(h.errs, err)
+}
+
+func TestClientContext(t *testing.T) {
+	s := newFakeServer(t)
+	s.defineScript(sleepScript, func(s *fakeServer, keys, args []string) any {
+		time.Sleep(200 * time.Millisecond)
+		return "OK"
+	})
+	pool := newTestPool(t, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cli, err := pool.GetClientContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Put()
+	if err = cli.Set("a", 1); err != nil {
+		t.Fatal(err)
+	}
+	if cli.Context() != ctx {
+		t.Fatal("context not bound")
+	}
+
+	cancel()
+	if _, _, err = cli.Get("a"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("get after cancel = %v", err)
+	}
+	if _, err = pool.GetClientContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("get client after cancel = %v", err)
+	}
+
+	// 超过 deadline 时返回 context.DeadlineExceeded
+	raw, _ := pool.GetClient()
+	defer raw.Put()
+	tctx, tcancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer tcancel()
+	start := time.Now()
+	if _, err = raw.WithContext(tctx).Do("EVAL", sleepScript, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("eval = %v", err)
+	}
+	if cost := time.Since(start); cost > 150*time.Millisecond {
+		t.Fatalf("deadline not honored, cost %v", cost)
+	}
+	if raw.Err() == nil {
+		t.Fatal("timed out conn should not be reused")
+	}
+}
+
+func TestHook(t *testing.T) {
+	s := newFakeServer(t)
+	pool := newTestPool(t, s)
+	h := &recordHook{}
+	pool.AddHook(h)
+
+	cli, _ := pool.GetClient()
+	defer cli.Put()
+
+	cli.Set("a", 1)
+	cli.Get("none")
+	cli.Pipelined(func(p *Pipeline) {
+		p.IncrBy("a", 1)
+		p.Do("UNKNOWN")
+	})
+	// WithContext 保留 hook
+	cli.WithContext(context.Background()).Del("a")
+
+	want := []string{"SET", "GET", "INCRBY", "UNKNOWN", "DEL"}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.cmds) != len(want) {
+		t.Fatalf("cmds = %v", h.cmds)
+	}
+	for i, cmd := range want {
+		if h.cmds[i] != cmd {
+			t.Fatalf("cmds = %v", h.cmds)
+		}
+	}
+	if h.errs[0] != nil || h.errs[2] != nil || h.errs[3] == nil {
+		t.Fatalf("errs = %v", h.errs)
+	}
+}
+
+func TestHookReceiveAllError(t *testing.T) {
+	s := newFakeServer(t)
+	s.defineScript(sleepScript, func(s *fakeServer, keys, args []string) any {
+		time.Sleep(200 * time.Millisecond)
+		return "OK"
+	})
+	pool := newTestPool(t, s)
+	h := &recordHook{}
+	pool.AddHook(h)
+
+	cli, _ := pool.GetClient()
+	defer cli.Put()
+
+	// 第一个命令读超时后连接失效，剩余命令收不到回包，也要以该错误调用 After
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	conn := cli.WithContext(ctx).Conn
+	conn.Send("EVAL", sleepScript, 0)
+	conn.Send("INCRBY", "a", 1)
+	conn.Send("GET", "a")
+	if _, err := conn.Do(""); err == nil {
+		t.Fatal("expect timeout error")
+	}
+
+	want := []string{"EVAL", "INCRBY", "GET"}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.cmds) != len(want) {
+		t.Fatalf("cmds = %v", h.cmds)
+	}
+	for i, cmd := range want {
+		if h.cmds[i] != cmd || h.errs[i] == nil {
+			t.Fatalf("cmds = %v, errs = %v", h.cmds, h.errs)
+		}
+	}
+}
+
+type fakeObserver struct {
+	mu   sync.Mutex
+	lvs  []string
+	seen map[string]int
+}
+
+func (o *fakeObserver) With(lvs ...string) metrics.Observer {
+	return &fakeObserver{lvs: lvs, seen: o.seen}
+}
+
+func (o *fakeObserver) Observe(float64) {
+	o.seen[o.lvs[1]]++
+}
+
+type fakeCounter struct {
+	lvs  []string
+	seen map[string]int
+}
+
+func (c *fakeCounter) With(lvs ...string) metrics.Counter {
+	return &fakeCounter{lvs: lvs, seen: c.seen}
+}
+
+func (c *fakeCounter) Inc() {
+	c.seen[c.lvs[1]+"|"+c.lvs[2]]++
+}
+
+func (c *fakeCounter) Add(delta float64) {}
+
+func TestMetricsHook(t *testing.T) {
+	s := newFakeServer(t)
+	pool := newTestPool(t, s)
+	seconds := &fakeObserver{seen: make(map[string]int)}
+	requests := &fakeCounter{seen: make(map[string]int)}
+	pool.AddHook(NewMetricsHook("test", seconds, requests), NewSlowLogHook(time.Hour))
+
+	cli, _ := pool.GetClient()
+	defer cli.Put()
+	cli.Set("a", 1)
+	cli.Get("a")
+	cli.Get("none")
+	cli.Do("UNKNOWN")
+
+	if seconds.seen["GET"] != 2 || seconds.seen["SET"] != 1 {
+		t.Fatalf("seconds = %v", seconds.seen)
+	}
+	if requests.seen["GET|ok"] != 1 || requests.seen["UNKNOWN|error"] != 1 {
+		t.Fatalf("requests = %v", requests.seen)
+	}
+}
@@ -0,0 +1,140 @@
+package redispool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lightmen/nami/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Hook 命令执行前后的回调，用于监控、链路追踪和慢日志。
+// Before 返回的 ctx 会传给同一个命令的 After；pipeline 中的命令在 Send 时调用 Before，Receive 时调用 After。
+// 回包为 nil 时 After 的 err 为 ErrNil
+type Hook interface {
+	Before(ctx context.Context, cmd string, args []any) context.Context
+	After(ctx context.Context, cmd string, args []any, err error, cost time.Duration)
+}
+
+// AddHook 添加命令回调，之后获取的 Client 生效
+func (p *Pool) AddHook(hooks ...Hook) {
+	p.hookLk.Lock()
+	defer p.hookLk.Unlock()
+
+	// 写时复制，已经获取的 Client 使用旧的列表
+	all := make([]Hook, 0, len(p.hooks)+len(hooks))
+	all = append(all, p.hooks...)
+	p.hooks = append(all, hooks...)
+}
+
+func (p *Pool) getHooks() []Hook {
+	p.hookLk.RLock()
+	defer p.hookLk.RUnlock()
+	return p.hooks
+}
+
+type metricsHook struct {
+	name     string
+	seconds  metrics.Observer
+	requests metrics.Counter
+}
+
+// NewMetricsHook 统计命令的耗时和结果，name 一般为连接池的名字，seconds 和 requests 可以为 nil
+//
+//	histogram: redis_cmd_durations_bucket{name, cmd}，单位毫秒
+//	counter: redis_cmd_requests_total{name, cmd, status}，status 为 ok、nil 或 error
+func NewMetricsHook(name string, seconds metrics.Observer, requests metrics.Counter) Hook {
+	return &metricsHook{name: name, seconds: seconds, requests: requests}
+}
+
+func (h *metricsHook) Before(ctx context.Context, cmd string, args []any) context.Context {
+	return ctx
+}
+
+func (h *metricsHook) After(ctx context.Context, cmd string, args []any, err error, cost time.Duration) {
+	cmd = strings.ToUpper(cmd)
+	if h.seconds != nil {
+		h.seconds.With(h.name, cmd).Observe(float64(cost.Milliseconds()))
+	}
+
+	if h.requests != nil {
+		status := "ok"
+		if errors.Is(err, ErrNil) {
+			status = "nil"
+		} else if err != nil {
+			status = "error"
+		}
+		h.requests.With(h.name, cmd, status).Inc()
+	}
+}
+
+type tracingHook struct {
+	tracer trace.Tracer
+}
+
+// NewTracingHook 为每个命令创建一个 client span，作为 ctx 中 span 的子 span
+func NewTracingHook() Hook {
+	return &tracingHook{tracer: otel.Tracer("nami/redispool")}
+}
+
+func (h *tracingHook) Before(ctx context.Context, cmd string, args []any) context.Context {
+	cmd = strings.ToUpper(cmd)
+	ctx, _ = h.tracer.Start(ctx, "redis "+cmd, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "redis"), attribute.String("db.operation", cmd)))
+	return ctx
+}
+
+func (h *tracingHook) After(ctx context.Context, cmd string, args []any, err error, cost time.Duration) {
+	span := trace.SpanFromContext(ctx)
+	if err != nil && !errors.Is(err, ErrNil) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetStatus(codes.Ok, "OK")
+	}
+	span.End()
+}
+
+const maxSlowLogArgs = 8
+
+type slowLogHook struct {
+	threshold time.Duration
+}
+
+// NewSlowLogHook 打印耗时超过 threshold 的命令
+func NewSlowLogHook(threshold time.Duration) Hook {
+	return &slowLogHook{threshold: threshold}
+}
+
+func (h *slowLogHook) Before(ctx context.Context, cmd string, args []any) context.Context {
+	return ctx
+}
+
+func (h *slowLogHook) After(ctx context.Context, cmd string, args []any, err error, cost time.Duration) {
+	if cost < h.threshold {
+		return
+	}
+
+	// 参数可能很多或者很大，只打印前面几个
+	var b strings.Builder
+	b.WriteString(strings.ToUpper(cmd))
+	for i, arg := range args {
+		if i == maxSlowLogArgs {
+			fmt.Fprintf(&b, " ...(%d more)", len(args)-i)
+			break
+		}
+		s := fmt.Sprint(arg)
+		if len(s) > 64 {
+			s = s[:64] + "..."
+		}
+		b.WriteString(" " + s)
+	}
+	log.Printf("[WARN] redis slow command cost %v: %s|%v", cost, b.String(), err)
+}
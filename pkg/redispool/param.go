@@ -33,6 +33,9 @@ type PoolParam struct {
 	avls                   int            //当前可用的地址个数
 	rrIndex                uint32         //RoundRobin的索引下标
 	Policy                 RoutePolicy    //负载均衡策略
+	Mode                   Mode           //部署模式，sentinel 模式下 Addr 为 sentinel 的地址列表，cluster 模式下 Addr 为种子节点的地址列表
+	MasterName             string         //sentinel 模式下 master 的名字
+	SentinelPass           string         //sentinel 的密码，没有则为空
 	Pass                   string         //密码，没有则为空
 	MaxIdle                int            //做多允许多少空闲连接
 	MaxActive              int            //最多允许多少并发连接
@@ -40,6 +43,7 @@ type PoolParam struct {
 	NetworkTimeoutMsec     int            //网络超时(connect,send,recv)，单位毫秒
 	HealthCheckIntervalSec int            //定时检查池子里面的节点是是否健康
 	retries                map[string]int //每个地址的失败次数
+	Hooks                  []Hook         //命令执行前后的回调，用于监控、链路追踪和慢日志
 }
 
 // 以下一些函数为了在运行时动态检测redis的地址列表，并且踢掉不健康的，以及运行时动态设置地址列表
@@ -56,6 +60,13 @@ func (p *PoolParam) setup() (err error) {
 
 	sort.Strings(p.addrList)
 	p.state = make([]bool, len(p.addrList))
+	if p.Mode != ModeStandalone { //sentinel 和 cluster 模式下地址只用于发现节点，不做检查
+		for i := range p.state {
+			p.state[i] = true
+		}
+		p.avls = len(p.state)
+		return
+	}
 	for i, addr := range p.addrList {
 		if err = p.checkRedisAddr(addr); err != nil {
 			return
@@ -0,0 +1,202 @@
+package redispool
+
+import (
+	"errors"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrNil 回包为 nil，比如 key 不存在
+var ErrNil = redis.ErrNil
+
+// Cmd 命令及其结果，Pipeline、事务和脚本执行之后通过类型方法获取结果
+type Cmd struct {
+	name  string
+	args  []any
+	reply any
+	err   error
+}
+
+func newCmd(name string, args ...any) *Cmd {
+	return &Cmd{name: name, args: args}
+}
+
+func (c *Cmd) Name() string {
+	return c.name
+}
+
+func (c *Cmd) Args() []any {
+	return c.args
+}
+
+func (c *Cmd) Err() error {
+	return c.err
+}
+
+func (c *Cmd) Reply() (any, error) {
+	return c.reply, c.err
+}
+
+func (c *Cmd) Int() (int, error) {
+	return redis.Int(c.reply, c.err)
+}
+
+func (c *Cmd) Int64() (int64, error) {
+	return redis.Int64(c.reply, c.err)
+}
+
+func (c *Cmd) Float64() (float64, error) {
+	return redis.Float64(c.reply, c.err)
+}
+
+func (c *Cmd) String() (string, error) {
+	return redis.String(c.reply, c.err)
+}
+
+func (c *Cmd) Bytes() ([]byte, error) {
+	return redis.Bytes(c.reply, c.err)
+}
+
+func (c *Cmd) Bool() (bool, error) {
+	return redis.Bool(c.reply, c.err)
+}
+
+func (c *Cmd) Strings() ([]string, error) {
+	return redis.Strings(c.reply, c.err)
+}
+
+func (c *Cmd) Values() ([]any, error) {
+	return redis.Values(c.reply, c.err)
+}
+
+func (c *Cmd) StringMap() (map[string]string, error) {
+	return redis.StringMap(c.reply, c.err)
+}
+
+func (c *Cmd) setReply(reply any, err error) {
+	if re, ok := reply.(redis.Error); ok && err == nil {
+		reply, err = nil, re
+	}
+	c.reply, c.err = reply, err
+}
+
+// Pipeline 批量发送命令，Exec 时一次发送并按顺序读取回包，减少网络往返
+//
+//	p := cli.Pipeline()
+//	incr := p.IncrBy("rank:score", 10)
+//	p.Expire("rank:score", 3600)
+//	if _, err := p.Exec(); err != nil { ... }
+//	score, _ := incr.Int()
+type Pipeline struct {
+	c    *Client
+	cmds []*Cmd
+}
+
+// Pipeline 创建 Pipeline
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{c: c}
+}
+
+// Pipelined 在 fn 中添加命令并执行
+func (c *Client) Pipelined(fn func(p *Pipeline)) ([]*Cmd, error) {
+	p := c.Pipeline()
+	fn(p)
+	return p.Exec()
+}
+
+// Do 添加命令，Exec 之后通过返回的 Cmd 获取结果
+func (p *Pipeline) Do(cmd string, args ...any) *Cmd {
+	c := newCmd(cmd, args...)
+	p.cmds = append(p.cmds, c)
+	return c
+}
+
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+// Exec 发送所有命令并读取回包，返回所有命令以及第一个失败命令的错误，执行之后清空命令
+func (p *Pipeline) Exec() ([]*Cmd, error) {
+	cmds := p.cmds
+	p.cmds = nil
+	if len(cmds) == 0 {
+		return cmds, nil
+	}
+
+	for _, c := range cmds {
+		if err := p.c.Conn.Send(c.name, c.args...); err != nil {
+			return cmds, err
+		}
+	}
+	if err := p.c.Conn.Flush(); err != nil {
+		return cmds, err
+	}
+
+	for _, c := range cmds {
+		c.setReply(p.c.Conn.Receive())
+	}
+
+	return cmds, firstErr(cmds)
+}
+
+// firstErr 返回第一个失败命令的错误，ErrNil 不算失败
+func firstErr(cmds []*Cmd) error {
+	for _, c := range cmds {
+		if c.err != nil && !errors.Is(c.err, ErrNil) {
+			return c.err
+		}
+	}
+	return nil
+}
+
+func (p *Pipeline) Get(key string) *Cmd {
+	return p.Do("GET", key)
+}
+
+func (p *Pipeline) Set(key string, val any) *Cmd {
+	return p.Do("SET", key, val)
+}
+
+func (p *Pipeline) SetEX(key string, ttl int, val any) *Cmd {
+	return p.Do("SETEX", key, ttl, val)
+}
+
+func (p *Pipeline) Del(keys ...string) *Cmd {
+	return p.Do("DEL", redis.Args{}.AddFlat(keys)...)
+}
+
+func (p *Pipeline) Expire(key string, ttl int) *Cmd {
+	return p.Do("EXPIRE", key, ttl)
+}
+
+func (p *Pipeline) IncrBy(key string, delta int) *Cmd {
+	return p.Do("INCRBY", key, delta)
+}
+
+func (p *Pipeline) HGet(key, field string) *Cmd {
+	return p.Do("HGET", key, field)
+}
+
+func (p *Pipeline) HSet(key, field string, val any) *Cmd {
+	return p.Do("HSET", key, field, val)
+}
+
+func (p *Pipeline) HIncrBy(key, field string, delta int) *Cmd {
+	return p.Do("HINCRBY", key, field, delta)
+}
+
+func (p *Pipeline) HGetAll(key string) *Cmd {
+	return p.Do("HGETALL", key)
+}
+
+func (p *Pipeline) ZAdd(key string, score int64, member any) *Cmd {
+	return p.Do("ZADD", key, score, member)
+}
+
+func (p *Pipeline) ZIncrBy(key string, delta int64, member any) *Cmd {
+	return p.Do("ZINCRBY", key, delta, member)
+}
+
+func (p *Pipeline) ZScore(key string, member any) *Cmd {
+	return p.Do("ZSCORE", key, member)
+}
@@ -0,0 +1,140 @@
+package redispool
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func newTestPool(t *testing.T, s *fakeServer) *Pool {
+	pool, err := NewPool(s.addr, "", 2, 10, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func TestPipeline(t *testing.T) {
+	s := newFakeServer(t)
+	cli, _ := newTestPool(t, s).GetClient()
+	defer cli.Put()
+
+	cmds, err := cli.Pipelined(func(p *Pipeline) {
+		p.Set("a", 1)
+		p.IncrBy("a", 2)
+		p.HSet("h", "f", "v")
+		p.Get("none")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := cmds[1].Int(); n != 3 {
+		t.Fatalf("incr = %d", n)
+	}
+	if _, err = cmds[3].Bytes(); !errors.Is(err, ErrNil) {
+		t.Fatalf("get none = %v", err)
+	}
+
+	p := cli.Pipeline()
+	get := p.Get("a")
+	hget := p.HGet("h", "f")
+	p.Do("UNKNOWN")
+	if _, err = p.Exec(); err == nil {
+		t.Fatal("exec should return the first error")
+	}
+	if v, _ := get.Int(); v != 3 {
+		t.Fatalf("get = %d", v)
+	}
+	if v, _ := hget.String(); v != "v" {
+		t.Fatalf("hget = %s", v)
+	}
+	if p.Len() != 0 {
+		t.Fatal("pipeline should be reset after exec")
+	}
+
+	// 后续的命令不受影响
+	if v, _, err := cli.GetInt64("a"); err != nil || v != 3 {
+		t.Fatalf("get after pipeline = %d, %v", v, err)
+	}
+}
+
+const incrScript = "return redis.call('INCRBY', KEYS[1], ARGV[1])"
+
+func defineIncr(s *fakeServer) {
+	s.defineScript(incrScript, func(s *fakeServer, keys, args []string) any {
+		delta, _ := strconv.Atoi(args[0])
+		return s.incrBy(keys[0], delta)
+	})
+}
+
+func TestScript(t *testing.T) {
+	s := newFakeServer(t)
+	defineIncr(s)
+	cli, _ := newTestPool(t, s).GetClient()
+	defer cli.Put()
+
+	script := NewScript(1, incrScript)
+
+	// 服务端没有缓存时自动 EVAL
+	if n, err := script.Run(cli, "n", 2).Int(); err != nil || n != 2 {
+		t.Fatalf("run = %d, %v", n, err)
+	}
+	if n, err := script.Run(cli, "n", 3).Int(); err != nil || n != 5 {
+		t.Fatalf("run = %d, %v", n, err)
+	}
+
+	s.mu.Lock()
+	evals := 0
+	for _, cmd := range s.cmds {
+		if cmd == "EVAL" {
+			evals++
+		}
+	}
+	s.mu.Unlock()
+	if evals != 1 {
+		t.Fatalf("eval count = %d, want 1", evals)
+	}
+
+	// Pipeline 中服务端没有缓存脚本，也按添加的顺序执行
+	s2 := newFakeServer(t)
+	defineIncr(s2)
+	cli2, _ := newTestPool(t, s2).GetClient()
+	defer cli2.Put()
+
+	p := cli2.Pipeline()
+	r1 := script.Send(p, "n", 1)
+	p.Set("n", 100)
+	r2 := script.Send(p, "n", 1)
+	if _, err := p.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	n1, _ := r1.Int()
+	n2, _ := r2.Int()
+	if n1 != 1 || n2 != 101 {
+		t.Fatalf("pipeline script = %d, %d", n1, n2)
+	}
+
+	// 事务中同样可以执行没有缓存的脚本
+	s3 := newFakeServer(t)
+	defineIncr(s3)
+	cli3, _ := newTestPool(t, s3).GetClient()
+	defer cli3.Put()
+
+	err := cli3.Watch(func(tx *Tx) error {
+		_, err := tx.Exec(func(p *Pipeline) {
+			p.Set("n", 10)
+			script.Send(p, "n", 2)
+		})
+		return err
+	}, "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _, err := cli3.GetInt64("n"); err != nil || v != 12 {
+		t.Fatalf("tx script = %d, %v", v, err)
+	}
+
+	if err := script.Load(cli2); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,6 +1,7 @@
 package redispool
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -14,10 +15,26 @@ var poolMap sync.Map
 
 // Pool implements the connection pool of redis
 type Pool struct {
-	pool  *redis.Pool
-	param *PoolParam
+	pool    *redis.Pool
+	param   *PoolParam
+	cluster *cluster // cluster 模式下按节点管理连接池
+
+	hookLk sync.RWMutex
+	hooks  []Hook
 }
 
+// Mode redis 部署模式
+type Mode int
+
+const (
+	// ModeStandalone 单机，多个地址之间按 RoutePolicy 负载均衡
+	ModeStandalone Mode = iota
+	// ModeSentinel 通过 sentinel 发现 master，故障转移后自动切换
+	ModeSentinel
+	// ModeCluster cluster 模式，按 slot 路由到各个节点
+	ModeCluster
+)
+
 // RoutePolicy redis各个地址负载均衡策略
 type RoutePolicy int
 
@@ -40,16 +57,30 @@ func (p *Pool) SetAddrList(addrList string) {
 
 // GetClient alloc a connection from pool
 func (p *Pool) GetClient() (cli *Client, err error) {
-	conn := p.pool.Get()
-	if conn.Err() != nil {
-		err = conn.Err()
+	conn, err := p.getConn()
+	if err != nil {
 		return
 	}
 
+	if hooks := p.getHooks(); len(hooks) > 0 {
+		conn = newCtxConn(context.Background(), conn, hooks)
+	}
 	cli = &Client{Conn: conn}
 	return
 }
 
+func (p *Pool) getConn() (conn redis.Conn, err error) {
+	if p.cluster != nil {
+		return newClusterConn(p.cluster), nil
+	}
+
+	conn = p.pool.Get()
+	if err = conn.Err(); err != nil {
+		conn = nil
+	}
+	return
+}
+
 func newPool(pparam *PoolParam) (pool *Pool, err error) {
 	param := new(PoolParam)
 	*param = *pparam
@@ -62,48 +93,76 @@ func newPool(pparam *PoolParam) (pool *Pool, err error) {
 	if err = param.setup(); err != nil {
 		return
 	}
-	p := &redis.Pool{
+
+	switch param.Mode {
+	case ModeCluster:
+		return newClusterPool(param, opts)
+	case ModeSentinel:
+		return newSentinelPool(param, opts)
+	}
+
+	p := newRedisPool(param, func() (string, error) {
+		addr := param.getAddr()
+		if addr == "" {
+			return "", errors.New("no server available")
+		}
+		return addr, nil
+	}, opts)
+
+	//做链接检查
+	if err = ping(p); err != nil {
+		return
+	}
+
+	pool = &Pool{pool: p, param: param, hooks: param.Hooks}
+	go param.monitorCheck()
+	return
+}
+
+// newRedisPool 创建连接 getAddr 返回的地址的连接池
+func newRedisPool(param *PoolParam, getAddr func() (string, error), opts []redis.DialOption) *redis.Pool {
+	return &redis.Pool{
 		MaxIdle:     param.MaxIdle,
 		Wait:        true,
 		MaxActive:   param.MaxActive,
 		IdleTimeout: time.Duration(param.IdleTimeoutSecond) * time.Second,
 
 		Dial: func() (c redis.Conn, err error) {
-			addr := param.getAddr()
-
-			if addr == "" {
-				err = errors.New("no server available")
-				return
-			}
-			c, err = redis.Dial("tcp", addr, opts...)
+			addr, err := getAddr()
 			if err != nil {
-				err = errors.New(err.Error())
 				return
 			}
-			if param.Pass != "" {
-				if _, err = c.Do("AUTH", param.Pass); err != nil {
-					err = errors.New(err.Error())
-					c.Close()
-					c = nil
-				}
-			}
-			return
+			return dial(addr, param.Pass, opts)
 		},
 		// TestOnBorrow: func(c redis.Conn, t time.Time) error {
 		// 	_, err := c.Do("PING")
 		// 	return err
 		// },
 	}
-	//做链接检查
+}
+
+func dial(addr, pass string, opts []redis.DialOption) (c redis.Conn, err error) {
+	c, err = redis.Dial("tcp", addr, opts...)
+	if err != nil {
+		err = errors.New(err.Error())
+		return
+	}
+	if pass != "" {
+		if _, err = c.Do("AUTH", pass); err != nil {
+			err = errors.New(err.Error())
+			c.Close()
+			c = nil
+		}
+	}
+	return
+}
+
+func ping(p *redis.Pool) (err error) {
 	conn := p.Get()
 	defer conn.Close()
 	if _, err = conn.Do("PING"); err != nil {
 		err = errors.New(err.Error())
-		return
 	}
-
-	pool = &Pool{pool: p, param: param}
-	go param.monitorCheck()
 	return
 }
 
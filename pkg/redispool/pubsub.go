@@ -0,0 +1,291 @@
+package redispool
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	defaultPingInterval = 30 * time.Second
+	minReconnectBackoff = 100 * time.Millisecond
+	maxReconnectBackoff = 5 * time.Second
+)
+
+// Message 订阅收到的消息
+type Message struct {
+	Channel string
+	Pattern string // 模式订阅时匹配到的模式，普通订阅为空
+	Data    []byte
+}
+
+// MessageHandler 处理订阅消息，在订阅的读协程中调用，不应长时间阻塞
+type MessageHandler func(msg *Message)
+
+// SubscriberOption Subscriber 的可选参数
+type SubscriberOption func(*Subscriber)
+
+// WithPingInterval 设置订阅连接的心跳间隔，超过两个间隔没有收到任何数据时重连
+func WithPingInterval(d time.Duration) SubscriberOption {
+	return func(s *Subscriber) {
+		s.pingInterval = d
+	}
+}
+
+// Subscriber 使用独立的连接订阅频道和模式，连接断开后自动重连并重新订阅
+type Subscriber struct {
+	dial         func() (redis.Conn, error)
+	handler      MessageHandler
+	pingInterval time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	lk       sync.Mutex
+	conn     *redis.PubSubConn // 当前的订阅连接，重连过程中为 nil
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+// NewSubscriber 创建订阅者，后台连接 redis，通过 Subscribe 和 PSubscribe 添加订阅
+func (p *Pool) NewSubscriber(handler MessageHandler, opts ...SubscriberOption) *Subscriber {
+	s := &Subscriber{
+		dial:         p.dialer(),
+		handler:      handler,
+		pingInterval: defaultPingInterval,
+		done:         make(chan struct{}),
+		channels:     make(map[string]struct{}),
+		patterns:     make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	go s.loop()
+	return s
+}
+
+// dialer 返回创建独立连接的函数，订阅等长时间占用的连接不从连接池中获取
+func (p *Pool) dialer() func() (redis.Conn, error) {
+	if p.cluster == nil {
+		return p.pool.Dial
+	}
+
+	// cluster 中 PUBLISH 会广播到所有节点，订阅任意节点即可
+	c := p.cluster
+	return func() (redis.Conn, error) {
+		nodes := c.nodes()
+		if len(nodes) == 0 {
+			return nil, errors.New("no server available")
+		}
+		return dial(nodes[0], c.param.Pass, c.opts)
+	}
+}
+
+// Subscribe 订阅频道
+func (s *Subscriber) Subscribe(channels ...string) error {
+	return s.update(s.channels, true, channels, func(c *redis.PubSubConn, args []any) error {
+		return c.Subscribe(args...)
+	})
+}
+
+// PSubscribe 按模式订阅频道，如 "room.*"
+func (s *Subscriber) PSubscribe(patterns ...string) error {
+	return s.update(s.patterns, true, patterns, func(c *redis.PubSubConn, args []any) error {
+		return c.PSubscribe(args...)
+	})
+}
+
+// Unsubscribe 取消订阅频道
+func (s *Subscriber) Unsubscribe(channels ...string) error {
+	return s.update(s.channels, false, channels, func(c *redis.PubSubConn, args []any) error {
+		return c.Unsubscribe(args...)
+	})
+}
+
+// PUnsubscribe 取消模式订阅
+func (s *Subscriber) PUnsubscribe(patterns ...string) error {
+	return s.update(s.patterns, false, patterns, func(c *redis.PubSubConn, args []any) error {
+		return c.PUnsubscribe(args...)
+	})
+}
+
+// update 记录订阅关系，已连接时立即发送命令，未连接时在重连后发送
+func (s *Subscriber) update(set map[string]struct{}, add bool, names []string, send func(*redis.PubSubConn, []any) error) error {
+	if len(names) == 0 {
+		return nil
+	}
+	if s.ctx.Err() != nil {
+		return errSubscriberClosed
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	args := make([]any, 0, len(names))
+	for _, name := range names {
+		if add {
+			set[name] = struct{}{}
+		} else {
+			delete(set, name)
+		}
+		args = append(args, name)
+	}
+
+	if s.conn == nil {
+		return nil
+	}
+	// 发送失败时读协程会发现连接断开，重连后重新订阅
+	return send(s.conn, args)
+}
+
+var errSubscriberClosed = errors.New("redis subscriber closed")
+
+// Close 关闭订阅连接，等待读协程退出
+func (s *Subscriber) Close() error {
+	s.cancel()
+
+	s.lk.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.lk.Unlock()
+
+	<-s.done
+	return nil
+}
+
+func (s *Subscriber) loop() {
+	defer close(s.done)
+
+	backoff := minReconnectBackoff
+	for s.ctx.Err() == nil {
+		connected, err := s.run()
+		if s.ctx.Err() != nil {
+			return
+		}
+		if connected && s.idle(err) { // 没有订阅的空闲连接读超时，直接重连
+			continue
+		}
+		log.Printf("[ERROR] redis subscriber disconnected: %v", err)
+
+		if connected {
+			backoff = minReconnectBackoff
+		}
+		select {
+		case <-time.After(backoff):
+		case <-s.ctx.Done():
+			return
+		}
+		if backoff *= 2; backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+}
+
+func (s *Subscriber) idle(err error) bool {
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		return false
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return !s.subscribed()
+}
+
+// run 建立连接并重新订阅，读取消息直到连接出错
+func (s *Subscriber) run() (connected bool, err error) {
+	conn, err := s.dial()
+	if err != nil {
+		return
+	}
+	psc := &redis.PubSubConn{Conn: conn}
+	defer func() {
+		s.lk.Lock()
+		s.conn = nil
+		s.lk.Unlock()
+		psc.Close()
+	}()
+
+	if err = s.resubscribe(psc); err != nil {
+		return
+	}
+	connected = true
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.ping(psc, stop)
+
+	for {
+		switch v := psc.ReceiveWithTimeout(2 * s.pingInterval).(type) {
+		case redis.Message:
+			s.handler(&Message{Channel: v.Channel, Data: v.Data})
+		case redis.PMessage:
+			s.handler(&Message{Channel: v.Channel, Pattern: v.Pattern, Data: v.Data})
+		case error:
+			return connected, v
+		}
+	}
+}
+
+func (s *Subscriber) resubscribe(psc *redis.PubSubConn) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if s.ctx.Err() != nil {
+		return errSubscriberClosed
+	}
+
+	for ch := range s.channels {
+		if err := psc.Conn.Send("SUBSCRIBE", ch); err != nil {
+			return err
+		}
+	}
+	for p := range s.patterns {
+		if err := psc.Conn.Send("PSUBSCRIBE", p); err != nil {
+			return err
+		}
+	}
+	if err := psc.Conn.Flush(); err != nil {
+		return err
+	}
+
+	s.conn = psc
+	return nil
+}
+
+func (s *Subscriber) subscribed() bool {
+	return len(s.channels)+len(s.patterns) > 0
+}
+
+// ping 定时发送心跳，读协程通过读超时发现失效的连接
+func (s *Subscriber) ping(psc *redis.PubSubConn, stop chan struct{}) {
+	ticker := time.NewTicker(s.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// 没有订阅时 PING 的回包不是订阅格式，不发送
+			s.lk.Lock()
+			var err error
+			if s.subscribed() {
+				err = psc.Ping("")
+			}
+			s.lk.Unlock()
+			if err != nil {
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
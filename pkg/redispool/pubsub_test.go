@@ -0,0 +1,76 @@
+package redispool
+
+import (
+	"testing"
+	"time"
+)
+
+// waitFor 等待 cond 成立，超时后失败
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSubscriber(t *testing.T) {
+	s := newFakeServer(t)
+	pool := newTestPool(t, s)
+
+	msgs := make(chan *Message, 16)
+	sub := pool.NewSubscriber(func(msg *Message) { msgs <- msg })
+	defer sub.Close()
+
+	if err := sub.Subscribe("news"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.PSubscribe("room.*"); err != nil {
+		t.Fatal(err)
+	}
+
+	recv := func(channel, pattern, data string) {
+		t.Helper()
+		select {
+		case msg := <-msgs:
+			if msg.Channel != channel || msg.Pattern != pattern || string(msg.Data) != data {
+				t.Fatalf("recv %+v", msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("recv timeout")
+		}
+	}
+
+	waitFor(t, func() bool { return s.publish("news", "hello") > 0 })
+	recv("news", "", "hello")
+	waitFor(t, func() bool { return s.publish("room.1", "enter") > 0 })
+	recv("room.1", "room.*", "enter")
+
+	// 断线后自动重连并重新订阅
+	s.dropConns()
+	waitFor(t, func() bool { return s.publish("room.2", "again") > 0 })
+	recv("room.2", "room.*", "again")
+
+	if err := sub.PUnsubscribe("room.*"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return s.publish("room.3", "gone") == 0 })
+	waitFor(t, func() bool { return s.publish("news", "still") > 0 })
+	for {
+		select {
+		case msg := <-msgs:
+			if msg.Channel == "room.3" { // 取消订阅生效前发布的消息
+				continue
+			}
+			if msg.Channel != "news" || string(msg.Data) != "still" {
+				t.Fatalf("recv %+v", msg)
+			}
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatal("recv timeout")
+		}
+	}
+}
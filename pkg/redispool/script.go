@@ -0,0 +1,64 @@
+package redispool
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Script Lua 脚本，Run 使用 EVALSHA 执行，服务端没有缓存脚本时自动使用 EVAL 加载
+type Script struct {
+	keyCount int
+	src      string
+	hash     string
+}
+
+// NewScript 创建脚本，keyCount 为 key 的个数，执行时 keysAndArgs 的前 keyCount 个参数为 key
+func NewScript(keyCount int, src string) *Script {
+	sum := sha1.Sum([]byte(src))
+	return &Script{
+		keyCount: keyCount,
+		src:      src,
+		hash:     hex.EncodeToString(sum[:]),
+	}
+}
+
+func (s *Script) Hash() string {
+	return s.hash
+}
+
+func (s *Script) args(spec string, keysAndArgs []any) []any {
+	args := make([]any, 0, 2+len(keysAndArgs))
+	args = append(args, spec, s.keyCount)
+	return append(args, keysAndArgs...)
+}
+
+// Load 使用 SCRIPT LOAD 预先加载脚本
+func (s *Script) Load(c *Client) error {
+	_, err := c.doCmd("SCRIPT", "LOAD", s.src)
+	return err
+}
+
+// Run 执行脚本
+func (s *Script) Run(c *Client, keysAndArgs ...any) *Cmd {
+	cmd := newCmd("EVALSHA", s.args(s.hash, keysAndArgs)...)
+	cmd.setReply(c.Conn.Do(cmd.name, cmd.args...))
+	if isNoScript(cmd.err) {
+		cmd = newCmd("EVAL", s.args(s.src, keysAndArgs)...)
+		cmd.setReply(c.Conn.Do(cmd.name, cmd.args...))
+	}
+	return cmd
+}
+
+// Send 在 Pipeline 或事务中执行脚本。使用 EVAL 发送，服务端没有缓存脚本时不需要在其他命令之后重试，
+// 保证命令按添加的顺序执行
+func (s *Script) Send(p *Pipeline, keysAndArgs ...any) *Cmd {
+	return p.Do("EVAL", s.args(s.src, keysAndArgs)...)
+}
+
+func isNoScript(err error) bool {
+	re, ok := err.(redis.Error)
+	return ok && strings.HasPrefix(string(re), "NOSCRIPT")
+}
@@ -0,0 +1,226 @@
+package redispool
+
+import (
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// errStaleMaster 连接的不是当前的 master，归还时从连接池中丢弃
+var errStaleMaster = errors.New("redis master changed")
+
+// sentinel 通过 sentinel 发现 master，订阅 +switch-master 并定时查询，master 变化后旧连接在归还或借出时丢弃
+type sentinel struct {
+	param *PoolParam
+	opts  []redis.DialOption
+
+	lk     sync.RWMutex
+	master string
+}
+
+// masterConn 记录连接的 master 地址
+type masterConn struct {
+	redis.Conn
+	s     *sentinel
+	addr  string
+	stale atomic.Bool
+}
+
+var _ redis.ConnWithTimeout = (*masterConn)(nil)
+
+func newSentinelPool(param *PoolParam, opts []redis.DialOption) (pool *Pool, err error) {
+	if param.MasterName == "" {
+		err = errors.New("redis sentinel master name is empty")
+		return
+	}
+
+	s := &sentinel{param: param, opts: opts}
+	if err = s.resolve(); err != nil {
+		return
+	}
+
+	p := newRedisPool(param, nil, opts)
+	p.Dial = s.dial
+	p.TestOnBorrow = func(c redis.Conn, t time.Time) error {
+		if mc, ok := c.(*masterConn); ok && mc.addr != s.masterAddr() {
+			return errStaleMaster
+		}
+		return nil
+	}
+
+	if err = ping(p); err != nil {
+		return
+	}
+
+	pool = &Pool{pool: p, param: param, hooks: param.Hooks}
+	go s.watch()
+	go s.monitor()
+	return
+}
+
+func (s *sentinel) masterAddr() string {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+	return s.master
+}
+
+func (s *sentinel) setMaster(addr string) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if s.master != addr {
+		log.Printf("[INFO] redis sentinel master %s switch from %s to %s\n", s.param.MasterName, s.master, addr)
+		s.master = addr
+	}
+}
+
+func (s *sentinel) dial() (redis.Conn, error) {
+	addr := s.masterAddr()
+	c, err := dial(addr, s.param.Pass, s.opts)
+	if err != nil {
+		go s.resolve()
+		return nil, err
+	}
+	return &masterConn{Conn: c, s: s, addr: addr}, nil
+}
+
+// resolve 依次询问 sentinel，第一个返回的地址作为 master
+func (s *sentinel) resolve() (err error) {
+	for _, addr := range s.sentinels() {
+		var master string
+		if master, err = s.queryMaster(addr); err != nil {
+			log.Printf("[ERROR] query redis sentinel %s error: %s\n", addr, err.Error())
+			continue
+		}
+
+		s.setMaster(master)
+		return nil
+	}
+
+	if err == nil {
+		err = errors.New("no sentinel available")
+	}
+	return
+}
+
+func (s *sentinel) queryMaster(addr string) (string, error) {
+	c, err := dial(addr, s.param.SentinelPass, s.opts)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+
+	reply, err := redis.Strings(c.Do("SENTINEL", "get-master-addr-by-name", s.param.MasterName))
+	if err != nil {
+		return "", err
+	}
+	if len(reply) != 2 {
+		return "", errors.New("unexpected sentinel reply")
+	}
+	return net.JoinHostPort(reply[0], reply[1]), nil
+}
+
+func (s *sentinel) sentinels() []string {
+	s.param.lock.RLock()
+	defer s.param.lock.RUnlock()
+	return append([]string(nil), s.param.addrList...)
+}
+
+// monitor 定时查询 master，避免错过 +switch-master 消息
+func (s *sentinel) monitor() {
+	sec := s.param.HealthCheckIntervalSec
+	if sec <= 0 {
+		sec = 1
+	}
+	tk := time.NewTicker(time.Duration(sec) * time.Second)
+	for range tk.C {
+		_ = s.resolve()
+	}
+}
+
+// watch 订阅 sentinel 的 +switch-master 消息，故障转移后立即切换
+func (s *sentinel) watch() {
+	for {
+		for _, addr := range s.sentinels() {
+			if err := s.subscribe(addr); err != nil {
+				log.Printf("[ERROR] subscribe redis sentinel %s error: %s\n", addr, err.Error())
+			}
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+func (s *sentinel) subscribe(addr string) error {
+	c, err := dial(addr, s.param.SentinelPass, s.opts)
+	if err != nil {
+		return err
+	}
+
+	psc := redis.PubSubConn{Conn: c}
+	defer psc.Close()
+
+	if err = psc.Subscribe("+switch-master"); err != nil {
+		return err
+	}
+
+	for {
+		switch v := psc.ReceiveWithTimeout(0).(type) {
+		case redis.Message:
+			// <master name> <old ip> <old port> <new ip> <new port>
+			fields := strings.Fields(string(v.Data))
+			if len(fields) == 5 && fields[0] == s.param.MasterName {
+				s.setMaster(net.JoinHostPort(fields[3], fields[4]))
+			}
+		case error:
+			return v
+		}
+	}
+}
+
+// Do 写入时返回 READONLY 说明连接的 master 已经降级，重新查询 master 并丢弃该连接
+func (c *masterConn) Do(cmd string, args ...any) (reply any, err error) {
+	reply, err = c.Conn.Do(cmd, args...)
+	c.check(err)
+	return
+}
+
+func (c *masterConn) Receive() (reply any, err error) {
+	reply, err = c.Conn.Receive()
+	c.check(err)
+	return
+}
+
+func (c *masterConn) DoWithTimeout(timeout time.Duration, cmd string, args ...any) (reply any, err error) {
+	reply, err = redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+	c.check(err)
+	return
+}
+
+func (c *masterConn) ReceiveWithTimeout(timeout time.Duration) (reply any, err error) {
+	reply, err = redis.ReceiveWithTimeout(c.Conn, timeout)
+	c.check(err)
+	return
+}
+
+func (c *masterConn) check(err error) {
+	if re, ok := err.(redis.Error); ok && strings.HasPrefix(string(re), "READONLY") {
+		c.stale.Store(true)
+		go c.s.resolve()
+	}
+}
+
+func (c *masterConn) Err() error {
+	if err := c.Conn.Err(); err != nil {
+		return err
+	}
+	if c.stale.Load() || c.addr != c.s.masterAddr() {
+		return errStaleMaster
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package redispool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSentinel(t *testing.T) {
+	m1 := newFakeServer(t)
+	m2 := newFakeServer(t)
+	s := newFakeServer(t)
+	s.masterName = "mymaster"
+	s.master = m1.addr
+
+	pool, err := NewPoolWithParam(&PoolParam{
+		Addr:       s.addr,
+		Mode:       ModeSentinel,
+		MasterName: "mymaster",
+		MaxIdle:    2,
+		MaxActive:  10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := func(key string) error {
+		cli, err := pool.GetClient()
+		if err != nil {
+			return err
+		}
+		defer cli.Put()
+		return cli.Set(key, "1")
+	}
+
+	if err = set("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if !m1.has("k1") {
+		t.Fatal("k1 should be set on m1")
+	}
+
+	// 故障转移：m1 降级，sentinel 切换到 m2
+	m1.setReadonly(true)
+	s.switchMaster(m2.addr)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if err = set("k2"); err == nil && m2.has("k2") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("failover not finished: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSentinelReadonly(t *testing.T) {
+	m1 := newFakeServer(t)
+	m2 := newFakeServer(t)
+	s := newFakeServer(t)
+	s.masterName = "mymaster"
+	s.master = m1.addr
+
+	pool, err := NewPoolWithParam(&PoolParam{
+		Addr:                   s.addr,
+		Mode:                   ModeSentinel,
+		MasterName:             "mymaster",
+		MaxIdle:                2,
+		MaxActive:              10,
+		HealthCheckIntervalSec: 3600,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有收到 +switch-master，写入返回 READONLY 后重新查询 master
+	s.mu.Lock()
+	s.master = m2.addr
+	s.mu.Unlock()
+	m1.setReadonly(true)
+
+	cli, _ := pool.GetClient()
+	if err = cli.Set("k1", "1"); err == nil {
+		t.Fatal("write to demoted master should fail")
+	}
+	cli.Put()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		cli, _ = pool.GetClient()
+		err = cli.Set("k1", "1")
+		cli.Put()
+		if err == nil && m2.has("k1") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("master not switched: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,709 @@
+package redispool
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeServer 进程内的 RESP 服务，实现测试需要的 redis 命令，
+// 可以模拟 cluster 的 slot 路由(MOVED/ASK)以及 sentinel 的 master 查询和切换
+type fakeServer struct {
+	ln   net.Listener
+	addr string
+
+	mu       sync.Mutex
+	data     map[string][]byte
+	hashes   map[string]map[string][]byte
+	versions map[string]int // key 的修改版本，用于 WATCH
+	readonly bool           // 模拟降级为从库，写命令返回 READONLY
+	cmds     []string       // 执行过的命令
+
+	scripts map[string]fakeScript // sha1 -> 脚本，SCRIPT LOAD 或 EVAL 之后才能 EVALSHA
+	lua     map[string]fakeScript // 脚本源码 -> Go 实现
+
+	cluster *fakeCluster
+
+	masterName string // sentinel 监控的 master
+	master     string
+
+	subs    map[string]map[*fakeConn]struct{}
+	psubs   map[string]map[*fakeConn]struct{}
+	conns   map[*fakeConn]struct{}
+	streams map[string]*fakeStream
+}
+
+// fakeCluster cluster 的拓扑，所有节点共享
+type fakeCluster struct {
+	mu        sync.Mutex
+	owner     [clusterSlots]*fakeServer
+	migrating map[int]*fakeServer // 正在迁移的 slot 及其目标节点
+}
+
+// fakeScript 用 Go 实现的 Lua 脚本，调用时持有 fakeServer.mu
+type fakeScript func(s *fakeServer, keys, args []string) any
+
+// nilArray 事务失败时 EXEC 的回包
+type nilArray struct{}
+
+type fakeConn struct {
+	s      *fakeServer
+	conn   net.Conn
+	wmu    sync.Mutex
+	w      *bufio.Writer
+	asking bool
+	subs   map[string]struct{}
+	psubs  map[string]struct{}
+
+	multi   bool
+	queued  [][]string
+	aborted bool           // 事务中有命令错误，EXEC 返回 EXECABORT
+	watched map[string]int // WATCH 的 key 及其版本
+}
+
+func newFakeServer(t testing.TB) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeServer{
+		ln:       ln,
+		addr:     ln.Addr().String(),
+		data:     make(map[string][]byte),
+		hashes:   make(map[string]map[string][]byte),
+		versions: make(map[string]int),
+		scripts:  make(map[string]fakeScript),
+		lua:      make(map[string]fakeScript),
+		subs:     make(map[string]map[*fakeConn]struct{}),
+		psubs:    make(map[string]map[*fakeConn]struct{}),
+		conns:    make(map[*fakeConn]struct{}),
+		streams:  make(map[string]*fakeStream),
+	}
+	go s.serve()
+	t.Cleanup(func() { _ = ln.Close() })
+	return s
+}
+
+// newFakeCluster 创建 n 个节点的 cluster，slot 平均分配
+func newFakeCluster(t testing.TB, n int) (*fakeCluster, []*fakeServer) {
+	c := &fakeCluster{migrating: make(map[int]*fakeServer)}
+	nodes := make([]*fakeServer, n)
+	for i := range nodes {
+		nodes[i] = newFakeServer(t)
+		nodes[i].cluster = c
+	}
+	for slot := 0; slot < clusterSlots; slot++ {
+		c.owner[slot] = nodes[slot*n/clusterSlots]
+	}
+	return c, nodes
+}
+
+// move 将 slot 迁移到 to，迁移后 key 也在 to 上
+func (c *fakeCluster) move(slot int, to *fakeServer) {
+	c.mu.Lock()
+	from := c.owner[slot]
+	c.owner[slot] = to
+	delete(c.migrating, slot)
+	c.mu.Unlock()
+
+	from.mu.Lock()
+	defer from.mu.Unlock()
+	to.mu.Lock()
+	defer to.mu.Unlock()
+	for k, v := range from.data {
+		if int(Slot(k)) == slot {
+			to.data[k] = v
+			delete(from.data, k)
+		}
+	}
+}
+
+func (s *fakeServer) has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.data[key]
+	return ok
+}
+
+func (s *fakeServer) setReadonly(readonly bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readonly = readonly
+}
+
+// switchMaster 模拟 sentinel 完成故障转移
+func (s *fakeServer) switchMaster(addr string) {
+	s.mu.Lock()
+	old := s.master
+	s.master = addr
+	s.mu.Unlock()
+
+	oldHost, oldPort, _ := net.SplitHostPort(old)
+	host, port, _ := net.SplitHostPort(addr)
+	s.publish("+switch-master", strings.Join([]string{s.masterName, oldHost, oldPort, host, port}, " "))
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		c := &fakeConn{
+			s:     s,
+			conn:  conn,
+			w:     bufio.NewWriter(conn),
+			subs:  make(map[string]struct{}),
+			psubs: make(map[string]struct{}),
+		}
+		s.mu.Lock()
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+		go c.serve()
+	}
+}
+
+func (c *fakeConn) serve() {
+	defer c.close()
+
+	r := bufio.NewReader(c.conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		c.s.exec(c, args)
+	}
+}
+
+func (c *fakeConn) close() {
+	_ = c.conn.Close()
+
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	delete(c.s.conns, c)
+	for ch := range c.subs {
+		delete(c.s.subs[ch], c)
+	}
+	for p := range c.psubs {
+		delete(c.s.psubs[p], c)
+	}
+}
+
+// dropConns 断开所有客户端连接，模拟网络故障
+func (s *fakeServer) dropConns() {
+	s.mu.Lock()
+	conns := make([]*fakeConn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		_ = c.conn.Close()
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return nil, errors.New("unexpected command")
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		if line, err = readLine(r); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+// reply 写入回包，支持 string(简单字符串)、error、int、[]byte(bulk)、nil、[]any
+func (c *fakeConn) reply(v any) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	writeValue(c.w, v)
+	_ = c.w.Flush()
+}
+
+func writeValue(w *bufio.Writer, v any) {
+	switch v := v.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case string:
+		w.WriteString("+" + v + "\r\n")
+	case error:
+		w.WriteString("-" + v.Error() + "\r\n")
+	case int:
+		w.WriteString(":" + strconv.Itoa(v) + "\r\n")
+	case []byte:
+		w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n")
+		w.Write(v)
+		w.WriteString("\r\n")
+	case nilArray:
+		w.WriteString("*-1\r\n")
+	case []any:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, e := range v {
+			writeValue(w, e)
+		}
+	default:
+		panic(fmt.Sprintf("unknown reply type %T", v))
+	}
+}
+
+var fakeWrites = map[string]bool{"SET": true, "DEL": true, "INCRBY": true, "HSET": true, "HINCRBY": true, "XADD": true}
+
+var fakeKnown = map[string]bool{
+	"PING": true, "AUTH": true, "SELECT": true, "ASKING": true, "WATCH": true, "UNWATCH": true,
+	"GET": true, "SET": true, "DEL": true, "INCRBY": true, "HSET": true, "HGET": true,
+	"EVAL": true, "EVALSHA": true, "SCRIPT": true, "CLUSTER": true, "SENTINEL": true, "PUBLISH": true,
+	"XGROUP": true, "XADD": true, "XREADGROUP": true, "XACK": true, "XAUTOCLAIM": true, "XPENDING": true,
+}
+
+// defineScript 注册脚本源码对应的 Go 实现
+func (s *fakeServer) defineScript(src string, fn fakeScript) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lua[src] = fn
+}
+
+// get 读取 key，调用时持有 s.mu
+func (s *fakeServer) get(key string) any {
+	v, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+// set 写入 key，调用时持有 s.mu
+func (s *fakeServer) set(key string, val []byte) {
+	s.data[key] = val
+	s.versions[key]++
+}
+
+// incrBy 调用时持有 s.mu
+func (s *fakeServer) incrBy(key string, delta int) int {
+	v, _ := strconv.Atoi(string(s.data[key]))
+	v += delta
+	s.set(key, []byte(strconv.Itoa(v)))
+	return v
+}
+
+func (s *fakeServer) exec(c *fakeConn, args []string) {
+	cmd := strings.ToUpper(args[0])
+
+	s.mu.Lock()
+	s.cmds = append(s.cmds, cmd)
+	s.mu.Unlock()
+
+	switch cmd {
+	case "SUBSCRIBE", "UNSUBSCRIBE", "PSUBSCRIBE", "PUNSUBSCRIBE":
+		s.subscribe(c, cmd, args[1:])
+		return
+	case "MULTI":
+		c.multi, c.queued, c.aborted = true, nil, false
+		c.reply("OK")
+		return
+	case "DISCARD":
+		c.multi, c.queued, c.watched = false, nil, nil
+		c.reply("OK")
+		return
+	case "EXEC":
+		c.reply(s.execTx(c))
+		return
+	}
+
+	key, keyed := fakeKey(cmd, args)
+	if c.multi {
+		if keyed && s.cluster != nil && !s.route(c, cmd, key) {
+			c.aborted = true
+			return
+		}
+		if !fakeKnown[cmd] { //未知命令在入队时返回错误
+			c.aborted = true
+			c.reply(fmt.Errorf("ERR unknown command '%s'", cmd))
+			return
+		}
+		c.queued = append(c.queued, args)
+		c.reply("QUEUED")
+		return
+	}
+
+	if keyed && s.cluster != nil && !s.route(c, cmd, key) {
+		return
+	}
+	c.reply(s.call(c, cmd, args))
+}
+
+// fakeKey 返回 cluster 模式下用于路由的 key
+func fakeKey(cmd string, args []string) (string, bool) {
+	if fakeKeyless[cmd] || len(args) < 2 {
+		return "", false
+	}
+	if cmd == "EVAL" || cmd == "EVALSHA" {
+		if len(args) < 4 || args[2] == "0" {
+			return "", false
+		}
+		return args[3], true
+	}
+	switch cmd {
+	case "XGROUP":
+		return args[2], len(args) > 2
+	case "XREADGROUP":
+		for i, a := range args {
+			if strings.EqualFold(a, "STREAMS") && i+1 < len(args) {
+				return args[i+1], true
+			}
+		}
+		return "", false
+	}
+	return args[1], true
+}
+
+func (s *fakeServer) execTx(c *fakeConn) any {
+	defer func() {
+		c.multi, c.queued, c.watched = false, nil, nil
+	}()
+
+	if !c.multi {
+		return errors.New("ERR EXEC without MULTI")
+	}
+	if c.aborted {
+		return errors.New("EXECABORT Transaction discarded because of previous errors.")
+	}
+
+	s.mu.Lock()
+	for k, v := range c.watched {
+		if s.versions[k] != v {
+			s.mu.Unlock()
+			return nilArray{}
+		}
+	}
+	s.mu.Unlock()
+
+	replies := make([]any, 0, len(c.queued))
+	for _, args := range c.queued {
+		replies = append(replies, s.call(c, strings.ToUpper(args[0]), args))
+	}
+	return replies
+}
+
+// call 执行普通命令并返回回包
+func (s *fakeServer) call(c *fakeConn, cmd string, args []string) any {
+	s.mu.Lock()
+	readonly := s.readonly
+	s.mu.Unlock()
+	if readonly && fakeWrites[cmd] {
+		return errors.New("READONLY You can't write against a read only replica.")
+	}
+
+	switch cmd {
+	case "PING":
+		s.mu.Lock()
+		subscribed := len(c.subs)+len(c.psubs) > 0
+		s.mu.Unlock()
+		if subscribed { // 订阅模式下 PING 的回包
+			return []any{[]byte("pong"), []byte("")}
+		}
+		return "PONG"
+	case "AUTH", "SELECT":
+		return "OK"
+	case "ASKING":
+		c.asking = true
+		return "OK"
+	case "WATCH":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if c.watched == nil {
+			c.watched = make(map[string]int)
+		}
+		for _, k := range args[1:] {
+			c.watched[k] = s.versions[k]
+		}
+		return "OK"
+	case "UNWATCH":
+		c.watched = nil
+		return "OK"
+	case "GET":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.get(args[1])
+	case "SET":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.set(args[1], []byte(args[2]))
+		return "OK"
+	case "DEL":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		n := 0
+		for _, k := range args[1:] {
+			if _, ok := s.data[k]; ok {
+				delete(s.data, k)
+				s.versions[k]++
+				n++
+			}
+		}
+		return n
+	case "INCRBY":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delta, err := strconv.Atoi(args[2])
+		if err != nil {
+			return errors.New("ERR value is not an integer or out of range")
+		}
+		return s.incrBy(args[1], delta)
+	case "HSET":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		h := s.hashes[args[1]]
+		if h == nil {
+			h = make(map[string][]byte)
+			s.hashes[args[1]] = h
+		}
+		n := 0
+		for i := 2; i+1 < len(args); i += 2 {
+			if _, ok := h[args[i]]; !ok {
+				n++
+			}
+			h[args[i]] = []byte(args[i+1])
+		}
+		s.versions[args[1]]++
+		return n
+	case "HGET":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		v, ok := s.hashes[args[1]][args[2]]
+		if !ok {
+			return nil
+		}
+		return v
+	case "EVAL", "EVALSHA":
+		return s.eval(cmd, args)
+	case "SCRIPT":
+		if len(args) < 3 || strings.ToUpper(args[1]) != "LOAD" {
+			return errors.New("ERR unknown script subcommand")
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		fn, ok := s.lua[args[2]]
+		if !ok {
+			return errors.New("ERR unknown script")
+		}
+		sha := sha1Hex(args[2])
+		s.scripts[sha] = fn
+		return []byte(sha)
+	case "CLUSTER":
+		return s.clusterSlots()
+	case "SENTINEL":
+		s.mu.Lock()
+		master := s.master
+		s.mu.Unlock()
+		if len(args) < 3 || args[2] != s.masterName {
+			return nil
+		}
+		host, port, _ := net.SplitHostPort(master)
+		return []any{[]byte(host), []byte(port)}
+	case "PUBLISH":
+		return s.publish(args[1], args[2])
+	case "XGROUP", "XADD", "XREADGROUP", "XACK", "XAUTOCLAIM", "XPENDING":
+		return s.stream(c, cmd, args)
+	default:
+		return fmt.Errorf("ERR unknown command '%s'", cmd)
+	}
+}
+
+func (s *fakeServer) eval(cmd string, args []string) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var fn fakeScript
+	if cmd == "EVAL" {
+		var ok bool
+		if fn, ok = s.lua[args[1]]; !ok {
+			return errors.New("ERR unknown script")
+		}
+		s.scripts[sha1Hex(args[1])] = fn
+	} else {
+		var ok bool
+		if fn, ok = s.scripts[args[1]]; !ok {
+			return errors.New("NOSCRIPT No matching script. Please use EVAL.")
+		}
+	}
+
+	n, err := strconv.Atoi(args[2])
+	if err != nil || 3+n > len(args) {
+		return errors.New("ERR bad number of keys")
+	}
+	return fn(s, args[3:3+n], args[3+n:])
+}
+
+func sha1Hex(src string) string {
+	sum := sha1.Sum([]byte(src))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *fakeServer) subscribe(c *fakeConn, cmd string, chs []string) {
+	kind := strings.ToLower(cmd)
+	subs, own := s.subs, c.subs
+	if strings.HasPrefix(cmd, "P") {
+		subs, own = s.psubs, c.psubs
+	}
+
+	if !strings.Contains(cmd, "UNSUBSCRIBE") {
+		for _, ch := range chs {
+			s.mu.Lock()
+			if subs[ch] == nil {
+				subs[ch] = make(map[*fakeConn]struct{})
+			}
+			subs[ch][c] = struct{}{}
+			own[ch] = struct{}{}
+			n := len(c.subs) + len(c.psubs)
+			s.mu.Unlock()
+			c.reply([]any{[]byte(kind), []byte(ch), n})
+		}
+		return
+	}
+
+	s.mu.Lock()
+	if len(chs) == 0 {
+		for ch := range own {
+			chs = append(chs, ch)
+		}
+	}
+	s.mu.Unlock()
+	for _, ch := range chs {
+		s.mu.Lock()
+		delete(subs[ch], c)
+		delete(own, ch)
+		n := len(c.subs) + len(c.psubs)
+		s.mu.Unlock()
+		c.reply([]any{[]byte(kind), []byte(ch), n})
+	}
+}
+
+func (s *fakeServer) publish(ch, msg string) int {
+	type target struct {
+		c       *fakeConn
+		pattern string
+	}
+
+	s.mu.Lock()
+	targets := make([]target, 0, len(s.subs[ch]))
+	for c := range s.subs[ch] {
+		targets = append(targets, target{c: c})
+	}
+	for p, conns := range s.psubs {
+		if ok, _ := path.Match(p, ch); !ok {
+			continue
+		}
+		for c := range conns {
+			targets = append(targets, target{c: c, pattern: p})
+		}
+	}
+	s.mu.Unlock()
+
+	for _, t := range targets {
+		if t.pattern != "" {
+			t.c.reply([]any{[]byte("pmessage"), []byte(t.pattern), []byte(ch), []byte(msg)})
+		} else {
+			t.c.reply([]any{[]byte("message"), []byte(ch), []byte(msg)})
+		}
+	}
+	return len(targets)
+}
+
+var fakeKeyless = map[string]bool{
+	"PING": true, "AUTH": true, "SELECT": true, "ASKING": true, "CLUSTER": true,
+	"SUBSCRIBE": true, "UNSUBSCRIBE": true, "PSUBSCRIBE": true, "PUNSUBSCRIBE": true,
+	"PUBLISH": true, "SCRIPT": true,
+}
+
+// route cluster 模式下检查 key 是否由本节点处理，不是时返回 MOVED 或 ASK
+func (s *fakeServer) route(c *fakeConn, cmd, key string) bool {
+	if fakeKeyless[cmd] {
+		return true
+	}
+
+	asking := c.asking
+	c.asking = false
+
+	slot := int(Slot(key))
+	s.cluster.mu.Lock()
+	owner := s.cluster.owner[slot]
+	target := s.cluster.migrating[slot]
+	s.cluster.mu.Unlock()
+
+	switch {
+	case owner == s:
+		if target != nil && !s.has(key) {
+			c.reply(fmt.Errorf("ASK %d %s", slot, target.addr))
+			return false
+		}
+		return true
+	case asking && target == s:
+		return true
+	default:
+		c.reply(fmt.Errorf("MOVED %d %s", slot, owner.addr))
+		return false
+	}
+}
+
+func (s *fakeServer) clusterSlots() []any {
+	s.cluster.mu.Lock()
+	defer s.cluster.mu.Unlock()
+
+	ranges := make([]any, 0)
+	start := 0
+	for slot := 1; slot <= clusterSlots; slot++ {
+		if slot < clusterSlots && s.cluster.owner[slot] == s.cluster.owner[start] {
+			continue
+		}
+
+		host, port, _ := net.SplitHostPort(s.cluster.owner[start].addr)
+		p, _ := strconv.Atoi(port)
+		ranges = append(ranges, []any{start, slot - 1, []any{[]byte(host), p, []byte(s.cluster.owner[start].addr)}})
+		start = slot
+	}
+	return ranges
+}
@@ -0,0 +1,436 @@
+package redispool
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/lightmen/nami/schedule"
+)
+
+const (
+	defaultStreamCount   = 10
+	defaultStreamBlock   = 2 * time.Second
+	defaultClaimIdle     = 30 * time.Second
+	defaultClaimInterval = 10 * time.Second
+	defaultMaxInflight   = 1024
+)
+
+// StreamMessage stream 中的一条消息
+type StreamMessage struct {
+	Stream string
+	ID     string
+	Values map[string]string
+}
+
+// StreamHandler 处理 stream 消息，返回 nil 时确认(XACK)消息，
+// 返回错误时消息留在 pending 列表中，超过 MinIdle 后重新投递。ctx 不会因为 Stop 取消
+type StreamHandler func(ctx context.Context, msg *StreamMessage) error
+
+// StreamOption StreamConsumer 的可选参数
+type StreamOption func(*StreamConsumer)
+
+// WithStreamCount 设置每次读取的最大消息数
+func WithStreamCount(n int) StreamOption {
+	return func(c *StreamConsumer) {
+		c.count = n
+	}
+}
+
+// WithStreamBlock 设置 XREADGROUP 没有消息时的阻塞时间
+func WithStreamBlock(d time.Duration) StreamOption {
+	return func(c *StreamConsumer) {
+		c.block = d
+	}
+}
+
+// WithStreamClaim 设置 pending 消息空闲多久后被重新认领，以及检查的间隔
+func WithStreamClaim(minIdle, interval time.Duration) StreamOption {
+	return func(c *StreamConsumer) {
+		c.minIdle = minIdle
+		c.claimInterval = interval
+	}
+}
+
+// WithStreamStart 设置创建消费组时的起始 ID，默认为 "$" 只消费新消息
+func WithStreamStart(id string) StreamOption {
+	return func(c *StreamConsumer) {
+		c.start = id
+	}
+}
+
+// WithStreamMaxInflight 设置已投递但还没处理完的最大消息数
+func WithStreamMaxInflight(n int) StreamOption {
+	return func(c *StreamConsumer) {
+		c.maxInflight = n
+	}
+}
+
+// WithStreamScheduler 消息投递到调度器中处理，keyField 对应的字段值作为调度的 key，
+// 相同 key 的消息串行处理(如玩家 uid)，字段不存在时使用消息 ID
+func WithStreamScheduler(sched schedule.Scheduler, keyField string) StreamOption {
+	return func(c *StreamConsumer) {
+		c.sched = sched
+		c.keyField = keyField
+	}
+}
+
+// StreamConsumer 以消费组的方式读取 stream，处理成功后确认，
+// 处理失败或者消费者宕机的消息由 XAUTOCLAIM 重新认领，保证至少投递一次
+type StreamConsumer struct {
+	pool     *Pool
+	stream   string
+	group    string
+	consumer string
+	handler  StreamHandler
+
+	count         int
+	block         time.Duration
+	minIdle       time.Duration
+	claimInterval time.Duration
+	start         string
+	maxInflight   int
+	sched         schedule.Scheduler
+	keyField      string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	lk       sync.Mutex
+	inflight map[string]*streamInflight // 已投递还没处理完的消息
+}
+
+// streamInflight 已投递的消息，running 表示已经开始处理
+type streamInflight struct {
+	at      time.Time
+	running bool
+}
+
+// NewStreamConsumer 创建 stream 消费者，consumer 在消费组内唯一，重启后使用相同的名字可以继续处理自己未确认的消息
+func (p *Pool) NewStreamConsumer(stream, group, consumer string, handler StreamHandler, opts ...StreamOption) *StreamConsumer {
+	c := &StreamConsumer{
+		pool:          p,
+		stream:        stream,
+		group:         group,
+		consumer:      consumer,
+		handler:       handler,
+		count:         defaultStreamCount,
+		block:         defaultStreamBlock,
+		minIdle:       defaultClaimIdle,
+		claimInterval: defaultClaimInterval,
+		start:         "$",
+		maxInflight:   defaultMaxInflight,
+		inflight:      make(map[string]*streamInflight),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c
+}
+
+// Start 创建消费组(已存在时忽略)，启动读取和认领协程
+func (c *StreamConsumer) Start() error {
+	if err := c.createGroup(); err != nil {
+		return err
+	}
+
+	c.wg.Add(2)
+	go c.readLoop()
+	go c.claimLoop()
+	return nil
+}
+
+// Stop 停止读取，等待读取和认领协程退出，已经投递到调度器的消息继续处理
+func (c *StreamConsumer) Stop() {
+	c.cancel()
+	c.wg.Wait()
+}
+
+func (c *StreamConsumer) createGroup() error {
+	cli, err := c.pool.GetClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Put()
+
+	_, err = cli.Do("XGROUP", "CREATE", c.stream, c.group, c.start, "MKSTREAM")
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		err = nil
+	}
+	return err
+}
+
+// readLoop 先读取自己未确认的消息，再阻塞读取新消息
+func (c *StreamConsumer) readLoop() {
+	defer c.wg.Done()
+
+	last := "0"
+	for c.ctx.Err() == nil {
+		msgs, err := c.read(last)
+		if err != nil {
+			if c.ctx.Err() != nil {
+				return
+			}
+			log.Printf("[ERROR] redis stream %s|%s XREADGROUP error: %v", c.stream, c.group, err)
+			if strings.HasPrefix(err.Error(), "NOGROUP") { // stream 被删除后重新创建消费组
+				c.createGroup()
+			}
+			c.sleep(time.Second)
+			continue
+		}
+
+		if last != ">" {
+			if len(msgs) == 0 {
+				last = ">"
+			} else {
+				last = msgs[len(msgs)-1].ID
+			}
+		}
+		for _, msg := range msgs {
+			c.dispatch(msg)
+		}
+	}
+}
+
+func (c *StreamConsumer) read(id string) (msgs []*StreamMessage, err error) {
+	if !c.wait() {
+		return nil, c.ctx.Err()
+	}
+
+	cli, err := c.pool.GetClient()
+	if err != nil {
+		return
+	}
+	defer cli.Put()
+
+	args := []any{"GROUP", c.group, c.consumer, "COUNT", c.count}
+	if id == ">" {
+		args = append(args, "BLOCK", c.block.Milliseconds())
+	}
+	args = append(args, "STREAMS", c.stream, id)
+
+	// 读超时需要大于阻塞时间
+	streams, err := redis.Values(redis.DoWithTimeout(cli.Conn, c.block+time.Second, "XREADGROUP", args...))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil || len(streams) == 0 {
+		return
+	}
+
+	// [[stream, [[id, [field, value...]]...]]]
+	stream, err := redis.Values(streams[0], nil)
+	if err != nil || len(stream) < 2 {
+		return
+	}
+	entries, err := redis.Values(stream[1], nil)
+	if err != nil {
+		return
+	}
+	return c.parse(entries)
+}
+
+func (c *StreamConsumer) parse(entries []any) ([]*StreamMessage, error) {
+	msgs := make([]*StreamMessage, 0, len(entries))
+	for _, e := range entries {
+		entry, err := redis.Values(e, nil)
+		if err != nil || len(entry) < 2 {
+			return nil, fmt.Errorf("redis stream invalid entry: %v", e)
+		}
+		id, err := redis.String(entry[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		// 已经被 XDEL 删除的 pending 消息字段为 nil
+		values, err := redis.StringMap(entry[1], nil)
+		if err != nil && err != redis.ErrNil {
+			return nil, err
+		}
+		msgs = append(msgs, &StreamMessage{Stream: c.stream, ID: id, Values: values})
+	}
+	return msgs, nil
+}
+
+// claimLoop 定时认领其他消费者(或自己)超时未确认的消息
+func (c *StreamConsumer) claimLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.claimInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.expire()
+			if err := c.claim(); err != nil && c.ctx.Err() == nil {
+				log.Printf("[ERROR] redis stream %s|%s XAUTOCLAIM error: %v", c.stream, c.group, err)
+			}
+		}
+	}
+}
+
+func (c *StreamConsumer) claim() error {
+	cli, err := c.pool.GetClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Put()
+
+	start := "0-0"
+	for c.ctx.Err() == nil {
+		// [next, [[id, [field, value...]]...], [deleted id...]]
+		reply, err := redis.Values(cli.Do("XAUTOCLAIM", c.stream, c.group, c.consumer,
+			c.minIdle.Milliseconds(), start, "COUNT", c.count))
+		if err != nil {
+			return err
+		}
+		if len(reply) < 2 {
+			return fmt.Errorf("redis stream invalid XAUTOCLAIM reply: %v", reply)
+		}
+
+		entries, err := redis.Values(reply[1], nil)
+		if err != nil {
+			return err
+		}
+		msgs, err := c.parse(entries)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			c.dispatch(msg)
+		}
+
+		if start, err = redis.String(reply[0], nil); err != nil || start == "0-0" {
+			return err
+		}
+	}
+	return nil
+}
+
+// dispatch 处理消息，正在处理中的消息不会重复投递
+func (c *StreamConsumer) dispatch(msg *StreamMessage) {
+	if msg.Values == nil { // 消息已经被删除，直接确认
+		c.ack(msg.ID)
+		return
+	}
+
+	c.lk.Lock()
+	if _, ok := c.inflight[msg.ID]; ok {
+		c.lk.Unlock()
+		return
+	}
+	in := &streamInflight{at: time.Now()}
+	c.inflight[msg.ID] = in
+	c.lk.Unlock()
+
+	run := func() {
+		if !c.begin(msg.ID, in) {
+			return
+		}
+		defer c.done(msg.ID)
+		if err := c.handle(msg); err != nil {
+			log.Printf("[ERROR] redis stream %s|%s|%s handle error: %v", c.stream, c.group, msg.ID, err)
+			return
+		}
+		c.ack(msg.ID)
+	}
+
+	if c.sched == nil {
+		run()
+		return
+	}
+
+	key := msg.Values[c.keyField]
+	if key == "" {
+		key = msg.ID
+	}
+	c.sched.Schedule(schedule.NewJob(key, func(*schedule.Job) { run() }, msg.ID))
+}
+
+func (c *StreamConsumer) handle(msg *StreamMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	// Stop 后已投递的消息继续处理，handler 的 ctx 不随 Stop 取消
+	return c.handler(context.WithoutCancel(c.ctx), msg)
+}
+
+func (c *StreamConsumer) ack(id string) {
+	cli, err := c.pool.GetClient()
+	if err != nil {
+		log.Printf("[ERROR] redis stream %s|%s|%s XACK error: %v", c.stream, c.group, id, err)
+		return
+	}
+	defer cli.Put()
+
+	if _, err = cli.Do("XACK", c.stream, c.group, id); err != nil {
+		log.Printf("[ERROR] redis stream %s|%s|%s XACK error: %v", c.stream, c.group, id, err)
+	}
+}
+
+// begin 开始处理消息，返回 false 表示消息已经被重新认领投递，不再处理
+func (c *StreamConsumer) begin(id string, in *streamInflight) bool {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	cur, ok := c.inflight[id]
+	if ok && cur != in {
+		return false
+	}
+	in.running = true
+	c.inflight[id] = in
+	return true
+}
+
+func (c *StreamConsumer) done(id string) {
+	c.lk.Lock()
+	delete(c.inflight, id)
+	c.lk.Unlock()
+}
+
+// expire 清理超过 MinIdle 还没开始处理的消息记录(如被调度器丢弃)，使其可以被重新认领投递，
+// 正在处理的消息在处理完之后清理
+func (c *StreamConsumer) expire() {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	for id, in := range c.inflight {
+		if !in.running && time.Since(in.at) > c.minIdle {
+			delete(c.inflight, id)
+		}
+	}
+}
+
+// wait 等待处理中的消息数低于 maxInflight，返回 false 表示已经停止
+func (c *StreamConsumer) wait() bool {
+	for {
+		c.lk.Lock()
+		n := len(c.inflight)
+		c.lk.Unlock()
+		if n < c.maxInflight {
+			return true
+		}
+		if !c.sleep(10 * time.Millisecond) {
+			return false
+		}
+	}
+}
+
+func (c *StreamConsumer) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,182 @@
+package redispool
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fakeStream 简化的 stream，ID 为 "序号-0"
+type fakeStream struct {
+	entries []fakeEntry
+	groups  map[string]*fakeGroup
+}
+
+type fakeEntry struct {
+	id     string
+	seq    int
+	fields []string
+}
+
+type fakeGroup struct {
+	next    int // 下一个要投递的 entry 下标
+	pending map[int]*fakePending
+}
+
+type fakePending struct {
+	consumer  string
+	delivered time.Time
+	count     int
+}
+
+func (e fakeEntry) reply() any {
+	fields := make([]any, len(e.fields))
+	for i, f := range e.fields {
+		fields[i] = []byte(f)
+	}
+	return []any{[]byte(e.id), fields}
+}
+
+func parseSeq(id string) int {
+	seq, _ := strconv.Atoi(strings.SplitN(id, "-", 2)[0])
+	return seq
+}
+
+// stream 执行 stream 相关命令，XREADGROUP 的 BLOCK 通过轮询实现
+func (s *fakeServer) stream(c *fakeConn, cmd string, args []string) any {
+	if cmd == "XREADGROUP" {
+		return s.xreadgroup(args)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := args[1]
+	if cmd == "XGROUP" {
+		key = args[2]
+	}
+	st := s.streams[key]
+
+	switch cmd {
+	case "XGROUP": // XGROUP CREATE key group id [MKSTREAM]
+		if st == nil {
+			st = &fakeStream{groups: make(map[string]*fakeGroup)}
+			s.streams[key] = st
+		}
+		if _, ok := st.groups[args[3]]; ok {
+			return errors.New("BUSYGROUP Consumer Group name already exists")
+		}
+		g := &fakeGroup{pending: make(map[int]*fakePending)}
+		if args[4] == "$" {
+			g.next = len(st.entries)
+		}
+		st.groups[args[3]] = g
+		return "OK"
+	case "XADD": // XADD key * field value ...
+		if st == nil {
+			st = &fakeStream{groups: make(map[string]*fakeGroup)}
+			s.streams[key] = st
+		}
+		seq := len(st.entries) + 1
+		e := fakeEntry{id: fmt.Sprintf("%d-0", seq), seq: seq, fields: args[3:]}
+		st.entries = append(st.entries, e)
+		return []byte(e.id)
+	case "XACK": // XACK key group id...
+		g := st.groups[args[2]]
+		n := 0
+		for _, id := range args[3:] {
+			if _, ok := g.pending[parseSeq(id)]; ok {
+				delete(g.pending, parseSeq(id))
+				n++
+			}
+		}
+		return n
+	case "XPENDING": // XPENDING key group，只返回数量
+		return len(st.groups[args[2]].pending)
+	case "XAUTOCLAIM": // XAUTOCLAIM key group consumer min-idle start [COUNT n]
+		g := st.groups[args[2]]
+		minIdle, _ := strconv.Atoi(args[4])
+		start := parseSeq(args[5])
+		count := 100
+		if len(args) > 7 {
+			count, _ = strconv.Atoi(args[7])
+		}
+
+		claimed := make([]any, 0)
+		for _, e := range st.entries {
+			p, ok := g.pending[e.seq]
+			if !ok || e.seq < start || time.Since(p.delivered) < time.Duration(minIdle)*time.Millisecond {
+				continue
+			}
+			if len(claimed) == count {
+				return []any{[]byte(e.id), claimed, []any{}}
+			}
+			p.consumer, p.delivered = args[3], time.Now()
+			p.count++
+			claimed = append(claimed, e.reply())
+		}
+		return []any{[]byte("0-0"), claimed, []any{}}
+	}
+	return nil
+}
+
+// xreadgroup XREADGROUP GROUP group consumer [COUNT n] [BLOCK ms] STREAMS key id
+func (s *fakeServer) xreadgroup(args []string) any {
+	group, consumer := args[2], args[3]
+	count, block := 100, -1
+	var key, id string
+	for i := 4; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "COUNT":
+			count, _ = strconv.Atoi(args[i+1])
+			i++
+		case "BLOCK":
+			block, _ = strconv.Atoi(args[i+1])
+			i++
+		case "STREAMS":
+			key, id = args[i+1], args[i+2]
+			i = len(args)
+		}
+	}
+
+	deadline := time.Now().Add(time.Duration(block) * time.Millisecond)
+	for {
+		s.mu.Lock()
+		st := s.streams[key]
+		if st == nil || st.groups[group] == nil {
+			s.mu.Unlock()
+			return errors.New("NOGROUP No such key or consumer group")
+		}
+		g := st.groups[group]
+
+		entries := make([]any, 0)
+		if id == ">" {
+			for g.next < len(st.entries) && len(entries) < count {
+				e := st.entries[g.next]
+				g.pending[e.seq] = &fakePending{consumer: consumer, delivered: time.Now(), count: 1}
+				entries = append(entries, e.reply())
+				g.next++
+			}
+		} else { // 本消费者未确认的消息
+			after := parseSeq(id)
+			for _, e := range st.entries {
+				if p, ok := g.pending[e.seq]; ok && p.consumer == consumer && e.seq > after && len(entries) < count {
+					entries = append(entries, e.reply())
+				}
+			}
+			s.mu.Unlock()
+			return []any{[]any{[]byte(key), entries}}
+		}
+		s.mu.Unlock()
+
+		if len(entries) > 0 {
+			return []any{[]any{[]byte(key), entries}}
+		}
+		if block < 0 || (block > 0 && time.Now().After(deadline)) {
+			return nilArray{}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
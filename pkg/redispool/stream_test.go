@@ -0,0 +1,198 @@
+package redispool
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/lightmen/nami/schedule/dispatch"
+)
+
+func xadd(t *testing.T, pool *Pool, stream string, kvs ...any) {
+	t.Helper()
+	cli, _ := pool.GetClient()
+	defer cli.Put()
+	if _, err := cli.Do("XADD", append([]any{stream, "*"}, kvs...)...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func pending(pool *Pool, stream, group string) int {
+	cli, _ := pool.GetClient()
+	defer cli.Put()
+	n, _ := redis.Int(cli.Do("XPENDING", stream, group))
+	return n
+}
+
+func TestStreamConsumer(t *testing.T) {
+	s := newFakeServer(t)
+	pool := newTestPool(t, s)
+
+	var mu sync.Mutex
+	got := make(map[string]int)
+	fail := true
+	c := pool.NewStreamConsumer("events", "g", "c1", func(ctx context.Context, msg *StreamMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got[msg.Values["n"]]++
+		if msg.Values["n"] == "2" && fail { // 第一次处理失败，等待重新认领
+			fail = false
+			return errors.New("fail")
+		}
+		return nil
+	}, WithStreamBlock(50*time.Millisecond), WithStreamClaim(50*time.Millisecond, 20*time.Millisecond))
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	// 重复创建消费组不报错
+	if err := c.createGroup(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		xadd(t, pool, "events", "n", strconv.Itoa(i))
+	}
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return got["1"] == 1 && got["2"] == 2 && got["3"] == 1
+	})
+	waitFor(t, func() bool { return pending(pool, "events", "g") == 0 })
+}
+
+func TestStreamConsumerRestart(t *testing.T) {
+	s := newFakeServer(t)
+	pool := newTestPool(t, s)
+
+	// c1 读取后没有确认就退出
+	c1 := pool.NewStreamConsumer("events", "g", "c1", func(ctx context.Context, msg *StreamMessage) error {
+		return errors.New("crash")
+	}, WithStreamBlock(50*time.Millisecond), WithStreamClaim(time.Hour, time.Hour))
+	if err := c1.Start(); err != nil {
+		t.Fatal(err)
+	}
+	xadd(t, pool, "events", "n", "1")
+	waitFor(t, func() bool { return pending(pool, "events", "g") == 1 })
+	c1.Stop()
+
+	// 相同名字的消费者重启后先处理自己 pending 的消息
+	done := make(chan string, 1)
+	c2 := pool.NewStreamConsumer("events", "g", "c1", func(ctx context.Context, msg *StreamMessage) error {
+		done <- msg.Values["n"]
+		return nil
+	}, WithStreamBlock(50*time.Millisecond), WithStreamClaim(time.Hour, time.Hour))
+	if err := c2.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Stop()
+
+	select {
+	case n := <-done:
+		if n != "1" {
+			t.Fatalf("n = %s", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	waitFor(t, func() bool { return pending(pool, "events", "g") == 0 })
+}
+
+func TestStreamConsumerScheduler(t *testing.T) {
+	s := newFakeServer(t)
+	pool := newTestPool(t, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	seqs := make(map[string][]int)
+	c := pool.NewStreamConsumer("events", "g", "c1", func(ctx context.Context, msg *StreamMessage) error {
+		seq, _ := strconv.Atoi(msg.Values["seq"])
+		mu.Lock()
+		seqs[msg.Values["uid"]] = append(seqs[msg.Values["uid"]], seq)
+		mu.Unlock()
+		return nil
+	}, WithStreamBlock(50*time.Millisecond), WithStreamScheduler(dispatch.New(ctx, dispatch.WithMaxWorker(8)), "uid"))
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	const n = 50
+	for i := 0; i < n; i++ {
+		for _, uid := range []string{"u1", "u2", "u3"} {
+			xadd(t, pool, "events", "uid", uid, "seq", strconv.Itoa(i))
+		}
+	}
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(seqs["u1"])+len(seqs["u2"])+len(seqs["u3"]) == 3*n
+	})
+	waitFor(t, func() bool { return pending(pool, "events", "g") == 0 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	for uid, list := range seqs {
+		if len(list) != n {
+			t.Fatalf("%s got %d messages", uid, len(list))
+		}
+		for i, seq := range list {
+			if seq != i {
+				t.Fatalf("%s out of order: %v", uid, list)
+			}
+		}
+	}
+}
+
+func TestStreamConsumerExpire(t *testing.T) {
+	c := &StreamConsumer{minIdle: time.Second, inflight: make(map[string]*streamInflight)}
+	old := time.Now().Add(-time.Minute)
+	running := &streamInflight{at: old}
+	dropped := &streamInflight{at: old}
+	c.inflight["1-0"], c.inflight["2-0"] = running, dropped
+	if !c.begin("1-0", running) {
+		t.Fatal("begin 1-0 failed")
+	}
+
+	// 正在处理的消息不清理，超时没有开始处理的消息可以重新认领
+	c.expire()
+	if _, ok := c.inflight["1-0"]; !ok {
+		t.Fatal("running message expired")
+	}
+	if _, ok := c.inflight["2-0"]; ok {
+		t.Fatal("dropped message not expired")
+	}
+
+	// 重新认领之后，之前投递的任务不再处理
+	c.inflight["2-0"] = &streamInflight{at: time.Now()}
+	if c.begin("2-0", dropped) {
+		t.Fatal("stale job should not run")
+	}
+}
+
+func TestStreamConsumerHandleAfterStop(t *testing.T) {
+	var herr error
+	c := &StreamConsumer{handler: func(ctx context.Context, msg *StreamMessage) error {
+		herr = ctx.Err()
+		return nil
+	}}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.cancel()
+
+	// Stop 后调度器中的消息继续处理，handler 的 ctx 不应该已经取消
+	if err := c.handle(&StreamMessage{ID: "1-0"}); err != nil {
+		t.Fatal(err)
+	}
+	if herr != nil {
+		t.Fatalf("handler ctx canceled: %v", herr)
+	}
+}
@@ -0,0 +1,93 @@
+package redispool
+
+import (
+	"errors"
+)
+
+// ErrTxFailed WATCH 的 key 在事务提交前被修改，事务没有执行
+var ErrTxFailed = errors.New("redis: transaction failed")
+
+// Tx WATCH 之后的事务，可以先用 Client 的方法读取数据，再用 Exec 提交修改
+type Tx struct {
+	*Client
+}
+
+// Exec 使用 MULTI/EXEC 原子执行 fn 中添加的命令，WATCH 的 key 被修改时返回 ErrTxFailed
+func (tx *Tx) Exec(fn func(p *Pipeline)) ([]*Cmd, error) {
+	p := tx.Pipeline()
+	fn(p)
+	cmds := p.cmds
+	if len(cmds) == 0 {
+		return cmds, nil
+	}
+
+	conn := tx.Conn
+	if err := conn.Send("MULTI"); err != nil {
+		return cmds, err
+	}
+	for _, c := range cmds {
+		if err := conn.Send(c.name, c.args...); err != nil {
+			return cmds, err
+		}
+	}
+	if err := conn.Send("EXEC"); err != nil {
+		return cmds, err
+	}
+	if err := conn.Flush(); err != nil {
+		return cmds, err
+	}
+
+	// MULTI 和每个命令的 QUEUED，入队失败的命令在 EXEC 时返回 EXECABORT，
+	// 出错时也要读完所有回包，避免连接中残留回包
+	_, multiErr := conn.Receive()
+	for _, c := range cmds {
+		c.setReply(conn.Receive())
+	}
+
+	reply, err := conn.Receive()
+	if multiErr != nil {
+		return cmds, multiErr
+	}
+	if err != nil {
+		return cmds, err
+	}
+	if reply == nil {
+		return cmds, ErrTxFailed
+	}
+
+	replies, ok := reply.([]any)
+	if !ok || len(replies) != len(cmds) {
+		return cmds, errors.New("redis: unexpected exec reply")
+	}
+	for i, c := range cmds {
+		c.setReply(replies[i], nil)
+	}
+	return cmds, firstErr(cmds)
+}
+
+// Watch WATCH keys 之后执行 fn，fn 中调用 tx.Exec 提交，fn 返回后 UNWATCH
+func (c *Client) Watch(fn func(tx *Tx) error, keys ...string) error {
+	args := make([]any, len(keys))
+	for i, k := range keys {
+		args[i] = k
+	}
+	if _, err := c.doCmd("WATCH", args...); err != nil {
+		return err
+	}
+
+	err := fn(&Tx{Client: c})
+	if _, e := c.doCmd("UNWATCH"); err == nil {
+		err = e
+	}
+	return err
+}
+
+// Transaction Watch 返回 ErrTxFailed 时重试，最多执行 maxRetries+1 次
+func (c *Client) Transaction(maxRetries int, fn func(tx *Tx) error, keys ...string) (err error) {
+	for i := 0; i <= maxRetries; i++ {
+		if err = c.Watch(fn, keys...); !errors.Is(err, ErrTxFailed) {
+			return
+		}
+	}
+	return
+}
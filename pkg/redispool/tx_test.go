@@ -0,0 +1,96 @@
+package redispool
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestTransaction(t *testing.T) {
+	s := newFakeServer(t)
+	pool := newTestPool(t, s)
+	cli, _ := pool.GetClient()
+	defer cli.Put()
+
+	other, _ := pool.GetClient()
+	defer other.Put()
+
+	// WATCH 之后 key 被修改，事务失败
+	err := cli.Watch(func(tx *Tx) error {
+		if err := other.Set("stock", 10); err != nil {
+			return err
+		}
+		_, err := tx.Exec(func(p *Pipeline) {
+			p.Set("stock", 9)
+		})
+		return err
+	}, "stock")
+	if !errors.Is(err, ErrTxFailed) {
+		t.Fatalf("watch = %v, want ErrTxFailed", err)
+	}
+
+	// 并发扣库存，冲突时重试
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, _ := pool.GetClient()
+			defer c.Put()
+
+			err := c.Transaction(100, func(tx *Tx) error {
+				n, _, err := tx.GetInt64("stock")
+				if err != nil {
+					return err
+				}
+				_, err = tx.Exec(func(p *Pipeline) {
+					p.Set("stock", n-1)
+				})
+				return err
+			}, "stock")
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n, _, _ := cli.GetInt64("stock"); n != 5 {
+		t.Fatalf("stock = %d, want 5", n)
+	}
+
+	// 入队失败时整个事务不执行
+	_, err = (&Tx{Client: cli}).Exec(func(p *Pipeline) {
+		p.Set("stock", 0)
+		p.Do("UNKNOWN")
+	})
+	if err == nil {
+		t.Fatal("exec with bad command should fail")
+	}
+	if n, _, _ := cli.GetInt64("stock"); n != 5 {
+		t.Fatalf("stock = %d, want 5", n)
+	}
+}
+
+func TestClusterTransaction(t *testing.T) {
+	_, nodes := newFakeCluster(t, 3)
+	pool := newTestClusterPool(t, nodes[0])
+	cli, _ := pool.GetClient()
+	defer cli.Put()
+
+	err := cli.Transaction(3, func(tx *Tx) error {
+		_, err := tx.Exec(func(p *Pipeline) {
+			p.IncrBy("{u1}.gold", 10)
+			p.IncrBy("{u1}.gem", 1)
+		})
+		return err
+	}, "{u1}.gold")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner := nodes[int(Slot("u1"))*3/clusterSlots]
+	if !owner.has("{u1}.gold") || !owner.has("{u1}.gem") {
+		t.Fatal("transaction should run on the slot owner")
+	}
+}
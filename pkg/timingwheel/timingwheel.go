@@ -0,0 +1,212 @@
+// Package timingwheel 分层时间轮，添加、停止和重置定时器的复杂度为 O(1)，
+// 适合大量定时器的场景，比如 session 超时清理、缓存过期等
+package timingwheel
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/lightmen/nami/pkg/safe"
+)
+
+// TimingWheel 分层时间轮，第 i 层的每个槽跨度为 tick * wheelSize^i，层数按需增长
+type TimingWheel struct {
+	tick      time.Duration
+	wheelSize int64
+
+	mu     sync.Mutex
+	start  time.Time
+	now    int64 // 已经处理到的 tick
+	levels [][]*list.List
+	spans  []int64 // 每一层一个槽的跨度，单位 tick
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// Timer 时间轮中的定时器
+type Timer struct {
+	tw     *TimingWheel
+	f      func()
+	expire int64 // 到期的 tick
+
+	bucket *list.List // 所在的槽，已经触发或者停止时为 nil
+	elem   *list.Element
+}
+
+// New 创建时间轮，tick 为精度，wheelSize 为每一层的槽数，创建后调用 Start 启动
+func New(tick time.Duration, wheelSize int) *TimingWheel {
+	if tick <= 0 {
+		tick = time.Millisecond
+	}
+	if wheelSize < 2 {
+		wheelSize = 2
+	}
+
+	tw := &TimingWheel{
+		tick:      tick,
+		wheelSize: int64(wheelSize),
+		start:     time.Now(),
+		stop:      make(chan struct{}),
+	}
+	tw.addLevel()
+	return tw
+}
+
+// Start 启动时间轮
+func (tw *TimingWheel) Start() {
+	tw.wg.Add(1)
+	safe.Go(tw.run)
+}
+
+// Stop 停止时间轮，未触发的定时器不再触发
+func (tw *TimingWheel) Stop() {
+	tw.once.Do(func() {
+		close(tw.stop)
+	})
+	tw.wg.Wait()
+}
+
+// AfterFunc d 之后在时间轮的 goroutine 中调用 f，f 需要尽快返回，耗时的任务需要自己启动 goroutine
+func (tw *TimingWheel) AfterFunc(d time.Duration, f func()) *Timer {
+	t := &Timer{tw: tw, f: f}
+
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	tw.schedule(t, d)
+	return t
+}
+
+// Stop 停止定时器，定时器已经触发或者停止时返回 false
+func (t *Timer) Stop() bool {
+	t.tw.mu.Lock()
+	defer t.tw.mu.Unlock()
+
+	return t.remove()
+}
+
+// Reset 重新设置定时器 d 之后触发，定时器还未触发时返回 true
+func (t *Timer) Reset(d time.Duration) bool {
+	t.tw.mu.Lock()
+	defer t.tw.mu.Unlock()
+
+	active := t.remove()
+	t.tw.schedule(t, d)
+	return active
+}
+
+// remove 调用时需持有锁
+func (t *Timer) remove() bool {
+	if t.bucket == nil {
+		return false
+	}
+
+	t.bucket.Remove(t.elem)
+	t.bucket, t.elem = nil, nil
+	return true
+}
+
+// schedule 调用时需持有锁
+func (tw *TimingWheel) schedule(t *Timer, d time.Duration) {
+	ticks := int64((time.Since(tw.start) + d + tw.tick - 1) / tw.tick)
+	if ticks <= tw.now {
+		ticks = tw.now + 1 // 已经过期的在下一个 tick 触发
+	}
+	t.expire = ticks
+	tw.add(t)
+}
+
+// add 将定时器放到第一个能容纳的层，调用时需持有锁
+func (tw *TimingWheel) add(t *Timer) {
+	for i := 0; ; i++ {
+		if i == len(tw.levels) {
+			tw.addLevel()
+		}
+
+		span := tw.spans[i]
+		if t.expire/span-tw.now/span < tw.wheelSize {
+			t.bucket = tw.levels[i][(t.expire/span)%tw.wheelSize]
+			t.elem = t.bucket.PushBack(t)
+			return
+		}
+	}
+}
+
+func (tw *TimingWheel) addLevel() {
+	span := int64(1)
+	if n := len(tw.spans); n > 0 {
+		span = tw.spans[n-1] * tw.wheelSize
+	}
+
+	buckets := make([]*list.List, tw.wheelSize)
+	for i := range buckets {
+		buckets[i] = list.New()
+	}
+	tw.levels = append(tw.levels, buckets)
+	tw.spans = append(tw.spans, span)
+}
+
+func (tw *TimingWheel) run() {
+	defer tw.wg.Done()
+
+	ticker := time.NewTicker(tw.tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tw.stop:
+			return
+		case <-ticker.C:
+			tw.advance(int64(time.Since(tw.start) / tw.tick))
+		}
+	}
+}
+
+// advance 处理到 target 为止所有到期的定时器
+func (tw *TimingWheel) advance(target int64) {
+	for {
+		tw.mu.Lock()
+		if tw.now >= target {
+			tw.mu.Unlock()
+			return
+		}
+
+		tw.now++
+		tw.cascade()
+		expired := tw.take(tw.levels[0][tw.now%tw.wheelSize])
+		tw.mu.Unlock()
+
+		for _, t := range expired {
+			safe.Func(t.f)
+		}
+	}
+}
+
+// cascade 将高层当前槽的定时器移到低层，调用时需持有锁
+func (tw *TimingWheel) cascade() {
+	for i := len(tw.levels) - 1; i > 0; i-- {
+		span := tw.spans[i]
+		if tw.now%span != 0 {
+			continue
+		}
+
+		for _, t := range tw.take(tw.levels[i][(tw.now/span)%tw.wheelSize]) {
+			tw.add(t)
+		}
+	}
+}
+
+// take 取出槽中的所有定时器，调用时需持有锁
+func (tw *TimingWheel) take(bucket *list.List) []*Timer {
+	timers := make([]*Timer, 0, bucket.Len())
+	for e := bucket.Front(); e != nil; e = e.Next() {
+		t := e.Value.(*Timer)
+		t.bucket, t.elem = nil, nil
+		timers = append(timers, t)
+	}
+	bucket.Init()
+	return timers
+}
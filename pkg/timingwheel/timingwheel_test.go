@@ -0,0 +1,104 @@
+package timingwheel
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestAdvance 不启动时间轮，手动推进 tick，检查所有定时器在到期的 tick 触发
+func TestAdvance(t *testing.T) {
+	tw := New(time.Millisecond, 4)
+
+	fired := make(map[int64]int64)
+	count := 0
+	const n = 2000
+	for i := 0; i < n; i++ {
+		expire := rand.Int63n(5000) + 1
+		timer := &Timer{tw: tw, expire: expire}
+		timer.f = func() {
+			fired[expire] = tw.now
+			count++
+		}
+		tw.add(timer)
+	}
+
+	tw.advance(5000)
+	if count != n {
+		t.Fatalf("fired %d timers, want %d", count, n)
+	}
+	if len(tw.levels) < 6 {
+		t.Fatalf("levels = %d, want >= 6", len(tw.levels))
+	}
+	for expire, now := range fired {
+		if expire != now {
+			t.Fatalf("timer expire at %d fired at %d", expire, now)
+		}
+	}
+}
+
+func TestAfterFunc(t *testing.T) {
+	tw := New(time.Millisecond, 8)
+	tw.Start()
+	defer tw.Stop()
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for _, d := range []time.Duration{5, 20, 80, 150} {
+		d := d * time.Millisecond
+		wg.Add(1)
+		tw.AfterFunc(d, func() {
+			defer wg.Done()
+			if elapsed := time.Since(start); elapsed < d {
+				t.Errorf("timer %v fired after %v", d, elapsed)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func TestStopReset(t *testing.T) {
+	tw := New(time.Millisecond, 8)
+	tw.Start()
+	defer tw.Stop()
+
+	var stopped, reset atomic.Int32
+	t1 := tw.AfterFunc(20*time.Millisecond, func() { stopped.Add(1) })
+	if !t1.Stop() || t1.Stop() {
+		t.Fatal("stop should succeed once")
+	}
+
+	done := make(chan struct{})
+	t2 := tw.AfterFunc(10*time.Millisecond, func() {
+		reset.Add(1)
+		close(done)
+	})
+	start := time.Now()
+	if !t2.Reset(50 * time.Millisecond) {
+		t.Fatal("reset active timer should return true")
+	}
+
+	<-done
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("reset timer fired after %v", elapsed)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if stopped.Load() != 0 || reset.Load() != 1 {
+		t.Fatalf("stopped = %d, reset = %d", stopped.Load(), reset.Load())
+	}
+}
+
+func BenchmarkReset(b *testing.B) {
+	tw := New(time.Millisecond, 64)
+	timers := make([]*Timer, 100000)
+	for i := range timers {
+		timers[i] = tw.AfterFunc(time.Duration(i)*time.Millisecond, func() {})
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		timers[i%len(timers)].Reset(time.Minute)
+	}
+}
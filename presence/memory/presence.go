@@ -0,0 +1,97 @@
+// Package memory 进程内的在线状态实现，用于测试和单进程部署
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/lightmen/nami/presence"
+)
+
+var _ presence.Presence = (*Presence)(nil)
+
+// Option is memory presence option.
+type Option func(p *Presence)
+
+// WithPolicy 设置多端登录策略，默认为 presence.KickOld
+func WithPolicy(policy presence.Policy) Option {
+	return func(p *Presence) {
+		p.policy = policy
+	}
+}
+
+// Presence is memory presence.
+type Presence struct {
+	policy presence.Policy
+
+	lk    sync.RWMutex
+	users map[string]map[string]*presence.Location // uid -> device -> location
+}
+
+// New creates memory presence
+func New(opts ...Option) *Presence {
+	p := &Presence{
+		policy: presence.KickOld,
+		users:  make(map[string]map[string]*presence.Location),
+	}
+
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+func (p *Presence) Login(ctx context.Context, loc *presence.Location) ([]*presence.Location, error) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	devices := p.users[loc.UID]
+	current := make([]*presence.Location, 0, len(devices))
+	for _, l := range devices {
+		current = append(current, l)
+	}
+
+	kicked := presence.Kicked(p.policy, current, loc)
+	if devices == nil || p.policy == presence.KickOld {
+		devices = make(map[string]*presence.Location)
+		p.users[loc.UID] = devices
+	}
+
+	l := *loc
+	devices[loc.Device] = &l
+	return kicked, nil
+}
+
+func (p *Presence) Logout(ctx context.Context, loc *presence.Location) error {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	devices := p.users[loc.UID]
+	if l, ok := devices[loc.Device]; ok && l.Same(loc) {
+		delete(devices, loc.Device)
+	}
+	if len(devices) == 0 {
+		delete(p.users, loc.UID)
+	}
+	return nil
+}
+
+func (p *Presence) Locate(ctx context.Context, uid string) ([]*presence.Location, error) {
+	p.lk.RLock()
+	defer p.lk.RUnlock()
+
+	devices := p.users[uid]
+	locs := make([]*presence.Location, 0, len(devices))
+	for _, l := range devices {
+		c := *l
+		locs = append(locs, &c)
+	}
+	return locs, nil
+}
+
+func (p *Presence) IsOnline(ctx context.Context, uid string) (bool, error) {
+	p.lk.RLock()
+	defer p.lk.RUnlock()
+
+	return len(p.users[uid]) > 0, nil
+}
@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lightmen/nami/presence"
+)
+
+func loc(device, gate string) *presence.Location {
+	return &presence.Location{UID: "u1", Device: device, GateAddr: gate, InstanceID: gate}
+}
+
+func TestKickOld(t *testing.T) {
+	ctx := context.Background()
+	p := New()
+
+	if online, _ := p.IsOnline(ctx, "u1"); online {
+		t.Fatal("u1 should be offline")
+	}
+
+	kicked, _ := p.Login(ctx, loc("pc", "gate1"))
+	if len(kicked) != 0 {
+		t.Fatalf("kicked = %v", kicked)
+	}
+
+	// 同一个网关上重连不踢
+	kicked, _ = p.Login(ctx, loc("pc", "gate1"))
+	if len(kicked) != 0 {
+		t.Fatalf("kicked = %v", kicked)
+	}
+
+	kicked, _ = p.Login(ctx, loc("phone", "gate2"))
+	if len(kicked) != 1 || kicked[0].GateAddr != "gate1" {
+		t.Fatalf("kicked = %v", kicked)
+	}
+
+	// 旧网关的登出不影响新的登录
+	_ = p.Logout(ctx, loc("pc", "gate1"))
+	locs, _ := p.Locate(ctx, "u1")
+	if len(locs) != 1 || locs[0].GateAddr != "gate2" {
+		t.Fatalf("locs = %v", locs)
+	}
+
+	_ = p.Logout(ctx, loc("phone", "gate2"))
+	if online, _ := p.IsOnline(ctx, "u1"); online {
+		t.Fatal("u1 should be offline")
+	}
+}
+
+func TestAllowMultiple(t *testing.T) {
+	ctx := context.Background()
+	p := New(WithPolicy(presence.AllowMultiple))
+
+	_, _ = p.Login(ctx, loc("pc", "gate1"))
+	kicked, _ := p.Login(ctx, loc("phone", "gate2"))
+	if len(kicked) != 0 {
+		t.Fatalf("kicked = %v", kicked)
+	}
+
+	kicked, _ = p.Login(ctx, loc("phone", "gate3"))
+	if len(kicked) != 1 || kicked[0].GateAddr != "gate2" {
+		t.Fatalf("kicked = %v", kicked)
+	}
+
+	locs, _ := p.Locate(ctx, "u1")
+	if len(locs) != 2 {
+		t.Fatalf("locs = %v", locs)
+	}
+}
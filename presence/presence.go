@@ -0,0 +1,54 @@
+// Package presence 记录玩家登录的网关，用于查询玩家是否在线以及将推送发送到玩家所在的网关
+package presence
+
+import (
+	"context"
+)
+
+// Policy 多端登录策略
+type Policy int
+
+const (
+	KickOld       Policy = iota // 只允许一个设备在线，新登录踢掉之前登录的设备
+	AllowMultiple               // 允许多个设备同时在线，同一个设备重复登录时踢掉之前的登录
+)
+
+// Location 玩家登录的位置
+type Location struct {
+	UID        string `json:"uid"`
+	Device     string `json:"device"`      // 设备标识，多端登录时区分不同的设备
+	GateAddr   string `json:"gate_addr"`   // 网关的地址，类似 grpc://192.168.15.117:33308
+	InstanceID string `json:"instance_id"` // 网关的实例ID
+	LoginTime  int64  `json:"login_time"`  // 登录时间，单位毫秒
+}
+
+// Same 是否为同一个网关上的同一个设备
+func (l *Location) Same(o *Location) bool {
+	return l.Device == o.Device && l.GateAddr == o.GateAddr && l.InstanceID == o.InstanceID
+}
+
+// Presence 在线状态服务
+type Presence interface {
+	// Login 记录玩家登录的位置，返回根据多端登录策略需要踢下线的位置
+	Login(ctx context.Context, loc *Location) (kicked []*Location, err error)
+	// Logout 玩家登出，只有记录的位置与 loc 相同时才删除，避免旧网关的登出覆盖新的登录
+	Logout(ctx context.Context, loc *Location) error
+	// Locate 返回玩家所有在线的位置，不在线时返回空
+	Locate(ctx context.Context, uid string) ([]*Location, error)
+	// IsOnline 玩家是否在线
+	IsOnline(ctx context.Context, uid string) (bool, error)
+}
+
+// Kicked 根据多端登录策略计算登录 loc 时需要踢下线的位置
+func Kicked(policy Policy, current []*Location, loc *Location) []*Location {
+	kicked := make([]*Location, 0)
+	for _, c := range current {
+		if c.Same(loc) {
+			continue
+		}
+		if policy == KickOld || c.Device == loc.Device {
+			kicked = append(kicked, c)
+		}
+	}
+	return kicked
+}
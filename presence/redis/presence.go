@@ -0,0 +1,193 @@
+// Package redis 基于 redispool 的在线状态实现，玩家的位置保存在 hash 中，field 为设备标识
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	redigo "github.com/garyburd/redigo/redis"
+	"github.com/lightmen/nami/pkg/redispool"
+	"github.com/lightmen/nami/presence"
+)
+
+var _ presence.Presence = (*Presence)(nil)
+
+// loginScript 写入新的位置，返回被替换的位置
+// KEYS[1] 玩家的 key
+// ARGV[1] 是否替换所有设备，ARGV[2] 设备，ARGV[3] 位置，ARGV[4] 过期毫秒
+var loginScript = redigo.NewScript(1, `
+local old = {}
+if ARGV[1] == '1' then
+	old = redis.call('HVALS', KEYS[1])
+	redis.call('DEL', KEYS[1])
+else
+	local v = redis.call('HGET', KEYS[1], ARGV[2])
+	if v then
+		old[1] = v
+	end
+end
+redis.call('HSET', KEYS[1], ARGV[2], ARGV[3])
+if tonumber(ARGV[4]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[4])
+end
+return old
+`)
+
+// logoutScript 位置的网关相同时删除
+// KEYS[1] 玩家的 key
+// ARGV[1] 设备，ARGV[2] 网关地址，ARGV[3] 网关实例ID
+var logoutScript = redigo.NewScript(1, `
+local v = redis.call('HGET', KEYS[1], ARGV[1])
+if not v then
+	return 0
+end
+local l = cjson.decode(v)
+if l.gate_addr ~= ARGV[2] or l.instance_id ~= ARGV[3] then
+	return 0
+end
+return redis.call('HDEL', KEYS[1], ARGV[1])
+`)
+
+// Option is redis presence option.
+type Option func(p *Presence)
+
+// WithPolicy 设置多端登录策略，默认为 presence.KickOld
+func WithPolicy(policy presence.Policy) Option {
+	return func(p *Presence) {
+		p.policy = policy
+	}
+}
+
+// Prefix 玩家位置在 redis 中的 key 前缀
+func Prefix(prefix string) Option {
+	return func(p *Presence) {
+		p.prefix = prefix
+	}
+}
+
+// TTL 玩家位置的过期时间，每次登录时刷新，避免网关异常退出后一直在线，小于等于0时不过期
+func TTL(ttl time.Duration) Option {
+	return func(p *Presence) {
+		p.ttl = ttl
+	}
+}
+
+// Presence is redis presence.
+type Presence struct {
+	pool   *redispool.Pool
+	policy presence.Policy
+	prefix string
+	ttl    time.Duration
+}
+
+// New creates redis presence
+func New(pool *redispool.Pool, opts ...Option) *Presence {
+	p := &Presence{
+		pool:   pool,
+		policy: presence.KickOld,
+		prefix: "nami:presence:",
+		ttl:    24 * time.Hour,
+	}
+
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+func (p *Presence) Login(ctx context.Context, loc *presence.Location) ([]*presence.Location, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(loc)
+	if err != nil {
+		return nil, err
+	}
+
+	kickAll := 0
+	if p.policy == presence.KickOld {
+		kickAll = 1
+	}
+
+	cli, err := p.pool.GetClient()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Put()
+
+	values, err := redigo.ByteSlices(loginScript.Do(cli.Conn, p.key(loc.UID), kickAll, loc.Device, data, p.ttl.Milliseconds()))
+	if err != nil {
+		return nil, err
+	}
+
+	old, err := decode(values)
+	if err != nil {
+		return nil, err
+	}
+	return presence.Kicked(p.policy, old, loc), nil
+}
+
+func (p *Presence) Logout(ctx context.Context, loc *presence.Location) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	cli, err := p.pool.GetClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Put()
+
+	_, err = logoutScript.Do(cli.Conn, p.key(loc.UID), loc.Device, loc.GateAddr, loc.InstanceID)
+	return err
+}
+
+func (p *Presence) Locate(ctx context.Context, uid string) ([]*presence.Location, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	cli, err := p.pool.GetClient()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Put()
+
+	values, err := redigo.ByteSlices(cli.Do("HVALS", p.key(uid)))
+	if err != nil {
+		return nil, err
+	}
+	return decode(values)
+}
+
+func (p *Presence) IsOnline(ctx context.Context, uid string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	cli, err := p.pool.GetClient()
+	if err != nil {
+		return false, err
+	}
+	defer cli.Put()
+
+	return cli.Exists(p.key(uid))
+}
+
+func (p *Presence) key(uid string) string {
+	return p.prefix + uid
+}
+
+func decode(values [][]byte) ([]*presence.Location, error) {
+	locs := make([]*presence.Location, 0, len(values))
+	for _, v := range values {
+		l := &presence.Location{}
+		if err := json.Unmarshal(v, l); err != nil {
+			return nil, err
+		}
+		locs = append(locs, l)
+	}
+	return locs, nil
+}
@@ -0,0 +1,51 @@
+package redis
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/lightmen/nami/pkg/random"
+	"github.com/lightmen/nami/pkg/redispool"
+	"github.com/lightmen/nami/presence"
+)
+
+// 需要设置 NAMI_REDIS_ADDR 环境变量指定 redis 地址
+func TestPresence(t *testing.T) {
+	addr := os.Getenv("NAMI_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("NAMI_REDIS_ADDR not set")
+	}
+
+	pool, err := redispool.NewPool(addr, os.Getenv("NAMI_REDIS_PASS"), 2, 16, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	p := New(pool, Prefix("nami:test:"+random.String(8)+":"))
+	loc1 := &presence.Location{UID: "u1", Device: "pc", GateAddr: "gate1", InstanceID: "gate1"}
+	loc2 := &presence.Location{UID: "u1", Device: "phone", GateAddr: "gate2", InstanceID: "gate2"}
+
+	if _, err = p.Login(ctx, loc1); err != nil {
+		t.Fatal(err)
+	}
+	kicked, err := p.Login(ctx, loc2)
+	if err != nil || len(kicked) != 1 || kicked[0].GateAddr != "gate1" {
+		t.Fatalf("kicked = %v, %v", kicked, err)
+	}
+
+	if err = p.Logout(ctx, loc1); err != nil {
+		t.Fatal(err)
+	}
+	if online, _ := p.IsOnline(ctx, "u1"); !online {
+		t.Fatal("u1 should be online")
+	}
+
+	if err = p.Logout(ctx, loc2); err != nil {
+		t.Fatal(err)
+	}
+	if online, _ := p.IsOnline(ctx, "u1"); online {
+		t.Fatal("u1 should be offline")
+	}
+}
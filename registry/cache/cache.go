@@ -0,0 +1,224 @@
+// Package cache 为 registry.Discovery 提供缓存，每个服务最后一次获取到的节点列表会持久化到本地磁盘，
+// 注册中心不可用(如启动时 etcd 无法连接)时使用缓存的节点列表，注册中心恢复后自动更新缓存
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/lightmen/nami/alog"
+	"github.com/lightmen/nami/registry"
+)
+
+var _ registry.Discovery = (*Discovery)(nil)
+
+// allServices 服务名为空(所有服务)时使用的缓存文件名
+const allServices = "_all"
+
+// snapshot 服务节点列表的快照
+type snapshot struct {
+	UpdateTime int64                `json:"UpdateTime"` // 从注册中心获取的时间，单位毫秒
+	Instances  []*registry.Instance `json:"Instances"`
+	data       []byte
+}
+
+// Discovery 带缓存的服务发现
+type Discovery struct {
+	dis  registry.Discovery
+	opts *options
+
+	lk        sync.RWMutex
+	snapshots map[string]*snapshot
+	fileLk    sync.Mutex
+}
+
+// New creates cache discovery
+func New(dis registry.Discovery, opts ...Option) *Discovery {
+	op := &options{
+		retry:   time.Second * 3,
+		nowFunc: time.Now,
+	}
+	for _, o := range opts {
+		o(op)
+	}
+
+	return &Discovery{
+		dis:       dis,
+		opts:      op,
+		snapshots: make(map[string]*snapshot),
+	}
+}
+
+// GetService 从注册中心获取节点列表并更新缓存，注册中心出错时返回缓存的节点列表
+func (d *Discovery) GetService(ctx context.Context, name string) ([]*registry.Instance, error) {
+	items, err := d.dis.GetService(ctx, name)
+	if err == nil {
+		d.store(name, items)
+		return items, nil
+	}
+
+	cached, ok := d.fromCache(name)
+	if !ok {
+		return nil, err
+	}
+
+	alog.ErrorCtx(ctx, "[registry][cache][%s] get service error: %s, use cache", name, err.Error())
+	return cached, nil
+}
+
+// Watch creates a watcher according to the service name, 注册中心创建 watcher 失败时返回使用缓存的 watcher，并在后台重试
+func (d *Discovery) Watch(ctx context.Context, name string) (registry.Watcher, error) {
+	w, err := d.dis.Watch(ctx, name)
+	if err != nil {
+		if _, ok := d.fromCache(name); !ok {
+			return nil, err
+		}
+		alog.ErrorCtx(ctx, "[registry][cache][%s] watch error: %s, use cache", name, err.Error())
+	}
+
+	return newWatcher(ctx, name, d, w), nil
+}
+
+// Staleness 返回服务节点列表距离上次从注册中心成功获取的时间，没有缓存时返回 false
+func (d *Discovery) Staleness(name string) (time.Duration, bool) {
+	s, ok := d.load(name)
+	if !ok {
+		return 0, false
+	}
+	return d.opts.nowFunc().Sub(time.UnixMilli(s.UpdateTime)), true
+}
+
+// store 更新缓存，节点列表有变化时写入磁盘
+func (d *Discovery) store(name string, items []*registry.Instance) {
+	s := &snapshot{
+		UpdateTime: d.opts.nowFunc().UnixMilli(),
+		Instances:  items,
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		alog.Error("[registry][cache][%s] marshal error: %s", name, err.Error())
+		return
+	}
+	s.data = data
+
+	d.lk.Lock()
+	old, ok := d.snapshots[name]
+	d.snapshots[name] = s
+	d.lk.Unlock()
+
+	if d.opts.staleness != nil {
+		d.opts.staleness.With(name).Set(0)
+	}
+
+	if ok && bytes.Equal(old.data, data) {
+		return
+	}
+
+	if err = d.persist(name, s); err != nil {
+		alog.Error("[registry][cache][%s] persist error: %s", name, err.Error())
+	}
+}
+
+// fromCache 返回缓存的节点列表并更新监控
+func (d *Discovery) fromCache(name string) ([]*registry.Instance, bool) {
+	s, ok := d.load(name)
+	if !ok {
+		return nil, false
+	}
+
+	if d.opts.cacheHits != nil {
+		d.opts.cacheHits.With(name).Inc()
+	}
+	d.setStaleness(name, s)
+
+	return s.Instances, true
+}
+
+// updateStaleness 使用缓存期间按快照的获取时间更新监控
+func (d *Discovery) updateStaleness(name string) {
+	if s, ok := d.load(name); ok {
+		d.setStaleness(name, s)
+	}
+}
+
+func (d *Discovery) setStaleness(name string, s *snapshot) {
+	if d.opts.staleness != nil {
+		d.opts.staleness.With(name).Set(d.opts.nowFunc().Sub(time.UnixMilli(s.UpdateTime)).Seconds())
+	}
+}
+
+// load 先从内存获取快照，内存中没有时从磁盘加载
+func (d *Discovery) load(name string) (*snapshot, bool) {
+	d.lk.RLock()
+	s, ok := d.snapshots[name]
+	d.lk.RUnlock()
+	if ok {
+		return s, true
+	}
+
+	if d.opts.dir == "" {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(d.path(name))
+	if err != nil {
+		return nil, false
+	}
+
+	s = &snapshot{}
+	if err = json.Unmarshal(data, s); err != nil {
+		alog.Error("[registry][cache][%s] unmarshal snapshot error: %s", name, err.Error())
+		return nil, false
+	}
+	s.data, _ = json.Marshal(s.Instances)
+
+	d.lk.Lock()
+	// 加载期间可能已经从注册中心获取到了最新的数据
+	if cur, ok := d.snapshots[name]; ok {
+		s = cur
+	} else {
+		d.snapshots[name] = s
+	}
+	d.lk.Unlock()
+
+	return s, true
+}
+
+// persist 先写临时文件再 rename，避免进程退出时写了一半的文件
+func (d *Discovery) persist(name string, s *snapshot) error {
+	if d.opts.dir == "" {
+		return nil
+	}
+
+	d.fileLk.Lock()
+	defer d.fileLk.Unlock()
+
+	if err := os.MkdirAll(d.opts.dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	path := d.path(name)
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (d *Discovery) path(name string) string {
+	if name == "" {
+		name = allServices
+	}
+	return filepath.Join(d.opts.dir, url.PathEscape(name)+".json")
+}
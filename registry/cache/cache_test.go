@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lightmen/nami/metrics"
+	"github.com/lightmen/nami/registry"
+	"github.com/lightmen/nami/registry/memory"
+	"github.com/lightmen/nami/registry/registrytest"
+)
+
+var errUnavailable = errors.New("registry unavailable")
+
+// flakyDiscovery 可以模拟注册中心不可用
+type flakyDiscovery struct {
+	registry.Discovery
+	down atomic.Bool
+}
+
+func (f *flakyDiscovery) GetService(ctx context.Context, name string) ([]*registry.Instance, error) {
+	if f.down.Load() {
+		return nil, errUnavailable
+	}
+	return f.Discovery.GetService(ctx, name)
+}
+
+func (f *flakyDiscovery) Watch(ctx context.Context, name string) (registry.Watcher, error) {
+	if f.down.Load() {
+		return nil, errUnavailable
+	}
+	w, err := f.Discovery.Watch(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &flakyWatcher{Watcher: w, f: f}, nil
+}
+
+// flakyWatcher 注册中心不可用时 Next 返回错误
+type flakyWatcher struct {
+	registry.Watcher
+	f *flakyDiscovery
+}
+
+func (w *flakyWatcher) Next() ([]*registry.Instance, error) {
+	items, err := w.Watcher.Next()
+	if err == nil && w.f.down.Load() {
+		return nil, errUnavailable
+	}
+	return items, err
+}
+
+type gauge struct {
+	values map[string]float64
+	lvs    []string
+}
+
+func (g *gauge) With(lvs ...string) metrics.Gauge {
+	return &gauge{values: g.values, lvs: lvs}
+}
+
+func (g *gauge) Set(value float64) {
+	g.values[g.lvs[0]] = value
+}
+
+func (g *gauge) Add(delta float64) {}
+
+func (g *gauge) Sub(delta float64) {}
+
+func TestGetServiceFromDisk(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	r := memory.New()
+	ins := registrytest.Instance("gamesrv", "1")
+	if err := r.Register(ctx, ins); err != nil {
+		t.Fatal(err)
+	}
+
+	d := New(r, Dir(dir))
+	if _, err := d.GetService(ctx, ins.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟进程重启时注册中心不可用
+	flaky := &flakyDiscovery{Discovery: r}
+	flaky.down.Store(true)
+
+	g := &gauge{values: make(map[string]float64)}
+	now := time.Now()
+	d = New(flaky, Dir(dir), WithStaleness(g))
+	d.opts.nowFunc = func() time.Time {
+		return now.Add(time.Minute)
+	}
+
+	res, err := d.GetService(ctx, ins.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].ID != ins.ID {
+		t.Fatalf("unexpected instances: %+v", res)
+	}
+	if g.values[ins.Name] < 59 {
+		t.Fatalf("expect staleness about 60 seconds, got: %v", g.values[ins.Name])
+	}
+
+	if _, err = d.GetService(ctx, "unknown"); !errors.Is(err, errUnavailable) {
+		t.Fatalf("expect errUnavailable, got: %v", err)
+	}
+
+	// 注册中心恢复后返回最新的数据
+	flaky.down.Store(false)
+	if res, err = d.GetService(ctx, ins.Name); err != nil || len(res) != 1 {
+		t.Fatalf("unexpected result: %v, %v", res, err)
+	}
+	if staleness, _ := d.Staleness(ins.Name); staleness > 2*time.Minute {
+		t.Fatalf("unexpected staleness: %v", staleness)
+	}
+	if g.values[ins.Name] != 0 {
+		t.Fatalf("expect staleness 0, got: %v", g.values[ins.Name])
+	}
+}
+
+func TestWatchRecover(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	r := memory.New()
+	ins1 := registrytest.Instance("gamesrv", "1")
+	if err := r.Register(ctx, ins1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(r, Dir(dir)).GetService(ctx, ins1.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	flaky := &flakyDiscovery{Discovery: r}
+	flaky.down.Store(true)
+
+	d := New(flaky, Dir(dir), RetryInterval(10*time.Millisecond))
+	w, err := d.Watch(ctx, ins1.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	res, err := w.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 {
+		t.Fatalf("expect cached instance, got: %+v", res)
+	}
+
+	// 注册中心恢复，watcher 重新创建后返回最新的数据
+	ins2 := registrytest.Instance("gamesrv", "2")
+	if err = r.Register(ctx, ins2); err != nil {
+		t.Fatal(err)
+	}
+	flaky.down.Store(false)
+
+	if res, err = w.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 {
+		t.Fatalf("expect 2 instances, got: %+v", res)
+	}
+}
+
+func TestWatchNextError(t *testing.T) {
+	ctx := context.Background()
+	r := memory.New()
+	ins1 := registrytest.Instance("gamesrv", "1")
+	if err := r.Register(ctx, ins1); err != nil {
+		t.Fatal(err)
+	}
+
+	flaky := &flakyDiscovery{Discovery: r}
+	g := &gauge{values: make(map[string]float64)}
+	now := time.UnixMilli(time.Now().UnixMilli())
+	d := New(flaky, RetryInterval(10*time.Millisecond), WithStaleness(g))
+	d.opts.nowFunc = func() time.Time { return now }
+	w, err := d.Watch(ctx, ins1.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	if res, err := w.Next(); err != nil || len(res) != 1 {
+		t.Fatalf("next = %+v, %v", res, err)
+	}
+
+	// 注册中心出错，返回一次缓存
+	flaky.down.Store(true)
+	now = now.Add(time.Minute)
+	ins2 := registrytest.Instance("gamesrv", "2")
+	if err = r.Register(ctx, ins2); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := w.Next(); err != nil || len(res) != 1 {
+		t.Fatalf("next from cache = %+v, %v", res, err)
+	}
+	if g.values[ins1.Name] != 60 {
+		t.Fatalf("expect staleness 60, got: %v", g.values[ins1.Name])
+	}
+
+	// 注册中心恢复后重新创建 watcher，不再返回错误
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		flaky.down.Store(false)
+	}()
+	if res, err := w.Next(); err != nil || len(res) != 2 {
+		t.Fatalf("next after recover = %+v, %v", res, err)
+	}
+}
+
+func TestWatchNoCache(t *testing.T) {
+	flaky := &flakyDiscovery{Discovery: memory.New()}
+	flaky.down.Store(true)
+
+	d := New(flaky, Dir(t.TempDir()))
+	if _, err := d.Watch(context.Background(), "gamesrv"); !errors.Is(err, errUnavailable) {
+		t.Fatalf("expect errUnavailable, got: %v", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	registrytest.Run(t, func(t *testing.T) registrytest.Registry {
+		r := memory.New()
+		return struct {
+			registry.Registrar
+			registry.Discovery
+		}{r, New(r, Dir(t.TempDir()))}
+	})
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/lightmen/nami/metrics"
+)
+
+// Option is cache discovery option.
+type Option func(o *options)
+
+type options struct {
+	dir       string
+	retry     time.Duration
+	staleness metrics.Gauge
+	cacheHits metrics.Counter
+	nowFunc   func() time.Time
+}
+
+// Dir with the directory to persist snapshots, empty means only cache in memory
+func Dir(dir string) Option {
+	return func(o *options) {
+		o.dir = dir
+	}
+}
+
+// RetryInterval with the interval to recreate backend watcher after it failed.
+func RetryInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.retry = d
+	}
+}
+
+// WithStaleness with gauge: registry_cache_staleness_seconds{service},
+// 服务节点从缓存读取时，值为距离上次从注册中心成功获取的秒数，否则为0
+func WithStaleness(g metrics.Gauge) Option {
+	return func(o *options) {
+		o.staleness = g
+	}
+}
+
+// WithCacheHits with counter: registry_cache_hits_total{service}, 注册中心出错时从缓存读取的次数
+func WithCacheHits(c metrics.Counter) Option {
+	return func(o *options) {
+		o.cacheHits = c
+	}
+}
@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lightmen/nami/alog"
+	"github.com/lightmen/nami/registry"
+)
+
+var _ registry.Watcher = (*watcher)(nil)
+
+// maxRetryInterval 重新创建注册中心 watcher 的最大间隔
+const maxRetryInterval = time.Minute
+
+// watcher 包装注册中心的 watcher，注册中心出错时返回一次缓存的节点列表并在后台按退避间隔重新创建 watcher，
+// 注册中心恢复后返回最新的节点列表
+type watcher struct {
+	srvName string
+	d       *Discovery
+	ctx     context.Context
+	cancel  context.CancelFunc
+	retry   time.Duration // 下次重新创建 watcher 的间隔
+
+	lk     sync.Mutex
+	w      registry.Watcher // 注册中心的 watcher，创建失败或者出错后为 nil
+	served bool             // 本次注册中心出错期间是否已经返回过缓存
+}
+
+func newWatcher(ctx context.Context, name string, d *Discovery, w registry.Watcher) *watcher {
+	cw := &watcher{
+		srvName: name,
+		d:       d,
+		w:       w,
+		retry:   d.opts.retry,
+	}
+	cw.ctx, cw.cancel = context.WithCancel(ctx)
+	return cw
+}
+
+func (w *watcher) Next() ([]*registry.Instance, error) {
+	for {
+		if err := w.ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		bw := w.backend()
+		if bw == nil {
+			if items, ok := w.serveCache(); ok {
+				return items, nil
+			}
+			w.rewatch()
+			continue
+		}
+
+		items, err := bw.Next()
+		if err == nil {
+			w.served = false
+			w.retry = w.d.opts.retry
+			w.d.store(w.srvName, items)
+			return items, nil
+		}
+
+		if w.ctx.Err() != nil {
+			return nil, w.ctx.Err()
+		}
+
+		// 注册中心的 watcher 出错后不再使用，返回一次缓存之后重新创建
+		alog.Error("[registry][cache][%s] watch next error: %s", w.srvName, err.Error())
+		w.drop(bw)
+		if items, ok := w.serveCache(); ok {
+			return items, nil
+		}
+	}
+}
+
+func (w *watcher) Stop() error {
+	w.cancel()
+
+	w.lk.Lock()
+	defer w.lk.Unlock()
+
+	if w.w != nil {
+		return w.w.Stop()
+	}
+	return nil
+}
+
+func (w *watcher) backend() registry.Watcher {
+	w.lk.Lock()
+	defer w.lk.Unlock()
+
+	return w.w
+}
+
+// serveCache 注册中心出错期间只返回一次缓存，避免调用方在没有变化时反复更新
+func (w *watcher) serveCache() ([]*registry.Instance, bool) {
+	if w.served {
+		return nil, false
+	}
+
+	items, ok := w.d.fromCache(w.srvName)
+	if ok {
+		w.served = true
+	}
+	return items, ok
+}
+
+// drop 停止出错的注册中心 watcher
+func (w *watcher) drop(bw registry.Watcher) {
+	w.lk.Lock()
+	if w.w == bw {
+		w.w = nil
+	}
+	w.lk.Unlock()
+
+	_ = bw.Stop()
+}
+
+// rewatch 间隔 retry 时间后重新创建注册中心的 watcher，失败时间隔加倍，最大为 maxRetryInterval
+func (w *watcher) rewatch() {
+	select {
+	case <-w.ctx.Done():
+		return
+	case <-time.After(w.retry):
+	}
+
+	// 使用缓存期间更新缓存的过期时间
+	w.d.updateStaleness(w.srvName)
+
+	bw, err := w.d.dis.Watch(w.ctx, w.srvName)
+	if err != nil {
+		alog.Error("[registry][cache][%s] rewatch error: %s", w.srvName, err.Error())
+		if w.retry *= 2; w.retry > maxRetryInterval {
+			w.retry = maxRetryInterval
+		}
+		return
+	}
+
+	w.lk.Lock()
+	defer w.lk.Unlock()
+
+	if w.ctx.Err() != nil {
+		_ = bw.Stop()
+		return
+	}
+	w.w = bw
+}
@@ -0,0 +1,278 @@
+package consul
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lightmen/nami/registry"
+)
+
+// agentService 对应 consul /v1/agent/service/register 的请求体
+type agentService struct {
+	ID              string                    `json:"ID"`
+	Name            string                    `json:"Name"`
+	Address         string                    `json:"Address,omitempty"`
+	Port            int                       `json:"Port,omitempty"`
+	Meta            map[string]string         `json:"Meta,omitempty"`
+	TaggedAddresses map[string]serviceAddress `json:"TaggedAddresses,omitempty"`
+	Check           *agentServiceCheck        `json:"Check,omitempty"`
+}
+
+type serviceAddress struct {
+	Address string `json:"Address"`
+	Port    int    `json:"Port"`
+}
+
+type agentServiceCheck struct {
+	CheckID                        string `json:"CheckID,omitempty"`
+	TTL                            string `json:"TTL,omitempty"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter,omitempty"`
+}
+
+// serviceEntry 对应 consul /v1/health/service/:name 的返回
+type serviceEntry struct {
+	Service *agentService `json:"Service"`
+}
+
+type client struct {
+	address string
+	token   string
+	http    *http.Client
+}
+
+func (c *client) register(ctx context.Context, svc *agentService) error {
+	return c.put(ctx, "/v1/agent/service/register", svc)
+}
+
+func (c *client) deregister(ctx context.Context, id string) error {
+	return c.put(ctx, "/v1/agent/service/deregister/"+url.PathEscape(id), nil)
+}
+
+func (c *client) passTTL(ctx context.Context, checkID string) error {
+	return c.put(ctx, "/v1/agent/check/pass/"+url.PathEscape(checkID), nil)
+}
+
+// services 返回所有的服务名
+func (c *client) services(ctx context.Context) ([]string, error) {
+	services := make(map[string][]string)
+	if _, err := c.get(ctx, "/v1/catalog/services", nil, &services); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(services))
+	for name := range services {
+		if name == "consul" {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// healthService 查询健康的服务节点，index 大于0时为阻塞查询，返回新的 index
+func (c *client) healthService(ctx context.Context, name string, index uint64, wait time.Duration) ([]*serviceEntry, uint64, error) {
+	query := blockingQuery(index, wait)
+	query.Set("passing", "true")
+
+	var entries []*serviceEntry
+	newIndex, err := c.get(ctx, "/v1/health/service/"+url.PathEscape(name), query, &entries)
+	if err != nil {
+		return nil, 0, err
+	}
+	return entries, newIndex, nil
+}
+
+// blockingQuery 构造 consul 阻塞查询的参数，index 为0时不阻塞
+func blockingQuery(index uint64, wait time.Duration) url.Values {
+	query := url.Values{}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", fmt.Sprintf("%dms", wait.Milliseconds()))
+	}
+	return query
+}
+
+func (c *client) put(ctx context.Context, path string, body any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	rsp, err := c.do(ctx, http.MethodPut, path, nil, reader)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, rsp.Body)
+	return nil
+}
+
+func (c *client) get(ctx context.Context, path string, query url.Values, out any) (uint64, error) {
+	rsp, err := c.do(ctx, http.MethodGet, path, query, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+
+	if err = json.NewDecoder(rsp.Body).Decode(out); err != nil {
+		return 0, err
+	}
+
+	index, _ := strconv.ParseUint(rsp.Header.Get("X-Consul-Index"), 10, 64)
+	return index, nil
+}
+
+func (c *client) do(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Response, error) {
+	u := c.address + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+
+	rsp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		return nil, fmt.Errorf("consul %s %s: %s %s", method, path, rsp.Status, bytes.TrimSpace(msg))
+	}
+	return rsp, nil
+}
+
+// consul 没有对应的字段，存放在 Meta 中的 Instance 字段
+const (
+	metaVersion = "nami_version"
+	metaWeight  = "nami_weight"
+	metaZone    = "nami_zone"
+	metaStatus  = "nami_status"
+)
+
+// toService 将 Instance 转换成 consul 的服务, 每个 endpoint 以 scheme 为 key 存到 TaggedAddresses 中，
+// 同一个 scheme 有多个 endpoint 时，之后的 key 为 scheme_1、scheme_2...
+func toService(ins *registry.Instance) (*agentService, error) {
+	svc := &agentService{
+		ID:              ins.ID,
+		Name:            ins.Name,
+		Meta:            make(map[string]string, len(ins.MetaData)+4),
+		TaggedAddresses: make(map[string]serviceAddress, len(ins.Endpoints)),
+	}
+
+	for k, v := range ins.MetaData {
+		svc.Meta[k] = v
+	}
+	setMeta(svc.Meta, metaVersion, ins.Version)
+	setMeta(svc.Meta, metaZone, ins.Zone)
+	setMeta(svc.Meta, metaStatus, string(ins.Status))
+	if ins.Weight > 0 {
+		svc.Meta[metaWeight] = strconv.Itoa(ins.Weight)
+	}
+
+	for _, e := range ins.Endpoints {
+		u, err := url.Parse(e)
+		if err != nil {
+			return nil, err
+		}
+		host, portStr, err := net.SplitHostPort(u.Host)
+		if err != nil {
+			return nil, err
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			return nil, err
+		}
+
+		addr := serviceAddress{Address: host, Port: port}
+		key := u.Scheme
+		for i := 1; ; i++ {
+			if _, ok := svc.TaggedAddresses[key]; !ok {
+				break
+			}
+			key = u.Scheme + "_" + strconv.Itoa(i)
+		}
+		svc.TaggedAddresses[key] = addr
+		if svc.Address == "" {
+			svc.Address = addr.Address
+			svc.Port = addr.Port
+		}
+	}
+
+	return svc, nil
+}
+
+func toInstance(svc *agentService) *registry.Instance {
+	ins := &registry.Instance{
+		ID:        svc.ID,
+		Name:      svc.Name,
+		Endpoints: make([]string, 0, len(svc.TaggedAddresses)),
+	}
+
+	for k, v := range svc.Meta {
+		switch k {
+		case metaVersion:
+			ins.Version = v
+		case metaZone:
+			ins.Zone = v
+		case metaStatus:
+			ins.Status = registry.Status(v)
+		case metaWeight:
+			ins.Weight, _ = strconv.Atoi(v)
+		default:
+			if ins.MetaData == nil {
+				ins.MetaData = make(map[string]string)
+			}
+			ins.MetaData[k] = v
+		}
+	}
+
+	for key, addr := range svc.TaggedAddresses {
+		// consul 会自动添加 lan/wan 等地址，这些不是服务的 endpoint
+		if key == "lan" || key == "wan" || key == "lan_ipv4" || key == "wan_ipv4" || key == "lan_ipv6" || key == "wan_ipv6" {
+			continue
+		}
+		scheme := schemeOf(key)
+		ins.Endpoints = append(ins.Endpoints, fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(addr.Address, strconv.Itoa(addr.Port))))
+	}
+	sort.Strings(ins.Endpoints)
+
+	return ins
+}
+
+// schemeOf 去掉 TaggedAddresses key 的序号，scheme 中不会有下划线
+func schemeOf(key string) string {
+	if i := strings.LastIndexByte(key, '_'); i > 0 {
+		if _, err := strconv.Atoi(key[i+1:]); err == nil {
+			return key[:i]
+		}
+	}
+	return key
+}
+
+func setMeta(meta map[string]string, key, val string) {
+	if val != "" {
+		meta[key] = val
+	}
+}
@@ -0,0 +1,69 @@
+package consul
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Option is consul registry option.
+type Option func(o *options)
+
+type options struct {
+	ctx             context.Context
+	address         string
+	token           string
+	client          *http.Client
+	ttl             time.Duration
+	deregisterAfter time.Duration
+	waitTime        time.Duration
+}
+
+// Context with registry context.
+func Context(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// Address with consul agent address, like http://127.0.0.1:8500
+func Address(addr string) Option {
+	return func(o *options) {
+		o.address = addr
+	}
+}
+
+// Token with consul acl token.
+func Token(token string) Option {
+	return func(o *options) {
+		o.token = token
+	}
+}
+
+// HTTPClient with http client used to access consul agent.
+func HTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
+
+// RegisterTTL with ttl of health check, heartbeat will be sent every ttl/3
+func RegisterTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// DeregisterCriticalServiceAfter with the time after which a critical service will be deregistered by consul.
+func DeregisterCriticalServiceAfter(d time.Duration) Option {
+	return func(o *options) {
+		o.deregisterAfter = d
+	}
+}
+
+// WaitTime with the max wait time of blocking query used by watcher.
+func WaitTime(d time.Duration) Option {
+	return func(o *options) {
+		o.waitTime = d
+	}
+}
@@ -0,0 +1,170 @@
+// Package consul 实现基于 consul agent http api 的注册中心，服务健康检查使用 TTL check
+package consul
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lightmen/nami/alog"
+	"github.com/lightmen/nami/registry"
+)
+
+var (
+	_ registry.Registrar = (*Registry)(nil)
+	_ registry.Discovery = (*Registry)(nil)
+)
+
+// Registry is consul registry.
+type Registry struct {
+	opts   *options
+	client *client
+
+	lk      sync.Mutex
+	cancels map[string]context.CancelFunc // service id -> heartbeat cancel
+}
+
+// New creates consul registry
+func New(opts ...Option) *Registry {
+	op := &options{
+		ctx:             context.Background(),
+		address:         "http://127.0.0.1:8500",
+		client:          http.DefaultClient,
+		ttl:             time.Second * 15,
+		deregisterAfter: time.Minute,
+		waitTime:        time.Second * 55,
+	}
+	for _, o := range opts {
+		o(op)
+	}
+
+	return &Registry{
+		opts: op,
+		client: &client{
+			address: strings.TrimSuffix(op.address, "/"),
+			token:   op.token,
+			http:    op.client,
+		},
+		cancels: make(map[string]context.CancelFunc),
+	}
+}
+
+// Register the registration.
+func (r *Registry) Register(ctx context.Context, service *registry.Instance) error {
+	svc, err := toService(service)
+	if err != nil {
+		return err
+	}
+
+	checkID := "service:" + service.ID
+	svc.Check = &agentServiceCheck{
+		CheckID:                        checkID,
+		TTL:                            r.opts.ttl.String(),
+		DeregisterCriticalServiceAfter: r.opts.deregisterAfter.String(),
+	}
+
+	if err = r.client.register(ctx, svc); err != nil {
+		return err
+	}
+	if err = r.client.passTTL(ctx, checkID); err != nil {
+		return err
+	}
+
+	hctx, cancel := context.WithCancel(r.opts.ctx)
+	r.lk.Lock()
+	if old, ok := r.cancels[service.ID]; ok {
+		old()
+	}
+	r.cancels[service.ID] = cancel
+	r.lk.Unlock()
+
+	go r.heartBeat(hctx, svc, checkID)
+	return nil
+}
+
+// Unregister the registration.
+func (r *Registry) Unregister(ctx context.Context, service *registry.Instance) error {
+	r.lk.Lock()
+	if cancel, ok := r.cancels[service.ID]; ok {
+		cancel()
+		delete(r.cancels, service.ID)
+	}
+	r.lk.Unlock()
+
+	alog.InfoCtx(ctx, "[consul]unregister service: %s", service.ID)
+
+	return r.client.deregister(ctx, service.ID)
+}
+
+// GetService return the service instances according to the service name.
+func (r *Registry) GetService(ctx context.Context, name string) ([]*registry.Instance, error) {
+	if name != "" {
+		entries, _, err := r.client.healthService(ctx, name, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		return toInstances(entries), nil
+	}
+
+	names, err := r.client.services(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*registry.Instance, 0)
+	for _, n := range names {
+		entries, _, err := r.client.healthService(ctx, n, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, toInstances(entries)...)
+	}
+	return items, nil
+}
+
+// Watch creates a watcher according to the service name.
+func (r *Registry) Watch(ctx context.Context, name string) (registry.Watcher, error) {
+	return newWatcher(ctx, name, r), nil
+}
+
+// heartBeat 每 ttl/3 上报一次 TTL check，如果服务在 consul 中丢失(如 agent 重启)则重新注册
+func (r *Registry) heartBeat(ctx context.Context, svc *agentService, checkID string) {
+	interval := r.opts.ttl / 3
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := r.client.passTTL(ctx, checkID)
+		if err == nil || ctx.Err() != nil {
+			continue
+		}
+
+		alog.ErrorCtx(ctx, "%s|pass ttl error: %s, try to register again", svc.ID, err.Error())
+		if err = r.client.register(ctx, svc); err != nil {
+			alog.ErrorCtx(ctx, "%s|register error: %s", svc.ID, err.Error())
+		}
+	}
+}
+
+func toInstances(entries []*serviceEntry) []*registry.Instance {
+	items := make([]*registry.Instance, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Service == nil {
+			continue
+		}
+		items = append(items, toInstance(entry.Service))
+	}
+	return items
+}
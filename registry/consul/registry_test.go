@@ -0,0 +1,329 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lightmen/nami/registry"
+	"github.com/lightmen/nami/registry/registrytest"
+)
+
+// fakeAgent 模拟 consul agent 的 http api，支持阻塞查询和 TTL check
+type fakeAgent struct {
+	sync.Mutex
+	index        uint64 // 健康节点的 index，任何变更都会增加
+	catalogIndex uint64 // 服务列表的 index，只在注册和注销时增加
+	changed      chan struct{}
+	services     map[string]*agentService
+	passTime     map[string]time.Time // check id -> last pass time
+	failing      map[string]bool      // check id -> 主动设置为失败
+	queries      int                  // 健康节点的查询次数
+}
+
+func newFakeAgent() *fakeAgent {
+	return &fakeAgent{
+		index:        1,
+		catalogIndex: 1,
+		changed:      make(chan struct{}),
+		services:     make(map[string]*agentService),
+		passTime:     make(map[string]time.Time),
+		failing:      make(map[string]bool),
+	}
+}
+
+func (a *fakeAgent) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /v1/agent/service/register", func(w http.ResponseWriter, r *http.Request) {
+		svc := &agentService{}
+		if err := json.NewDecoder(r.Body).Decode(svc); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a.Lock()
+		a.services[svc.ID] = svc
+		a.catalogIndex++
+		a.bump()
+		a.Unlock()
+	})
+	mux.HandleFunc("PUT /v1/agent/service/deregister/{id}", func(w http.ResponseWriter, r *http.Request) {
+		a.Lock()
+		delete(a.services, r.PathValue("id"))
+		a.catalogIndex++
+		a.bump()
+		a.Unlock()
+	})
+	mux.HandleFunc("PUT /v1/agent/check/fail/{id}", func(w http.ResponseWriter, r *http.Request) {
+		a.Lock()
+		a.failing[r.PathValue("id")] = true
+		a.bump()
+		a.Unlock()
+	})
+	mux.HandleFunc("PUT /v1/agent/check/pass/{id}", func(w http.ResponseWriter, r *http.Request) {
+		a.Lock()
+		defer a.Unlock()
+		id := r.PathValue("id")
+		for _, svc := range a.services {
+			if svc.Check != nil && svc.Check.CheckID == id {
+				a.passTime[id] = time.Now()
+				return
+			}
+		}
+		http.Error(w, "unknown check", http.StatusNotFound)
+	})
+	mux.HandleFunc("GET /v1/health/service/{name}", func(w http.ResponseWriter, r *http.Request) {
+		index := a.block(r, false)
+
+		a.Lock()
+		a.queries++
+		entries := make([]*serviceEntry, 0)
+		for _, svc := range a.services {
+			if svc.Name == r.PathValue("name") && a.passing(svc) {
+				entries = append(entries, &serviceEntry{Service: svc})
+			}
+		}
+		a.Unlock()
+
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(index, 10))
+		_ = json.NewEncoder(w).Encode(entries)
+	})
+	mux.HandleFunc("GET /v1/catalog/services", func(w http.ResponseWriter, r *http.Request) {
+		index := a.block(r, true)
+
+		a.Lock()
+		services := map[string][]string{"consul": {}}
+		for _, svc := range a.services {
+			services[svc.Name] = []string{}
+		}
+		a.Unlock()
+
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(index, 10))
+		_ = json.NewEncoder(w).Encode(services)
+	})
+	return mux
+}
+
+// bump 数据变更，唤醒所有的阻塞查询，调用时需持有锁
+func (a *fakeAgent) bump() {
+	a.index++
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+func (a *fakeAgent) passing(svc *agentService) bool {
+	if svc.Check == nil {
+		return true
+	}
+	if a.failing[svc.Check.CheckID] {
+		return false
+	}
+	ttl, _ := time.ParseDuration(svc.Check.TTL)
+	last, ok := a.passTime[svc.Check.CheckID]
+	return ok && time.Since(last) <= ttl
+}
+
+// block 实现阻塞查询，返回当前的 index，catalog 为 true 时使用服务列表的 index
+func (a *fakeAgent) block(r *http.Request, catalog bool) uint64 {
+	index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+	wait, err := time.ParseDuration(r.URL.Query().Get("wait"))
+	if err != nil {
+		wait = time.Minute
+	}
+
+	current := func() uint64 {
+		if catalog {
+			return a.catalogIndex
+		}
+		return a.index
+	}
+
+	a.Lock()
+	cur, changed := current(), a.changed
+	a.Unlock()
+	if index == 0 || index < cur {
+		return cur
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(wait):
+	case <-r.Context().Done():
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	return current()
+}
+
+func TestRegistry(t *testing.T) {
+	registrytest.Run(t, func(t *testing.T) registrytest.Registry {
+		srv := httptest.NewServer(newFakeAgent().handler())
+		t.Cleanup(srv.Close)
+
+		return New(Address(srv.URL), WaitTime(time.Second))
+	})
+}
+
+func TestHeartBeat(t *testing.T) {
+	srv := httptest.NewServer(newFakeAgent().handler())
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := New(Address(srv.URL), Context(ctx), RegisterTTL(300*time.Millisecond))
+	ins := registrytest.Instance("helloworld", "0")
+	if err := r.Register(ctx, ins); err != nil {
+		t.Fatal(err)
+	}
+
+	// 超过多个 TTL 后节点依然健康，说明心跳正常
+	time.Sleep(time.Second)
+	res, err := r.GetService(ctx, ins.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Endpoints[0] != ins.Endpoints[0] {
+		t.Fatalf("unexpected instances: %+v", res)
+	}
+
+	// 停止心跳后节点在 TTL 后变为不健康
+	cancel()
+	time.Sleep(500 * time.Millisecond)
+	res, err = r.GetService(context.Background(), ins.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 0 {
+		t.Fatalf("expect empty, got: %+v", res)
+	}
+}
+
+func TestWatchAllHealth(t *testing.T) {
+	agent := newFakeAgent()
+	srv := httptest.NewServer(agent.handler())
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r := New(Address(srv.URL), Context(ctx), WaitTime(time.Second))
+	ins1 := registrytest.Instance("helloworld", "1")
+	ins2 := registrytest.Instance("helloworld", "2")
+	for _, ins := range []*registry.Instance{ins1, ins2} {
+		if err := r.Register(ctx, ins); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w, err := r.Watch(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	if res, err := w.Next(); err != nil || len(res) != 2 {
+		t.Fatalf("next = %+v, %v", res, err)
+	}
+
+	// 健康状态变化不改变服务列表，也能唤醒监控所有服务的 watcher
+	req, _ := http.NewRequest(http.MethodPut, srv.URL+"/v1/agent/check/fail/service:"+ins1.ID, nil)
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+
+	for {
+		res, err := w.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) == 1 && res[0].ID == ins2.ID {
+			break
+		}
+	}
+}
+
+func TestWatchNoIndex(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	r := New(Address(srv.URL))
+	w, err := r.Watch(context.Background(), "helloworld")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// 没有 X-Consul-Index 时返回错误并退避，不会忙等
+	start := time.Now()
+	if _, err = w.Next(); !errors.Is(err, errNoIndex) {
+		t.Fatalf("expect errNoIndex, got: %v", err)
+	}
+	// 退避时间在 [minRetryInterval/2, minRetryInterval] 之间随机
+	if time.Since(start) < minRetryInterval/2 {
+		t.Fatal("expect backoff before error")
+	}
+}
+
+func TestTaggedAddresses(t *testing.T) {
+	ins := registrytest.Instance("helloworld", "1")
+	ins.Endpoints = []string{"grpc://127.0.0.1:9000", "grpc://127.0.0.1:9001", "http://127.0.0.1:8000"}
+	svc, err := toService(ins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(svc.TaggedAddresses) != 3 {
+		t.Fatalf("tagged addresses = %+v", svc.TaggedAddresses)
+	}
+
+	got := toInstance(svc)
+	if len(got.Endpoints) != 3 {
+		t.Fatalf("endpoints = %v", got.Endpoints)
+	}
+	for i, e := range ins.Endpoints {
+		if got.Endpoints[i] != e {
+			t.Fatalf("endpoints = %v, want %v", got.Endpoints, ins.Endpoints)
+		}
+	}
+}
+
+func TestWatchUseBlockingResult(t *testing.T) {
+	agent := newFakeAgent()
+	srv := httptest.NewServer(agent.handler())
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r := New(Address(srv.URL), Context(ctx), WaitTime(time.Second))
+	ins := registrytest.Instance("helloworld", "1")
+	if err := r.Register(ctx, ins); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := r.Watch(ctx, "helloworld")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// 直接返回阻塞查询的结果，不再额外查询一次
+	if res, err := w.Next(); err != nil || len(res) != 1 || res[0].ID != ins.ID {
+		t.Fatalf("next = %+v, %v", res, err)
+	}
+	agent.Lock()
+	queries := agent.queries
+	agent.Unlock()
+	if queries != 1 {
+		t.Fatalf("expect 1 health query, got: %d", queries)
+	}
+}
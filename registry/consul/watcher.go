@@ -0,0 +1,267 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lightmen/nami/alog"
+	"github.com/lightmen/nami/registry"
+	"github.com/lightmen/nami/registry/internal/backoff"
+)
+
+var _ registry.Watcher = (*watcher)(nil)
+
+// errNoIndex 回包中没有 X-Consul-Index，无法进行阻塞查询
+var errNoIndex = errors.New("consul: missing X-Consul-Index")
+
+const (
+	minRetryInterval = time.Second
+	maxRetryInterval = 30 * time.Second
+)
+
+// watcher 基于 consul 的阻塞查询实现，直接返回阻塞查询得到的节点。srvName 为空时监控所有服务：
+// 阻塞查询服务列表发现服务的增减，并为每个服务阻塞查询健康节点，任意服务的节点或者健康状态变化时返回所有服务的节点
+type watcher struct {
+	srvName string
+	r       *Registry
+	ctx     context.Context
+	cancel  context.CancelFunc
+	index   uint64
+	retry   *backoff.Backoff
+
+	// srvName 为空时使用
+	once     sync.Once
+	notify   chan struct{}
+	lk       sync.Mutex
+	services map[string]*serviceState // 服务列表查询到的服务，nil 表示还没有查询到服务列表
+	err      error                    // 后台查询的错误，Next 返回后清空
+}
+
+// serviceState 一个服务最近一次阻塞查询的结果
+type serviceState struct {
+	items []*registry.Instance
+	ready bool // 已经查询到节点
+}
+
+func newWatcher(ctx context.Context, name string, r *Registry) *watcher {
+	w := &watcher{
+		srvName: name,
+		r:       r,
+		retry:   backoff.New(minRetryInterval, maxRetryInterval),
+		notify:  make(chan struct{}, 1),
+	}
+	w.ctx, w.cancel = context.WithCancel(ctx)
+	return w
+}
+
+func (w *watcher) Next() ([]*registry.Instance, error) {
+	if w.srvName == "" {
+		return w.nextAll()
+	}
+
+	for {
+		if err := w.ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		first := w.index == 0
+		entries, index, err := w.r.client.healthService(w.ctx, w.srvName, w.index, w.r.opts.waitTime)
+		if err == nil && index == 0 {
+			err = errNoIndex
+		}
+		if err != nil {
+			return nil, w.fail(err)
+		}
+		w.retry.Reset()
+
+		// index 变小说明 consul 的数据被重置了，需要重新开始阻塞查询
+		if index < w.index {
+			index = 0
+		}
+		changed := index != w.index
+		w.index = index
+
+		if first || changed {
+			return toInstances(entries), nil
+		}
+	}
+}
+
+// nextAll 等待所有服务都查询到节点后返回，之后等待任意服务变化
+func (w *watcher) nextAll() ([]*registry.Instance, error) {
+	w.once.Do(func() {
+		go w.watchServices()
+	})
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return nil, w.ctx.Err()
+		case <-w.notify:
+		}
+
+		if items, err, ok := w.snapshot(); ok {
+			return items, err
+		}
+	}
+}
+
+// snapshot 有后台查询错误时返回错误，所有服务都查询到节点时按服务名排序返回所有节点
+func (w *watcher) snapshot() ([]*registry.Instance, error, bool) {
+	w.lk.Lock()
+	defer w.lk.Unlock()
+
+	if err := w.err; err != nil {
+		w.err = nil
+		return nil, err, true
+	}
+	if w.services == nil {
+		return nil, nil, false
+	}
+
+	names := make([]string, 0, len(w.services))
+	for name, st := range w.services {
+		if !st.ready {
+			return nil, nil, false
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := make([]*registry.Instance, 0)
+	for _, name := range names {
+		items = append(items, w.services[name].items...)
+	}
+	return items, nil, true
+}
+
+func (w *watcher) Stop() error {
+	w.cancel()
+	return nil
+}
+
+// fail 出错后按退避时间等待再返回
+func (w *watcher) fail(err error) error {
+	if w.ctx.Err() != nil {
+		return w.ctx.Err()
+	}
+	if !w.retry.Wait(w.ctx) {
+		return w.ctx.Err()
+	}
+	return err
+}
+
+// signal 通知 Next 有服务变化，多次通知合并为一次
+func (w *watcher) signal() {
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// setErr 记录后台查询的错误并通知 Next
+func (w *watcher) setErr(err error) {
+	w.lk.Lock()
+	w.err = err
+	w.lk.Unlock()
+	w.signal()
+}
+
+// watchServices 阻塞查询服务列表，为每个服务启动一个阻塞查询健康节点的协程
+func (w *watcher) watchServices() {
+	subs := make(map[string]context.CancelFunc)
+	var index uint64
+	retry := backoff.New(minRetryInterval, maxRetryInterval)
+	for w.ctx.Err() == nil {
+		services := make(map[string][]string)
+		newIndex, err := w.r.client.get(w.ctx, "/v1/catalog/services", blockingQuery(index, w.r.opts.waitTime), &services)
+		if err == nil && newIndex == 0 {
+			err = errNoIndex
+		}
+		if err != nil {
+			if w.ctx.Err() != nil {
+				return
+			}
+			alog.Error("[consul] watch services error: %s", err.Error())
+			w.setErr(err)
+			if !retry.Wait(w.ctx) {
+				return
+			}
+			continue
+		}
+		retry.Reset()
+		delete(services, "consul")
+
+		w.lk.Lock()
+		if w.services == nil {
+			w.services = make(map[string]*serviceState)
+		}
+		// 新增的服务在第一次查询到健康节点时通知
+		for name := range services {
+			if _, ok := subs[name]; ok {
+				continue
+			}
+			st := &serviceState{}
+			w.services[name] = st
+			ctx, cancel := context.WithCancel(w.ctx)
+			subs[name] = cancel
+			go w.watchService(ctx, name, st)
+		}
+		for name, cancel := range subs {
+			if _, ok := services[name]; !ok {
+				cancel()
+				delete(subs, name)
+				delete(w.services, name)
+			}
+		}
+		w.lk.Unlock()
+		// 服务列表为空或者有服务被删除时也需要通知
+		w.signal()
+
+		if newIndex < index {
+			newIndex = 0
+		}
+		index = newIndex
+	}
+}
+
+// watchService 阻塞查询服务的健康节点，节点或者健康状态变化时更新 st 并通知 Next
+func (w *watcher) watchService(ctx context.Context, name string, st *serviceState) {
+	var index uint64
+	retry := backoff.New(minRetryInterval, maxRetryInterval)
+	for ctx.Err() == nil {
+		entries, newIndex, err := w.r.client.healthService(ctx, name, index, w.r.opts.waitTime)
+		if err == nil && newIndex == 0 {
+			err = errNoIndex
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			alog.Error("[consul] watch service %s error: %s", name, err.Error())
+			w.setErr(err)
+			if !retry.Wait(ctx) {
+				return
+			}
+			continue
+		}
+		retry.Reset()
+
+		if newIndex != index {
+			w.lk.Lock()
+			if ctx.Err() == nil {
+				st.items = toInstances(entries)
+				st.ready = true
+			}
+			w.lk.Unlock()
+			w.signal()
+		}
+		if newIndex < index {
+			newIndex = 0
+		}
+		index = newIndex
+	}
+}
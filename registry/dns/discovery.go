@@ -0,0 +1,88 @@
+// Package dns 实现基于 DNS SRV 记录的服务发现，只支持 Discovery，watcher 通过定时轮询实现
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lightmen/nami/pkg/aerror"
+	"github.com/lightmen/nami/registry"
+)
+
+var _ registry.Discovery = (*Discovery)(nil)
+
+// Discovery is dns srv discovery.
+type Discovery struct {
+	opts *options
+}
+
+// New creates dns srv discovery, srv 记录的查询名为 _scheme._proto.name.domain
+func New(opts ...Option) *Discovery {
+	op := &options{
+		scheme:   "grpc",
+		proto:    "tcp",
+		interval: time.Second * 10,
+		resolver: net.DefaultResolver,
+	}
+	for _, o := range opts {
+		o(op)
+	}
+
+	return &Discovery{
+		opts: op,
+	}
+}
+
+// GetService return the service instances according to the service name, name 不能为空
+func (d *Discovery) GetService(ctx context.Context, name string) ([]*registry.Instance, error) {
+	if name == "" {
+		return nil, aerror.InvalidParam
+	}
+
+	host := name
+	if d.opts.domain != "" {
+		host = name + "." + d.opts.domain
+	}
+
+	_, addrs, err := d.opts.resolver.LookupSRV(ctx, d.opts.scheme, d.opts.proto, host)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return []*registry.Instance{}, nil
+		}
+		return nil, err
+	}
+
+	items := make([]*registry.Instance, 0, len(addrs))
+	for _, srv := range addrs {
+		target := strings.TrimSuffix(srv.Target, ".")
+		addr := net.JoinHostPort(target, strconv.Itoa(int(srv.Port)))
+		items = append(items, &registry.Instance{
+			ID:   addr,
+			Name: name,
+			MetaData: map[string]string{
+				"priority": strconv.Itoa(int(srv.Priority)),
+			},
+			Weight:    int(srv.Weight),
+			Endpoints: []string{fmt.Sprintf("%s://%s", d.opts.scheme, addr)},
+		})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ID < items[j].ID
+	})
+
+	return items, nil
+}
+
+// Watch creates a watcher according to the service name.
+func (d *Discovery) Watch(ctx context.Context, name string) (registry.Watcher, error) {
+	if name == "" {
+		return nil, aerror.InvalidParam
+	}
+	return newWatcher(ctx, name, d), nil
+}
@@ -0,0 +1,214 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeServer 进程内的 dns 服务器，只应答 SRV 查询
+type fakeServer struct {
+	sync.RWMutex
+	conn    net.PacketConn
+	records map[string][]dnsmessage.SRVResource // fqdn -> srv records
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{
+		conn:    conn,
+		records: make(map[string][]dnsmessage.SRVResource),
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) set(name string, records ...dnsmessage.SRVResource) {
+	s.Lock()
+	s.records[name] = records
+	s.Unlock()
+}
+
+func (s *fakeServer) resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", s.conn.LocalAddr().String())
+		},
+	}
+}
+
+func (s *fakeServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		var req dnsmessage.Message
+		if err = req.Unpack(buf[:n]); err != nil || len(req.Questions) == 0 {
+			continue
+		}
+
+		q := req.Questions[0]
+		rsp := dnsmessage.Message{
+			Header: dnsmessage.Header{
+				ID:            req.ID,
+				Response:      true,
+				Authoritative: true,
+			},
+			Questions: req.Questions,
+		}
+
+		s.RLock()
+		records, ok := s.records[strings.ToLower(q.Name.String())]
+		s.RUnlock()
+
+		switch {
+		case !ok:
+			rsp.RCode = dnsmessage.RCodeNameError
+		case q.Type == dnsmessage.TypeSRV:
+			for _, r := range records {
+				srv := r
+				rsp.Answers = append(rsp.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{
+						Name:  q.Name,
+						Type:  dnsmessage.TypeSRV,
+						Class: dnsmessage.ClassINET,
+						TTL:   1,
+					},
+					Body: &srv,
+				})
+			}
+		}
+
+		data, err := rsp.Pack()
+		if err != nil {
+			continue
+		}
+		_, _ = s.conn.WriteTo(data, addr)
+	}
+}
+
+func srvRecord(target string, port, weight uint16) dnsmessage.SRVResource {
+	return dnsmessage.SRVResource{
+		Priority: 1,
+		Weight:   weight,
+		Port:     port,
+		Target:   dnsmessage.MustNewName(target),
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	s := newFakeServer(t)
+	s.set("_grpc._tcp.gamesrv.svc.local.", srvRecord("node1.svc.local.", 9000, 10))
+
+	d := New(
+		Domain("svc.local"),
+		Interval(50*time.Millisecond),
+		Resolver(s.resolver()),
+	)
+
+	ctx := context.Background()
+	res, err := d.GetService(ctx, "gamesrv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Endpoints[0] != "grpc://node1.svc.local:9000" || res[0].Weight != 10 {
+		t.Fatalf("unexpected instances: %+v", res)
+	}
+
+	res, err = d.GetService(ctx, "notfound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 0 {
+		t.Fatalf("expect empty, got: %+v", res)
+	}
+
+	if _, err = d.GetService(ctx, ""); err == nil {
+		t.Fatalf("expect error for empty service name")
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	s := newFakeServer(t)
+	s.set("_grpc._tcp.gamesrv.", srvRecord("node1.", 9000, 10))
+
+	d := New(
+		Interval(50*time.Millisecond),
+		Resolver(s.resolver()),
+	)
+
+	w, err := d.Watch(context.Background(), "gamesrv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := w.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 {
+		t.Fatalf("expect 1 instance, got: %d", len(res))
+	}
+
+	s.set("_grpc._tcp.gamesrv.", srvRecord("node1.", 9000, 10), srvRecord("node2.", 9000, 10))
+	res, err = w.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 {
+		t.Fatalf("expect 2 instances, got: %d", len(res))
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = w.Stop()
+	}()
+	if _, err = w.Next(); err != context.Canceled {
+		t.Fatalf("expect context.Canceled, got: %v", err)
+	}
+}
+
+func TestWatcherBackoff(t *testing.T) {
+	// dns 服务器不可用
+	d := New(
+		Interval(50*time.Millisecond),
+		Resolver(&net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return nil, errors.New("dns unavailable")
+			},
+		}),
+	)
+
+	w, err := d.Watch(context.Background(), "gamesrv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// 查询出错时退避后再返回错误，调用方立即重试也不会频繁查询
+	start := time.Now()
+	if _, err = w.Next(); err == nil {
+		t.Fatal("expect lookup error")
+	}
+	if time.Since(start) < minRetryInterval/2 {
+		t.Fatal("expect backoff before error")
+	}
+}
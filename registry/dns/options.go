@@ -0,0 +1,52 @@
+package dns
+
+import (
+	"net"
+	"time"
+)
+
+// Option is dns discovery option.
+type Option func(o *options)
+
+type options struct {
+	domain   string
+	scheme   string
+	proto    string
+	interval time.Duration
+	resolver *net.Resolver
+}
+
+// Domain with the domain appended to service name, like service.consul
+func Domain(domain string) Option {
+	return func(o *options) {
+		o.domain = domain
+	}
+}
+
+// Scheme with the srv service label and the endpoint scheme, default is grpc
+func Scheme(scheme string) Option {
+	return func(o *options) {
+		o.scheme = scheme
+	}
+}
+
+// Proto with the srv proto label, default is tcp
+func Proto(proto string) Option {
+	return func(o *options) {
+		o.proto = proto
+	}
+}
+
+// Interval with the polling interval of watcher.
+func Interval(interval time.Duration) Option {
+	return func(o *options) {
+		o.interval = interval
+	}
+}
+
+// Resolver with custom dns resolver.
+func Resolver(r *net.Resolver) Option {
+	return func(o *options) {
+		o.resolver = r
+	}
+}
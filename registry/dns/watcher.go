@@ -0,0 +1,88 @@
+package dns
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/lightmen/nami/registry"
+	"github.com/lightmen/nami/registry/internal/backoff"
+)
+
+var _ registry.Watcher = (*watcher)(nil)
+
+const (
+	minRetryInterval = time.Second
+	maxRetryInterval = 30 * time.Second
+)
+
+// watcher 定时查询 srv 记录，记录发生变化时 Next 返回
+type watcher struct {
+	srvName string
+	d       *Discovery
+	ctx     context.Context
+	cancel  context.CancelFunc
+	last    []*registry.Instance
+	first   bool
+	retry   *backoff.Backoff // 查询出错后的重试间隔
+}
+
+func newWatcher(ctx context.Context, name string, d *Discovery) *watcher {
+	w := &watcher{
+		srvName: name,
+		d:       d,
+		first:   true,
+		retry:   backoff.New(minRetryInterval, maxRetryInterval),
+	}
+	w.ctx, w.cancel = context.WithCancel(ctx)
+	return w
+}
+
+func (w *watcher) Next() ([]*registry.Instance, error) {
+	if w.first {
+		items, err := w.d.GetService(w.ctx, w.srvName)
+		if err != nil {
+			return nil, w.fail(err)
+		}
+		w.retry.Reset()
+		w.first = false
+		w.last = items
+		return items, nil
+	}
+
+	ticker := time.NewTicker(w.d.opts.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return nil, w.ctx.Err()
+		case <-ticker.C:
+		}
+
+		items, err := w.d.GetService(w.ctx, w.srvName)
+		if err != nil {
+			return nil, w.fail(err)
+		}
+		w.retry.Reset()
+		if reflect.DeepEqual(items, w.last) {
+			continue
+		}
+
+		w.last = items
+		return items, nil
+	}
+}
+
+// fail 出错后按退避时间等待再返回，避免调用方立即重试时频繁查询
+func (w *watcher) fail(err error) error {
+	if w.ctx.Err() != nil || !w.retry.Wait(w.ctx) {
+		return w.ctx.Err()
+	}
+	return err
+}
+
+func (w *watcher) Stop() error {
+	w.cancel()
+	return nil
+}
@@ -0,0 +1,72 @@
+package etcd
+
+import (
+	"context"
+	"sync"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/lightmen/nami/registry"
+)
+
+// registration 一个注册节点的信息，每个节点使用独立的租约
+type registration struct {
+	key    string
+	lease  clientv3.Lease
+	cancel context.CancelFunc // 停止心跳
+	done   chan struct{}      // 心跳协程退出时关闭，没有启动心跳时为 nil
+
+	lk      sync.Mutex
+	ins     *registry.Instance // 最新的注册内容，续租失败重新注册时使用
+	leaseID clientv3.LeaseID
+}
+
+func newRegistration(key string, ins *registry.Instance, lease clientv3.Lease) *registration {
+	return &registration{
+		key:   key,
+		ins:   ins,
+		lease: lease,
+	}
+}
+
+// update 在锁内修改注册内容并写入 etcd，写入失败时不修改注册内容
+func (reg *registration) update(fn func(ins *registry.Instance, leaseID clientv3.LeaseID) error) error {
+	reg.lk.Lock()
+	defer reg.lk.Unlock()
+
+	ins := *reg.ins
+	if err := fn(&ins, reg.leaseID); err != nil {
+		return err
+	}
+	reg.ins = &ins
+	return nil
+}
+
+func (reg *registration) getLeaseID() clientv3.LeaseID {
+	reg.lk.Lock()
+	defer reg.lk.Unlock()
+
+	return reg.leaseID
+}
+
+func (reg *registration) setLeaseID(leaseID clientv3.LeaseID) {
+	reg.lk.Lock()
+	reg.leaseID = leaseID
+	reg.lk.Unlock()
+}
+
+// stop 停止心跳并等待心跳协程退出，之后不会再重新注册
+func (reg *registration) stop() {
+	if reg.cancel != nil {
+		reg.cancel()
+	}
+	if reg.done != nil {
+		<-reg.done
+	}
+}
+
+// close 停止心跳并关闭租约
+func (reg *registration) close() {
+	reg.stop()
+	reg.lease.Close()
+}
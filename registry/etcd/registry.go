@@ -3,18 +3,21 @@ package etcd
 import (
 	"context"
 	"fmt"
-	"math/rand"
+	"sync"
 	"time"
 
 	clientv3 "go.etcd.io/etcd/client/v3"
 
 	"github.com/lightmen/nami/alog"
+	"github.com/lightmen/nami/pkg/aerror"
 	"github.com/lightmen/nami/registry"
+	"github.com/lightmen/nami/registry/internal/backoff"
 )
 
 var (
-	_ registry.Registrar = (*Registry)(nil)
-	_ registry.Discovery = (*Registry)(nil)
+	_ registry.Registrar     = (*Registry)(nil)
+	_ registry.Discovery     = (*Registry)(nil)
+	_ registry.StatusUpdater = (*Registry)(nil)
 )
 
 // Option is etcd registry option.
@@ -54,12 +57,15 @@ func MaxRetry(num int) Option {
 	}
 }
 
-// Registry is etcd registry.
+// Registry is etcd registry, 一个 Registry 可以注册多个节点，每个节点使用独立的租约和心跳
 type Registry struct {
-	opts   *options
-	client *clientv3.Client
-	kv     clientv3.KV
-	lease  clientv3.Lease
+	opts    *options
+	client  *clientv3.Client
+	kv      clientv3.KV
+	backoff *backoff.Backoff // 所有节点共享的重试退避，etcd 不可用时避免每个节点各自频繁重试
+
+	lk   sync.RWMutex
+	regs map[string]*registration // key -> 注册信息
 }
 
 // New creates etcd registry
@@ -73,48 +79,113 @@ func New(client *clientv3.Client, opts ...Option) (r *Registry) {
 	for _, o := range opts {
 		o(op)
 	}
+
+	maxSleep := op.ttl / 2
+	if maxSleep < time.Second {
+		maxSleep = time.Second
+	}
+
 	return &Registry{
-		opts:   op,
-		client: client,
-		kv:     clientv3.NewKV(client),
+		opts:    op,
+		client:  client,
+		kv:      clientv3.NewKV(client),
+		backoff: backoff.New(time.Second, maxSleep),
+		regs:    make(map[string]*registration),
 	}
 }
 
-// Register the registration.
+// Register the registration, 重复注册同一个节点会替换原来的注册信息和租约
 func (r *Registry) Register(ctx context.Context, service *registry.Instance) error {
-	key := fmt.Sprintf("%s/%s/%s", r.opts.namespace, service.Name, service.ID)
-	value, err := marshal(service)
-	if err != nil {
+	key := r.key(service)
+	ins := *service
+	reg := newRegistration(key, &ins, clientv3.NewLease(r.client))
+
+	if _, err := r.registerWithKV(ctx, reg); err != nil {
+		reg.close()
 		return err
 	}
-	if r.lease != nil {
-		r.lease.Close()
-	}
-	r.lease = clientv3.NewLease(r.client)
-	leaseID, err := r.registerWithKV(ctx, key, value)
-	if err != nil {
-		return err
+
+	var hctx context.Context
+	hctx, reg.cancel = context.WithCancel(r.opts.ctx)
+	reg.done = make(chan struct{})
+
+	r.lk.Lock()
+	old := r.regs[key]
+	r.regs[key] = reg
+	r.lk.Unlock()
+
+	if old != nil {
+		old.close()
 	}
 
-	go r.heartBeat(r.opts.ctx, leaseID, key, value)
+	go func() {
+		defer close(reg.done)
+		r.heartBeat(hctx, reg)
+	}()
 	return nil
 }
 
 // Unregister the registration.
 func (r *Registry) Unregister(ctx context.Context, service *registry.Instance) error {
-	defer func() {
-		if r.lease != nil {
-			r.lease.Close()
-		}
-	}()
-	key := fmt.Sprintf("%s/%s/%s", r.opts.namespace, service.Name, service.ID)
+	key := r.key(service)
+
+	r.lk.Lock()
+	reg := r.regs[key]
+	delete(r.regs, key)
+	r.lk.Unlock()
 
 	alog.InfoCtx(ctx, "[etcd]unregister key: %s", key)
 
+	if reg != nil {
+		// 先停止心跳，否则撤销租约后心跳发现续租中断会重新注册
+		reg.stop()
+		defer reg.close()
+		if leaseID := reg.getLeaseID(); leaseID != 0 {
+			// 撤销租约会同时删除 key
+			_, _ = reg.lease.Revoke(ctx, leaseID)
+		}
+	}
+
 	_, err := r.client.Delete(ctx, key)
 	return err
 }
 
+// UpdateStatus 修改节点状态，使用当前的租约直接覆盖注册内容，不需要重新注册
+func (r *Registry) UpdateStatus(ctx context.Context, service *registry.Instance, status registry.Status) error {
+	return r.update(ctx, service, func(ins *registry.Instance) {
+		ins.Status = status
+	})
+}
+
+// UpdateMetadata 替换节点的 MetaData，使用当前的租约直接覆盖注册内容，不需要重新注册
+func (r *Registry) UpdateMetadata(ctx context.Context, service *registry.Instance, md map[string]string) error {
+	return r.update(ctx, service, func(ins *registry.Instance) {
+		ins.MetaData = make(map[string]string, len(md))
+		for k, v := range md {
+			ins.MetaData[k] = v
+		}
+	})
+}
+
+func (r *Registry) update(ctx context.Context, service *registry.Instance, fn func(ins *registry.Instance)) error {
+	r.lk.RLock()
+	reg, ok := r.regs[r.key(service)]
+	r.lk.RUnlock()
+	if !ok {
+		return aerror.NotFound
+	}
+
+	return reg.update(func(ins *registry.Instance, leaseID clientv3.LeaseID) error {
+		fn(ins)
+		value, err := marshal(ins)
+		if err != nil {
+			return err
+		}
+		_, err = r.client.Put(ctx, reg.key, value, clientv3.WithLease(leaseID))
+		return err
+	})
+}
+
 // GetService return the service instances in memory according to the service name.
 func (r *Registry) GetService(ctx context.Context, name string) ([]*registry.Instance, error) {
 	key := fmt.Sprintf("%s/%s", r.opts.namespace, name)
@@ -142,32 +213,45 @@ func (r *Registry) Watch(ctx context.Context, name string) (registry.Watcher, er
 	return newWatcher(ctx, key, name, r.client)
 }
 
+func (r *Registry) key(service *registry.Instance) string {
+	return fmt.Sprintf("%s/%s/%s", r.opts.namespace, service.Name, service.ID)
+}
+
 // registerWithKV create a new lease, return current leaseID
-func (r *Registry) registerWithKV(ctx context.Context, key string, value string) (clientv3.LeaseID, error) {
-	grant, err := r.lease.Grant(ctx, int64(r.opts.ttl.Seconds()))
+func (r *Registry) registerWithKV(ctx context.Context, reg *registration) (clientv3.LeaseID, error) {
+	grant, err := reg.lease.Grant(ctx, int64(r.opts.ttl.Seconds()))
 	if err != nil {
 		return 0, err
 	}
-	_, err = r.client.Put(ctx, key, value, clientv3.WithLease(grant.ID))
+
+	err = reg.update(func(ins *registry.Instance, _ clientv3.LeaseID) error {
+		value, err := marshal(ins)
+		if err != nil {
+			return err
+		}
+		_, err = r.client.Put(ctx, reg.key, value, clientv3.WithLease(grant.ID))
+		return err
+	})
 	if err != nil {
 		return 0, err
 	}
+
+	reg.setLeaseID(grant.ID)
 	return grant.ID, nil
 }
 
-func (r *Registry) heartBeat(ctx context.Context, leaseID clientv3.LeaseID, key string, value string) {
-	curLeaseID := leaseID
-	kac, err := r.client.KeepAlive(ctx, leaseID)
+func (r *Registry) heartBeat(ctx context.Context, reg *registration) {
+	kac, err := reg.lease.KeepAlive(ctx, reg.getLeaseID())
 	if err != nil {
-		alog.ErrorCtx(ctx, "%s|keep alive error: %s", key, err.Error())
-		curLeaseID = 0
+		alog.ErrorCtx(ctx, "%s|keep alive error: %s", reg.key, err.Error())
+		kac = nil
 	}
 
 	for {
-		if curLeaseID == 0 {
-			curLeaseID, kac = r.tryRegister(ctx, key, value)
+		if kac == nil {
+			kac = r.tryRegister(ctx, reg)
 			if kac == nil {
-				alog.ErrorCtx(ctx, "%s|tryRegister failed, exit", key)
+				alog.ErrorCtx(ctx, "%s|tryRegister failed, exit", reg.key)
 				return
 			}
 		}
@@ -180,7 +264,7 @@ func (r *Registry) heartBeat(ctx context.Context, leaseID clientv3.LeaseID, key
 					return
 				}
 				// need to retry registration
-				curLeaseID = 0
+				kac = nil
 				continue
 			}
 		case <-ctx.Done():
@@ -189,65 +273,39 @@ func (r *Registry) heartBeat(ctx context.Context, leaseID clientv3.LeaseID, key
 	}
 }
 
-func (r *Registry) tryRegister(ctx context.Context, key, value string) (curLeaseID clientv3.LeaseID, kac <-chan *clientv3.LeaseKeepAliveResponse) {
-	var err error
-	var retreat []int
-
-	maxSleepTime := int(r.opts.ttl.Seconds())
-	maxSleepTime = maxSleepTime / 2
-	if maxSleepTime <= 0 {
-		maxSleepTime = 1
-	}
-
-	// try to registerWithKV
+func (r *Registry) tryRegister(ctx context.Context, reg *registration) <-chan *clientv3.LeaseKeepAliveResponse {
 	for retryCnt := 0; retryCnt < r.opts.maxRetry; retryCnt++ {
 		if ctx.Err() != nil {
-			return 0, nil
+			return nil
 		}
-		// prevent infinite blocking
-		idChan := make(chan clientv3.LeaseID, 1)
-		errChan := make(chan error, 1)
-		cancelCtx, cancel := context.WithCancel(ctx)
-		go func() {
-			defer cancel()
-			id, registerErr := r.registerWithKV(cancelCtx, key, value)
-			if registerErr != nil {
-				errChan <- registerErr
-			} else {
-				idChan <- id
-			}
-		}()
 
-		select {
-		case <-time.After(3 * time.Second):
-			cancel()
-			continue
-		case <-errChan:
-			continue
-		case curLeaseID = <-idChan:
-		}
-
-		kac, err = r.client.KeepAlive(ctx, curLeaseID)
+		kac, err := r.registerAndKeepAlive(ctx, reg)
 		if err == nil {
-			break
+			r.backoff.Reset()
+			return kac
 		}
 
-		if maxSleepTime >= 1<<retryCnt {
-			retreat = append(retreat, 1<<retryCnt)
-		}
+		sleep := r.backoff.Next()
+		alog.ErrorCtx(ctx, "%s|%d|register error: %s, sleep: %s", reg.key, retryCnt, err.Error(), sleep)
 
-		sleepIdx := rand.Intn(len(retreat))
-
-		alog.ErrorCtx(ctx, "%s|%d|keep alive error: %s, sleep seconds: %d", key, retryCnt, err.Error(), retreat[sleepIdx])
-
-		time.Sleep(time.Duration(retreat[sleepIdx]) * time.Second)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(sleep):
+		}
 	}
 
-	if _, ok := <-kac; !ok {
-		// retry failed
-		alog.Debug("%s|keep alive failed , exit heartbeat", key)
-		return 0, nil
+	return nil
+}
+
+func (r *Registry) registerAndKeepAlive(ctx context.Context, reg *registration) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	// prevent infinite blocking
+	cancelCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	leaseID, err := r.registerWithKV(cancelCtx, reg)
+	cancel()
+	if err != nil {
+		return nil, err
 	}
 
-	return
+	return reg.lease.KeepAlive(ctx, leaseID)
 }
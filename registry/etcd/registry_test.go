@@ -2,8 +2,10 @@ package etcd
 
 import (
 	"context"
-	"fmt"
 	"log"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -13,16 +15,37 @@ import (
 
 	"github.com/lightmen/nami/pkg/cast"
 	"github.com/lightmen/nami/registry"
+	"github.com/lightmen/nami/registry/registrytest"
 )
 
-func TestRegistry(t *testing.T) {
+// newClient 需要设置 NAMI_ETCD_ADDR 环境变量指定 etcd 地址，多个地址用逗号分隔
+func newClient(t *testing.T) *clientv3.Client {
+	addr := os.Getenv("NAMI_ETCD_ADDR")
+	if addr == "" {
+		t.Skip("NAMI_ETCD_ADDR not set")
+	}
+
 	client, err := clientv3.New(clientv3.Config{
-		Endpoints:   []string{"127.0.0.1:2379"},
+		Endpoints:   strings.Split(addr, ","),
 		DialTimeout: time.Second, DialOptions: []grpc.DialOption{grpc.WithBlock()},
 	})
 	if err != nil {
 		t.Fatal(err)
 	}
+	return client
+}
+
+func TestConformance(t *testing.T) {
+	client := newClient(t)
+	defer client.Close()
+
+	registrytest.Run(t, func(t *testing.T) registrytest.Registry {
+		return New(client, Namespace("/registrytest/node"))
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	client := newClient(t)
 	defer client.Close()
 
 	ctx := context.Background()
@@ -81,13 +104,7 @@ func TestRegistry(t *testing.T) {
 }
 
 func TestHeartBeat(t *testing.T) {
-	client, err := clientv3.New(clientv3.Config{
-		Endpoints:   []string{"127.0.0.1:2379"},
-		DialTimeout: time.Second, DialOptions: []grpc.DialOption{grpc.WithBlock()},
-	})
-	if err != nil {
-		t.Fatal(err)
-	}
+	client := newClient(t)
 	defer client.Close()
 
 	ctx := context.Background()
@@ -124,10 +141,9 @@ func TestHeartBeat(t *testing.T) {
 		MaxRetry(5),
 	)
 
-	key := fmt.Sprintf("%s/%s/%s", r.opts.namespace, s.Name, s.ID)
-	value, _ := marshal(s)
-	r.lease = clientv3.NewLease(r.client)
-	leaseID, err := r.registerWithKV(ctx, key, value)
+	reg := newRegistration(r.key(s), s, clientv3.NewLease(r.client))
+	defer reg.close()
+	_, err := r.registerWithKV(ctx, reg)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -144,7 +160,7 @@ func TestHeartBeat(t *testing.T) {
 		t.Errorf("not expected empty")
 	}
 
-	go r.heartBeat(ctx, leaseID, key, value)
+	go r.heartBeat(ctx, reg)
 
 	time.Sleep(time.Second)
 	res, err = r.GetService(ctx, s.Name)
@@ -157,13 +173,7 @@ func TestHeartBeat(t *testing.T) {
 }
 
 func TestAutoWatch(t *testing.T) {
-	client, err := clientv3.New(clientv3.Config{
-		Endpoints:   []string{"127.0.0.1:2379"},
-		DialTimeout: time.Second, DialOptions: []grpc.DialOption{grpc.WithBlock()},
-	})
-	if err != nil {
-		t.Fatal(err)
-	}
+	client := newClient(t)
 	defer client.Close()
 
 	r := New(client, Namespace("/servers/crazypoker"))
@@ -180,3 +190,148 @@ func TestAutoWatch(t *testing.T) {
 func updateIns(insList []*registry.Instance) {
 	log.Printf("insList: %s", cast.ToJson(insList))
 }
+
+func TestMultiInstance(t *testing.T) {
+	client := newClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	r := New(client, RegisterTTL(2*time.Second))
+
+	admin := registrytest.Instance("admin", "1")
+	game := registrytest.Instance("gamesrv", "2")
+	for _, ins := range []*registry.Instance{admin, game} {
+		if err := r.Register(ctx, ins); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 超过 TTL 后两个节点都还在，说明第二次注册没有影响第一个节点的心跳
+	time.Sleep(5 * time.Second)
+	for _, ins := range []*registry.Instance{admin, game} {
+		res, err := r.GetService(ctx, ins.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != 1 {
+			t.Fatalf("%s lost after ttl", ins.Name)
+		}
+	}
+
+	if err := r.Unregister(ctx, admin); err != nil {
+		t.Fatal(err)
+	}
+	res, _ := r.GetService(ctx, "")
+	if len(res) != 1 || res[0].Name != game.Name {
+		t.Fatalf("unexpected instances: %+v", res)
+	}
+}
+
+func TestConcurrentRegister(t *testing.T) {
+	client := newClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	r := New(client)
+
+	const count = 20
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ins := registrytest.Instance("gamesrv", cast.ToString(i))
+			if err := r.Register(ctx, ins); err != nil {
+				t.Error(err)
+				return
+			}
+			// 偶数节点注册后马上注销
+			if i%2 == 0 {
+				if err := r.Unregister(ctx, ins); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	res, err := r.GetService(ctx, "gamesrv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != count/2 {
+		t.Fatalf("expect %d instances, got: %d", count/2, len(res))
+	}
+
+	r.lk.RLock()
+	regCount := len(r.regs)
+	r.lk.RUnlock()
+	if regCount != count/2 {
+		t.Fatalf("expect %d registrations, got: %d", count/2, regCount)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	client := newClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	r := New(client)
+
+	ins := registrytest.Instance("gamesrv", "1")
+	if err := r.UpdateStatus(ctx, ins, registry.StatusDraining); err == nil {
+		t.Fatalf("expect error when instance is not registered")
+	}
+
+	if err := r.Register(ctx, ins); err != nil {
+		t.Fatal(err)
+	}
+	leaseID := r.regs[r.key(ins)].getLeaseID()
+
+	if err := r.UpdateStatus(ctx, ins, registry.StatusDraining); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.UpdateMetadata(ctx, ins, map[string]string{"room": "100"}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := r.GetService(ctx, ins.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Status != registry.StatusDraining || res[0].MetaData["room"] != "100" {
+		t.Fatalf("unexpected instances: %+v", res)
+	}
+
+	// 修改不会重新注册
+	if got := r.regs[r.key(ins)].getLeaseID(); got != leaseID {
+		t.Fatalf("lease changed: %d -> %d", leaseID, got)
+	}
+}
+
+// TestUnregister Unregister 返回后 key 已经删除，心跳不会重新注册
+func TestUnregister(t *testing.T) {
+	client := newClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	s := &registry.Instance{ID: "0", Name: "unregister"}
+	r := New(client, RegisterTTL(2*time.Second))
+	if err := r.Register(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Unregister(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		rsp, err := client.Get(ctx, r.key(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rsp.Kvs) != 0 {
+			t.Fatalf("key should be deleted after Unregister: %s", rsp.Kvs[0].Value)
+		}
+		time.Sleep(time.Second)
+	}
+}
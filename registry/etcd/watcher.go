@@ -48,18 +48,26 @@ func (w *watcher) Next() ([]*registry.Instance, error) {
 		return item, err
 	}
 
-	select {
-	case <-w.ctx.Done():
-		return nil, w.ctx.Err()
-	case watchResp, ok := <-w.watchChan:
-		if !ok || watchResp.Err() != nil {
-			time.Sleep(time.Second)
-			err := w.reWatch()
-			if err != nil {
-				return nil, err
+	for {
+		select {
+		case <-w.ctx.Done():
+			return nil, w.ctx.Err()
+		case watchResp, ok := <-w.watchChan:
+			if w.ctx.Err() != nil {
+				return nil, w.ctx.Err()
 			}
+			if !ok || watchResp.Err() != nil {
+				time.Sleep(time.Second)
+				err := w.reWatch()
+				if err != nil {
+					return nil, err
+				}
+			} else if watchResp.IsProgressNotify() {
+				// RequestProgress 产生的通知，节点没有变化
+				continue
+			}
+			return w.getInstance()
 		}
-		return w.getInstance()
 	}
 }
 
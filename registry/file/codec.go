@@ -0,0 +1,56 @@
+package file
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/lightmen/nami/registry"
+	"gopkg.in/yaml.v3"
+)
+
+// decode 解析文件内容，yaml 会先转成 json 再解析，保证字段名和 etcd 中存储的 json 一致
+func decode(path string, data []byte) ([]*registry.Instance, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+
+	if isYaml(path) {
+		var raw any
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		var err error
+		if data, err = json.Marshal(raw); err != nil {
+			return nil, err
+		}
+	}
+
+	var items []*registry.Instance
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func encode(path string, items []*registry.Instance) ([]byte, error) {
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if !isYaml(path) {
+		return data, nil
+	}
+
+	var raw any
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(raw)
+}
+
+func isYaml(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
@@ -0,0 +1,15 @@
+package file
+
+// Option is file registry option.
+type Option func(o *options)
+
+type options struct {
+	writable bool
+}
+
+// Writable 开启后 Register/Unregister 会把本地节点写入/移出文件，否则 Registrar 为空操作
+func Writable() Option {
+	return func(o *options) {
+		o.writable = true
+	}
+}
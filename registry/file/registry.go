@@ -0,0 +1,187 @@
+// Package file 实现基于静态文件的注册中心，文件内容为 registry.Instance 数组，支持 json 和 yaml 格式，
+// 文件修改后通过 pkg/filewatch 自动 reload 并通知所有的 watcher
+package file
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/lightmen/nami/alog"
+	"github.com/lightmen/nami/pkg/filewatch"
+	"github.com/lightmen/nami/registry"
+	"github.com/lightmen/nami/registry/internal/local"
+)
+
+var (
+	_ registry.Registrar = (*Registry)(nil)
+	_ registry.Discovery = (*Registry)(nil)
+)
+
+// Registry is file registry.
+type Registry struct {
+	opts     *options
+	path     string
+	fileLk   sync.Mutex // 保证文件的读写不会交叉
+	lk       sync.RWMutex
+	items    []*registry.Instance
+	watchers map[*local.Watcher]struct{}
+}
+
+// New creates file registry, path 对应的文件必须存在
+func New(path string, opts ...Option) (*Registry, error) {
+	op := &options{}
+	for _, o := range opts {
+		o(op)
+	}
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Registry{
+		opts:     op,
+		path:     path,
+		watchers: make(map[*local.Watcher]struct{}),
+	}
+
+	if err = filewatch.Add(path, r.load); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Close 停止监控文件
+func (r *Registry) Close() error {
+	return filewatch.Remove(r.path)
+}
+
+// Register 当开启 Writable 时将节点写入文件，否则为空操作
+func (r *Registry) Register(ctx context.Context, service *registry.Instance) error {
+	if !r.opts.writable {
+		return nil
+	}
+
+	return r.modify(func(items []*registry.Instance) []*registry.Instance {
+		items = remove(items, service)
+		return append(items, local.Clone(service))
+	})
+}
+
+// Unregister 当开启 Writable 时将节点从文件移除，否则为空操作
+func (r *Registry) Unregister(ctx context.Context, service *registry.Instance) error {
+	if !r.opts.writable {
+		return nil
+	}
+
+	return r.modify(func(items []*registry.Instance) []*registry.Instance {
+		return remove(items, service)
+	})
+}
+
+// GetService return the service instances in memory according to the service name.
+func (r *Registry) GetService(ctx context.Context, name string) ([]*registry.Instance, error) {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+
+	items := make([]*registry.Instance, 0, len(r.items))
+	for _, ins := range r.items {
+		if name != "" && ins.Name != name {
+			continue
+		}
+		items = append(items, local.Clone(ins))
+	}
+	return items, nil
+}
+
+// Watch creates a watcher according to the service name.
+func (r *Registry) Watch(ctx context.Context, name string) (registry.Watcher, error) {
+	w := local.NewWatcher(ctx, name, r.GetService, r.removeWatcher)
+
+	r.lk.Lock()
+	r.watchers[w] = struct{}{}
+	r.lk.Unlock()
+
+	return w, nil
+}
+
+// load 为 filewatch 的回调，文件修改后重新加载节点。
+// 编辑器或者 os.WriteFile 会先清空文件再写入，读到空文件或者解析失败时保留之前的节点
+func (r *Registry) load(path string) error {
+	r.fileLk.Lock()
+	data, err := os.ReadFile(path)
+	r.fileLk.Unlock()
+	if err != nil {
+		alog.Error("[registry][file] read %s error: %s", path, err.Error())
+		return err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		alog.Info("[registry][file] %s is empty, keep the last instances", path)
+		return nil
+	}
+
+	items, err := decode(path, data)
+	if err != nil {
+		alog.Error("[registry][file] decode %s error: %s", path, err.Error())
+		return err
+	}
+
+	r.update(items)
+	return nil
+}
+
+func (r *Registry) modify(fn func([]*registry.Instance) []*registry.Instance) error {
+	r.fileLk.Lock()
+	defer r.fileLk.Unlock()
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	items, err := decode(r.path, data)
+	if err != nil {
+		return err
+	}
+
+	items = fn(items)
+	if data, err = encode(r.path, items); err != nil {
+		return err
+	}
+	if err = os.WriteFile(r.path, data, 0644); err != nil {
+		return err
+	}
+
+	r.update(items)
+	return nil
+}
+
+func (r *Registry) update(items []*registry.Instance) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	r.items = items
+	for w := range r.watchers {
+		w.Wakeup()
+	}
+}
+
+func (r *Registry) removeWatcher(w *local.Watcher) {
+	r.lk.Lock()
+	delete(r.watchers, w)
+	r.lk.Unlock()
+}
+
+func remove(items []*registry.Instance, service *registry.Instance) []*registry.Instance {
+	res := make([]*registry.Instance, 0, len(items))
+	for _, ins := range items {
+		if ins.Name == service.Name && ins.ID == service.ID {
+			continue
+		}
+		res = append(res, ins)
+	}
+	return res
+}
@@ -0,0 +1,140 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lightmen/nami/registry/registrytest"
+)
+
+func TestRegistry(t *testing.T) {
+	registrytest.Run(t, func(t *testing.T) registrytest.Registry {
+		path := filepath.Join(t.TempDir(), "registry.json")
+		if err := os.WriteFile(path, []byte("[]"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		r, err := New(path, Writable())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = r.Close()
+		})
+		return r
+	})
+}
+
+func TestYamlReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.yaml")
+	content := `
+- ID: "1"
+  Name: gamesrv
+  MetaData:
+    zone: sz
+  Endpoints:
+    - grpc://127.0.0.1:9000
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	ctx := context.Background()
+	res, err := r.GetService(ctx, "gamesrv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].MetaData["zone"] != "sz" || res[0].Endpoints[0] != "grpc://127.0.0.1:9000" {
+		t.Fatalf("unexpected instances: %+v", res)
+	}
+
+	w, err := r.Watch(ctx, "gamesrv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	if res, _ = w.Next(); len(res) != 1 {
+		t.Fatalf("expect 1 instance, got: %d", len(res))
+	}
+
+	content += `
+- ID: "2"
+  Name: gamesrv
+  Endpoints:
+    - grpc://127.0.0.1:9001
+`
+	if err = os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if res, _ = w.Next(); len(res) == 2 {
+			return
+		}
+	}
+	t.Fatalf("expect 2 instances after reload, got: %d", len(res))
+}
+
+func TestRegistrarNoop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	if err := os.WriteFile(path, []byte("[]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	ctx := context.Background()
+	if err = r.Register(ctx, registrytest.Instance("gamesrv", "1")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "[]" {
+		t.Fatalf("expect file not changed, got: %s", data)
+	}
+}
+
+func TestKeepLastSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	if err := os.WriteFile(path, []byte(`[{"ID":"1","Name":"gamesrv","MetaData":{"zone":"sz"}}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// 返回的节点是拷贝，修改不影响注册中心
+	ctx := context.Background()
+	res, _ := r.GetService(ctx, "gamesrv")
+	res[0].MetaData["zone"] = "gz"
+	if res, _ = r.GetService(ctx, "gamesrv"); res[0].MetaData["zone"] != "sz" {
+		t.Fatalf("instance modified by caller: %+v", res[0])
+	}
+
+	// 写入过程中读到空文件或者不完整的文件时保留之前的节点
+	for _, content := range []string{"", `[{"ID":"1",`} {
+		if err = os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_ = r.load(path)
+		if res, _ = r.GetService(ctx, "gamesrv"); len(res) != 1 {
+			t.Fatalf("content %q: expect 1 instance, got: %d", content, len(res))
+		}
+	}
+}
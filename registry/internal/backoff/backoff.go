@@ -0,0 +1,61 @@
+// Package backoff 注册中心连接失败后重试使用的指数退避
+package backoff
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Backoff 指数退避，连续失败的次数越多等待的时间越长，并加上随机抖动
+type Backoff struct {
+	lk       sync.Mutex
+	base     time.Duration
+	max      time.Duration
+	failures int
+}
+
+// New creates backoff, 等待时间从 base 开始翻倍，最长为 max
+func New(base, max time.Duration) *Backoff {
+	return &Backoff{
+		base: base,
+		max:  max,
+	}
+}
+
+// Next 记录一次失败并返回需要等待的时间
+func (b *Backoff) Next() time.Duration {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+
+	d := b.base << b.failures
+	if d <= 0 || d > b.max {
+		d = b.max
+	} else {
+		b.failures++
+	}
+
+	// 在 [d/2, d] 之间随机，避免所有节点同时重试
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Wait 记录一次失败并等待，ctx 结束时返回 false
+func (b *Backoff) Wait(ctx context.Context) bool {
+	t := time.NewTimer(b.Next())
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// Reset 成功后重置失败次数
+func (b *Backoff) Reset() {
+	b.lk.Lock()
+	b.failures = 0
+	b.lk.Unlock()
+}
@@ -0,0 +1,22 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := New(time.Second, 4*time.Second)
+
+	for i, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		d := b.Next()
+		if d < max/2 || d > max {
+			t.Fatalf("%d: expect sleep in [%s, %s], got: %s", i, max/2, max, d)
+		}
+	}
+
+	b.Reset()
+	if d := b.Next(); d > time.Second {
+		t.Fatalf("expect sleep less than 1s after reset, got: %s", d)
+	}
+}
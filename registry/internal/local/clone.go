@@ -0,0 +1,18 @@
+package local
+
+import "github.com/lightmen/nami/registry"
+
+// Clone 深拷贝节点，避免调用方修改注册中心保存的节点
+func Clone(ins *registry.Instance) *registry.Instance {
+	c := *ins
+	if ins.MetaData != nil {
+		c.MetaData = make(map[string]string, len(ins.MetaData))
+		for k, v := range ins.MetaData {
+			c.MetaData[k] = v
+		}
+	}
+	if ins.Endpoints != nil {
+		c.Endpoints = append([]string(nil), ins.Endpoints...)
+	}
+	return &c
+}
@@ -0,0 +1,70 @@
+// Package local 为进程内保存节点的注册中心(memory、file)提供公共的 watcher 实现
+package local
+
+import (
+	"context"
+
+	"github.com/lightmen/nami/registry"
+)
+
+var _ registry.Watcher = (*Watcher)(nil)
+
+// GetFunc 获取服务的节点，name 为空时获取所有服务的节点
+type GetFunc func(ctx context.Context, name string) ([]*registry.Instance, error)
+
+// Watcher 第一次 Next 立即返回节点，之后等待 Wakeup 通知再重新获取
+type Watcher struct {
+	name   string
+	get    GetFunc
+	remove func(w *Watcher)
+	ctx    context.Context
+	cancel context.CancelFunc
+	event  chan struct{}
+	first  bool
+}
+
+// NewWatcher creates watcher, remove 在 Stop 时调用，用于注册中心删除该 watcher
+func NewWatcher(ctx context.Context, name string, get GetFunc, remove func(w *Watcher)) *Watcher {
+	w := &Watcher{
+		name:   name,
+		get:    get,
+		remove: remove,
+		event:  make(chan struct{}, 1),
+		first:  true,
+	}
+	w.ctx, w.cancel = context.WithCancel(ctx)
+	return w
+}
+
+// Name 监控的服务名，为空时监控所有服务
+func (w *Watcher) Name() string {
+	return w.name
+}
+
+func (w *Watcher) Next() ([]*registry.Instance, error) {
+	if w.first {
+		w.first = false
+		return w.get(w.ctx, w.name)
+	}
+
+	select {
+	case <-w.ctx.Done():
+		return nil, w.ctx.Err()
+	case <-w.event:
+		return w.get(w.ctx, w.name)
+	}
+}
+
+func (w *Watcher) Stop() error {
+	w.cancel()
+	w.remove(w)
+	return nil
+}
+
+// Wakeup 通知watcher有变更，多次变更会被合并成一次
+func (w *Watcher) Wakeup() {
+	select {
+	case w.event <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,139 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/lightmen/nami/pkg/aerror"
+	"github.com/lightmen/nami/registry"
+	"github.com/lightmen/nami/registry/internal/local"
+)
+
+var (
+	_ registry.Registrar     = (*Registry)(nil)
+	_ registry.Discovery     = (*Registry)(nil)
+	_ registry.StatusUpdater = (*Registry)(nil)
+)
+
+// Registry is an in-process registry, it can be shared by several nami.App in one process.
+type Registry struct {
+	sync.RWMutex
+	services map[string]map[string]*registry.Instance // name -> id -> instance
+	watchers map[*local.Watcher]struct{}
+}
+
+// New creates memory registry
+func New() *Registry {
+	return &Registry{
+		services: make(map[string]map[string]*registry.Instance),
+		watchers: make(map[*local.Watcher]struct{}),
+	}
+}
+
+// Register the registration.
+func (r *Registry) Register(ctx context.Context, service *registry.Instance) error {
+	r.Lock()
+	insMap, ok := r.services[service.Name]
+	if !ok {
+		insMap = make(map[string]*registry.Instance)
+		r.services[service.Name] = insMap
+	}
+	insMap[service.ID] = local.Clone(service)
+	r.Unlock()
+
+	r.notify(service.Name)
+	return nil
+}
+
+// Unregister the registration.
+func (r *Registry) Unregister(ctx context.Context, service *registry.Instance) error {
+	r.Lock()
+	if insMap, ok := r.services[service.Name]; ok {
+		delete(insMap, service.ID)
+		if len(insMap) == 0 {
+			delete(r.services, service.Name)
+		}
+	}
+	r.Unlock()
+
+	r.notify(service.Name)
+	return nil
+}
+
+// UpdateStatus 修改已注册节点的状态
+func (r *Registry) UpdateStatus(ctx context.Context, service *registry.Instance, status registry.Status) error {
+	r.Lock()
+	ins, ok := r.services[service.Name][service.ID]
+	if ok {
+		ins.Status = status
+	}
+	r.Unlock()
+
+	if !ok {
+		return aerror.NotFound
+	}
+
+	r.notify(service.Name)
+	return nil
+}
+
+// GetService return the service instances in memory according to the service name.
+func (r *Registry) GetService(ctx context.Context, name string) ([]*registry.Instance, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	return r.getService(name), nil
+}
+
+// Watch creates a watcher according to the service name.
+func (r *Registry) Watch(ctx context.Context, name string) (registry.Watcher, error) {
+	w := local.NewWatcher(ctx, name, r.GetService, r.removeWatcher)
+
+	r.Lock()
+	r.watchers[w] = struct{}{}
+	r.Unlock()
+
+	return w, nil
+}
+
+func (r *Registry) getService(name string) []*registry.Instance {
+	keys := make([]string, 0)
+	all := make(map[string]*registry.Instance)
+	for srvName, insMap := range r.services {
+		if name != "" && srvName != name {
+			continue
+		}
+		for id, ins := range insMap {
+			key := srvName + "/" + id
+			keys = append(keys, key)
+			all[key] = ins
+		}
+	}
+	sort.Strings(keys)
+
+	items := make([]*registry.Instance, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, local.Clone(all[key]))
+	}
+	return items
+}
+
+// notify wakes up all watchers interested in the service
+func (r *Registry) notify(name string) {
+	r.RLock()
+	defer r.RUnlock()
+
+	for w := range r.watchers {
+		if w.Name() != "" && w.Name() != name {
+			continue
+		}
+		w.Wakeup()
+	}
+}
+
+func (r *Registry) removeWatcher(w *local.Watcher) {
+	r.Lock()
+	delete(r.watchers, w)
+	r.Unlock()
+}
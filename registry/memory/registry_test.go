@@ -0,0 +1,91 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lightmen/nami"
+	"github.com/lightmen/nami/registry"
+	"github.com/lightmen/nami/registry/registrytest"
+)
+
+func TestRegistry(t *testing.T) {
+	registrytest.Run(t, func(t *testing.T) registrytest.Registry {
+		return New()
+	})
+}
+
+func TestUpdateStatus(t *testing.T) {
+	r := New()
+	ctx := context.Background()
+
+	ins := registrytest.Instance("gamesrv", "1")
+	if err := r.UpdateStatus(ctx, ins, registry.StatusDraining); err == nil {
+		t.Fatalf("expect error when instance is not registered")
+	}
+
+	if err := r.Register(ctx, ins); err != nil {
+		t.Fatal(err)
+	}
+	w, _ := r.Watch(ctx, ins.Name)
+	defer w.Stop()
+	_, _ = w.Next()
+
+	if err := r.UpdateStatus(ctx, ins, registry.StatusDraining); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := w.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].GetStatus() != registry.StatusDraining {
+		t.Fatalf("unexpected instances: %+v", res)
+	}
+}
+
+func TestMultiApp(t *testing.T) {
+	r := New()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	apps := make([]*nami.App, 0, 2)
+	for _, id := range []string{"1", "2"} {
+		app, err := nami.New(
+			nami.ID(id),
+			nami.Name("memory_app"),
+			nami.Context(ctx),
+			nami.Registrar(r),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		apps = append(apps, app)
+		go func() {
+			_ = app.Run()
+		}()
+	}
+
+	waitCount(t, r, "memory_app", 2)
+
+	if err := apps[0].Stop(); err != nil {
+		t.Fatal(err)
+	}
+	waitCount(t, r, "memory_app", 1)
+}
+
+func waitCount(t *testing.T, r *Registry, name string, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		res, _ := r.GetService(context.Background(), name)
+		if len(res) == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expect %d instances", n)
+}
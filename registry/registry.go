@@ -2,16 +2,53 @@ package registry
 
 import "context"
 
+// Status 服务节点状态
+type Status string
+
+const (
+	StatusUp       Status = "UP"       // 正常提供服务
+	StatusDraining Status = "DRAINING" // 即将下线，不再接收新的流量，但已有的请求会处理完
+	StatusDown     Status = "DOWN"     // 不可用
+)
+
+// DefaultWeight 节点未设置权重时的默认权重
+const DefaultWeight = 100
+
 // Instance 服务节点信息
 type Instance struct {
 	ID       string            `json:"ID,omitempty"`
 	Name     string            `json:"Name,omitempty"`
+	Version  string            `json:"Version,omitempty"`
 	MetaData map[string]string `json:"MetaData,omitempty"`
 	// Endpoints is endpoint addresses of the service instance.
 	// schema:
 	//   http://127.0.0.1:8000
 	//   grpc://127.0.0.1:9000
 	Endpoints []string `json:"Endpoints,omitempty"`
+	Weight    int      `json:"Weight,omitempty"` // 负载权重，小于等于0时使用 DefaultWeight
+	Zone      string   `json:"Zone,omitempty"`   // 所在的区域/机房
+	Status    Status   `json:"Status,omitempty"` // 节点状态，为空时等同于 StatusUp
+}
+
+// GetWeight 返回节点的权重，未设置时返回 DefaultWeight
+func (ins *Instance) GetWeight() int {
+	if ins.Weight <= 0 {
+		return DefaultWeight
+	}
+	return ins.Weight
+}
+
+// GetStatus 返回节点的状态，未设置时返回 StatusUp
+func (ins *Instance) GetStatus() Status {
+	if ins.Status == "" {
+		return StatusUp
+	}
+	return ins.Status
+}
+
+// IsUp 节点是否可以接收新的流量
+func (ins *Instance) IsUp() bool {
+	return ins.GetStatus() == StatusUp
 }
 
 type Registrar interface {
@@ -19,6 +56,11 @@ type Registrar interface {
 	Unregister(ctx context.Context, service *Instance) error
 }
 
+// StatusUpdater 支持在不重新注册的情况下修改节点状态的注册中心
+type StatusUpdater interface {
+	UpdateStatus(ctx context.Context, service *Instance, status Status) error
+}
+
 // Discovery is service discovery.
 type Discovery interface {
 	// GetService return the service instances in memory according to the service name. if srvName is emtpy, get all service
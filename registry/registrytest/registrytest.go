@@ -0,0 +1,271 @@
+// Package registrytest 提供 registry 实现的一致性测试，所有的 registry 实现都应该通过该测试
+package registrytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lightmen/nami/registry"
+)
+
+// Registry 同时实现了 Registrar 和 Discovery 的注册中心
+type Registry interface {
+	registry.Registrar
+	registry.Discovery
+}
+
+// Run 对 registry 实现执行一致性测试，newRegistry 每次调用都需要返回一个空的注册中心
+func Run(t *testing.T, newRegistry func(t *testing.T) Registry) {
+	t.Run("RegisterAndGetService", func(t *testing.T) {
+		testRegisterAndGetService(t, newRegistry(t))
+	})
+	t.Run("WatchFirstNext", func(t *testing.T) {
+		testWatchFirstNext(t, newRegistry(t))
+	})
+	t.Run("WatchChanges", func(t *testing.T) {
+		testWatchChanges(t, newRegistry(t))
+	})
+	t.Run("WatchAll", func(t *testing.T) {
+		testWatchAll(t, newRegistry(t))
+	})
+	t.Run("StopUnblocksNext", func(t *testing.T) {
+		testStopUnblocksNext(t, newRegistry(t))
+	})
+}
+
+// Instance 创建测试用的服务节点，id 在整个注册中心内需要唯一
+func Instance(name, id string) *registry.Instance {
+	return &registry.Instance{
+		ID:        id,
+		Name:      name,
+		MetaData:  map[string]string{"id": id},
+		Endpoints: []string{fmt.Sprintf("grpc://127.0.0.1:%d", 9000+len(id))},
+	}
+}
+
+func testRegisterAndGetService(t *testing.T, r Registry) {
+	ctx := context.Background()
+	name := uniqueName("get")
+
+	ins1 := Instance(name, "1")
+	ins2 := Instance(name, "2")
+	other := Instance(name+"_other", "3")
+	for _, ins := range []*registry.Instance{ins1, ins2, other} {
+		if err := r.Register(ctx, ins); err != nil {
+			t.Fatalf("Register(%s) got error: %v", ins.ID, err)
+		}
+	}
+	defer func() {
+		_ = r.Unregister(ctx, ins2)
+		_ = r.Unregister(ctx, other)
+	}()
+
+	res := waitService(t, r, name, 2)
+	for _, ins := range res {
+		if ins.Name != name {
+			t.Fatalf("expect name %s, got: %s", name, ins.Name)
+		}
+		if ins.MetaData["id"] != ins.ID {
+			t.Fatalf("expect metadata id %s, got: %s", ins.ID, ins.MetaData["id"])
+		}
+		if len(ins.Endpoints) != 1 {
+			t.Fatalf("expect 1 endpoint, got: %v", ins.Endpoints)
+		}
+	}
+
+	if err := r.Unregister(ctx, ins1); err != nil {
+		t.Fatalf("Unregister got error: %v", err)
+	}
+
+	res = waitService(t, r, name, 1)
+	if res[0].ID != ins2.ID {
+		t.Fatalf("expect %s, got: %s", ins2.ID, res[0].ID)
+	}
+}
+
+func testWatchFirstNext(t *testing.T, r Registry) {
+	ctx := context.Background()
+	name := uniqueName("first")
+
+	ins := Instance(name, "1")
+	if err := r.Register(ctx, ins); err != nil {
+		t.Fatalf("Register got error: %v", err)
+	}
+	defer func() {
+		_ = r.Unregister(ctx, ins)
+	}()
+	waitService(t, r, name, 1)
+
+	w, err := r.Watch(ctx, name)
+	if err != nil {
+		t.Fatalf("Watch got error: %v", err)
+	}
+	defer func() {
+		_ = w.Stop()
+	}()
+
+	res := nextTimeout(t, w)
+	if len(res) != 1 || res[0].ID != ins.ID {
+		t.Fatalf("expect [%s], got: %v", ins.ID, res)
+	}
+}
+
+func testWatchChanges(t *testing.T, r Registry) {
+	ctx := context.Background()
+	name := uniqueName("changes")
+
+	w, err := r.Watch(ctx, name)
+	if err != nil {
+		t.Fatalf("Watch got error: %v", err)
+	}
+	defer func() {
+		_ = w.Stop()
+	}()
+
+	if res := nextTimeout(t, w); len(res) != 0 {
+		t.Fatalf("expect empty, got: %v", res)
+	}
+
+	ins := Instance(name, "1")
+	if err = r.Register(ctx, ins); err != nil {
+		t.Fatalf("Register got error: %v", err)
+	}
+	waitNext(t, w, 1)
+
+	if err = r.Unregister(ctx, ins); err != nil {
+		t.Fatalf("Unregister got error: %v", err)
+	}
+	waitNext(t, w, 0)
+}
+
+func testWatchAll(t *testing.T, r Registry) {
+	ctx := context.Background()
+	name := uniqueName("all")
+
+	w, err := r.Watch(ctx, "")
+	if err != nil {
+		t.Fatalf("Watch got error: %v", err)
+	}
+	defer func() {
+		_ = w.Stop()
+	}()
+	nextTimeout(t, w)
+
+	ins := Instance(name, "1")
+	if err = r.Register(ctx, ins); err != nil {
+		t.Fatalf("Register got error: %v", err)
+	}
+	defer func() {
+		_ = r.Unregister(ctx, ins)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, got := range nextTimeout(t, w) {
+			if got.Name == name && got.ID == ins.ID {
+				return
+			}
+		}
+	}
+	t.Fatalf("watch all not found %s", name)
+}
+
+func testStopUnblocksNext(t *testing.T, r Registry) {
+	ctx := context.Background()
+	name := uniqueName("stop")
+
+	w, err := r.Watch(ctx, name)
+	if err != nil {
+		t.Fatalf("Watch got error: %v", err)
+	}
+	nextTimeout(t, w)
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := w.Next()
+		errCh <- err
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if err = w.Stop(); err != nil {
+		t.Fatalf("Stop got error: %v", err)
+	}
+
+	select {
+	case err = <-errCh:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expect context.Canceled, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Next is not unblocked after Stop")
+	}
+}
+
+// waitService 等待服务节点数量等于 n, 兼容最终一致的注册中心
+func waitService(t *testing.T, r Registry, name string, n int) []*registry.Instance {
+	t.Helper()
+
+	var res []*registry.Instance
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		var err error
+		res, err = r.GetService(context.Background(), name)
+		if err != nil {
+			t.Fatalf("GetService got error: %v", err)
+		}
+		if len(res) == n {
+			return res
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("expect %d instances, got: %d", n, len(res))
+	return nil
+}
+
+// waitNext 等待 watcher 返回的服务节点数量等于 n
+func waitNext(t *testing.T, w registry.Watcher, n int) []*registry.Instance {
+	t.Helper()
+
+	var res []*registry.Instance
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		res = nextTimeout(t, w)
+		if len(res) == n {
+			return res
+		}
+	}
+	t.Fatalf("expect %d instances from watcher, got: %d", n, len(res))
+	return nil
+}
+
+func nextTimeout(t *testing.T, w registry.Watcher) []*registry.Instance {
+	t.Helper()
+
+	type result struct {
+		res []*registry.Instance
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		res, err := w.Next()
+		ch <- result{res: res, err: err}
+	}()
+
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			t.Fatalf("Next got error: %v", r.err)
+		}
+		return r.res
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Next timeout")
+	}
+	return nil
+}
+
+func uniqueName(prefix string) string {
+	return fmt.Sprintf("registrytest_%s_%d", prefix, time.Now().UnixNano())
+}
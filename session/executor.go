@@ -0,0 +1,169 @@
+package session
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lightmen/nami/alog"
+	"github.com/lightmen/nami/metadata"
+	"github.com/lightmen/nami/pkg/random"
+	"github.com/lightmen/nami/pkg/safe"
+)
+
+// Executor 保证同一个session的任务串行执行，每个session一个mailbox，
+// 有任务时启动goroutine按顺序执行，任务执行完后退出
+//
+// 任务中通过arpc调用又回到同一个session时(比如 A 服务处理玩家请求时调用 B 服务，B 服务又调用 A 服务)，
+// 如果排队会等待自己执行完，造成死锁。执行任务时在ctx和metadata中记录任务的token，
+// 只有携带正在执行的任务的token的任务才是重入，直接执行，不排队。任务执行完后token失效，
+// 通过异步调用或者在任务结束后才使用的ctx不会绕过排队
+type Executor struct {
+	id  string // 区分不同进程的执行器
+	seq atomic.Uint64
+
+	lk    sync.Mutex
+	boxes map[string]*mailbox
+}
+
+type mailbox struct {
+	jobs    []*job
+	running string // 正在执行的任务的token
+}
+
+type job struct {
+	token string
+	fn    func()
+}
+
+type execKey struct{}
+
+// NewExecutor creates session executor
+func NewExecutor() *Executor {
+	return &Executor{
+		id:    random.String(8),
+		boxes: make(map[string]*mailbox),
+	}
+}
+
+// Execute 在id对应的mailbox中执行fn，同一个id的fn按调用顺序串行执行，Execute不等待fn执行完
+func (e *Executor) Execute(ctx context.Context, id string, fn func(ctx context.Context)) {
+	if e.isReentrant(ctx, id) {
+		alog.DebugCtx(ctx, "%s|session executor reentrant, run directly", id)
+		safe.Go(func() { fn(ctx) })
+		return
+	}
+
+	token := e.token(id)
+	ctx = withExecuting(ctx, token)
+	j := &job{token: token, fn: func() { fn(ctx) }}
+
+	e.lk.Lock()
+	if box, ok := e.boxes[id]; ok {
+		box.jobs = append(box.jobs, j)
+		e.lk.Unlock()
+		return
+	}
+	box := &mailbox{running: j.token}
+	e.boxes[id] = box
+	e.lk.Unlock()
+
+	safe.Go(func() { e.drain(id, box, j) })
+}
+
+// Len 返回正在执行或排队的session数量
+func (e *Executor) Len() int {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+	return len(e.boxes)
+}
+
+func (e *Executor) drain(id string, box *mailbox, j *job) {
+	for {
+		safe.Func(j.fn)
+
+		e.lk.Lock()
+		if len(box.jobs) == 0 {
+			delete(e.boxes, id)
+			e.lk.Unlock()
+			return
+		}
+		j = box.jobs[0]
+		box.jobs[0] = nil
+		box.jobs = box.jobs[1:]
+		box.running = j.token
+		e.lk.Unlock()
+	}
+}
+
+// isReentrant 调用链上是否有id正在执行的任务
+func (e *Executor) isReentrant(ctx context.Context, id string) bool {
+	e.lk.Lock()
+	box, ok := e.boxes[id]
+	var running string
+	if ok {
+		running = box.running
+	}
+	e.lk.Unlock()
+
+	return running != "" && isExecuting(ctx, running)
+}
+
+// token 每个任务唯一
+func (e *Executor) token(id string) string {
+	return e.id + "/" + id + "/" + strconv.FormatUint(e.seq.Add(1), 10)
+}
+
+// isExecuting 调用链上是否正在执行token对应的session
+func isExecuting(ctx context.Context, token string) bool {
+	if tokens, ok := ctx.Value(execKey{}).([]string); ok && slices.Contains(tokens, token) {
+		return true
+	}
+
+	if md, ok := metadata.FromServerContext(ctx); ok {
+		if v := md.Get(metadata.ExecKey); v != "" {
+			return slices.Contains(strings.Split(v, ","), token)
+		}
+	}
+	return false
+}
+
+// withExecuting 在ctx和metadata中记录正在执行的session，通过arpc调用时传递给下游
+func withExecuting(ctx context.Context, token string) context.Context {
+	tokens, _ := ctx.Value(execKey{}).([]string)
+	tokens = append(slices.Clip(tokens), token)
+	ctx = context.WithValue(ctx, execKey{}, tokens)
+
+	md, ok := metadata.FromServerContext(ctx)
+	if !ok {
+		md = metadata.New()
+	} else {
+		md = md.Clone()
+	}
+
+	v := md.Get(metadata.ExecKey)
+	if v != "" {
+		v += ","
+	}
+	md.Set(metadata.ExecKey, v+token)
+	return metadata.NewServerContext(ctx, md)
+}
+
+// WithoutExecuting 清除ctx和metadata中记录的正在执行的session，
+// 异步调用(Event、Notify)不等待结果，下游的任务需要排队执行，不能视为重入
+func WithoutExecuting(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(execKey{}).([]string); ok {
+		ctx = context.WithValue(ctx, execKey{}, []string(nil))
+	}
+
+	md, ok := metadata.FromServerContext(ctx)
+	if !ok || md.Get(metadata.ExecKey) == "" {
+		return ctx
+	}
+	md = md.Clone()
+	delete(md, metadata.ExecKey)
+	return metadata.NewServerContext(ctx, md)
+}
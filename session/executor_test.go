@@ -0,0 +1,141 @@
+package session
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lightmen/nami/metadata"
+)
+
+func TestExecutorSerial(t *testing.T) {
+	e := NewExecutor()
+
+	var running, maxRunning atomic.Int32
+	var wg sync.WaitGroup
+	order := make([]int, 0)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		e.Execute(context.Background(), "u1", func(ctx context.Context) {
+			defer wg.Done()
+			if n := running.Add(1); n > maxRunning.Load() {
+				maxRunning.Store(n)
+			}
+			order = append(order, i)
+			running.Add(-1)
+		})
+	}
+	wg.Wait()
+
+	if maxRunning.Load() != 1 {
+		t.Fatalf("max running = %d, want 1", maxRunning.Load())
+	}
+	for i, v := range order {
+		if v != i {
+			t.Fatalf("order = %v", order)
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if e.Len() != 0 {
+		t.Fatalf("mailboxes = %d, want 0", e.Len())
+	}
+}
+
+func TestExecutorReentrant(t *testing.T) {
+	e := NewExecutor()
+	done := make(chan struct{})
+
+	e.Execute(context.Background(), "u1", func(ctx context.Context) {
+		// 进程内嵌套执行
+		nested := make(chan struct{})
+		e.Execute(ctx, "u1", func(ctx context.Context) {
+			close(nested)
+		})
+		<-nested
+
+		// 模拟经过 arpc 调用回到本进程，只传递了 metadata
+		md, _ := metadata.FromServerContext(ctx)
+		remote := metadata.NewServerContext(context.Background(), md.Clone())
+		e.Execute(remote, "u1", func(ctx context.Context) {
+			close(done)
+		})
+		<-done
+	})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("reentrant execute deadlock")
+	}
+
+	// 其他 session 不受影响
+	other := make(chan struct{})
+	e.Execute(context.Background(), "u2", func(ctx context.Context) {
+		if tokens, _ := ctx.Value(execKey{}).([]string); len(tokens) != 1 || strings.Contains(tokens[0], "/u1/") {
+			t.Errorf("u2 should not carry u1: %v", tokens)
+		}
+		close(other)
+	})
+	<-other
+}
+
+// expectQueued 在 ctx 中执行 u1 的任务，任务需要等 release 关闭后才执行
+func expectQueued(t *testing.T, e *Executor, ctx context.Context, release chan struct{}) {
+	t.Helper()
+	ran := make(chan struct{})
+	e.Execute(ctx, "u1", func(ctx context.Context) {
+		close(ran)
+	})
+	select {
+	case <-ran:
+		t.Fatal("job should wait in mailbox")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("queued job not executed")
+	}
+}
+
+func TestExecutorStaleToken(t *testing.T) {
+	e := NewExecutor()
+
+	// 任务结束后 ctx 中的 token 失效
+	captured := make(chan context.Context, 1)
+	e.Execute(context.Background(), "u1", func(ctx context.Context) {
+		captured <- ctx
+	})
+	stale := <-captured
+
+	release := make(chan struct{})
+	e.Execute(context.Background(), "u1", func(ctx context.Context) {
+		<-release
+	})
+
+	md, _ := metadata.FromServerContext(stale)
+	remote := metadata.NewServerContext(context.Background(), md.Clone())
+	expectQueued(t, e, remote, release)
+}
+
+func TestExecutorWithoutExecuting(t *testing.T) {
+	e := NewExecutor()
+	release := make(chan struct{})
+	captured := make(chan context.Context, 1)
+
+	// 异步调用回到同一个 session 时排队执行
+	e.Execute(context.Background(), "u1", func(ctx context.Context) {
+		captured <- WithoutExecuting(ctx)
+		<-release
+	})
+	async := <-captured
+	if md, _ := metadata.FromServerContext(async); md.Get(metadata.ExecKey) != "" {
+		t.Fatalf("exec token should be cleared")
+	}
+	expectQueued(t, e, async, release)
+}
@@ -0,0 +1,109 @@
+package session
+
+import (
+	"github.com/lightmen/nami/pkg/safe"
+)
+
+// CloseReason session 关闭的原因
+type CloseReason int
+
+const (
+	CloseLogout CloseReason = iota // 正常登出
+	CloseKick                      // 被踢下线
+)
+
+func (r CloseReason) String() string {
+	switch r {
+	case CloseLogout:
+		return "logout"
+	case CloseKick:
+		return "kick"
+	default:
+		return "unknown"
+	}
+}
+
+// Hook session 生命周期回调
+type Hook func(s Session)
+
+// CloseHook session 关闭回调
+type CloseHook func(s Session, reason CloseReason)
+
+type hooks struct {
+	create []Hook
+	expire []Hook
+	close  []CloseHook
+}
+
+// clearer 关闭或超时后清除 session 中的数据
+type clearer interface {
+	Clear()
+}
+
+// OnCreate 注册 session 加入 Manager 时的回调
+func (mgr *Manager) OnCreate(fn Hook) {
+	mgr.hookLock.Lock()
+	defer mgr.hookLock.Unlock()
+	mgr.hooks.create = append(mgr.hooks.create, fn)
+}
+
+// OnExpire 注册 session 超时被清理时的回调，回调之后清除 session 中的数据
+func (mgr *Manager) OnExpire(fn Hook) {
+	mgr.hookLock.Lock()
+	defer mgr.hookLock.Unlock()
+	mgr.hooks.expire = append(mgr.hooks.expire, fn)
+}
+
+// OnClose 注册 session 调用 Close 或 Kick 时的回调，回调之后清除 session 中的数据
+func (mgr *Manager) OnClose(fn CloseHook) {
+	mgr.hookLock.Lock()
+	defer mgr.hookLock.Unlock()
+	mgr.hooks.close = append(mgr.hooks.close, fn)
+}
+
+func (mgr *Manager) getHooks() hooks {
+	mgr.hookLock.RLock()
+	defer mgr.hookLock.RUnlock()
+	return mgr.hooks
+}
+
+func (mgr *Manager) fireCreate(s Session) {
+	for _, fn := range mgr.getHooks().create {
+		safe.Func(func() { fn(s) })
+	}
+}
+
+func (mgr *Manager) fireExpire(s Session) {
+	for _, fn := range mgr.getHooks().expire {
+		safe.Func(func() { fn(s) })
+	}
+	clearSession(s)
+}
+
+func (mgr *Manager) fireClose(s Session, reason CloseReason) {
+	for _, fn := range mgr.getHooks().close {
+		safe.Func(func() { fn(s, reason) })
+	}
+	clearSession(s)
+}
+
+func clearSession(s Session) {
+	if c, ok := s.(clearer); ok {
+		c.Clear()
+	}
+}
+
+// OnCreate 注册全局 Manager 的 session 创建回调
+func OnCreate(fn Hook) {
+	gMgr.OnCreate(fn)
+}
+
+// OnExpire 注册全局 Manager 的 session 超时回调
+func OnExpire(fn Hook) {
+	gMgr.OnExpire(fn)
+}
+
+// OnClose 注册全局 Manager 的 session 关闭回调
+func OnClose(fn CloseHook) {
+	gMgr.OnClose(fn)
+}
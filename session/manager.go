@@ -5,12 +5,19 @@ import (
 	"sync"
 	"time"
 
+	"github.com/lightmen/nami/alog"
 	"github.com/lightmen/nami/pkg/safe"
+	"github.com/lightmen/nami/pkg/timingwheel"
 )
 
 type Manager struct {
 	sessions sync.Map
-	ttlMilli int64 //session超时删除时间，单位豪秒
+	invalid  sync.Map // uid -> 调用 Invalidate 删除，等待重新加载的session
+	ttlMilli int64    //session超时删除时间，单位豪秒
+	wheel    *timingwheel.TimingWheel
+
+	hookLock sync.RWMutex
+	hooks    hooks
 }
 
 var gMgr *Manager
@@ -19,6 +26,20 @@ func init() {
 	gMgr = NewManager()
 }
 
+// lastTimer 记录最后访问时间的session，超过ttl没有访问会从内存中清掉
+type lastTimer interface {
+	GetLastTime() int64
+	SetLastTime(lastTime int64)
+}
+
+// flusher 超时清理前需要保存本地修改的session，返回错误时保留session稍后重试
+type flusher interface {
+	Flush() error
+}
+
+// flushRetryDelay 超时清理前保存失败的重试间隔
+const flushRetryDelay = 10 * time.Second
+
 type ManagerOption func(mgr *Manager)
 
 func WithTTL(ttlMilli int64) ManagerOption {
@@ -27,6 +48,13 @@ func WithTTL(ttlMilli int64) ManagerOption {
 	}
 }
 
+// WithTimingWheel 使用外部的时间轮清理超时的session，时间轮需要调用方启动
+func WithTimingWheel(tw *timingwheel.TimingWheel) ManagerOption {
+	return func(mgr *Manager) {
+		mgr.wheel = tw
+	}
+}
+
 func NewManager(opts ...ManagerOption) *Manager {
 	mgr := &Manager{
 		ttlMilli: 180000, //默认180秒,超过该时间的session会从内存中清掉
@@ -36,78 +64,170 @@ func NewManager(opts ...ManagerOption) *Manager {
 		op(mgr)
 	}
 
-	safe.Go(mgr.loop)
+	if mgr.wheel == nil {
+		mgr.wheel = timingwheel.New(time.Second, 64)
+		mgr.wheel.Start()
+	}
 	return mgr
 }
 
-func (mgr *Manager) loop() {
-	ticker := time.NewTicker(time.Second)
-	defer ticker.Stop()
-
-	for t := range ticker.C {
-		_ = t
-		mgr.cleanSession()
+// watch 在时间轮中添加session的超时检查，访问session时只更新最后访问时间，
+// 检查时没有超时则按剩余时间重新添加
+func (mgr *Manager) watch(s Session, delay time.Duration) {
+	if _, ok := s.(lastTimer); !ok {
+		return
 	}
+
+	mgr.wheel.AfterFunc(delay, func() {
+		mgr.check(s)
+	})
 }
 
-func (mgr *Manager) cleanSession() {
-	const (
-		maxScanCount = 1024
-		maxDelCount  = 256
-	)
-	delCount := 0
-	scanCount := 0
+func (mgr *Manager) check(s Session) {
+	if !mgr.expired(s) {
+		return
+	}
 
-	nowMilli := time.Now().UnixMilli()
+	f, ok := s.(flusher)
+	if !ok {
+		mgr.expire(s)
+		return
+	}
 
-	mgr.sessions.Range(func(key, val any) bool {
-		s := val.(*session)
-		lastTime := s.GetLastTime()
-		if nowMilli-lastTime >= mgr.ttlMilli {
-			mgr.sessions.Delete(key)
-			delCount++
+	// 保存可能有网络请求，不在时间轮的协程中执行
+	safe.Go(func() {
+		if err := f.Flush(); err != nil {
+			alog.Error("[session] flush session %s before expire error: %s", s.ID(), err.Error())
+			mgr.watch(s, flushRetryDelay)
+			return
 		}
-
-		if delCount >= maxDelCount {
-			return false
+		if mgr.expired(s) {
+			mgr.expire(s)
 		}
+	})
+}
 
-		scanCount++
-		if scanCount >= maxScanCount {
-			return false
-		}
+// expired 检查session是否超时，没有超时则按剩余时间重新添加检查
+func (mgr *Manager) expired(s Session) bool {
+	cur, ok := mgr.sessions.Load(s.ID())
+	if !ok || cur != s { //已经关闭或者被替换
+		return false
+	}
 
-		return true
-	})
+	idle := time.Now().UnixMilli() - s.(lastTimer).GetLastTime()
+	if idle < mgr.ttlMilli {
+		mgr.watch(s, time.Duration(mgr.ttlMilli-idle)*time.Millisecond)
+		return false
+	}
+	return true
+}
+
+func (mgr *Manager) expire(s Session) {
+	if mgr.sessions.CompareAndDelete(s.ID(), s) {
+		safe.Go(func() { mgr.fireExpire(s) })
+	}
 }
 
 // Get 根据uid返回玩家的session
-func (mgr *Manager) Get(uid string) (s *session, ok bool) {
+func (mgr *Manager) Get(uid string) (s Session, ok bool) {
 	val, ok := mgr.sessions.Load(uid)
 	if !ok {
 		return
 	}
 
-	s = val.(*session)
-	s.SetLastTime(time.Now().UnixMilli())
+	s = val.(Session)
+	if t, ok := s.(lastTimer); ok {
+		t.SetLastTime(time.Now().UnixMilli())
+	}
 	return
 }
 
-func (mgr *Manager) Set(s *session) {
+// Set 保存session，uid第一次加入时触发OnCreate回调，Invalidate 之后重新加载的session不触发
+func (mgr *Manager) Set(s Session) {
 	if s == nil {
 		return
 	}
-	mgr.sessions.Store(s.ID(), s)
+	old, loaded := mgr.sessions.Swap(s.ID(), s)
+	if !loaded {
+		if _, reload := mgr.invalid.LoadAndDelete(s.ID()); !reload {
+			mgr.fireCreate(s)
+		}
+	}
+	if old != s {
+		mgr.watch(s, time.Duration(mgr.ttlMilli)*time.Millisecond)
+	}
+}
+
+// Delete 从内存中删除uid的session，下次获取时由Factory重新创建，不触发回调
+func (mgr *Manager) Delete(uid string) {
+	mgr.sessions.Delete(uid)
+}
+
+// Invalidate 其他节点修改了session，从内存中删除，下次获取时由Factory重新加载，重新加载后Set不触发OnCreate。
+// 超过ttl没有重新加载时，对删除的session触发OnExpire
+func (mgr *Manager) Invalidate(uid string) {
+	val, ok := mgr.sessions.LoadAndDelete(uid)
+	if !ok {
+		return
+	}
+
+	s := val.(Session)
+	mgr.invalid.Store(uid, s)
+	mgr.wheel.AfterFunc(time.Duration(mgr.ttlMilli)*time.Millisecond, func() {
+		if mgr.invalid.CompareAndDelete(uid, s) {
+			safe.Go(func() { mgr.fireExpire(s) })
+		}
+	})
+}
+
+// Close 玩家登出，删除session并触发OnClose回调
+func (mgr *Manager) Close(uid string) bool {
+	return mgr.close(uid, CloseLogout)
+}
+
+// Kick 将玩家踢下线，删除session并触发OnClose回调
+func (mgr *Manager) Kick(uid string) bool {
+	return mgr.close(uid, CloseKick)
+}
+
+func (mgr *Manager) close(uid string, reason CloseReason) bool {
+	val, ok := mgr.sessions.LoadAndDelete(uid)
+	if !ok {
+		// 失效后还没有重新加载
+		if val, ok = mgr.invalid.LoadAndDelete(uid); !ok {
+			return false
+		}
+	}
+
+	mgr.fireClose(val.(Session), reason)
+	return true
 }
 
-func Get(uid string) (s *session, ok bool) {
+// DefaultManager 返回全局的Manager
+func DefaultManager() *Manager {
+	return gMgr
+}
+
+func Get(uid string) (s Session, ok bool) {
 	return gMgr.Get(uid)
 }
 
-func Set(s *session) {
+func Set(s Session) {
 	gMgr.Set(s)
 }
 
+func Delete(uid string) {
+	gMgr.Delete(uid)
+}
+
+func Close(uid string) bool {
+	return gMgr.Close(uid)
+}
+
+func Kick(uid string) bool {
+	return gMgr.Kick(uid)
+}
+
 // GetForce 根据uid获取session，如果不存在则创建一个
 func GetForce(ctx context.Context, uid string) (s Session) {
 	s, ok := Get(uid)
@@ -0,0 +1,224 @@
+package session
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lightmen/nami/pkg/timingwheel"
+)
+
+type recorder struct {
+	lk     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(e string) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.events = append(r.events, e)
+}
+
+func TestManagerHooks(t *testing.T) {
+	tw := timingwheel.New(time.Millisecond, 8)
+	tw.Start()
+	defer tw.Stop()
+
+	mgr := NewManager(WithTTL(50), WithTimingWheel(tw))
+	r := &recorder{}
+	mgr.OnCreate(func(s Session) { r.add("create:" + s.ID()) })
+	mgr.OnExpire(func(s Session) {
+		if _, ok := s.Get("level"); !ok {
+			t.Error("data cleared before expire hook")
+		}
+		r.add("expire:" + s.ID())
+	})
+	mgr.OnClose(func(s Session, reason CloseReason) { r.add(reason.String() + ":" + s.ID()) })
+
+	s1 := &session{id: "u1"}
+	s1.SetLastTime(time.Now().UnixMilli())
+	s1.Set("level", 10)
+	mgr.Set(s1)
+	mgr.Set(s1) // 重复设置不触发create
+
+	s2 := &session{id: "u2"}
+	s2.SetLastTime(time.Now().UnixMilli())
+	mgr.Set(s2)
+	s3 := &session{id: "u3"}
+	s3.SetLastTime(time.Now().UnixMilli())
+	mgr.Set(s3)
+
+	if !mgr.Close("u2") || mgr.Close("u2") {
+		t.Fatal("close u2 should succeed once")
+	}
+	if !mgr.Kick("u3") {
+		t.Fatal("kick u3 failed")
+	}
+
+	// 访问之后重新计时
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := mgr.Get("u1"); !ok {
+		t.Fatal("u1 should not expire")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := s1.Get("level"); !ok {
+		t.Fatal("u1 should not expire after touch")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, ok := s1.Get("level")
+		if !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("u1 should expire")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, ok := mgr.sessions.Load("u1"); ok {
+		t.Fatal("u1 should be deleted")
+	}
+
+	want := []string{"create:u1", "create:u2", "create:u3", "logout:u2", "kick:u3", "expire:u1"}
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	if len(r.events) != len(want) {
+		t.Fatalf("events = %v, want %v", r.events, want)
+	}
+	for i := range want {
+		if r.events[i] != want[i] {
+			t.Fatalf("events = %v, want %v", r.events, want)
+		}
+	}
+}
+
+func TestManagerInvalidate(t *testing.T) {
+	tw := timingwheel.New(time.Millisecond, 8)
+	tw.Start()
+	defer tw.Stop()
+
+	mgr := NewManager(WithTTL(50), WithTimingWheel(tw))
+	r := &recorder{}
+	mgr.OnCreate(func(s Session) { r.add("create:" + s.ID()) })
+	mgr.OnExpire(func(s Session) { r.add("expire:" + s.ID()) })
+
+	s1 := &session{id: "u1"}
+	s1.SetLastTime(time.Now().UnixMilli())
+	mgr.Set(s1)
+
+	// 失效后重新加载不触发create
+	mgr.Invalidate("u1")
+	if _, ok := mgr.Get("u1"); ok {
+		t.Fatal("u1 should be deleted")
+	}
+	reload := &session{id: "u1"}
+	reload.SetLastTime(time.Now().UnixMilli())
+	mgr.Set(reload)
+	if !mgr.Close("u1") {
+		t.Fatal("close u1 failed")
+	}
+
+	// 失效后没有重新加载，超时触发expire
+	s2 := &session{id: "u2"}
+	s2.SetLastTime(time.Now().UnixMilli())
+	mgr.Set(s2)
+	mgr.Invalidate("u2")
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		r.lk.Lock()
+		n := len(r.events)
+		r.lk.Unlock()
+		if n == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("events = %v", r.events)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	want := []string{"create:u1", "create:u2", "expire:u2"}
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	for i := range want {
+		if r.events[i] != want[i] {
+			t.Fatalf("events = %v, want %v", r.events, want)
+		}
+	}
+}
+
+// flushSession 超时清理前需要保存的session，第一次保存失败
+type flushSession struct {
+	session
+	lk      sync.Mutex
+	flushes int
+}
+
+func (s *flushSession) Flush() error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.flushes++
+	if s.flushes == 1 {
+		return errors.New("redis down")
+	}
+	return nil
+}
+
+func TestManagerFlushBeforeExpire(t *testing.T) {
+	tw := timingwheel.New(time.Millisecond, 8)
+	tw.Start()
+	defer tw.Stop()
+
+	mgr := NewManager(WithTTL(20), WithTimingWheel(tw))
+	expired := make(chan int, 1)
+	s := &flushSession{session: session{id: "u1"}}
+	mgr.OnExpire(func(Session) {
+		s.lk.Lock()
+		defer s.lk.Unlock()
+		expired <- s.flushes
+	})
+	s.SetLastTime(time.Now().UnixMilli())
+	mgr.Set(s)
+
+	// 第一次保存失败，保留session等待重试
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := mgr.sessions.Load("u1"); !ok {
+		t.Fatal("session should be kept after flush error")
+	}
+
+	mgr.check(s)
+	select {
+	case n := <-expired:
+		if n != 2 {
+			t.Fatalf("flushes = %d, want 2", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("session should expire after flush")
+	}
+}
+
+type item struct {
+	ID int
+}
+
+func TestGetAs(t *testing.T) {
+	s := &session{id: "u1"}
+	s.Set("level", 10)
+	s.Set("item", item{ID: 1})
+
+	if v, ok := GetAs[int](s, "level"); !ok || v != 10 {
+		t.Fatalf("level = %v, %v", v, ok)
+	}
+	if _, ok := GetAs[string](s, "level"); ok {
+		t.Fatal("level is not string")
+	}
+	if v, ok := GetAs[item](s, "item"); !ok || v.ID != 1 {
+		t.Fatalf("item = %v, %v", v, ok)
+	}
+	if v := GetOr(s, "none", 5); v != 5 {
+		t.Fatalf("none = %v", v)
+	}
+}
@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"time"
+
+	"github.com/lightmen/nami/pkg/random"
+	"github.com/lightmen/nami/session"
+)
+
+// Option is redis session store option.
+type Option func(o *options)
+
+type options struct {
+	prefix  string
+	channel string
+	node    string
+	ttl     time.Duration
+	codec   Codec
+	manager *session.Manager
+}
+
+func defaultOptions() *options {
+	return &options{
+		prefix:  "nami:session:",
+		channel: "nami:session:invalidate",
+		node:    random.String(16),
+		ttl:     24 * time.Hour,
+		codec:   JSONCodec{},
+		manager: session.DefaultManager(),
+	}
+}
+
+// Prefix session 在 redis 中的 key 前缀
+func Prefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// Channel 失效通知的 channel，其他节点写入 session 后通知本节点从本地缓存中删除
+func Channel(channel string) Option {
+	return func(o *options) {
+		o.channel = channel
+	}
+}
+
+// Node 本节点的标识，用于忽略自己发出的失效通知，默认随机生成
+func Node(node string) Option {
+	return func(o *options) {
+		o.node = node
+	}
+}
+
+// TTL session 在 redis 中的过期时间，每次保存时刷新，小于等于0时不过期
+func TTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// WithCodec 设置 session 数据的编解码
+func WithCodec(c Codec) Option {
+	return func(o *options) {
+		o.codec = c
+	}
+}
+
+// WithManager 设置本地缓存 session 的 Manager，默认为全局的 Manager
+func WithManager(mgr *session.Manager) Option {
+	return func(o *options) {
+		o.manager = mgr
+	}
+}
@@ -0,0 +1,165 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lightmen/nami/alog"
+	"github.com/lightmen/nami/session"
+)
+
+var _ session.Session = (*Session)(nil)
+
+// flushTimeout 超时清理前保存的超时时间
+const flushTimeout = 5 * time.Second
+
+// Session 保存在 redis 中的 session，Set 只修改本地数据，调用 Save 写入 redis
+type Session struct {
+	id       string
+	store    *Store
+	lastTime atomic.Int64
+
+	lk      sync.RWMutex
+	version int64               // redis 中数据的版本，保存时版本不一致返回 ErrConflict
+	raw     map[string][]byte   // redis 中的数据
+	values  map[string]any      // 解码后的数据和本地修改的数据
+	dirty   map[string]struct{} // 本地修改，还没有保存的 key
+	err     error               // 加载失败的错误，不为 nil 时不能保存
+}
+
+func newSession(store *Store, id string) *Session {
+	s := &Session{
+		id:     id,
+		store:  store,
+		raw:    make(map[string][]byte),
+		values: make(map[string]any),
+		dirty:  make(map[string]struct{}),
+	}
+	s.SetLastTime(time.Now().UnixMilli())
+	return s
+}
+
+// fieldKey session 的 key 转换为 redis hash 的 field
+func fieldKey(key any) string {
+	if k, ok := key.(string); ok {
+		return k
+	}
+	return fmt.Sprint(key)
+}
+
+func (s *Session) ID() string {
+	return s.id
+}
+
+// Get 返回 key 对应的值，redis 中加载的数据解码为 any，需要具体类型时使用 Decode
+func (s *Session) Get(key any) (val any, ok bool) {
+	k := fieldKey(key)
+
+	s.lk.RLock()
+	val, ok = s.values[k]
+	s.lk.RUnlock()
+	if ok {
+		return
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if val, ok = s.values[k]; ok {
+		return
+	}
+
+	data, ok := s.raw[k]
+	if !ok {
+		return
+	}
+	if err := s.store.opts.codec.Unmarshal(data, &val); err != nil {
+		return nil, false
+	}
+	s.values[k] = val
+	return
+}
+
+// Decode 将 key 对应的值解码到 v 中
+func (s *Session) Decode(key any, v any) (ok bool, err error) {
+	k := fieldKey(key)
+
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+
+	data, ok := s.raw[k]
+	if _, dirty := s.dirty[k]; dirty {
+		if data, err = s.store.opts.codec.Marshal(s.values[k]); err != nil {
+			return
+		}
+		ok = true
+	}
+	if !ok {
+		return
+	}
+
+	err = s.store.opts.codec.Unmarshal(data, v)
+	return
+}
+
+func (s *Session) Set(key, val any) {
+	k := fieldKey(key)
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	s.values[k] = val
+	s.dirty[k] = struct{}{}
+}
+
+// Clear 清除本地的数据，不影响 redis 中的数据
+func (s *Session) Clear() {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	clear(s.raw)
+	clear(s.values)
+	clear(s.dirty)
+}
+
+// Err 返回从 redis 加载时的错误，加载失败的 session 是空的，保存时返回 ErrNotLoaded
+func (s *Session) Err() error {
+	return s.err
+}
+
+// Version 返回 redis 中数据的版本，没有保存过时为0
+func (s *Session) Version() int64 {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+	return s.version
+}
+
+// Save 将本地修改写入 redis，其他节点先写入时返回 ErrConflict
+func (s *Session) Save(ctx context.Context) error {
+	return s.store.Save(ctx, s)
+}
+
+// Flush 保存本地修改，Manager 超时清理前调用，版本冲突时放弃本地修改
+func (s *Session) Flush() error {
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	err := s.Save(ctx)
+	if errors.Is(err, ErrConflict) {
+		alog.Error("[session][redis] flush session %s conflict, local changes dropped", s.id)
+		return nil
+	}
+	return err
+}
+
+func (s *Session) GetLastTime() int64 {
+	return s.lastTime.Load()
+}
+
+func (s *Session) SetLastTime(lastTime int64) {
+	s.lastTime.Store(lastTime)
+}
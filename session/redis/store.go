@@ -0,0 +1,246 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	redigo "github.com/garyburd/redigo/redis"
+	"github.com/lightmen/nami/alog"
+	"github.com/lightmen/nami/pkg/redispool"
+	"github.com/lightmen/nami/session"
+)
+
+var _ session.Factory = (*Store)(nil)
+
+var (
+	// ErrConflict 保存时 redis 中的版本已经被其他节点修改，需要 Reload 后重试
+	ErrConflict = errors.New("session version conflict")
+	// ErrNotLoaded session 从 redis 加载失败，不能保存，避免覆盖 redis 中的数据
+	ErrNotLoaded = errors.New("session not loaded")
+)
+
+const (
+	versionField = "_version"
+	dataPrefix   = "d:"
+)
+
+// saveScript 版本一致时写入数据，版本加1并通知其他节点
+// KEYS[1] session key
+// ARGV[1] 期望的版本，ARGV[2] 过期毫秒，ARGV[3] channel，ARGV[4] 通知消息前缀，ARGV[5:] field value
+var saveScript = redigo.NewScript(1, `
+local v = tonumber(redis.call('HGET', KEYS[1], '`+versionField+`') or '0')
+if v ~= tonumber(ARGV[1]) then
+	return -1
+end
+v = v + 1
+redis.call('HSET', KEYS[1], '`+versionField+`', v)
+for i = 5, #ARGV, 2 do
+	redis.call('HSET', KEYS[1], ARGV[i], ARGV[i+1])
+end
+if tonumber(ARGV[2]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+redis.call('PUBLISH', ARGV[3], ARGV[4] .. v)
+return v
+`)
+
+// Store 基于 redispool 的 session.Factory，session 数据保存在 redis 的 hash 中，
+// 本地的 session.Manager 作为缓存，其他节点写入后从本地缓存中删除，下次使用时重新加载
+type Store struct {
+	opts *options
+	pool *redispool.Pool
+	sub  *redispool.Subscriber
+}
+
+// NewStore 创建 redis session store，使用 session.RegisterFactory 注册后 session.GetForce 从 redis 加载
+func NewStore(pool *redispool.Pool, opts ...Option) *Store {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	s := &Store{
+		opts: o,
+		pool: pool,
+	}
+
+	// 订阅使用独立的连接，断开后自动重连
+	s.sub = pool.NewSubscriber(func(msg *redispool.Message) {
+		s.invalidate(string(msg.Data))
+	})
+	_ = s.sub.Subscribe(o.channel)
+	return s
+}
+
+// Get 实现 session.Factory，加载失败时返回空的 session，不放入本地缓存，下次 Get 时重新加载。
+// 加载失败的 session 保存时返回 ErrNotLoaded，可以通过 Session.Err 检查
+func (s *Store) Get(ctx context.Context, id string) session.Session {
+	if sess, ok := s.opts.manager.Get(id); ok {
+		return sess
+	}
+
+	sess, err := s.Load(ctx, id)
+	if err != nil {
+		alog.ErrorCtx(ctx, "[session][redis] load session %s error: %s", id, err.Error())
+		sess = newSession(s, id)
+		sess.err = err
+		return sess
+	}
+
+	s.opts.manager.Set(sess)
+	return sess
+}
+
+// Load 从 redis 加载 session，不存在时返回空的 session
+func (s *Store) Load(ctx context.Context, id string) (*Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	cli, err := s.pool.GetClient()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Put()
+
+	fields, err := redigo.ByteSlices(cli.Do("HGETALL", s.key(id)))
+	if err != nil {
+		return nil, err
+	}
+
+	sess := newSession(s, id)
+	for i := 0; i+1 < len(fields); i += 2 {
+		field := string(fields[i])
+		if field == versionField {
+			if sess.version, err = strconv.ParseInt(string(fields[i+1]), 10, 64); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if k, ok := strings.CutPrefix(field, dataPrefix); ok {
+			sess.raw[k] = fields[i+1]
+		}
+	}
+
+	return sess, nil
+}
+
+// Reload 重新从 redis 加载 session 并替换本地缓存
+func (s *Store) Reload(ctx context.Context, id string) (*Session, error) {
+	sess, err := s.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.opts.manager.Set(sess)
+	return sess, nil
+}
+
+// Save 将 session 的本地修改写入 redis
+func (s *Store) Save(ctx context.Context, sess *Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	sess.lk.Lock()
+	defer sess.lk.Unlock()
+
+	if sess.err != nil {
+		return fmt.Errorf("%w: %w", ErrNotLoaded, sess.err)
+	}
+	if len(sess.dirty) == 0 {
+		return nil
+	}
+
+	encoded := make(map[string][]byte, len(sess.dirty))
+	args := make([]any, 0, 5+2*len(sess.dirty))
+	args = append(args, s.key(sess.id), sess.version, s.opts.ttl.Milliseconds(),
+		s.opts.channel, s.opts.node+"|"+sess.id+"|")
+	for k := range sess.dirty {
+		data, err := s.opts.codec.Marshal(sess.values[k])
+		if err != nil {
+			return err
+		}
+		encoded[k] = data
+		args = append(args, dataPrefix+k, data)
+	}
+
+	cli, err := s.pool.GetClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Put()
+
+	version, err := redigo.Int64(saveScript.Do(cli.Conn, args...))
+	if err != nil {
+		return err
+	}
+	if version < 0 {
+		return ErrConflict
+	}
+
+	for k, data := range encoded {
+		sess.raw[k] = data
+	}
+	clear(sess.dirty)
+	sess.version = version
+	return nil
+}
+
+// Delete 删除 redis 和本地缓存中的 session
+func (s *Store) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.opts.manager.Delete(id)
+
+	cli, err := s.pool.GetClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Put()
+
+	if _, err = cli.Do("DEL", s.key(id)); err != nil {
+		return err
+	}
+	_, err = cli.Do("PUBLISH", s.opts.channel, s.opts.node+"|"+id+"|0")
+	return err
+}
+
+// Close 停止接收失效通知
+func (s *Store) Close() error {
+	return s.sub.Close()
+}
+
+func (s *Store) key(id string) string {
+	return s.opts.prefix + id
+}
+
+// invalidate 处理失效通知，消息格式为 node|id|version
+func (s *Store) invalidate(msg string) {
+	node, rest, ok := strings.Cut(msg, "|")
+	if !ok || node == s.opts.node {
+		return
+	}
+
+	i := strings.LastIndexByte(rest, '|')
+	if i < 0 {
+		return
+	}
+	id := rest[:i]
+	version, err := strconv.ParseInt(rest[i+1:], 10, 64)
+	if err != nil {
+		return
+	}
+
+	if cached, ok := s.opts.manager.Get(id); ok {
+		if sess, ok := cached.(*Session); ok && version > 0 && sess.Version() >= version {
+			return
+		}
+		s.opts.manager.Invalidate(id)
+	}
+}
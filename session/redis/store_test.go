@@ -0,0 +1,206 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lightmen/nami/pkg/random"
+	"github.com/lightmen/nami/pkg/redispool"
+	"github.com/lightmen/nami/session"
+)
+
+type player struct {
+	Name  string `json:"name"`
+	Level int    `json:"level"`
+}
+
+func TestSessionDecode(t *testing.T) {
+	s := newSession(&Store{opts: defaultOptions()}, "u1")
+	s.raw["player"] = []byte(`{"name":"a","level":3}`)
+
+	val, ok := s.Get("player")
+	if !ok || val.(map[string]any)["name"] != "a" {
+		t.Fatalf("get = %v, %v", val, ok)
+	}
+
+	var p player
+	if ok, err := s.Decode("player", &p); !ok || err != nil || p.Level != 3 {
+		t.Fatalf("decode = %v, %v, %v", p, ok, err)
+	}
+
+	s.Set("player", player{Name: "b", Level: 4})
+	if ok, err := s.Decode("player", &p); !ok || err != nil || p.Name != "b" {
+		t.Fatalf("decode dirty = %v, %v, %v", p, ok, err)
+	}
+
+	if _, ok := s.Get("none"); ok {
+		t.Fatal("get none should fail")
+	}
+}
+
+// newTestPool 需要设置 NAMI_REDIS_ADDR 环境变量指定 redis 地址
+func newTestPool(t *testing.T) *redispool.Pool {
+	addr := os.Getenv("NAMI_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("NAMI_REDIS_ADDR not set")
+	}
+
+	pool, err := redispool.NewPool(addr, os.Getenv("NAMI_REDIS_PASS"), 2, 16, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func TestStore(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	prefix := "nami:test:" + random.String(8) + ":"
+	channel := prefix + "invalidate"
+
+	mgr1 := session.NewManager()
+	mgr2 := session.NewManager()
+	store1 := NewStore(pool, Prefix(prefix), Channel(channel), WithManager(mgr1))
+	store2 := NewStore(pool, Prefix(prefix), Channel(channel), WithManager(mgr2))
+	defer store1.Close()
+	defer store2.Close()
+	defer store1.Delete(ctx, "u1")
+
+	// 等待订阅完成
+	time.Sleep(200 * time.Millisecond)
+
+	s1 := store1.Get(ctx, "u1").(*Session)
+	s1.Set("player", player{Name: "a", Level: 1})
+	if err := s1.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	s2 := store2.Get(ctx, "u1").(*Session)
+	var p player
+	if ok, err := s2.Decode("player", &p); !ok || err != nil || p.Name != "a" {
+		t.Fatalf("decode = %v, %v, %v", p, ok, err)
+	}
+
+	s2.Set("player", player{Name: "a", Level: 2})
+	if err := s2.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// s1 的版本已经过期
+	s1.Set("player", player{Name: "a", Level: 3})
+	if err := s1.Save(ctx); !errors.Is(err, ErrConflict) {
+		t.Fatalf("save = %v, want ErrConflict", err)
+	}
+
+	// 收到失效通知后从本地缓存删除
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := mgr1.Get("u1"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("session not invalidated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s1 = store1.Get(ctx, "u1").(*Session)
+	if s1.Version() != 2 {
+		t.Fatalf("version = %d, want 2", s1.Version())
+	}
+}
+
+func TestSessionGetAs(t *testing.T) {
+	s := newSession(&Store{opts: defaultOptions()}, "u1")
+	s.raw["player"] = []byte(`{"name":"a","level":3}`)
+
+	p, ok := session.GetAs[player](s, "player")
+	if !ok || p.Level != 3 {
+		t.Fatalf("get as = %v, %v", p, ok)
+	}
+
+	s.Clear()
+	if _, ok := session.GetAs[player](s, "player"); ok {
+		t.Fatal("data should be cleared")
+	}
+}
+
+// newBrokenPool 只响应 PING 的 redis 服务，其他命令都返回错误，模拟 redis 故障
+func newBrokenPool(t *testing.T) *redispool.Pool {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+			go serveBroken(conn)
+		}
+	}()
+
+	pool, err := redispool.NewPool(l.Addr().String(), "", 2, 16, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func serveBroken(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			if _, err = r.ReadString('\n'); err != nil {
+				return
+			}
+			arg, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			args = append(args, strings.TrimSpace(arg))
+		}
+		if len(args) > 0 && strings.EqualFold(args[0], "PING") {
+			conn.Write([]byte("+PONG\r\n"))
+		} else {
+			conn.Write([]byte("-ERR redis down\r\n"))
+		}
+	}
+}
+
+func TestStoreLoadError(t *testing.T) {
+	mgr := session.NewManager()
+	store := NewStore(newBrokenPool(t), WithManager(mgr))
+	defer store.Close()
+
+	ctx := context.Background()
+	s := store.Get(ctx, "u1").(*Session)
+	if s.Err() == nil {
+		t.Fatal("load should fail")
+	}
+	if _, ok := mgr.Get("u1"); ok {
+		t.Fatal("session should not be cached on load error")
+	}
+
+	s.Set("player", player{Name: "a"})
+	if err := s.Save(ctx); !errors.Is(err, ErrNotLoaded) {
+		t.Fatalf("save = %v, want ErrNotLoaded", err)
+	}
+}
@@ -51,6 +51,11 @@ func (s *session) Set(key, val any) {
 	s.data.Store(key, val)
 }
 
+// Clear 清除session中的数据
+func (s *session) Clear() {
+	s.data.Clear()
+}
+
 // UID returns uid that bind to current session
 func (s *session) ID() string {
 	return s.id
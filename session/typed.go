@@ -0,0 +1,32 @@
+package session
+
+// decoder 可以将数据解码为具体类型的 session，比如保存在 redis 中的 session
+type decoder interface {
+	Decode(key any, v any) (ok bool, err error)
+}
+
+// GetAs 返回 key 对应的类型为 T 的值，类型不匹配时返回 false
+func GetAs[T any](s Session, key any) (val T, ok bool) {
+	v, ok := s.Get(key)
+	if !ok {
+		return
+	}
+
+	if val, ok = v.(T); ok {
+		return
+	}
+
+	if d, isDecoder := s.(decoder); isDecoder {
+		found, err := d.Decode(key, &val)
+		ok = found && err == nil
+	}
+	return
+}
+
+// GetOr 返回 key 对应的类型为 T 的值，不存在或类型不匹配时返回 def
+func GetOr[T any](s Session, key any, def T) T {
+	if val, ok := GetAs[T](s, key); ok {
+		return val
+	}
+	return def
+}
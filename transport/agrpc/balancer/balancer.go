@@ -7,6 +7,30 @@ import (
 
 func init() {
 	//默认使用一致性hash
-	b := base.NewBalancerBuilder(Mix, &mixPickerBuilder{}, base.Config{HealthCheck: true})
+	balancer.Register(&mixBalancerBuilder{})
+}
+
+// Register 使用可选参数重新注册 mix 负载，只对之后创建的 ClientConn 生效，一般在 init 中调用
+func Register(opts ...Option) {
+	b := &mixBalancerBuilder{}
+	for _, opt := range opts {
+		opt(&b.opts)
+	}
 	balancer.Register(b)
 }
+
+// mixBalancerBuilder 为每个 ClientConn 创建独立的 mixPickerBuilder，使负载状态不在不同的服务之间共享
+type mixBalancerBuilder struct {
+	opts options
+}
+
+func (b *mixBalancerBuilder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	pb := newMixPickerBuilder(b.opts)
+	pb.target = opts.Target.Endpoint()
+	bb := base.NewBalancerBuilder(Mix, pb, base.Config{HealthCheck: true})
+	return bb.Build(cc, opts)
+}
+
+func (b *mixBalancerBuilder) Name() string {
+	return Mix
+}
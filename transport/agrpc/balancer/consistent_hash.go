@@ -2,13 +2,34 @@ package balancer
 
 import (
 	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
 
 	"github.com/lightmen/nami/pkg/hash/ketama"
+	"github.com/lightmen/nami/transport/agrpc/resolver/discovery"
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
 )
 
+// consistentHashPickerBuilder 在多次 Build 之间复用 hash 环，节点变化时只增删变化的节点
 type consistentHashPickerBuilder struct {
+	sync.Mutex
+	hash     *ketama.Ketama
+	weights  map[string]int    // 环上的节点及其权重
+	loads    map[string]*int64 // 节点正在处理的请求数
+	inflight int64             // 所有节点正在处理的请求数
+
+	loadFactor float64 // 负载上限系数，小于等于 0 时不限制负载，见 WithBoundedLoad
+}
+
+func newConsistentHashPickerBuilder(loadFactor float64) *consistentHashPickerBuilder {
+	return &consistentHashPickerBuilder{
+		hash:       ketama.New(),
+		weights:    make(map[string]int),
+		loads:      make(map[string]*int64),
+		loadFactor: loadFactor,
+	}
 }
 
 func (b *consistentHashPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
@@ -16,23 +37,58 @@ func (b *consistentHashPickerBuilder) Build(info base.PickerBuildInfo) balancer.
 		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
 	}
 
+	b.Lock()
+	defer b.Unlock()
+
 	picker := &consistentHashPicker{
-		subConns: make(map[string]balancer.SubConn, len(info.ReadySCs)),
-		hash:     ketama.New(),
+		subConns:   make(map[string]balancer.SubConn, len(info.ReadySCs)),
+		loads:      make(map[string]*int64, len(info.ReadySCs)),
+		weights:    make(map[string]int, len(info.ReadySCs)),
+		hash:       b.hash,
+		inflight:   &b.inflight,
+		loadFactor: b.loadFactor,
 	}
 
-	for sc, conInfo := range info.ReadySCs {
+	for sc, conInfo := range upSubConns(info.ReadySCs) {
 		node := conInfo.Address.Addr
-		picker.hash.Add(node)
 		picker.subConns[node] = sc
+		picker.weights[node] = discovery.GetAttributes(conInfo.Address).Weight
+	}
+
+	// 移除下线和权重变化的节点
+	for node, weight := range b.weights {
+		if w, ok := picker.weights[node]; !ok || w != weight {
+			b.hash.Remove(node)
+			delete(b.weights, node)
+			if !ok {
+				delete(b.loads, node)
+			}
+		}
+	}
+
+	for node, weight := range picker.weights {
+		if _, ok := b.weights[node]; !ok {
+			b.hash.AddWithWeight(node, weight)
+			b.weights[node] = weight
+		}
+		if _, ok := b.loads[node]; !ok {
+			b.loads[node] = new(int64)
+		}
+		picker.loads[node] = b.loads[node]
+		picker.totalWeight += normalizeWeight(weight)
 	}
 
 	return picker
 }
 
 type consistentHashPicker struct {
-	subConns map[string]balancer.SubConn
-	hash     *ketama.Ketama
+	subConns    map[string]balancer.SubConn
+	loads       map[string]*int64
+	weights     map[string]int
+	totalWeight int
+	hash        *ketama.Ketama
+	inflight    *int64
+	loadFactor  float64
 }
 
 func (p *consistentHashPicker) Pick(info balancer.PickInfo) (result balancer.PickResult, err error) {
@@ -42,14 +98,70 @@ func (p *consistentHashPicker) Pick(info balancer.PickInfo) (result balancer.Pic
 		return
 	}
 
-	targetAddr, ok := p.hash.Get(key)
-	if ok {
-		result.SubConn = p.subConns[targetAddr]
+	var target, first string
+	p.hash.Walk(key, func(node string) bool {
+		// hash 环已经被新的 Build 修改，节点不属于当前 picker
+		if _, ok := p.subConns[node]; !ok {
+			return true
+		}
+		if first == "" {
+			first = node
+		}
+		if p.underLoad(node) {
+			target = node
+			return false
+		}
+		return true
+	})
+
+	if target == "" {
+		target = first
+	}
+	if target == "" {
+		err = balancer.ErrNoSubConnAvailable
+		return
 	}
 
+	load := p.loads[target]
+	atomic.AddInt64(load, 1)
+	atomic.AddInt64(p.inflight, 1)
+
+	result.SubConn = p.subConns[target]
+	result.Done = func(balancer.DoneInfo) {
+		atomic.AddInt64(load, -1)
+		atomic.AddInt64(p.inflight, -1)
+	}
 	return
 }
 
+// underLoad 节点再处理一个请求后是否仍不超过负载上限 ceil(c * (inflight+1) * weight / totalWeight)
+func (p *consistentHashPicker) underLoad(node string) bool {
+	if p.loadFactor <= 0 {
+		return true
+	}
+
+	inflight := atomic.LoadInt64(p.inflight) + 1
+	share := float64(normalizeWeight(p.weights[node])) / float64(p.totalWeight)
+	limit := int64(math.Ceil(p.loadFactor * float64(inflight) * share))
+
+	return atomic.LoadInt64(p.loads[node])+1 <= limit
+}
+
 func (p *consistentHashPicker) Name() string {
 	return Consistent
 }
+
+// upSubConns 过滤掉 DRAINING 和 DOWN 状态的节点，如果所有节点都不可用，返回全部节点
+func upSubConns(readySCs map[balancer.SubConn]base.SubConnInfo) map[balancer.SubConn]base.SubConnInfo {
+	ups := make(map[balancer.SubConn]base.SubConnInfo, len(readySCs))
+	for sc, info := range readySCs {
+		if discovery.GetAttributes(info.Address).IsUp() {
+			ups[sc] = info
+		}
+	}
+
+	if len(ups) == 0 {
+		return readySCs
+	}
+	return ups
+}
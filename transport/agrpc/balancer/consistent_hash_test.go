@@ -2,14 +2,20 @@ package balancer
 
 import (
 	"context"
+	"math"
 	"testing"
 
+	"github.com/lightmen/nami/pkg/cast"
+	"github.com/lightmen/nami/registry"
+	"github.com/lightmen/nami/transport/agrpc/resolver/discovery"
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
 	"google.golang.org/grpc/resolver"
 )
 
-type mockConn struct{}
+type mockConn struct {
+	id int // 非空结构体，保证每个 mockConn 的地址不同
+}
 
 func (mc *mockConn) UpdateAddresses([]resolver.Address) {
 
@@ -23,8 +29,12 @@ func (mc *mockConn) GetOrBuildProducer(balancer.ProducerBuilder) (p balancer.Pro
 	return
 }
 
+func (mc *mockConn) Shutdown() {
+
+}
+
 func Test_consistentHashPicker(t *testing.T) {
-	b := &consistentHashPickerBuilder{}
+	b := newConsistentHashPickerBuilder(0)
 
 	mc := &mockConn{}
 
@@ -48,7 +58,7 @@ func Test_consistentHashPicker(t *testing.T) {
 		t.Fatalf("Pick got error: %v", err)
 	}
 
-	if result.SubConn != mc {
+	if result.SubConn != balancer.SubConn(mc) {
 		t.Fatalf("expect %v, got: %v", mc, result.SubConn)
 	}
 
@@ -60,3 +70,139 @@ func Test_consistentHashPicker(t *testing.T) {
 		t.Fatalf("expect error, but error is nil")
 	}
 }
+
+func Test_consistentHashPickerSkipDraining(t *testing.T) {
+	b := newConsistentHashPickerBuilder(0)
+
+	up := &mockConn{}
+	draining := &mockConn{}
+
+	info := base.PickerBuildInfo{
+		ReadySCs: map[balancer.SubConn]base.SubConnInfo{
+			up: {
+				Address: discoveryAddress("127.0.0.1:12454", &registry.Instance{Status: registry.StatusUp}),
+			},
+			draining: {
+				Address: discoveryAddress("127.0.0.1:12455", &registry.Instance{Status: registry.StatusDraining}),
+			},
+		},
+	}
+	picker := b.Build(info)
+
+	for i := 0; i < 100; i++ {
+		result, err := picker.Pick(balancer.PickInfo{
+			Ctx: NewParamContext(context.Background(), cast.ToString(i)),
+		})
+		if err != nil {
+			t.Fatalf("Pick got error: %v", err)
+		}
+		if result.SubConn != balancer.SubConn(up) {
+			t.Fatalf("picked draining subConn")
+		}
+	}
+}
+
+func Test_upSubConns(t *testing.T) {
+	draining := &mockConn{}
+	readySCs := map[balancer.SubConn]base.SubConnInfo{
+		draining: {
+			Address: discoveryAddress("127.0.0.1:12455", &registry.Instance{Status: registry.StatusDraining}),
+		},
+	}
+
+	// 全部节点都不可用时，使用所有节点
+	if got := upSubConns(readySCs); len(got) != 1 {
+		t.Fatalf("expect 1 subConn, got: %d", len(got))
+	}
+}
+
+// discoveryAddress 生成带节点信息的地址
+func discoveryAddress(addr string, ins *registry.Instance) resolver.Address {
+	return discovery.SetAttributes(resolver.Address{Addr: addr}, discovery.Attributes{
+		Weight: ins.GetWeight(),
+		Status: ins.GetStatus(),
+	})
+}
+
+func Test_consistentHashPickerBoundedLoad(t *testing.T) {
+	info, conns := newBuildInfo(100, 100, 100, 100)
+	picker := newConsistentHashPickerBuilder(1.25).Build(info)
+
+	// 同一个热点 key 的请求一直在处理，超过负载上限后分散到其他节点
+	ctx := NewParamContext(context.Background(), "hotPlayer")
+	count := make(map[balancer.SubConn]int)
+	for i := 0; i < 100; i++ {
+		result, err := picker.Pick(balancer.PickInfo{Ctx: ctx})
+		if err != nil {
+			t.Fatalf("Pick got error: %v", err)
+		}
+		count[result.SubConn]++
+	}
+
+	limit := int(math.Ceil(1.25 * 100 / 4))
+	for _, mc := range conns {
+		if count[mc] > limit {
+			t.Fatalf("load exceed limit %d: %v", limit, count)
+		}
+	}
+}
+
+func Test_consistentHashPickerIncremental(t *testing.T) {
+	b := newConsistentHashPickerBuilder(0)
+	info, conns := newBuildInfo(100, 100, 100)
+
+	pickAll := func(picker balancer.Picker) map[string]balancer.SubConn {
+		picked := make(map[string]balancer.SubConn)
+		for i := 0; i < 1000; i++ {
+			key := cast.ToString(i)
+			result, err := picker.Pick(balancer.PickInfo{Ctx: NewParamContext(context.Background(), key)})
+			if err != nil {
+				t.Fatalf("Pick got error: %v", err)
+			}
+			result.Done(balancer.DoneInfo{})
+			picked[key] = result.SubConn
+		}
+		return picked
+	}
+
+	before := pickAll(b.Build(info))
+	ring := b.hash
+
+	// 移除一个节点，只有该节点上的 key 迁移
+	delete(info.ReadySCs, conns[2])
+	after := pickAll(b.Build(info))
+	if b.hash != ring {
+		t.Fatalf("hash ring rebuilt")
+	}
+
+	moved := 0
+	for key, sc := range before {
+		if after[key] != sc {
+			if sc != balancer.SubConn(conns[2]) {
+				t.Fatalf("key %s moved from remaining node", key)
+			}
+			moved++
+		}
+	}
+	t.Logf("leave: %d/%d keys moved", moved, len(before))
+}
+
+// 默认不限制负载，同一个 key 的并发请求都在同一个节点上
+func Test_consistentHashPickerAffinity(t *testing.T) {
+	info, _ := newBuildInfo(100, 100, 100, 100)
+	picker := newConsistentHashPickerBuilder(0).Build(info)
+
+	ctx := NewParamContext(context.Background(), "player1")
+	var first balancer.SubConn
+	for i := 0; i < 10; i++ {
+		result, err := picker.Pick(balancer.PickInfo{Ctx: ctx})
+		if err != nil {
+			t.Fatalf("Pick got error: %v", err)
+		}
+		if first == nil {
+			first = result.SubConn
+		} else if result.SubConn != first {
+			t.Fatalf("key moved to another node without bounded load")
+		}
+	}
+}
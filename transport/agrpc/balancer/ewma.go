@@ -0,0 +1,164 @@
+package balancer
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+const (
+	ewmaDecay = 10 * time.Second // 延迟的衰减时间，越小对最近的延迟越敏感
+)
+
+// ewmaPickerBuilder 按地址保存节点的延迟数据，节点列表变化时不丢失已有节点的数据
+type ewmaPickerBuilder struct {
+	lk    sync.Mutex
+	stats map[string]*ewmaStat // addr -> stat
+}
+
+func (b *ewmaPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	b.lk.Lock()
+	defer b.lk.Unlock()
+
+	now := time.Now()
+	avg := b.avgLatency()
+	nodes := readyNodes(info.ReadySCs)
+	stats := make(map[string]*ewmaStat, len(nodes))
+	picker := &ewmaPicker{
+		nodes: make([]*ewmaNode, 0, len(nodes)),
+		now:   time.Now,
+	}
+	for _, n := range nodes {
+		stat, ok := b.stats[n.addr]
+		if !ok {
+			// 新加入的节点使用已有节点的平均延迟，避免没有延迟数据时被集中选择
+			stat = &ewmaStat{}
+			if avg > 0 {
+				stat.latency = avg
+				stat.stamp = now
+			}
+		}
+		stats[n.addr] = stat
+		picker.nodes = append(picker.nodes, &ewmaNode{node: n, ewmaStat: stat})
+	}
+	b.stats = stats
+
+	return picker
+}
+
+// avgLatency 已有延迟数据的节点的平均延迟，调用时需持有锁
+func (b *ewmaPickerBuilder) avgLatency() float64 {
+	var sum float64
+	var count int
+	for _, stat := range b.stats {
+		if latency, _, ok := stat.load(); ok {
+			sum += latency
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// ewmaStat 节点的延迟数据，在多次 Build 之间共用
+type ewmaStat struct {
+	sync.Mutex
+	latency  float64   // 指数加权移动平均延迟(纳秒)
+	stamp    time.Time // 最后一次更新延迟的时间，为零表示还没有延迟数据
+	inflight int64     // 正在处理的请求数
+}
+
+type ewmaNode struct {
+	*node
+	*ewmaStat
+}
+
+// load 返回延迟和正在处理的请求数，ok 为 false 表示还没有延迟数据
+func (s *ewmaStat) load() (latency float64, inflight int64, ok bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.latency, s.inflight, !s.stamp.IsZero()
+}
+
+func (s *ewmaStat) start() {
+	s.Lock()
+	s.inflight++
+	s.Unlock()
+}
+
+func (s *ewmaStat) done(now time.Time, latency time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.inflight--
+
+	if s.stamp.IsZero() {
+		s.latency = float64(latency)
+	} else {
+		// 距离上次更新越久，旧的延迟占比越小
+		td := now.Sub(s.stamp)
+		if td < 0 {
+			td = 0
+		}
+		w := math.Exp(-float64(td) / float64(ewmaDecay))
+		s.latency = s.latency*w + float64(latency)*(1-w)
+	}
+	s.stamp = now
+}
+
+// ewmaPicker 随机选择两个节点，使用指数加权移动平均延迟较低的那个
+type ewmaPicker struct {
+	nodes []*ewmaNode
+	now   func() time.Time
+}
+
+func (p *ewmaPicker) Pick(info balancer.PickInfo) (result balancer.PickResult, err error) {
+	n := p.choose()
+	n.start()
+
+	start := p.now()
+	result.SubConn = n.subConn
+	result.Done = func(balancer.DoneInfo) {
+		now := p.now()
+		n.done(now, now.Sub(start))
+	}
+	return
+}
+
+func (p *ewmaPicker) choose() *ewmaNode {
+	if len(p.nodes) == 1 {
+		return p.nodes[0]
+	}
+
+	i, j := pickTwo(len(p.nodes))
+	a, b := p.nodes[i], p.nodes[j]
+	la, ia, oka := a.load()
+	lb, ib, okb := b.load()
+
+	// 没有延迟数据的节点使用另一个节点的延迟，都没有时只比较正在处理的请求数
+	if !oka {
+		la = lb
+	}
+	if !okb {
+		lb = la
+	}
+	if score(lb, ib, b.weight) < score(la, ia, a.weight) {
+		return b
+	}
+	return a
+}
+
+// score 按权重折算后的预期延迟
+func score(latency float64, inflight int64, weight int) float64 {
+	return math.Max(latency, 1) * float64(inflight+1) / float64(weight)
+}
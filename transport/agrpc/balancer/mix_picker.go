@@ -2,6 +2,8 @@ package balancer
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/lightmen/nami/codes"
 	"github.com/lightmen/nami/pkg/aerror"
@@ -11,10 +13,17 @@ import (
 )
 
 const (
-	Mix        = "mix"        // consistent 和 其他注册balancer算法 的混合体
-	Consistent = "consistent" //一致性hash
+	Mix                = "mix"                  // consistent 和 其他注册balancer算法 的混合体
+	Consistent         = "consistent"           //一致性hash
+	Random             = "random"               //随机
+	WeightedRoundRobin = "weighted_round_robin" //平滑加权轮询
+	P2C                = "p2c"                  //随机选两个节点，使用正在处理请求数较少的节点
+	EWMA               = "ewma"                 //随机选两个节点，使用平均延迟较低的节点
 )
 
+// defaultPicker 没有指定负载名字，也没有负载参数时使用的负载
+const defaultPicker = WeightedRoundRobin
+
 var gSelector *selector
 
 func init() {
@@ -38,56 +47,182 @@ func (p PickerBuildInfoString) String() string {
 	return cast.ToJson(infos)
 }
 
+// mixPickerBuilder 每个 ClientConn 一个，在多次 Build 之间保存一致性hash环等状态
 type mixPickerBuilder struct {
+	opts     options
+	target   string // 服务名，与 resolver.Address.ServerName 相同
+	builders map[string]base.PickerBuilder
+	detector *outlierDetector // 与路由规则的节点子集共用
+
+	lk      sync.Mutex
+	current *mixPicker                   // 最新 Build 的 picker，只有它会因为节点剔除和恢复重建
+	subsets map[string]*mixPickerBuilder // 路由规则的节点子集，labelKey -> builder
+}
+
+func newMixPickerBuilder(opts options) *mixPickerBuilder {
+	return newSubsetPickerBuilder(newOutlierDetector(opts.outlier), opts)
+}
+
+func newSubsetPickerBuilder(detector *outlierDetector, opts options) *mixPickerBuilder {
+	return &mixPickerBuilder{
+		opts: opts,
+		builders: map[string]base.PickerBuilder{
+			Consistent:         newConsistentHashPickerBuilder(opts.loadFactor),
+			Random:             &randomPickerBuilder{},
+			WeightedRoundRobin: &weightedRoundRobinPickerBuilder{},
+			P2C:                &p2cPickerBuilder{},
+			EWMA:               &ewmaPickerBuilder{},
+		},
+		detector: detector,
+		subsets:  make(map[string]*mixPickerBuilder),
+	}
 }
 
 func (b *mixPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
 	if len(info.ReadySCs) == 0 {
+		if b.target != "" {
+			gSelector.Remove(b.target)
+		}
 		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
 	}
 
 	// alog.Debug("mix picker build got(%d): %s", len(info.ReadySCs), PickerBuildInfoString(info).String())
 
-	builders := map[string]base.PickerBuilder{
-		Consistent: &consistentHashPickerBuilder{},
+	gSelector.Update(info)
+	b.detector.Update(info)
+
+	picker := b.build(info)
+	picker.addrs = make(map[balancer.SubConn]string, len(info.ReadySCs))
+	for sc, conInfo := range info.ReadySCs {
+		picker.addrs[sc] = conInfo.Address.Addr
 	}
+	return picker
+}
 
-	mixPicker := &mixPicker{
-		pickers: make(map[string]balancer.Picker, len(builders)),
+func (b *mixPickerBuilder) build(info base.PickerBuildInfo) *mixPicker {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+
+	picker := &mixPicker{
+		builder: b,
+		info:    info,
+		version: b.detector.Version(),
+		pickers: b.buildPickers(info),
+		subsets: make(map[string]*mixPicker),
 	}
 
-	gSelector.Update(info)
+	b.current = picker
+	return picker
+}
+
+// buildPickers 使用没有被剔除的节点创建各个负载的 picker，调用时需持有锁
+func (b *mixPickerBuilder) buildPickers(info base.PickerBuildInfo) map[string]balancer.Picker {
+	healthy := b.detector.Filter(info)
 
-	for name, builder := range builders {
-		picker := builder.Build(info)
-		mixPicker.pickers[name] = picker
+	pickers := make(map[string]balancer.Picker, len(b.builders))
+	for name, builder := range b.builders {
+		pickers[name] = builder.Build(healthy)
 	}
+	return pickers
+}
 
-	return mixPicker
+// rebuild 节点被剔除或者恢复后重建 picker，旧的 picker 不再重建，避免覆盖一致性hash环的状态
+func (b *mixPickerBuilder) rebuild(p *mixPicker) (map[string]balancer.Picker, bool) {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+
+	if b.current != p {
+		return nil, false
+	}
+	return b.buildPickers(p.info), true
+}
+
+// subset 返回带有指定标签的节点子集的 builder，子集的一致性hash环等状态同样在多次 Build 之间保存
+func (b *mixPickerBuilder) subset(key string) *mixPickerBuilder {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+
+	sub, ok := b.subsets[key]
+	if !ok {
+		sub = newSubsetPickerBuilder(b.detector, b.opts)
+		b.subsets[key] = sub
+	}
+	return sub
 }
 
 type mixPicker struct {
+	builder *mixPickerBuilder
+	info    base.PickerBuildInfo
+	addrs   map[balancer.SubConn]string // 用于记录请求结果，只有 Build 创建的 picker 有
+
+	lk      sync.RWMutex
+	version int64 // 创建 pickers 时的节点剔除版本号
 	pickers map[string]balancer.Picker
+	subsets map[string]*mixPicker // labelKey -> 节点子集的 picker，第一次使用时创建，没有节点时为 nil
 }
 
 func (p *mixPicker) Pick(info balancer.PickInfo) (result balancer.PickResult, err error) {
 	//1. 首先权重最高的Picker是直连，如果是直连负载，直接使用直连
 	//2. 如果业务注册了picker负载，判断是否匹配业务的picker,如果匹配，使用业务的picker
-	//3. 否则的话，只用Consistent一致性hash的负载
+	//3. 如果匹配了路由规则，在规则指定标签的节点中负载
+	//4. 否则的话，使用 NewNameContext 指定的负载，没有指定时，有负载参数使用Consistent一致性hash，否则使用默认负载
+	//被剔除的节点不参与 3 和 4 的负载
 
 	ctx := info.Ctx
 
-	//获取默认的picker
-	name, ok := FromNameContext(ctx)
+	if picker := gSelector.Get(ctx); picker != nil {
+		result, err = picker.Pick(info)
+	} else {
+		picker := p
+		matchRouteRules(ctx, func(rule *RouteRule) bool {
+			if sub := p.subset(rule.labels()); sub != nil {
+				picker = sub
+				return false
+			}
+			return true
+		})
+		result, err = picker.pick(info)
+	}
+
+	if err == nil {
+		p.record(&result)
+	}
+	return
+}
+
+// record 请求结束时记录结果，用于剔除异常节点
+func (p *mixPicker) record(result *balancer.PickResult) {
+	if p.builder.detector.cfg.ConsecutiveErrors <= 0 {
+		return
+	}
+	addr, ok := p.addrs[result.SubConn]
 	if !ok {
-		name = Consistent
+		return
 	}
 
-	if picker := gSelector.Get(ctx); picker != nil {
-		return picker.Pick(info)
+	start := time.Now()
+	done := result.Done
+	result.Done = func(info balancer.DoneInfo) {
+		p.builder.detector.Record(addr, info.Err, time.Since(start))
+		if done != nil {
+			done(info)
+		}
 	}
+}
 
-	picker, ok := p.pickers[name]
+func (p *mixPicker) pick(info balancer.PickInfo) (result balancer.PickResult, err error) {
+	ctx := info.Ctx
+
+	//获取默认的picker
+	name, ok := FromNameContext(ctx)
+	if !ok {
+		name = defaultPicker
+		if _, ok = FromParamContext(ctx); ok {
+			name = Consistent
+		}
+	}
+
+	picker, ok := p.getPickers()[name]
 	if !ok {
 		err = aerror.New(codes.InvalidArgument, fmt.Sprintf("got empty picker for:%s", name))
 		return
@@ -95,3 +230,52 @@ func (p *mixPicker) Pick(info balancer.PickInfo) (result balancer.PickResult, er
 
 	return picker.Pick(info)
 }
+
+// getPickers 返回各个负载的 picker，节点剔除状态变化时重建
+func (p *mixPicker) getPickers() map[string]balancer.Picker {
+	version := p.builder.detector.Version()
+
+	p.lk.RLock()
+	pickers := p.pickers
+	changed := p.version != version
+	p.lk.RUnlock()
+	if !changed {
+		return pickers
+	}
+
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	if p.version != version {
+		p.version = version
+		if pickers, ok := p.builder.rebuild(p); ok {
+			p.pickers = pickers
+			p.subsets = make(map[string]*mixPicker)
+		}
+	}
+	return p.pickers
+}
+
+// subset 返回带有所有标签的节点子集的 picker，没有节点时返回 nil
+func (p *mixPicker) subset(labels map[string]string) *mixPicker {
+	key := labelKey(labels)
+
+	p.lk.RLock()
+	sub, ok := p.subsets[key]
+	p.lk.RUnlock()
+	if ok {
+		return sub
+	}
+
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	if sub, ok = p.subsets[key]; ok {
+		return sub
+	}
+	if info := filterSubConns(p.info, labels); len(info.ReadySCs) > 0 {
+		sub = p.builder.subset(key).build(info)
+	}
+	p.subsets[key] = sub
+	return sub
+}
@@ -0,0 +1,40 @@
+package balancer
+
+import (
+	"sort"
+
+	"github.com/lightmen/nami/transport/agrpc/resolver/discovery"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+// node 可用于负载的节点
+type node struct {
+	subConn balancer.SubConn
+	addr    string
+	weight  int
+}
+
+// readyNodes 返回可用的节点，按地址排序保证每次构建的顺序一致
+func readyNodes(readySCs map[balancer.SubConn]base.SubConnInfo) []*node {
+	nodes := make([]*node, 0, len(readySCs))
+	for sc, info := range upSubConns(readySCs) {
+		nodes = append(nodes, &node{
+			subConn: sc,
+			addr:    info.Address.Addr,
+			weight:  normalizeWeight(discovery.GetAttributes(info.Address).Weight),
+		})
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].addr < nodes[j].addr
+	})
+	return nodes
+}
+
+func normalizeWeight(weight int) int {
+	if weight <= 0 {
+		return 1
+	}
+	return weight
+}
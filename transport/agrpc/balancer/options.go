@@ -0,0 +1,25 @@
+package balancer
+
+// Option mix 负载的可选参数，通过 Register 设置
+type Option func(o *options)
+
+type options struct {
+	loadFactor float64       // 一致性hash的负载上限系数，小于等于 0 时不限制负载
+	outlier    OutlierConfig // 被动健康检查配置，ConsecutiveErrors 小于等于 0 时关闭
+}
+
+// WithBoundedLoad 开启一致性hash的负载上限，每个节点正在处理的请求数不超过 c 倍的平均值(按权重折算)，
+// 超过时顺时针使用下一个节点。并发较低时同一个 key 的请求也可能被分散，需要节点亲和性时不要开启，c 一般为 1.25
+func WithBoundedLoad(c float64) Option {
+	return func(o *options) {
+		o.loadFactor = c
+	}
+}
+
+// WithOutlierDetection 开启被动健康检查，节点连续失败后暂时从负载中剔除，默认关闭，
+// 一般使用 DefaultOutlierConfig
+func WithOutlierDetection(cfg OutlierConfig) Option {
+	return func(o *options) {
+		o.outlier = cfg
+	}
+}
@@ -0,0 +1,198 @@
+package balancer
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// OutlierConfig 被动健康检查的配置，节点连续失败后暂时从负载中剔除，一致性hash中该节点的 key 迁移到相邻节点
+type OutlierConfig struct {
+	ConsecutiveErrors  int           // 连续失败多少次后剔除，小于等于 0 时关闭
+	SlowThreshold      time.Duration // 延迟超过该值的请求视为失败，0 表示不检查延迟
+	BaseEjectionTime   time.Duration // 第一次剔除的时间，之后每次剔除时间翻倍
+	MaxEjectionTime    time.Duration // 最长的剔除时间
+	MaxEjectionPercent int           // 最多剔除的节点百分比，保证剩下的节点可以承载流量
+}
+
+// DefaultOutlierConfig 推荐的被动健康检查配置，通过 Register(WithOutlierDetection(DefaultOutlierConfig)) 开启
+var DefaultOutlierConfig = OutlierConfig{
+	ConsecutiveErrors:  5,
+	BaseEjectionTime:   30 * time.Second,
+	MaxEjectionTime:    5 * time.Minute,
+	MaxEjectionPercent: 50,
+}
+
+// outlierCodes 视为节点故障的错误码，业务错误不会导致节点被剔除。
+// DeadlineExceeded 通常是调用方设置的超时过短，不视为节点故障，慢节点通过 SlowThreshold 剔除
+var outlierCodes = map[codes.Code]bool{
+	codes.Unavailable:       true,
+	codes.Internal:          true,
+	codes.ResourceExhausted: true,
+}
+
+type outlierStat struct {
+	consecutive  int       // 连续失败次数
+	ejections    int       // 连续被剔除的次数
+	ejectedUntil time.Time // 剔除的截止时间
+}
+
+// outlierDetector 一个 ClientConn 的节点健康状态，节点被剔除和恢复时 version 增加，picker 根据 version 重建
+type outlierDetector struct {
+	cfg OutlierConfig
+	now func() time.Time
+
+	version    int64 // atomic
+	nextExpire int64 // atomic, 最近的剔除截止时间(纳秒)，0 表示没有被剔除的节点
+
+	lk    sync.Mutex
+	stats map[string]*outlierStat // addr -> stat
+}
+
+func newOutlierDetector(cfg OutlierConfig) *outlierDetector {
+	return &outlierDetector{
+		cfg:   cfg,
+		now:   time.Now,
+		stats: make(map[string]*outlierStat),
+	}
+}
+
+// Version 返回当前的版本号，剔除时间到期的节点在这里恢复
+func (d *outlierDetector) Version() int64 {
+	next := atomic.LoadInt64(&d.nextExpire)
+	if next != 0 && d.now().UnixNano() >= next {
+		d.lk.Lock()
+		d.refresh()
+		d.lk.Unlock()
+	}
+	return atomic.LoadInt64(&d.version)
+}
+
+// refresh 重新计算最近的剔除截止时间，有节点恢复时增加版本号，调用时需持有锁
+func (d *outlierDetector) refresh() {
+	now := d.now()
+	old := atomic.LoadInt64(&d.nextExpire)
+
+	var next int64
+	for _, stat := range d.stats {
+		if stat.ejectedUntil.After(now) {
+			if until := stat.ejectedUntil.UnixNano(); next == 0 || until < next {
+				next = until
+			}
+		}
+	}
+	atomic.StoreInt64(&d.nextExpire, next)
+
+	if old != 0 && old <= now.UnixNano() {
+		atomic.AddInt64(&d.version, 1)
+	}
+}
+
+// Update 更新节点列表，删除下线节点的状态
+func (d *outlierDetector) Update(info base.PickerBuildInfo) {
+	addrs := make(map[string]struct{}, len(info.ReadySCs))
+	for _, conInfo := range info.ReadySCs {
+		addrs[conInfo.Address.Addr] = struct{}{}
+	}
+
+	d.lk.Lock()
+	defer d.lk.Unlock()
+
+	for addr := range d.stats {
+		if _, ok := addrs[addr]; !ok {
+			delete(d.stats, addr)
+		}
+	}
+	for addr := range addrs {
+		if _, ok := d.stats[addr]; !ok {
+			d.stats[addr] = &outlierStat{}
+		}
+	}
+}
+
+// Record 记录一次请求的结果
+func (d *outlierDetector) Record(addr string, err error, latency time.Duration) {
+	if d.cfg.ConsecutiveErrors <= 0 {
+		return
+	}
+
+	failed := err != nil && outlierCodes[status.Code(err)]
+	if d.cfg.SlowThreshold > 0 && latency > d.cfg.SlowThreshold {
+		failed = true
+	}
+
+	d.lk.Lock()
+	defer d.lk.Unlock()
+
+	stat, ok := d.stats[addr]
+	if !ok {
+		return
+	}
+
+	now := d.now()
+	if !failed {
+		stat.consecutive = 0
+		// 恢复后稳定运行超过最长剔除时间，重置剔除次数
+		if stat.ejections > 0 && now.Sub(stat.ejectedUntil) > d.cfg.MaxEjectionTime {
+			stat.ejections = 0
+		}
+		return
+	}
+
+	stat.consecutive++
+	if stat.consecutive < d.cfg.ConsecutiveErrors || stat.ejectedUntil.After(now) {
+		return
+	}
+	if !d.canEject(now) {
+		return
+	}
+
+	stat.consecutive = 0
+	stat.ejections++
+	ejection := d.cfg.BaseEjectionTime << (stat.ejections - 1)
+	if ejection <= 0 || ejection > d.cfg.MaxEjectionTime {
+		ejection = d.cfg.MaxEjectionTime
+	}
+	stat.ejectedUntil = now.Add(ejection)
+
+	d.refresh()
+	atomic.AddInt64(&d.version, 1)
+}
+
+// canEject 再剔除一个节点后，剔除的节点数是否不超过 MaxEjectionPercent，调用时需持有锁
+func (d *outlierDetector) canEject(now time.Time) bool {
+	ejected := 0
+	for _, stat := range d.stats {
+		if stat.ejectedUntil.After(now) {
+			ejected++
+		}
+	}
+	return (ejected+1)*100 <= len(d.stats)*d.cfg.MaxEjectionPercent
+}
+
+// Filter 返回没有被剔除的节点，所有节点都被剔除时返回全部节点
+func (d *outlierDetector) Filter(info base.PickerBuildInfo) base.PickerBuildInfo {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+
+	now := d.now()
+	healthy := base.PickerBuildInfo{
+		ReadySCs: make(map[balancer.SubConn]base.SubConnInfo, len(info.ReadySCs)),
+	}
+	for sc, conInfo := range info.ReadySCs {
+		if stat, ok := d.stats[conInfo.Address.Addr]; ok && stat.ejectedUntil.After(now) {
+			continue
+		}
+		healthy.ReadySCs[sc] = conInfo
+	}
+
+	if len(healthy.ReadySCs) == 0 {
+		return info
+	}
+	return healthy
+}
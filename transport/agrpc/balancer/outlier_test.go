@@ -0,0 +1,169 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lightmen/nami/pkg/cast"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestOutlierDetector(t *testing.T) {
+	info, _ := newBuildInfo(100, 100, 100, 100)
+	addrs := make([]string, 0, len(info.ReadySCs))
+	for _, conInfo := range info.ReadySCs {
+		addrs = append(addrs, conInfo.Address.Addr)
+	}
+
+	now := time.Now()
+	d := newOutlierDetector(DefaultOutlierConfig)
+	d.now = func() time.Time { return now }
+	d.Update(info)
+
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	version := d.Version()
+
+	// 业务错误和调用方超时不剔除
+	for i := 0; i < 10; i++ {
+		d.Record(addrs[0], errors.New("business error"), time.Millisecond)
+		d.Record(addrs[0], status.Error(codes.DeadlineExceeded, "deadline exceeded"), time.Millisecond)
+	}
+	if d.Version() != version {
+		t.Fatalf("business error should not eject node")
+	}
+
+	// 成功的请求重置连续失败次数
+	for i := 0; i < 4; i++ {
+		d.Record(addrs[0], unavailable, time.Millisecond)
+	}
+	d.Record(addrs[0], nil, time.Millisecond)
+	d.Record(addrs[0], unavailable, time.Millisecond)
+	if d.Version() != version {
+		t.Fatalf("node should not be ejected")
+	}
+
+	for i := 0; i < 5; i++ {
+		d.Record(addrs[0], unavailable, time.Millisecond)
+	}
+	if d.Version() == version {
+		t.Fatalf("node should be ejected")
+	}
+	if n := len(d.Filter(info).ReadySCs); n != 3 {
+		t.Fatalf("expect 3 healthy nodes, got: %d", n)
+	}
+
+	// 最多剔除 50% 的节点
+	for _, addr := range addrs[1:] {
+		for i := 0; i < 5; i++ {
+			d.Record(addr, unavailable, time.Millisecond)
+		}
+	}
+	if n := len(d.Filter(info).ReadySCs); n != 2 {
+		t.Fatalf("expect 2 healthy nodes, got: %d", n)
+	}
+
+	// 剔除时间到期后恢复
+	version = d.Version()
+	now = now.Add(DefaultOutlierConfig.BaseEjectionTime + time.Second)
+	if d.Version() == version {
+		t.Fatalf("version should change after ejection expired")
+	}
+	if n := len(d.Filter(info).ReadySCs); n != 4 {
+		t.Fatalf("expect 4 healthy nodes, got: %d", n)
+	}
+
+	// 第二次剔除的时间翻倍
+	for i := 0; i < 5; i++ {
+		d.Record(addrs[0], unavailable, time.Millisecond)
+	}
+	if until := d.stats[addrs[0]].ejectedUntil; until.Sub(now) != 2*DefaultOutlierConfig.BaseEjectionTime {
+		t.Fatalf("expect ejection time %s, got: %s", 2*DefaultOutlierConfig.BaseEjectionTime, until.Sub(now))
+	}
+}
+
+func TestOutlierSlowRequest(t *testing.T) {
+	info, _ := newBuildInfo(100, 100)
+	cfg := DefaultOutlierConfig
+	cfg.SlowThreshold = time.Second
+
+	d := newOutlierDetector(cfg)
+	d.Update(info)
+
+	var addr string
+	for _, conInfo := range info.ReadySCs {
+		addr = conInfo.Address.Addr
+	}
+	version := d.Version()
+	for i := 0; i < cfg.ConsecutiveErrors; i++ {
+		d.Record(addr, nil, 2*time.Second)
+	}
+	if d.Version() == version {
+		t.Fatalf("slow node should be ejected")
+	}
+}
+
+// failNode 让 bad 节点连续返回 n 次 Unavailable
+func failNode(t *testing.T, picker balancer.Picker, bad balancer.SubConn, n int) {
+	for i, j := 0, 0; i < n; j++ {
+		result, err := picker.Pick(balancer.PickInfo{Ctx: NewParamContext(context.Background(), cast.ToString(j))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.SubConn != bad {
+			result.Done(balancer.DoneInfo{})
+			continue
+		}
+		result.Done(balancer.DoneInfo{Err: status.Error(codes.Unavailable, "unavailable")})
+		i++
+	}
+}
+
+func pickKeys(t *testing.T, picker balancer.Picker) map[string]balancer.SubConn {
+	picked := make(map[string]balancer.SubConn)
+	for i := 0; i < 1000; i++ {
+		key := cast.ToString(i)
+		picked[key] = pickSubConn(t, picker, NewParamContext(context.Background(), key))
+	}
+	return picked
+}
+
+func TestMixPickerOutlier(t *testing.T) {
+	info, conns := newBuildInfo(100, 100, 100, 100)
+	picker := newMixPickerBuilder(options{outlier: DefaultOutlierConfig}).Build(info)
+	before := pickKeys(t, picker)
+
+	// conns[0] 连续返回 Unavailable 后被剔除
+	bad := balancer.SubConn(conns[0])
+	failNode(t, picker, bad, DefaultOutlierConfig.ConsecutiveErrors)
+
+	// 只有被剔除节点上的 key 迁移到其他节点
+	after := pickKeys(t, picker)
+	for key, sc := range before {
+		if sc == bad {
+			if after[key] == bad {
+				t.Fatalf("key %s still routed to ejected node", key)
+			}
+		} else if after[key] != sc {
+			t.Fatalf("key %s moved from healthy node", key)
+		}
+	}
+}
+
+func TestMixPickerOutlierDisabled(t *testing.T) {
+	info, conns := newBuildInfo(100, 100, 100, 100)
+	picker := newMixPickerBuilder(options{}).Build(info)
+	before := pickKeys(t, picker)
+
+	// 默认不开启被动健康检查，失败的节点不会被剔除
+	failNode(t, picker, conns[0], 2*DefaultOutlierConfig.ConsecutiveErrors)
+	after := pickKeys(t, picker)
+	for key, sc := range before {
+		if after[key] != sc {
+			t.Fatalf("key %s moved without outlier detection", key)
+		}
+	}
+}
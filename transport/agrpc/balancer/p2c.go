@@ -0,0 +1,90 @@
+package balancer
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+// p2cPickerBuilder 按地址保存节点正在处理的请求数，节点列表变化时不丢失已有节点的计数
+type p2cPickerBuilder struct {
+	lk       sync.Mutex
+	inflight map[string]*int64 // addr -> inflight
+}
+
+func (b *p2cPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	b.lk.Lock()
+	defer b.lk.Unlock()
+
+	nodes := readyNodes(info.ReadySCs)
+	inflight := make(map[string]*int64, len(nodes))
+	picker := &p2cPicker{
+		nodes: make([]*p2cNode, 0, len(nodes)),
+	}
+	for _, n := range nodes {
+		count, ok := b.inflight[n.addr]
+		if !ok {
+			count = new(int64)
+		}
+		inflight[n.addr] = count
+		picker.nodes = append(picker.nodes, &p2cNode{node: n, inflight: count})
+	}
+	b.inflight = inflight
+
+	return picker
+}
+
+type p2cNode struct {
+	*node
+	inflight *int64 // 正在处理的请求数，在多次 Build 之间共用
+}
+
+// load 按权重折算后的负载
+func (n *p2cNode) load() int64 {
+	return (atomic.LoadInt64(n.inflight) + 1) * 100 / int64(n.weight)
+}
+
+// p2cPicker 随机选择两个节点，使用正在处理的请求数较少的那个
+type p2cPicker struct {
+	nodes []*p2cNode
+}
+
+func (p *p2cPicker) Pick(info balancer.PickInfo) (result balancer.PickResult, err error) {
+	n := p.choose()
+	atomic.AddInt64(n.inflight, 1)
+
+	result.SubConn = n.subConn
+	result.Done = func(balancer.DoneInfo) {
+		atomic.AddInt64(n.inflight, -1)
+	}
+	return
+}
+
+func (p *p2cPicker) choose() *p2cNode {
+	if len(p.nodes) == 1 {
+		return p.nodes[0]
+	}
+
+	a, b := pickTwo(len(p.nodes))
+	if p.nodes[b].load() < p.nodes[a].load() {
+		return p.nodes[b]
+	}
+	return p.nodes[a]
+}
+
+// pickTwo 随机返回 [0, n) 中两个不同的数，n 必须大于 1
+func pickTwo(n int) (int, int) {
+	a := rand.Intn(n)
+	b := rand.Intn(n - 1)
+	if b >= a {
+		b++
+	}
+	return a, b
+}
@@ -0,0 +1,198 @@
+package balancer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lightmen/nami/registry"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+// newBuildInfo 生成带权重的节点，返回节点和对应的 subConn
+func newBuildInfo(weights ...int) (base.PickerBuildInfo, []*mockConn) {
+	info := base.PickerBuildInfo{
+		ReadySCs: make(map[balancer.SubConn]base.SubConnInfo, len(weights)),
+	}
+	conns := make([]*mockConn, 0, len(weights))
+	for i, w := range weights {
+		mc := &mockConn{id: i}
+		conns = append(conns, mc)
+		info.ReadySCs[mc] = base.SubConnInfo{
+			Address: discoveryAddress("127.0.0.1:1000"+string(rune('0'+i)), &registry.Instance{Weight: w}),
+		}
+	}
+	return info, conns
+}
+
+func countPicks(t *testing.T, picker balancer.Picker, n int) map[balancer.SubConn]int {
+	count := make(map[balancer.SubConn]int)
+	for i := 0; i < n; i++ {
+		result, err := picker.Pick(balancer.PickInfo{Ctx: context.Background()})
+		if err != nil {
+			t.Fatalf("Pick got error: %v", err)
+		}
+		count[result.SubConn]++
+		if result.Done != nil {
+			result.Done(balancer.DoneInfo{})
+		}
+	}
+	return count
+}
+
+func Test_randomPicker(t *testing.T) {
+	info, conns := newBuildInfo(100, 100)
+	count := countPicks(t, (&randomPickerBuilder{}).Build(info), 1000)
+	for _, mc := range conns {
+		if count[mc] == 0 {
+			t.Fatalf("subConn never picked: %v", count)
+		}
+	}
+}
+
+func Test_weightedRoundRobinPicker(t *testing.T) {
+	info, conns := newBuildInfo(300, 100)
+	picker := (&weightedRoundRobinPickerBuilder{}).Build(info)
+
+	count := countPicks(t, picker, 400)
+	if count[conns[0]] != 300 || count[conns[1]] != 100 {
+		t.Fatalf("expect 300:100, got: %d:%d", count[conns[0]], count[conns[1]])
+	}
+
+	// 平滑加权，权重低的节点不会连续 4 次都没有被选中
+	last := 0
+	for i := 1; i <= 40; i++ {
+		result, _ := picker.Pick(balancer.PickInfo{Ctx: context.Background()})
+		if result.SubConn == balancer.SubConn(conns[1]) {
+			if i-last > 4 {
+				t.Fatalf("light node skipped %d times", i-last-1)
+			}
+			last = i
+		}
+	}
+}
+
+func Test_p2cPicker(t *testing.T) {
+	info, conns := newBuildInfo(100, 100)
+	picker := (&p2cPickerBuilder{}).Build(info)
+
+	// 不调用 Done 模拟请求一直在处理，两个节点的请求数会保持均衡
+	count := make(map[balancer.SubConn]int)
+	for i := 0; i < 100; i++ {
+		result, err := picker.Pick(balancer.PickInfo{Ctx: context.Background()})
+		if err != nil {
+			t.Fatalf("Pick got error: %v", err)
+		}
+		count[result.SubConn]++
+	}
+	if diff := count[conns[0]] - count[conns[1]]; diff > 1 || diff < -1 {
+		t.Fatalf("unbalanced inflight: %v", count)
+	}
+}
+
+func Test_ewmaPicker(t *testing.T) {
+	info, conns := newBuildInfo(100, 100)
+	picker := (&ewmaPickerBuilder{}).Build(info).(*ewmaPicker)
+
+	now := time.Now()
+	picker.now = func() time.Time { return now }
+
+	// conns[0] 的延迟是 conns[1] 的 10 倍
+	for _, n := range picker.nodes {
+		latency := 10 * time.Millisecond
+		if n.subConn == balancer.SubConn(conns[0]) {
+			latency = 100 * time.Millisecond
+		}
+		n.start()
+		n.done(now, latency)
+	}
+
+	count := countPicks(t, picker, 100)
+	if count[conns[0]] != 0 {
+		t.Fatalf("slow node should not be picked: %v", count)
+	}
+}
+
+func Test_mixPickerDefault(t *testing.T) {
+	info, _ := newBuildInfo(100, 100)
+	picker := newMixPickerBuilder(options{}).Build(info)
+
+	// 没有负载参数时使用默认负载
+	if _, err := picker.Pick(balancer.PickInfo{Ctx: context.Background()}); err != nil {
+		t.Fatalf("Pick without param got error: %v", err)
+	}
+
+	// 有负载参数时使用一致性hash，同一个参数选择同一个节点
+	ctx := NewParamContext(context.Background(), "10001")
+	first, err := picker.Pick(balancer.PickInfo{Ctx: ctx})
+	if err != nil {
+		t.Fatalf("Pick got error: %v", err)
+	}
+	first.Done(balancer.DoneInfo{})
+	for i := 0; i < 10; i++ {
+		result, _ := picker.Pick(balancer.PickInfo{Ctx: ctx})
+		if result.SubConn != first.SubConn {
+			t.Fatalf("consistent picker got different subConn")
+		}
+		result.Done(balancer.DoneInfo{})
+	}
+
+	for _, name := range []string{Random, WeightedRoundRobin, P2C, EWMA} {
+		if _, err = picker.Pick(balancer.PickInfo{Ctx: NewNameContext(context.Background(), name)}); err != nil {
+			t.Fatalf("%s Pick got error: %v", name, err)
+		}
+	}
+
+	if _, err = picker.Pick(balancer.PickInfo{Ctx: NewNameContext(context.Background(), "unknown")}); err == nil {
+		t.Fatalf("expect error for unknown picker")
+	}
+}
+
+func Test_ewmaPickerRebuild(t *testing.T) {
+	b := &ewmaPickerBuilder{}
+	info, conns := newBuildInfo(100, 100)
+	picker := b.Build(info).(*ewmaPicker)
+
+	now := time.Now()
+	for _, n := range picker.nodes {
+		latency := 10 * time.Millisecond
+		if n.subConn == balancer.SubConn(conns[0]) {
+			latency = 100 * time.Millisecond
+		}
+		n.start()
+		n.done(now, latency)
+	}
+
+	// 新节点加入，已有节点保留延迟数据，新节点使用平均延迟
+	info, _ = newBuildInfo(100, 100, 100)
+	picker = b.Build(info).(*ewmaPicker)
+	want := []time.Duration{100 * time.Millisecond, 10 * time.Millisecond, 55 * time.Millisecond}
+	for i, n := range picker.nodes {
+		latency, _, ok := n.load()
+		if !ok || time.Duration(latency) != want[i] {
+			t.Fatalf("node %s latency = %v, want %v", n.addr, time.Duration(latency), want[i])
+		}
+	}
+}
+
+func Test_p2cPickerRebuild(t *testing.T) {
+	b := &p2cPickerBuilder{}
+	info, conns := newBuildInfo(100, 100)
+	picker := b.Build(info)
+
+	// conns[0] 上有一个请求一直在处理，重新 Build 后不丢失
+	for {
+		result, _ := picker.Pick(balancer.PickInfo{Ctx: context.Background()})
+		if result.SubConn == balancer.SubConn(conns[0]) {
+			break
+		}
+		result.Done(balancer.DoneInfo{})
+	}
+
+	info, conns = newBuildInfo(100, 100)
+	count := countPicks(t, b.Build(info), 10)
+	if count[conns[0]] != 0 {
+		t.Fatalf("busy node should not be picked: %v", count)
+	}
+}
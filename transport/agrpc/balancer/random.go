@@ -0,0 +1,31 @@
+package balancer
+
+import (
+	"math/rand"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+type randomPickerBuilder struct {
+}
+
+func (b *randomPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	return &randomPicker{
+		nodes: readyNodes(info.ReadySCs),
+	}
+}
+
+// randomPicker 随机选择一个节点
+type randomPicker struct {
+	nodes []*node
+}
+
+func (p *randomPicker) Pick(info balancer.PickInfo) (result balancer.PickResult, err error) {
+	result.SubConn = p.nodes[rand.Intn(len(p.nodes))].subConn
+	return
+}
@@ -0,0 +1,204 @@
+package balancer
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lightmen/nami/metadata"
+	"github.com/lightmen/nami/transport/agrpc/resolver/discovery"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+const (
+	LabelVersion = "version" // 节点版本标签，优先使用 registry.Instance.Version，为空时使用 MetaData 中的值
+	LabelZone    = "zone"    // 节点区域标签，优先使用 registry.Instance.Zone，为空时使用 MetaData 中的值
+)
+
+// RouteRule 路由规则，请求满足所有匹配条件时，只在带有指定标签的节点中负载，用于灰度发布和就近访问，
+// 匹配条件为空表示不限制
+type RouteRule struct {
+	Name string `json:"name"`
+
+	// 匹配条件
+	UIDs    []string          `json:"uids,omitempty"`    // uid 白名单
+	Cmds    []string          `json:"cmds,omitempty"`    // 协议号
+	Headers map[string]string `json:"headers,omitempty"` // 请求的 metadata
+	Percent int               `json:"percent,omitempty"` // 按 uid(没有 uid 时按负载参数) hash 后匹配的百分比，取值 1-100，0 表示不限制
+
+	// 目标节点的标签
+	Version string            `json:"version,omitempty"`
+	Zone    string            `json:"zone,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// labels 目标节点需要满足的所有标签
+func (r *RouteRule) labels() map[string]string {
+	labels := make(map[string]string, len(r.Labels)+2)
+	for k, v := range r.Labels {
+		labels[k] = v
+	}
+	if r.Version != "" {
+		labels[LabelVersion] = r.Version
+	}
+	if r.Zone != "" {
+		labels[LabelZone] = r.Zone
+	}
+	return labels
+}
+
+func (r *RouteRule) match(ctx context.Context) bool {
+	md, _ := metadata.FromClientContext(ctx)
+	uid := md.Get(metadata.UIDKey)
+
+	if len(r.UIDs) > 0 && !contains(r.UIDs, uid) {
+		return false
+	}
+	if len(r.Cmds) > 0 && !contains(r.Cmds, md.Get(metadata.CmdKey)) {
+		return false
+	}
+	for k, v := range r.Headers {
+		if md.Get(k) != v {
+			return false
+		}
+	}
+
+	if r.Percent > 0 && r.Percent < 100 {
+		key := uid
+		if key == "" {
+			key, _ = FromParamContext(ctx)
+		}
+		if percentOf(key) >= r.Percent {
+			return false
+		}
+	}
+
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// percentOf 把 key 映射到 [0, 100)，同一个 key 的结果固定，灰度比例调大时已经命中的 key 保持命中
+func percentOf(key string) int {
+	f := fnv.New32a()
+	f.Write([]byte(key))
+	return int(f.Sum32() % 100)
+}
+
+var (
+	gRouteRules    atomic.Value // target -> []*RouteRule，整体替换，读取时不加锁
+	routeRulesLock sync.Mutex
+)
+
+func init() {
+	gRouteRules.Store(map[string][]*RouteRule{})
+}
+
+// SetRouteRules 设置 target 服务的路由规则，运行时可以随时修改，按顺序匹配，第一个匹配且有可用节点的规则生效，
+// rules 为空时删除 target 的路由规则
+func SetRouteRules(target string, rules []*RouteRule) {
+	routeRulesLock.Lock()
+	defer routeRulesLock.Unlock()
+
+	old := gRouteRules.Load().(map[string][]*RouteRule)
+	all := make(map[string][]*RouteRule, len(old)+1)
+	for k, v := range old {
+		all[k] = v
+	}
+	if len(rules) == 0 {
+		delete(all, target)
+	} else {
+		all[target] = rules
+	}
+	gRouteRules.Store(all)
+}
+
+// GetRouteRules 返回 target 服务的路由规则
+func GetRouteRules(target string) []*RouteRule {
+	return gRouteRules.Load().(map[string][]*RouteRule)[target]
+}
+
+// matchRouteRules 按顺序遍历 target 服务中匹配的规则，fn 返回 false 时停止
+func matchRouteRules(ctx context.Context, fn func(rule *RouteRule) bool) {
+	target, ok := FromTargetContext(ctx)
+	if !ok {
+		return
+	}
+
+	for _, rule := range GetRouteRules(target) {
+		if rule.match(ctx) && !fn(rule) {
+			return
+		}
+	}
+}
+
+// labelKey 标签的唯一标识，用于缓存相同标签的节点子集
+func labelKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(labels[k])
+		sb.WriteByte(';')
+	}
+	return sb.String()
+}
+
+// addressLabel 节点的标签，version 和 zone 优先使用 registry.Instance 中的字段
+func addressLabel(addr resolver.Address, key string) string {
+	attr := discovery.GetAttributes(addr)
+	switch key {
+	case LabelVersion:
+		if attr.Version != "" {
+			return attr.Version
+		}
+	case LabelZone:
+		if attr.Zone != "" {
+			return attr.Zone
+		}
+	}
+
+	if addr.Attributes == nil {
+		return ""
+	}
+	v, _ := addr.Attributes.Value(key).(string)
+	return v
+}
+
+// filterSubConns 返回带有所有标签的节点
+func filterSubConns(info base.PickerBuildInfo, labels map[string]string) base.PickerBuildInfo {
+	sub := base.PickerBuildInfo{
+		ReadySCs: make(map[balancer.SubConn]base.SubConnInfo),
+	}
+	for sc, conInfo := range info.ReadySCs {
+		matched := true
+		for k, v := range labels {
+			if addressLabel(conInfo.Address, k) != v {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			sub.ReadySCs[sc] = conInfo
+		}
+	}
+	return sub
+}
@@ -0,0 +1,115 @@
+package balancer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lightmen/nami/metadata"
+	"github.com/lightmen/nami/pkg/cast"
+	"github.com/lightmen/nami/transport/agrpc/resolver/discovery"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+// newVersionBuildInfo 生成 v1 和 v2 两个版本的节点，v2 节点的 zone 通过 MetaData 设置
+func newVersionBuildInfo() (base.PickerBuildInfo, *mockConn, *mockConn) {
+	v1, v2 := &mockConn{id: 1}, &mockConn{id: 2}
+	info := base.PickerBuildInfo{
+		ReadySCs: map[balancer.SubConn]base.SubConnInfo{
+			v1: {
+				Address: discovery.SetAttributes(resolver.Address{Addr: "127.0.0.1:10001"},
+					discovery.Attributes{Weight: 100, Version: "v1"}),
+			},
+			v2: {
+				Address: discovery.SetAttributes(resolver.Address{
+					Addr:       "127.0.0.1:10002",
+					Attributes: attributes.New(LabelZone, "sz"),
+				}, discovery.Attributes{Weight: 100, Version: "v2"}),
+			},
+		},
+	}
+	return info, v1, v2
+}
+
+func routeContext(uid string, kv ...string) context.Context {
+	ctx := NewTargetContext(context.Background(), "gamesrv")
+	ctx = NewParamContext(ctx, uid)
+	ctx = metadata.AppendUIDToClientContext(ctx, uid)
+	if len(kv) > 0 {
+		ctx = metadata.AppendToClientContext(ctx, kv...)
+	}
+	return ctx
+}
+
+func pickSubConn(t *testing.T, picker balancer.Picker, ctx context.Context) balancer.SubConn {
+	result, err := picker.Pick(balancer.PickInfo{Ctx: ctx})
+	if err != nil {
+		t.Fatalf("Pick got error: %v", err)
+	}
+	if result.Done != nil {
+		result.Done(balancer.DoneInfo{})
+	}
+	return result.SubConn
+}
+
+func TestRouteRule(t *testing.T) {
+	info, v1, v2 := newVersionBuildInfo()
+	picker := newMixPickerBuilder(options{}).Build(info)
+
+	SetRouteRules("gamesrv", []*RouteRule{
+		{Name: "whitelist", UIDs: []string{"10001"}, Version: "v2"},
+		{Name: "cmd", Cmds: []string{"1001"}, Headers: map[string]string{"x-md-channel": "test"}, Zone: "sz"},
+		{Name: "missing", UIDs: []string{"10003"}, Version: "v3"},
+	})
+	defer SetRouteRules("gamesrv", nil)
+
+	if sc := pickSubConn(t, picker, routeContext("10001")); sc != balancer.SubConn(v2) {
+		t.Fatalf("whitelist uid should route to v2")
+	}
+
+	if sc := pickSubConn(t, picker, routeContext("20001", metadata.CmdKey, "1001", "x-md-channel", "test")); sc != balancer.SubConn(v2) {
+		t.Fatalf("cmd and header should route to zone sz")
+	}
+
+	// 规则的目标节点不存在时，使用所有节点
+	seen := make(map[balancer.SubConn]bool)
+	for i := 0; i < 100; i++ {
+		seen[pickSubConn(t, picker, routeContext("10003", "x-md-seq", cast.ToString(i)))] = true
+		seen[pickSubConn(t, picker, routeContext(cast.ToString(i)))] = true
+	}
+	if !seen[v1] || !seen[v2] {
+		t.Fatalf("unmatched request should use all nodes")
+	}
+
+	// 其他 target 不受影响
+	ctx := NewParamContext(NewTargetContext(context.Background(), "roomsrv"), "10001")
+	ctx = metadata.AppendUIDToClientContext(ctx, "10001")
+	pickSubConn(t, picker, ctx)
+}
+
+func TestRouteRulePercent(t *testing.T) {
+	info, _, v2 := newVersionBuildInfo()
+	picker := newMixPickerBuilder(options{}).Build(info)
+
+	SetRouteRules("gamesrv", []*RouteRule{
+		{Name: "canary", Percent: 20, Version: "v2"},
+	})
+	defer SetRouteRules("gamesrv", nil)
+
+	canary := 0
+	for i := 0; i < 10000; i++ {
+		uid := cast.ToString(100000 + i)
+		// percentOf 命中的 uid 一定在 v2
+		if percentOf(uid) < 20 {
+			if sc := pickSubConn(t, picker, routeContext(uid)); sc != balancer.SubConn(v2) {
+				t.Fatalf("uid %s should route to v2", uid)
+			}
+			canary++
+		}
+	}
+	if canary < 1500 || canary > 2500 {
+		t.Fatalf("expect about 20%% canary uid, got: %d", canary)
+	}
+}
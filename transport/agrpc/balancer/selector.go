@@ -20,6 +20,11 @@ type Picker interface {
 	Name() string
 }
 
+// Remover Picker 可选实现，服务的节点全部下线时删除该服务的状态
+type Remover interface {
+	Remove(target string)
+}
+
 type selector struct {
 	sync.RWMutex
 	pickers map[string]Picker
@@ -59,3 +64,15 @@ func (s *selector) Update(info base.PickerBuildInfo) {
 		builder.Build(info)
 	}
 }
+
+// Remove 服务的节点全部下线，通知各个 Picker 删除该服务的状态
+func (s *selector) Remove(target string) {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, picker := range s.pickers {
+		if r, ok := picker.(Remover); ok {
+			r.Remove(target)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package sticky
+
+import "time"
+
+// Option is sticky table option.
+type Option func(o *options)
+
+type options struct {
+	ttl     time.Duration
+	store   Store
+	nowFunc func() time.Time
+}
+
+// TTL 绑定关系的空闲过期时间，超过该时间没有请求的 route 会被解绑
+func TTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// WithStore 持久化绑定关系，如 NewEtcdStore，不设置时只保存在本地内存
+func WithStore(store Store) Option {
+	return func(o *options) {
+		o.store = store
+	}
+}
@@ -0,0 +1,166 @@
+package sticky
+
+import (
+	"context"
+	"sync"
+
+	"github.com/lightmen/nami/pkg/hash/rendezvous"
+	"github.com/lightmen/nami/transport/agrpc/balancer"
+	"github.com/lightmen/nami/transport/agrpc/resolver/discovery"
+	grpcbalancer "google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+// Name sticky picker 的名字，使用 balancer.NewNameContext(ctx, sticky.Name) 选择粘性路由
+const Name = "sticky"
+
+var (
+	_ balancer.Picker  = (*Picker)(nil)
+	_ balancer.Remover = (*Picker)(nil)
+)
+
+type node struct {
+	subConn grpcbalancer.SubConn
+	up      bool
+}
+
+// service 一个 target 服务的节点
+type service struct {
+	nodes map[string]*node // addr -> node
+	hash  *rendezvous.Rendezvous
+}
+
+// Picker 粘性路由的 Picker，通过 balancer.RegisterPicker 注册后，mix 负载在一致性hash之前使用，
+// route 第一次请求时按 hash 选择节点并记录绑定关系，之后一直使用该节点，
+// 节点下线或者不再是 UP 状态(如 DRAINING)时，route 迁移到新的节点
+type Picker struct {
+	table *Table
+
+	lk       sync.RWMutex
+	services map[string]*service // target -> service
+}
+
+// Register 创建粘性路由的 Picker 并注册到 mix 负载
+func Register(table *Table) *Picker {
+	p := NewPicker(table)
+	balancer.RegisterPicker(p)
+	return p
+}
+
+// NewPicker creates sticky picker
+func NewPicker(table *Table) *Picker {
+	return &Picker{
+		table:    table,
+		services: make(map[string]*service),
+	}
+}
+
+func (p *Picker) Name() string {
+	return Name
+}
+
+// Match 指定了 sticky 负载，并且有 target 和 route 参数时使用粘性路由
+func (p *Picker) Match(ctx context.Context) bool {
+	if name, ok := balancer.FromNameContext(ctx); !ok || name != Name {
+		return false
+	}
+	if _, ok := balancer.FromTargetContext(ctx); !ok {
+		return false
+	}
+	_, ok := balancer.FromParamContext(ctx)
+	return ok
+}
+
+// Build 更新 target 服务的节点，所有服务共用一个 Picker，按 resolver.Address.ServerName 区分服务
+func (p *Picker) Build(info base.PickerBuildInfo) grpcbalancer.Picker {
+	services := make(map[string]*service)
+	for sc, conInfo := range info.ReadySCs {
+		target := conInfo.Address.ServerName
+		svc, ok := services[target]
+		if !ok {
+			svc = &service{
+				nodes: make(map[string]*node),
+				hash:  rendezvous.New(),
+			}
+			services[target] = svc
+		}
+
+		attr := discovery.GetAttributes(conInfo.Address)
+		svc.nodes[conInfo.Address.Addr] = &node{
+			subConn: sc,
+			up:      attr.IsUp(),
+		}
+		if attr.IsUp() {
+			svc.hash.AddWithWeight(conInfo.Address.Addr, attr.Weight)
+		}
+	}
+
+	// 所有节点都不可用时，使用全部节点
+	for _, svc := range services {
+		if !svc.hash.IsEmpty() {
+			continue
+		}
+		for addr, n := range svc.nodes {
+			n.up = true
+			svc.hash.Add(addr)
+		}
+	}
+
+	p.lk.Lock()
+	for target, svc := range services {
+		p.services[target] = svc
+	}
+	p.lk.Unlock()
+
+	return p
+}
+
+// Remove 服务的节点全部下线后删除该服务，绑定关系由 Table 超时清理
+func (p *Picker) Remove(target string) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	delete(p.services, target)
+}
+
+func (p *Picker) Pick(info grpcbalancer.PickInfo) (result grpcbalancer.PickResult, err error) {
+	target, _ := balancer.FromTargetContext(info.Ctx)
+	route, _ := balancer.FromParamContext(info.Ctx)
+
+	p.lk.RLock()
+	svc, ok := p.services[target]
+	p.lk.RUnlock()
+	if !ok {
+		err = grpcbalancer.ErrNoSubConnAvailable
+		return
+	}
+
+	// 绑定关系还在从 Store 中加载，按 hash 选择节点，不记录绑定关系，避免阻塞请求
+	if !p.table.Ready(target) {
+		addr, ok := svc.hash.Get(route)
+		if !ok {
+			err = grpcbalancer.ErrNoSubConnAvailable
+			return
+		}
+		result.SubConn = svc.nodes[addr].subConn
+		return
+	}
+
+	if addr, ok := p.table.Lookup(target, route); ok {
+		if n, ok := svc.nodes[addr]; ok && n.up {
+			result.SubConn = n.subConn
+			return
+		}
+	}
+
+	// 没有绑定，或者绑定的节点已经不可用，重新选择节点
+	addr, ok := svc.hash.Get(route)
+	if !ok {
+		err = grpcbalancer.ErrNoSubConnAvailable
+		return
+	}
+
+	p.table.Bind(target, route, addr)
+	result.SubConn = svc.nodes[addr].subConn
+	return
+}
@@ -0,0 +1,308 @@
+package sticky
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lightmen/nami/registry"
+	"github.com/lightmen/nami/transport/agrpc/balancer"
+	"github.com/lightmen/nami/transport/agrpc/resolver/discovery"
+	grpcbalancer "google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+type mockConn struct {
+	grpcbalancer.SubConn
+	addr string
+}
+
+type memoryStore struct {
+	sync.Mutex
+	routes map[string]string
+}
+
+func (s *memoryStore) Load(ctx context.Context, target string) (map[string]string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	routes := make(map[string]string, len(s.routes))
+	for k, v := range s.routes {
+		routes[k] = v
+	}
+	return routes, nil
+}
+
+func (s *memoryStore) Save(ctx context.Context, target, route, addr string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.routes[route] = addr
+	return nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, target, route string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.routes, route)
+	return nil
+}
+
+func buildInfo(status map[string]registry.Status) base.PickerBuildInfo {
+	info := base.PickerBuildInfo{
+		ReadySCs: make(map[grpcbalancer.SubConn]base.SubConnInfo),
+	}
+	for addr, st := range status {
+		address := resolver.Address{Addr: addr, ServerName: "roomsrv"}
+		address = discovery.SetAttributes(address, discovery.Attributes{Weight: 100, Status: st})
+		info.ReadySCs[&mockConn{addr: addr}] = base.SubConnInfo{Address: address}
+	}
+	return info
+}
+
+func pick(t *testing.T, p *Picker, route string) string {
+	ctx := balancer.NewNameContext(context.Background(), Name)
+	ctx = balancer.NewTargetContext(ctx, "roomsrv")
+	ctx = balancer.NewParamContext(ctx, route)
+	if !p.Match(ctx) {
+		t.Fatalf("expect match")
+	}
+
+	result, err := p.Pick(grpcbalancer.PickInfo{Ctx: ctx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.SubConn.(*mockConn).addr
+}
+
+func TestPicker(t *testing.T) {
+	table := NewTable()
+	defer table.Close()
+	p := NewPicker(table)
+
+	if p.Match(balancer.NewParamContext(context.Background(), "room1")) {
+		t.Fatalf("expect not match without sticky name")
+	}
+
+	p.Build(buildInfo(map[string]registry.Status{
+		"127.0.0.1:1001": registry.StatusUp,
+		"127.0.0.1:1002": registry.StatusUp,
+	}))
+
+	routes := make(map[string]string)
+	for _, route := range []string{"room1", "room2", "room3", "room4", "room5", "room6"} {
+		routes[route] = pick(t, p, route)
+	}
+
+	// 新节点加入，已绑定的 route 不迁移
+	p.Build(buildInfo(map[string]registry.Status{
+		"127.0.0.1:1001": registry.StatusUp,
+		"127.0.0.1:1002": registry.StatusUp,
+		"127.0.0.1:1003": registry.StatusUp,
+	}))
+	for route, addr := range routes {
+		if got := pick(t, p, route); got != addr {
+			t.Fatalf("route %s moved: %s -> %s", route, addr, got)
+		}
+	}
+
+	// 节点 DRAINING 后，绑定在该节点上的 route 迁移到其他节点
+	p.Build(buildInfo(map[string]registry.Status{
+		"127.0.0.1:1001": registry.StatusDraining,
+		"127.0.0.1:1002": registry.StatusUp,
+		"127.0.0.1:1003": registry.StatusUp,
+	}))
+	for route, addr := range routes {
+		got := pick(t, p, route)
+		if got == "127.0.0.1:1001" {
+			t.Fatalf("route %s picked draining node", route)
+		}
+		if addr != "127.0.0.1:1001" && got != addr {
+			t.Fatalf("route %s moved: %s -> %s", route, addr, got)
+		}
+		if bound, _ := table.Lookup("roomsrv", route); bound != got {
+			t.Fatalf("route %s not rebound: %s", route, bound)
+		}
+	}
+}
+
+func TestTableExpire(t *testing.T) {
+	now := time.Now()
+	table := NewTable(TTL(time.Minute))
+	defer table.Close()
+	table.opts.nowFunc = func() time.Time { return now }
+
+	table.Bind("roomsrv", "room1", "127.0.0.1:1001")
+	table.Bind("roomsrv", "room2", "127.0.0.1:1002")
+
+	now = now.Add(50 * time.Second)
+	if _, ok := table.Lookup("roomsrv", "room1"); !ok {
+		t.Fatalf("room1 should not expire")
+	}
+
+	// room2 超过 TTL 没有使用
+	now = now.Add(20 * time.Second)
+	table.Expire()
+	if _, ok := table.Lookup("roomsrv", "room2"); ok {
+		t.Fatalf("room2 should expire")
+	}
+	if _, ok := table.Lookup("roomsrv", "room1"); !ok {
+		t.Fatalf("room1 should not expire")
+	}
+	if n := table.Len("roomsrv"); n != 1 {
+		t.Fatalf("expect 1 binding, got: %d", n)
+	}
+}
+
+func TestTableStore(t *testing.T) {
+	store := &memoryStore{routes: map[string]string{"room1": "127.0.0.1:1001"}}
+
+	table := NewTable(WithStore(store))
+	defer table.Close()
+
+	// 第一次使用时在后台从 Store 中加载
+	deadline := time.Now().Add(time.Second)
+	for !table.Ready("roomsrv") {
+		if time.Now().After(deadline) {
+			t.Fatal("routes not loaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if addr, _ := table.Lookup("roomsrv", "room1"); addr != "127.0.0.1:1001" {
+		t.Fatalf("expect loaded binding, got: %s", addr)
+	}
+
+	table.Bind("roomsrv", "room2", "127.0.0.1:1002")
+	table.Unbind("roomsrv", "room1")
+
+	deadline = time.Now().Add(time.Second)
+	for {
+		routes, _ := store.Load(context.Background(), "roomsrv")
+		if len(routes) == 1 && routes["room2"] == "127.0.0.1:1002" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("store not updated: %v", routes)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// slowStore 写入很慢的 Store，记录每个 route 的写入顺序
+type slowStore struct {
+	memoryStore
+	ops []string
+}
+
+func (s *slowStore) Save(ctx context.Context, target, route, addr string) error {
+	time.Sleep(20 * time.Millisecond)
+	s.Lock()
+	s.ops = append(s.ops, "save:"+route)
+	s.Unlock()
+	return s.memoryStore.Save(ctx, target, route, addr)
+}
+
+func (s *slowStore) Delete(ctx context.Context, target, route string) error {
+	s.Lock()
+	s.ops = append(s.ops, "delete:"+route)
+	s.Unlock()
+	return s.memoryStore.Delete(ctx, target, route)
+}
+
+func TestTableStoreOrder(t *testing.T) {
+	store := &slowStore{memoryStore: memoryStore{routes: map[string]string{}}}
+	table := NewTable(WithStore(store))
+	defer table.Close()
+
+	for i := 0; i < 10; i++ {
+		table.Bind("roomsrv", "room1", "127.0.0.1:1001")
+		table.Unbind("roomsrv", "room1")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		store.Lock()
+		n := len(store.ops)
+		last := ""
+		if n > 0 {
+			last = store.ops[n-1]
+		}
+		_, bound := store.routes["room1"]
+		store.Unlock()
+		if last == "delete:room1" && !bound {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("store ops = %v", store.ops)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// blockStore Load 一直阻塞直到 release 关闭
+type blockStore struct {
+	memoryStore
+	release chan struct{}
+}
+
+func (s *blockStore) Load(ctx context.Context, target string) (map[string]string, error) {
+	<-s.release
+	return s.memoryStore.Load(ctx, target)
+}
+
+func TestPickerLoading(t *testing.T) {
+	store := &blockStore{
+		memoryStore: memoryStore{routes: map[string]string{"room1": "127.0.0.1:1003"}},
+		release:     make(chan struct{}),
+	}
+	table := NewTable(WithStore(store))
+	defer table.Close()
+
+	p := NewPicker(table)
+	p.Build(buildInfo(map[string]registry.Status{
+		"127.0.0.1:1001": registry.StatusUp,
+		"127.0.0.1:1002": registry.StatusUp,
+		"127.0.0.1:1003": registry.StatusUp,
+	}))
+
+	// 加载过程中不阻塞，也不记录绑定关系
+	pick(t, p, "room1")
+	if n := table.Len("roomsrv"); n != 0 {
+		t.Fatalf("expect no binding while loading, got: %d", n)
+	}
+
+	close(store.release)
+	deadline := time.Now().Add(time.Second)
+	for !table.Ready("roomsrv") {
+		if time.Now().After(deadline) {
+			t.Fatal("routes not loaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if addr := pick(t, p, "room1"); addr != "127.0.0.1:1003" {
+		t.Fatalf("expect stored binding, got: %s", addr)
+	}
+}
+
+func TestPickerRemove(t *testing.T) {
+	table := NewTable()
+	defer table.Close()
+
+	p := NewPicker(table)
+	p.Build(buildInfo(map[string]registry.Status{
+		"127.0.0.1:1001": registry.StatusUp,
+	}))
+	pick(t, p, "room1")
+
+	// 服务的节点全部下线后删除该服务
+	p.Remove("roomsrv")
+	ctx := balancer.NewNameContext(context.Background(), Name)
+	ctx = balancer.NewTargetContext(ctx, "roomsrv")
+	ctx = balancer.NewParamContext(ctx, "room1")
+	if _, err := p.Pick(grpcbalancer.PickInfo{Ctx: ctx}); err != grpcbalancer.ErrNoSubConnAvailable {
+		t.Fatalf("expect ErrNoSubConnAvailable, got: %v", err)
+	}
+}
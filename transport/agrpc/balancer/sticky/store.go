@@ -0,0 +1,153 @@
+package sticky
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lightmen/nami/pkg/safe"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Store 绑定关系的持久化存储，多个客户端共享同一个 Store 时，route 会被绑定到同一个节点
+type Store interface {
+	// Load 加载 target 服务的所有绑定关系，返回 route -> addr
+	Load(ctx context.Context, target string) (map[string]string, error)
+	// Save 保存绑定关系
+	Save(ctx context.Context, target, route, addr string) error
+	// Delete 删除绑定关系
+	Delete(ctx context.Context, target, route string) error
+}
+
+var _ Store = (*EtcdStore)(nil)
+
+// DefaultLeaseTTL EtcdStore 租约的默认过期时间
+const DefaultLeaseTTL = 60 * time.Second
+
+// EtcdOption is etcd store option.
+type EtcdOption func(s *EtcdStore)
+
+// LeaseTTL 绑定关系租约的过期时间，写入的进程退出后，绑定关系在该时间之后从 etcd 中删除
+func LeaseTTL(ttl time.Duration) EtcdOption {
+	return func(s *EtcdStore) {
+		s.ttl = ttl
+	}
+}
+
+// EtcdStore 保存在 etcd 中的绑定关系，key 为 prefix/target/route，value 为 addr。
+// 绑定关系使用本进程的租约写入并自动续约，不再使用时调用 Close 停止续约
+type EtcdStore struct {
+	client *clientv3.Client
+	prefix string
+	ttl    time.Duration
+
+	lk      sync.Mutex
+	leaseID clientv3.LeaseID // 当前的租约，0 表示需要重新创建
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewEtcdStore creates etcd store, 与 registry/etcd 共用同一个 client
+func NewEtcdStore(client *clientv3.Client, prefix string, opts ...EtcdOption) *EtcdStore {
+	s := &EtcdStore{
+		client: client,
+		prefix: strings.TrimSuffix(prefix, "/"),
+		ttl:    DefaultLeaseTTL,
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+func (s *EtcdStore) Load(ctx context.Context, target string) (map[string]string, error) {
+	pfx := s.key(target, "")
+	rsp, err := s.client.Get(ctx, pfx, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make(map[string]string, len(rsp.Kvs))
+	for _, kv := range rsp.Kvs {
+		routes[strings.TrimPrefix(string(kv.Key), pfx)] = string(kv.Value)
+	}
+	return routes, nil
+}
+
+func (s *EtcdStore) Save(ctx context.Context, target, route, addr string) error {
+	leaseID, err := s.lease(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.Put(ctx, s.key(target, route), addr, clientv3.WithLease(leaseID))
+	if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		// 租约已经过期，重新创建后再写入一次
+		s.resetLease(leaseID)
+		if leaseID, err = s.lease(ctx); err != nil {
+			return err
+		}
+		_, err = s.client.Put(ctx, s.key(target, route), addr, clientv3.WithLease(leaseID))
+	}
+	return err
+}
+
+func (s *EtcdStore) Delete(ctx context.Context, target, route string) error {
+	_, err := s.client.Delete(ctx, s.key(target, route))
+	return err
+}
+
+// Close 停止续约，已经写入的绑定关系在租约过期后删除
+func (s *EtcdStore) Close() error {
+	s.cancel()
+	return nil
+}
+
+// lease 返回写入使用的租约，没有租约或者续约已经停止时重新创建
+func (s *EtcdStore) lease(ctx context.Context) (clientv3.LeaseID, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if s.leaseID != 0 {
+		return s.leaseID, nil
+	}
+	if err := s.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	grant, err := s.client.Grant(ctx, int64(s.ttl.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+	kac, err := s.client.KeepAlive(s.ctx, grant.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	s.leaseID = grant.ID
+	safe.Go(func() {
+		for range kac {
+		}
+		s.resetLease(grant.ID)
+	})
+	return grant.ID, nil
+}
+
+func (s *EtcdStore) resetLease(leaseID clientv3.LeaseID) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if s.leaseID == leaseID {
+		s.leaseID = 0
+	}
+}
+
+func (s *EtcdStore) key(target, route string) string {
+	return fmt.Sprintf("%s/%s/%s", s.prefix, target, route)
+}
@@ -0,0 +1,279 @@
+// Package sticky 粘性路由，把 route 绑定到固定的节点，节点加入时不会像一致性hash那样迁移 route，
+// 适用于房间等在内存中保存状态的服务
+package sticky
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lightmen/nami/alog"
+	"github.com/lightmen/nami/pkg/safe"
+)
+
+const storeTimeout = 3 * time.Second
+
+type binding struct {
+	addr   string
+	active time.Time // 最后一次使用的时间
+}
+
+// storeOp 等待写入 Store 的绑定关系变化，addr 为空时删除
+type storeOp struct {
+	target string
+	route  string
+	addr   string
+}
+
+// Table 路由表，记录 target 服务中 route -> addr 的绑定关系
+type Table struct {
+	opts *options
+
+	lk      sync.Mutex
+	targets map[string]map[string]*binding // target -> route -> binding
+	loaded  map[string]bool                // target 是否已经从 Store 中加载，false 表示正在加载
+
+	storeLk sync.Mutex
+	pending map[string]storeOp // target/route -> 最新的变化，同一个 route 只保留最后一次
+	notify  chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewTable creates routing table, 后台定期清理过期的绑定关系，不再使用时调用 Close
+func NewTable(opts ...Option) *Table {
+	op := &options{
+		ttl:     30 * time.Minute,
+		nowFunc: time.Now,
+	}
+	for _, o := range opts {
+		o(op)
+	}
+
+	t := &Table{
+		opts:    op,
+		targets: make(map[string]map[string]*binding),
+		loaded:  make(map[string]bool),
+		pending: make(map[string]storeOp),
+		notify:  make(chan struct{}, 1),
+	}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+
+	safe.Go(t.sweep)
+	if op.store != nil {
+		safe.Go(t.storeLoop)
+	}
+	return t
+}
+
+// Ready 返回 target 的绑定关系是否已经从 Store 中加载，第一次调用时在后台加载
+func (t *Table) Ready(target string) bool {
+	if t.opts.store == nil {
+		return true
+	}
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	loaded, ok := t.loaded[target]
+	if !ok {
+		t.loaded[target] = false
+		safe.Go(func() { t.load(target) })
+	}
+	return loaded
+}
+
+// Lookup 返回 route 绑定的节点地址，并刷新绑定关系的使用时间
+func (t *Table) Lookup(target, route string) (string, bool) {
+	t.Ready(target)
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	b, ok := t.targets[target][route]
+	if !ok {
+		return "", false
+	}
+
+	now := t.opts.nowFunc()
+	if now.Sub(b.active) > t.opts.ttl {
+		t.unbind(target, route)
+		return "", false
+	}
+
+	b.active = now
+	return b.addr, true
+}
+
+// Bind 把 route 绑定到 addr，已有绑定关系时替换
+func (t *Table) Bind(target, route, addr string) {
+	t.lk.Lock()
+	routes, ok := t.targets[target]
+	if !ok {
+		routes = make(map[string]*binding)
+		t.targets[target] = routes
+	}
+	routes[route] = &binding{
+		addr:   addr,
+		active: t.opts.nowFunc(),
+	}
+	t.lk.Unlock()
+
+	t.store(storeOp{target: target, route: route, addr: addr})
+}
+
+// Unbind 解除 route 的绑定关系
+func (t *Table) Unbind(target, route string) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	t.unbind(target, route)
+}
+
+// Len 返回 target 服务的绑定关系数量
+func (t *Table) Len(target string) int {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	return len(t.targets[target])
+}
+
+// Close 停止清理过期的绑定关系
+func (t *Table) Close() {
+	t.cancel()
+}
+
+// unbind 调用时需持有锁
+func (t *Table) unbind(target, route string) {
+	routes, ok := t.targets[target]
+	if !ok {
+		return
+	}
+	if _, ok = routes[route]; !ok {
+		return
+	}
+
+	delete(routes, route)
+	if len(routes) == 0 {
+		delete(t.targets, target)
+	}
+
+	t.store(storeOp{target: target, route: route})
+}
+
+// Expire 清理所有过期的绑定关系
+func (t *Table) Expire() {
+	now := t.opts.nowFunc()
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	for target, routes := range t.targets {
+		for route, b := range routes {
+			if now.Sub(b.active) > t.opts.ttl {
+				t.unbind(target, route)
+			}
+		}
+	}
+}
+
+func (t *Table) sweep() {
+	interval := t.opts.ttl / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-ticker.C:
+			t.Expire()
+		}
+	}
+}
+
+// load 从 Store 中加载绑定关系，失败时下次 Ready 重新加载
+func (t *Table) load(target string) {
+	ctx, cancel := context.WithTimeout(t.ctx, storeTimeout)
+	defer cancel()
+
+	routes, err := t.opts.store.Load(ctx, target)
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	if err != nil {
+		alog.Error("[sticky][%s] load routes error: %s", target, err.Error())
+		delete(t.loaded, target)
+		return
+	}
+	t.loaded[target] = true
+
+	now := t.opts.nowFunc()
+	bindings, ok := t.targets[target]
+	if !ok {
+		bindings = make(map[string]*binding, len(routes))
+		t.targets[target] = bindings
+	}
+	for route, addr := range routes {
+		// 本地已有的绑定关系比 Store 中的新，不覆盖
+		if _, ok = bindings[route]; !ok {
+			bindings[route] = &binding{addr: addr, active: now}
+		}
+	}
+}
+
+// store 异步写入 Store，不阻塞请求，同一个 route 的变化按顺序写入
+func (t *Table) store(op storeOp) {
+	if t.opts.store == nil {
+		return
+	}
+
+	t.storeLk.Lock()
+	t.pending[op.target+"/"+op.route] = op
+	t.storeLk.Unlock()
+
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+}
+
+// storeLoop 唯一的写入协程，每次取出所有等待写入的变化
+func (t *Table) storeLoop() {
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-t.notify:
+		}
+
+		t.storeLk.Lock()
+		ops := t.pending
+		t.pending = make(map[string]storeOp)
+		t.storeLk.Unlock()
+
+		for _, op := range ops {
+			t.write(op)
+		}
+	}
+}
+
+func (t *Table) write(op storeOp) {
+	ctx, cancel := context.WithTimeout(t.ctx, storeTimeout)
+	defer cancel()
+
+	var err error
+	if op.addr == "" {
+		err = t.opts.store.Delete(ctx, op.target, op.route)
+	} else {
+		err = t.opts.store.Save(ctx, op.target, op.route, op.addr)
+	}
+	if err != nil {
+		alog.Error("[sticky][%s] store route %s error: %s", op.target, op.route, err.Error())
+	}
+}
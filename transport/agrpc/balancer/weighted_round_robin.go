@@ -0,0 +1,48 @@
+package balancer
+
+import (
+	"sync"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+type weightedRoundRobinPickerBuilder struct {
+}
+
+func (b *weightedRoundRobinPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	nodes := readyNodes(info.ReadySCs)
+	return &weightedRoundRobinPicker{
+		nodes:   nodes,
+		current: make([]int, len(nodes)),
+	}
+}
+
+// weightedRoundRobinPicker 平滑加权轮询，按节点权重分配请求，且同一个节点的请求不会连续集中
+type weightedRoundRobinPicker struct {
+	sync.Mutex
+	nodes   []*node
+	current []int // 每个节点当前的权重
+}
+
+func (p *weightedRoundRobinPicker) Pick(info balancer.PickInfo) (result balancer.PickResult, err error) {
+	p.Lock()
+	defer p.Unlock()
+
+	total, best := 0, -1
+	for i, n := range p.nodes {
+		p.current[i] += n.weight
+		total += n.weight
+		if best == -1 || p.current[i] > p.current[best] {
+			best = i
+		}
+	}
+	p.current[best] -= total
+
+	result.SubConn = p.nodes[best].subConn
+	return
+}
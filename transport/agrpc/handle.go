@@ -7,6 +7,7 @@ import (
 	"github.com/lightmen/nami/alog"
 	"github.com/lightmen/nami/codes"
 	"github.com/lightmen/nami/message"
+	"github.com/lightmen/nami/metadata"
 	"github.com/lightmen/nami/pkg/aerror"
 	"github.com/lightmen/nami/schedule"
 )
@@ -53,7 +54,7 @@ func (s *Server) handlePacket(ctx context.Context, in *message.Packet) chan *sch
 	head := in.Head
 	meta := head
 
-	fn := func(j *schedule.Job) {
+	handle := func(ctx context.Context, j *schedule.Job) {
 		rsp, err := s.service.HandlePacket(ctx, head.Cmd, in.Body)
 		j.ResultChan <- &schedule.Result{
 			Rsp: rsp,
@@ -61,7 +62,20 @@ func (s *Server) handlePacket(ctx context.Context, in *message.Packet) chan *sch
 		}
 	}
 
+	fn := func(j *schedule.Job) {
+		handle(ctx, j)
+	}
+
 	job := schedule.NewJob(in.Head.Route, fn, meta)
+
+	//同一个玩家的请求不论 Route 是否相同都串行执行
+	if uid := metadata.GetUID(ctx); s.executor != nil && uid != "" {
+		s.executor.Execute(ctx, uid, func(ctx context.Context) {
+			handle(ctx, job)
+		})
+		return job.ResultChan
+	}
+
 	s.sched.Schedule(job)
 
 	return job.ResultChan
@@ -8,6 +8,7 @@ import (
 	"github.com/lightmen/nami/middleware"
 	"github.com/lightmen/nami/schedule"
 	"github.com/lightmen/nami/service"
+	"github.com/lightmen/nami/session"
 )
 
 type ServerOption func(s *Server)
@@ -48,6 +49,13 @@ func Scheduler(sched schedule.Scheduler) ServerOption {
 	}
 }
 
+// SessionExecutor 有uid的请求在session的mailbox中串行执行，不使用Scheduler
+func SessionExecutor(e *session.Executor) ServerOption {
+	return func(s *Server) {
+		s.executor = e
+	}
+}
+
 func Service(svc service.Service) ServerOption {
 	return func(s *Server) {
 		s.service = svc
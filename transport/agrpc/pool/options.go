@@ -99,3 +99,13 @@ func Dial(address string) (*grpc.ClientConn, error) {
 			})),
 	)
 }
+
+// WithSize 设置连接池的大小，常驻 maxIdle 个物理连接，最多 maxActive 个物理连接，
+// 每个物理连接的并发流数超过 maxStreams 时扩容
+func WithSize(maxIdle, maxActive, maxStreams int) Option {
+	return func(o *options) {
+		o.MaxIdle = maxIdle
+		o.MaxActive = maxActive
+		o.MaxConcurrentStreams = maxStreams
+	}
+}
@@ -26,6 +26,16 @@ type Pool interface {
 
 	// Status returns the current status of the pool.
 	Status() string
+
+	// Stats returns the current statistics of the pool.
+	Stats() Stats
+}
+
+// Stats 连接池的统计信息
+type Stats struct {
+	Address string // 连接的地址
+	Conns   int    // 物理连接数
+	Streams int    // 正在使用的逻辑连接数(并发流数)
 }
 
 type pool struct {
@@ -134,6 +144,7 @@ func (p *pool) Get() (Conn, error) {
 	current := p.current.Load()
 	p.RUnlock()
 	if current == 0 {
+		p.ref.Add(-1)
 		return nil, ErrClosed
 	}
 	if nextRef <= current*int32(p.opt.MaxConcurrentStreams) {
@@ -150,7 +161,11 @@ func (p *pool) Get() (Conn, error) {
 		}
 		// the third create one-time connection
 		c, err := p.opt.Dial(p.address)
-		return p.wrapConn(c, true), err
+		if err != nil {
+			p.decrRef()
+			return nil, err
+		}
+		return p.wrapConn(c, true), nil
 	}
 
 	// the fourth create new connections given back to pool
@@ -179,6 +194,7 @@ func (p *pool) Get() (Conn, error) {
 		p.current.Store(current)
 		if err != nil {
 			p.Unlock()
+			p.decrRef()
 			return nil, err
 		}
 	}
@@ -189,7 +205,7 @@ func (p *pool) Get() (Conn, error) {
 
 // Close see Pool interface.
 func (p *pool) Close() error {
-	p.closed.Store(0)
+	p.closed.Store(1)
 	p.index.Store(0)
 	p.current.Store(0)
 	p.ref.Store(0)
@@ -203,3 +219,12 @@ func (p *pool) Status() string {
 	return fmt.Sprintf("address:%s, index:%d, current:%d, ref:%d. option:%+v",
 		p.address, p.index.Load(), p.current.Load(), p.ref.Load(), p.opt)
 }
+
+// Stats see Pool interface.
+func (p *pool) Stats() Stats {
+	return Stats{
+		Address: p.address,
+		Conns:   int(p.current.Load()),
+		Streams: int(p.ref.Load()),
+	}
+}
@@ -0,0 +1,56 @@
+package pool
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// failingDial 只有前 n 次拨号成功
+func failingDial(n int) Option {
+	return WithDial(func(address string) (*grpc.ClientConn, error) {
+		if n <= 0 {
+			return nil, errors.New("dial failed")
+		}
+		n--
+		return grpc.NewClient("passthrough:///"+address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	})
+}
+
+func TestGetDialError(t *testing.T) {
+	noReuse := func(o *options) { o.Reuse = false }
+	for name, opts := range map[string][]Option{
+		"grow":    {WithSize(1, 2, 1)},
+		"oneTime": {WithSize(1, 1, 1), noReuse},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p, err := New("127.0.0.1:1", append(opts, failingDial(1))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Close()
+
+			c, err := p.Get()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// 拨号失败时归还引用计数
+			for i := 0; i < 3; i++ {
+				if c, err := p.Get(); err == nil || c != nil {
+					t.Fatalf("expect dial error and nil conn, got: %v, %v", c, err)
+				}
+			}
+			if n := p.Stats().Streams; n != 1 {
+				t.Fatalf("expect 1 stream, got: %d", n)
+			}
+
+			c.Close()
+			if n := p.Stats().Streams; n != 0 {
+				t.Fatalf("expect 0 stream, got: %d", n)
+			}
+		})
+	}
+}
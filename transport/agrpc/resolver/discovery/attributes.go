@@ -0,0 +1,49 @@
+package discovery
+
+import (
+	"github.com/lightmen/nami/registry"
+	"google.golang.org/grpc/resolver"
+)
+
+type attrKey struct{}
+
+// Attributes 节点的负载信息，由 resolver 写入 resolver.Address.BalancerAttributes 供 balancer 使用，
+// 放在 BalancerAttributes 中，节点状态和权重变更时不会重建连接
+type Attributes struct {
+	Weight  int
+	Zone    string
+	Version string
+	Status  registry.Status
+}
+
+// IsUp 节点是否可以接收新的流量
+func (a Attributes) IsUp() bool {
+	return a.Status == registry.StatusUp
+}
+
+func newAttributes(ins *registry.Instance) Attributes {
+	return Attributes{
+		Weight:  ins.GetWeight(),
+		Zone:    ins.Zone,
+		Version: ins.Version,
+		Status:  ins.GetStatus(),
+	}
+}
+
+// SetAttributes 设置地址对应节点的负载信息
+func SetAttributes(addr resolver.Address, attr Attributes) resolver.Address {
+	addr.BalancerAttributes = addr.BalancerAttributes.WithValue(attrKey{}, attr)
+	return addr
+}
+
+// GetAttributes 返回地址对应节点的负载信息，如果地址不是由 discovery resolver 生成的，返回默认值
+func GetAttributes(addr resolver.Address) Attributes {
+	if attr, ok := addr.BalancerAttributes.Value(attrKey{}).(Attributes); ok {
+		return attr
+	}
+
+	return Attributes{
+		Weight: registry.DefaultWeight,
+		Status: registry.StatusUp,
+	}
+}
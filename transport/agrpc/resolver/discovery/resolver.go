@@ -65,6 +65,7 @@ func (r *discoveryResolver) update(ins []*registry.Instance) {
 			Addr:       ept,
 		}
 		addr.Attributes = addr.Attributes.WithValue("rawServiceInstance", in)
+		addr = SetAttributes(addr, newAttributes(in))
 		addrs = append(addrs, addr)
 	}
 	if len(addrs) == 0 {
@@ -69,3 +69,50 @@ func TestWatch(t *testing.T) {
 	r.watch()
 	t.Log("watch goroutine exited after 2 second")
 }
+
+type stateClientConn struct {
+	resolver.ClientConn
+	state resolver.State
+}
+
+func (cc *stateClientConn) UpdateState(s resolver.State) error {
+	cc.state = s
+	return nil
+}
+
+func TestUpdateAttributes(t *testing.T) {
+	cc := &stateClientConn{}
+	r := &discoveryResolver{cc: cc}
+
+	r.update([]*registry.Instance{
+		{
+			ID:        "1",
+			Name:      "gamesrv",
+			Version:   "v1.0.1",
+			Endpoints: []string{"grpc://127.0.0.1:9000"},
+			Weight:    50,
+			Zone:      "sz",
+			Status:    registry.StatusDraining,
+		},
+		{
+			ID:        "2",
+			Name:      "gamesrv",
+			Endpoints: []string{"grpc://127.0.0.1:9001"},
+		},
+	})
+
+	if len(cc.state.Addresses) != 2 {
+		t.Fatalf("expect 2 addresses, got: %d", len(cc.state.Addresses))
+	}
+
+	attr := GetAttributes(cc.state.Addresses[0])
+	expect := Attributes{Weight: 50, Zone: "sz", Version: "v1.0.1", Status: registry.StatusDraining}
+	if attr != expect || attr.IsUp() {
+		t.Fatalf("expect %+v, got: %+v", expect, attr)
+	}
+
+	attr = GetAttributes(cc.state.Addresses[1])
+	if attr.Weight != registry.DefaultWeight || !attr.IsUp() {
+		t.Fatalf("unexpected default attributes: %+v", attr)
+	}
+}
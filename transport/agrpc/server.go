@@ -14,6 +14,7 @@ import (
 	"github.com/lightmen/nami/schedule"
 	"github.com/lightmen/nami/service"
 	"github.com/lightmen/nami/service/cmd"
+	"github.com/lightmen/nami/session"
 	"github.com/lightmen/nami/transport"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/health"
@@ -41,8 +42,9 @@ type Server struct {
 
 	msgServer message.MessageServer
 
-	sched   schedule.Scheduler
-	service service.Service
+	sched    schedule.Scheduler
+	executor *session.Executor
+	service  service.Service
 }
 
 func New(opts ...ServerOption) (srv *Server, err error) {